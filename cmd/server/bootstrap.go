@@ -0,0 +1,61 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"gorm.io/gorm/logger"
+
+	"url-shortener/internal/config"
+	"url-shortener/internal/database/gormdb"
+	"url-shortener/internal/repository"
+	"url-shortener/internal/service"
+)
+
+// runBootstrapAdmin 实现 bootstrap-admin 子命令：创建一个拥有全部权限（含 keys:admin）的 API Key 并打印一次
+// 已存在可用的管理员 Key 时拒绝执行，除非指定 -force
+func runBootstrapAdmin(args []string) int {
+	flags := flag.NewFlagSet("bootstrap-admin", flag.ContinueOnError)
+	name := flags.String("name", service.BootstrapKeyName, "name of the new admin key")
+	force := flags.Bool("force", false, "create the key even if an admin key already exists")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	// 关闭 SQL 日志（默认写到标准输出），标准输出只包含新 Key，便于脚本读取
+	logger.Default = logger.Discard
+
+	db, err := gorm.NewDatabase()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to initialize database: %v\n", err)
+		return 1
+	}
+	defer db.Close()
+
+	workspaceRepo := repository.NewWorkspaceRepository(db.GetDB())
+	apiKeyService := service.NewAPIKeyService(repository.NewAPIKeyRepository(db.GetDB()), repository.NewURLRepository(db.GetDB()),
+		workspaceRepo, service.NewAuthorizationService(workspaceRepo), nil, config.LoadConfig().APIKeyConfig)
+
+	if !*force {
+		exists, err := apiKeyService.HasAdminKey()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to check existing admin keys: %v\n", err)
+			return 1
+		}
+		if exists {
+			fmt.Fprintln(os.Stderr, "An active admin key already exists; use it to create more keys, or pass -force")
+			return 1
+		}
+	}
+
+	key, err := apiKeyService.GenerateAdminKey(*name)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to create admin key: %v\n", err)
+		return 1
+	}
+
+	fmt.Fprintf(os.Stderr, "Created admin key %d (%s). Store it now; it cannot be retrieved again.\n", key.ID, key.KeyPrefix)
+	fmt.Println(key.Key)
+	return 0
+}
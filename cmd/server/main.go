@@ -10,21 +10,34 @@ import (
 	"strings"
 	"syscall"
 	"time"
+	_ "time/tzdata" // 内嵌时区数据，保证精简镜像中也能解析 tz 参数
 
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
 
+	"url-shortener/internal/cache"
 	"url-shortener/internal/config"
 	"url-shortener/internal/database/gormdb"
 	"url-shortener/internal/handler"
+	"url-shortener/internal/metrics"
 	"url-shortener/internal/middleware"
+	"url-shortener/internal/model"
 	"url-shortener/internal/repository"
 	"url-shortener/internal/service"
+	"url-shortener/internal/utils"
 )
 
 func main() {
+	// 子命令：创建首个管理员 Key
+	if len(os.Args) > 1 && os.Args[1] == "bootstrap-admin" {
+		os.Exit(runBootstrapAdmin(os.Args[2:]))
+	}
+
 	// 加载配置
 	cfg := config.LoadConfig()
+	if err := cfg.Validate(); err != nil {
+		log.Fatalf("Invalid configuration: %v", err)
+	}
 
 	// 初始化数据库
 	db, err := gorm.NewDatabase()
@@ -37,17 +50,103 @@ func main() {
 	urlRepo := repository.NewURLRepository(db.GetDB())
 	apiKeyRepo := repository.NewAPIKeyRepository(db.GetDB())
 	analyticsRepo := repository.NewAnalyticsRepository(db.GetDB())
+	reportRepo := repository.NewReportRepository(db.GetDB())
+	workspaceRepo := repository.NewWorkspaceRepository(db.GetDB())
+
+	// 加载 User-Agent 识别规则
+	userAgentParser, err := utils.LoadUserAgentParser(cfg.AnalyticsConfig.UserAgentRulesFile)
+	if err != nil {
+		log.Fatalf("Failed to load user agent rules: %v", err)
+	}
 
 	// 初始化服务
-	shortenerService := service.NewEnhancedShortenerService(urlRepo, analyticsRepo, cfg.BaseURL)
-	apiKeyService := service.NewAPIKeyService(apiKeyRepo)
+	authzService := service.NewAuthorizationService(workspaceRepo)
+	workspaceService := service.NewWorkspaceService(workspaceRepo, authzService)
+	visitBroker := service.NewVisitBroker(cfg.AnalyticsConfig)
+	analyticsService := service.NewAnalyticsService(urlRepo, analyticsRepo, visitBroker, userAgentParser, cfg.AnalyticsConfig)
+	visitQueue := service.NewVisitQueue(analyticsService, cfg.AnalyticsConfig)
+	shortenerService := service.NewEnhancedShortenerService(urlRepo, analyticsRepo, analyticsService, visitQueue, cfg.BaseURL)
+	var apiKeyCache *cache.APIKeyCache
+	if cfg.APIKeyConfig.CacheTTL > 0 {
+		apiKeyCache = cache.NewAPIKeyCache(cfg.APIKeyConfig.CacheSize, cfg.APIKeyConfig.CacheTTL)
+		metrics.RegisterCache("api_keys", apiKeyCache)
+	}
+	apiKeyService := service.NewAPIKeyService(apiKeyRepo, urlRepo, workspaceRepo, authzService, apiKeyCache, cfg.APIKeyConfig)
+	reportService := service.NewReportService(reportRepo, urlRepo, analyticsRepo, cfg.ReportConfig)
+
+	// 确保存在管理员 Key，否则无法创建其他 Key
+	if cfg.APIKeyConfig.AdminKey != "" {
+		created, err := apiKeyService.EnsureAdminKey(cfg.APIKeyConfig.AdminKey)
+		if err != nil {
+			log.Fatalf("Failed to create admin key from ADMIN_API_KEY: %v", err)
+		}
+		if created {
+			log.Println("Created admin key from ADMIN_API_KEY")
+		}
+	}
+	if hasAdmin, err := apiKeyService.HasAdminKey(); err != nil {
+		log.Printf("Failed to check admin keys: %v", err)
+	} else if !hasAdmin {
+		log.Println("No active admin key: set ADMIN_API_KEY or run `server bootstrap-admin` to create one")
+	}
+
+	// 启动访问记录汇总任务
+	rollupAggregator := service.NewRollupAggregator(analyticsRepo, cfg.AnalyticsConfig)
+	rollupAggregator.Start()
+	defer rollupAggregator.Stop()
+
+	// 启动 API Key 缓存同步任务，其他实例撤销或修改的 Key 在一个轮询间隔内失效
+	if apiKeyCache != nil {
+		apiKeyCacheWatcher := service.NewAPIKeyCacheWatcher(apiKeyRepo, apiKeyCache, cfg.APIKeyConfig)
+		apiKeyCacheWatcher.Start()
+		defer apiKeyCacheWatcher.Stop()
+	}
+
+	// 启动 API Key 使用情况写入任务
+	apiKeyUsage := service.NewAPIKeyUsageTracker(apiKeyRepo, cfg.APIKeyConfig)
+	apiKeyUsage.Start()
+	defer apiKeyUsage.Stop()
+
+	// 启动定期报告推送任务
+	reportScheduler := service.NewReportScheduler(reportRepo, reportService, cfg.ReportConfig)
+	reportScheduler.Start()
+	defer reportScheduler.Stop()
+
+	// 启动访问记录写入队列，退出时写完已排队的记录
+	visitQueue.Start()
+	defer visitQueue.Close()
+
+	// 注册监控指标
+	sqlDB, err := db.GetDB().DB()
+	if err != nil {
+		log.Fatalf("Failed to get database handle: %v", err)
+	}
+	metrics.RegisterDBStats(metrics.Default, sqlDB)
+	metrics.Default.NewGaugeFunc("visit_queue_depth", "Visits waiting to be written.",
+		func() float64 { return float64(visitQueue.Len()) })
+	metrics.Default.NewGaugeFunc("visit_queue_capacity", "Maximum number of visits the queue can hold.",
+		func() float64 { return float64(visitQueue.Cap()) })
 
 	// 初始化处理器
 	enhancedHandler := handler.NewEnhancedHandler(shortenerService)
 	apiKeyHandler := handler.NewAPIKeyHandler(apiKeyService)
+	reportHandler := handler.NewReportHandler(reportService)
+	workspaceHandler := handler.NewWorkspaceHandler(workspaceService)
 
-	// 初始化中间件
-	apiKeyMiddleware := middleware.NewAPIKeyAuthMiddleware(apiKeyService)
+	// 初始化中间件，配置了 JWKS 时同时接受身份提供方签发的 JWT
+	var jwtAuthenticator *service.JWTAuthenticator
+	if cfg.JWTConfig.Enabled() {
+		jwtAuthenticator, err = service.NewJWTAuthenticator(workspaceRepo, cfg.JWTConfig)
+		if err != nil {
+			log.Fatalf("Failed to initialize JWT authentication: %v", err)
+		}
+		log.Printf("JWT authentication enabled for issuer %s", cfg.JWTConfig.Issuer)
+	}
+	apiKeyMiddleware := middleware.NewAPIKeyAuthMiddleware(apiKeyService, authzService, jwtAuthenticator, apiKeyUsage)
+	clientIPResolver, err := utils.NewClientIPResolver(cfg.TrustedProxies, cfg.ForwardedHeader)
+	if err != nil {
+		log.Fatalf("Invalid trusted proxies: %v", err)
+	}
 
 	// 设置 Gin 模式
 	if cfg.Debug {
@@ -58,9 +157,25 @@ func main() {
 
 	// 创建路由
 	router := gin.New()
+	// 客户端 IP 统一由 ClientIPMiddleware 解析，gin 自身不信任任何转发头
+	if err := router.SetTrustedProxies(nil); err != nil {
+		log.Fatalf("Failed to configure trusted proxies: %v", err)
+	}
 	router.Use(gin.Logger())
+	router.Use(middleware.MetricsMiddleware())
 	router.Use(gin.Recovery())
 	router.Use(cors.Default())
+	router.Use(middleware.ClientIPMiddleware(clientIPResolver))
+
+	// 按 API Key 各自的设置限流
+	keyRateLimiter := middleware.NewKeyRateLimiter()
+	go func() {
+		ticker := time.NewTicker(time.Minute)
+		defer ticker.Stop()
+		for range ticker.C {
+			keyRateLimiter.Cleanup()
+		}
+	}()
 
 	// 健康检查
 	router.GET("/health", func(c *gin.Context) {
@@ -71,6 +186,19 @@ func main() {
 		})
 	})
 
+	// 监控指标：优先使用独立端口，否则只有配置了 Token 才在主端口上提供
+	var metricsServer *http.Server
+	metricsHandler := metrics.Handler(metrics.Default, cfg.MetricsConfig.Token)
+	if cfg.MetricsConfig.Addr != "" {
+		mux := http.NewServeMux()
+		mux.Handle("/metrics", metricsHandler)
+		metricsServer = &http.Server{Addr: cfg.MetricsConfig.Addr, Handler: mux}
+	} else if cfg.MetricsConfig.Token != "" {
+		router.GET("/metrics", gin.WrapH(metricsHandler))
+	} else {
+		log.Println("Metrics endpoint disabled: set METRICS_ADDR or METRICS_TOKEN to enable it")
+	}
+
 	// 公开路由
 	router.GET("/:code", enhancedHandler.Redirect)
 
@@ -78,26 +206,89 @@ func main() {
 	api := router.Group("/api")
 	{
 		// 公开 API
-		api.POST("/keys", apiKeyHandler.CreateKey)
 		api.GET("/keys/validate", apiKeyHandler.ValidateKey)
 
-		// 需要 API Key 的路由
-		api.POST("/shorten", apiKeyMiddleware.RequireAPIKey(), enhancedHandler.CreateShortURL)
-
-		// 受保护的路由
+		// 受保护的路由，按 API Key 的权限范围分组
 		protected := api.Group("")
-		protected.Use(apiKeyMiddleware.RequireAPIKey())
+		protected.Use(apiKeyMiddleware.RequireAPIKey(), middleware.KeyRateLimitMiddleware(keyRateLimiter))
+
+		// 当前 Key 的用量、所在工作区，无需额外权限；创建工作区需使用属于用户的 Key
+		protected.GET("/keys/me/usage", apiKeyHandler.Usage)
+		protected.GET("/workspace", workspaceHandler.GetCurrent)
+		protected.GET("/workspaces", workspaceHandler.ListWorkspaces)
+		protected.POST("/workspaces", workspaceHandler.CreateWorkspace)
+
+		// 创建 Key 需要 keys:admin 权限；开启自助模式后匿名请求也可创建，按 IP 单独限流
+		if cfg.APIKeyConfig.SelfService {
+			selfServiceLimiter := middleware.NewWindowRateLimiter(cfg.APIKeyConfig.SelfServicePerHour, time.Hour)
+			api.POST("/keys", apiKeyMiddleware.OptionalAPIKey(),
+				middleware.SelfServiceKeyRateLimit(selfServiceLimiter), apiKeyHandler.CreateKey)
+		} else {
+			protected.POST("/keys", apiKeyMiddleware.RequireScope(model.ScopeKeysAdmin), apiKeyHandler.CreateKey)
+		}
+
+		linksRead := protected.Group("", apiKeyMiddleware.RequireScope(model.ScopeLinksRead))
+		{
+			linksRead.GET("/stats/:code", enhancedHandler.GetStats)
+			linksRead.GET("/groups", enhancedHandler.ListGroups)
+			linksRead.GET("/urls", enhancedHandler.ListURLs)
+			linksRead.GET("/urls/pagination", enhancedHandler.GetURLsWithPagination)
+			linksRead.GET("/urls/search", enhancedHandler.SearchURLs)
+		}
+
+		linksWrite := protected.Group("", apiKeyMiddleware.RequireScope(model.ScopeLinksWrite))
+		{
+			linksWrite.POST("/shorten", apiKeyMiddleware.RequireLinkQuota(), enhancedHandler.CreateShortURL)
+			linksWrite.DELETE("/urls/:code", enhancedHandler.DeleteURL)
+			linksWrite.PUT("/urls/:code/group", enhancedHandler.SetURLGroup)
+			linksWrite.PUT("/urls/:code/click-tracking", enhancedHandler.SetClickTracking)
+			linksWrite.POST("/cleanup", enhancedHandler.CleanupExpiredURLs)
+		}
+
+		analyticsRead := protected.Group("", apiKeyMiddleware.RequireScope(model.ScopeAnalyticsRead))
+		{
+			analyticsRead.GET("/analytics/:code", enhancedHandler.GetAdvancedAnalytics)
+			analyticsRead.GET("/analytics/:code/compare", enhancedHandler.CompareAnalytics)
+			analyticsRead.GET("/analytics/:code/live", enhancedHandler.StreamLiveVisits)
+			analyticsRead.GET("/analytics/live", enhancedHandler.StreamAllLiveVisits)
+			analyticsRead.GET("/dashboard", enhancedHandler.GetDashboard)
+			analyticsRead.GET("/visits/:code", enhancedHandler.GetRecentVisits)
+			analyticsRead.GET("/visits/:code/export", enhancedHandler.ExportVisits)
+			analyticsRead.GET("/visits/export", enhancedHandler.ExportAllVisits)
+			analyticsRead.GET("/groups/:group/analytics", enhancedHandler.GetGroupAnalytics)
+		}
+
+		conversionsWrite := protected.Group("", apiKeyMiddleware.RequireScope(model.ScopeConversionsWrite))
+		{
+			conversionsWrite.POST("/conversions", enhancedHandler.RecordConversion)
+		}
+
+		reportsRead := protected.Group("", apiKeyMiddleware.RequireScope(model.ScopeReportsRead))
 		{
-			protected.GET("/stats/:code", enhancedHandler.GetStats)
-			protected.GET("/analytics/:code", enhancedHandler.GetAdvancedAnalytics)
-			protected.GET("/visits/:code", enhancedHandler.GetRecentVisits)
-			protected.DELETE("/urls/:code", enhancedHandler.DeleteURL)
-			protected.GET("/urls", enhancedHandler.ListURLs)
-			protected.GET("/urls/pagination", enhancedHandler.GetURLsWithPagination)
-			protected.GET("/urls/search", enhancedHandler.SearchURLs)
-			protected.POST("/cleanup", enhancedHandler.CleanupExpiredURLs)
-			protected.GET("/keys", apiKeyHandler.ListKeys)
-			protected.DELETE("/keys/:key", apiKeyHandler.RevokeKey)
+			reportsRead.GET("/reports", reportHandler.ListSubscriptions)
+			reportsRead.GET("/reports/:id", reportHandler.GetSubscription)
+			reportsRead.GET("/reports/:id/deliveries", reportHandler.ListDeliveries)
+		}
+
+		reportsWrite := protected.Group("", apiKeyMiddleware.RequireScope(model.ScopeReportsWrite))
+		{
+			reportsWrite.POST("/reports", reportHandler.CreateSubscription)
+			reportsWrite.DELETE("/reports/:id", reportHandler.DeleteSubscription)
+		}
+
+		keysAdmin := protected.Group("", apiKeyMiddleware.RequireScope(model.ScopeKeysAdmin))
+		{
+			keysAdmin.GET("/keys", apiKeyHandler.ListKeys)
+			keysAdmin.PATCH("/keys/:id", apiKeyHandler.UpdateKey)
+			keysAdmin.DELETE("/keys/:id", apiKeyHandler.RevokeKey)
+			keysAdmin.POST("/keys/:id/rotate", apiKeyHandler.RotateKey)
+			keysAdmin.GET("/keys/:id/denials", apiKeyHandler.ListDenials)
+			keysAdmin.GET("/keys/usage", apiKeyHandler.ListActivity)
+			keysAdmin.GET("/keys/:id/usage", apiKeyHandler.GetActivity)
+			keysAdmin.GET("/workspace/members", workspaceHandler.ListMembers)
+			keysAdmin.POST("/workspace/members", workspaceHandler.AddMember)
+			keysAdmin.PATCH("/workspace/members/:user_id", workspaceHandler.UpdateMember)
+			keysAdmin.DELETE("/workspace/members/:user_id", workspaceHandler.RemoveMember)
 		}
 	}
 
@@ -124,6 +315,8 @@ func main() {
 		Addr:    addr,
 		Handler: router,
 	}
+	// 关闭时断开实时访问流，避免长连接阻塞优雅退出
+	server.RegisterOnShutdown(visitBroker.Close)
 
 	// 启动服务器
 	go func() {
@@ -133,6 +326,15 @@ func main() {
 		}
 	}()
 
+	if metricsServer != nil {
+		go func() {
+			log.Printf("Serving metrics on %s", cfg.MetricsConfig.Addr)
+			if err := metricsServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				log.Fatalf("Failed to start metrics server: %v", err)
+			}
+		}()
+	}
+
 	// 等待中断信号
 	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
@@ -144,6 +346,11 @@ func main() {
 	if err := server.Shutdown(ctx); err != nil {
 		log.Fatal("Server forced to shutdown:", err)
 	}
+	if metricsServer != nil {
+		if err := metricsServer.Shutdown(ctx); err != nil {
+			log.Printf("Metrics server forced to shutdown: %v", err)
+		}
+	}
 
 	log.Println("Server exited")
 }
@@ -0,0 +1,90 @@
+package cache
+
+import (
+	"sync"
+	"time"
+
+	"url-shortener/internal/model"
+)
+
+// APIKeyCache 已验证 API Key 的缓存，以 Key 的 SHA-256 摘要为键
+// 只缓存有效的 Key；缓存时间不超过 Key 的过期时间，读取时再次检查过期
+// 每次失效都会增加代数，从数据库读取前记下代数，写入缓存时代数已变化则放弃写入，
+// 避免与撤销并发的验证把已撤销的 Key 重新写回缓存
+type APIKeyCache struct {
+	cache *MemoryCache
+	ttl   time.Duration
+
+	mu         sync.Mutex
+	generation uint64
+}
+
+// NewAPIKeyCache 创建 API Key 缓存
+func NewAPIKeyCache(maxEntries int, ttl time.Duration) *APIKeyCache {
+	return &APIKeyCache{
+		cache: NewMemoryCache(maxEntries),
+		ttl:   ttl,
+	}
+}
+
+// Get 获取缓存的 Key，已过期的 Key 视为未命中
+func (a *APIKeyCache) Get(keyHash string) (*model.APIKey, bool) {
+	data, exists := a.cache.Get(keyHash)
+	if !exists {
+		return nil, false
+	}
+
+	apikey, ok := data.(*model.APIKey)
+	if !ok {
+		return nil, false
+	}
+	if apikey.ExpiresAt != nil && !time.Now().Before(*apikey.ExpiresAt) {
+		a.cache.Delete(keyHash)
+		return nil, false
+	}
+
+	// 返回副本，调用方修改不影响缓存
+	copied := *apikey
+	return &copied, true
+}
+
+// Generation 返回当前代数，应在从数据库读取 Key 之前获取并传给 Set
+func (a *APIKeyCache) Generation() uint64 {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.generation
+}
+
+// Set 缓存已验证的 Key，generation 之后发生过失效时不写入
+func (a *APIKeyCache) Set(apikey *model.APIKey, generation uint64) {
+	ttl := a.ttl
+	if apikey.ExpiresAt != nil {
+		if untilExpiry := time.Until(*apikey.ExpiresAt); untilExpiry < ttl {
+			ttl = untilExpiry
+		}
+	}
+	if ttl <= 0 {
+		return
+	}
+
+	copied := *apikey
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.generation != generation {
+		return
+	}
+	a.cache.Set(apikey.KeyHash, &copied, ttl)
+}
+
+// Invalidate 使 Key 的缓存失效
+func (a *APIKeyCache) Invalidate(keyHash string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.generation++
+	a.cache.Delete(keyHash)
+}
+
+// Stats 返回累计的命中与未命中次数
+func (a *APIKeyCache) Stats() (hits, misses uint64) {
+	return a.cache.Stats()
+}
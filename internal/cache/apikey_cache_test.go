@@ -0,0 +1,51 @@
+package cache
+
+import (
+	"testing"
+	"time"
+
+	"url-shortener/internal/model"
+)
+
+func TestAPIKeyCacheRefusesSetAfterInvalidate(t *testing.T) {
+	c := NewAPIKeyCache(10, time.Minute)
+	key := &model.APIKey{ID: 1, KeyHash: "hash", IsActive: true}
+
+	// 验证开始时记下代数，读取数据库期间 Key 被撤销
+	generation := c.Generation()
+	c.Invalidate(key.KeyHash)
+	c.Set(key, generation)
+	if _, ok := c.Get(key.KeyHash); ok {
+		t.Fatal("key loaded before invalidation was cached")
+	}
+
+	c.Set(key, c.Generation())
+	if _, ok := c.Get(key.KeyHash); !ok {
+		t.Fatal("key loaded after invalidation was not cached")
+	}
+
+	c.Invalidate(key.KeyHash)
+	if _, ok := c.Get(key.KeyHash); ok {
+		t.Fatal("invalidated key is still cached")
+	}
+}
+
+func TestAPIKeyCacheExpiry(t *testing.T) {
+	c := NewAPIKeyCache(10, time.Minute)
+
+	expired := time.Now().Add(-time.Second)
+	c.Set(&model.APIKey{KeyHash: "expired", ExpiresAt: &expired}, c.Generation())
+	if _, ok := c.Get("expired"); ok {
+		t.Error("expired key was cached")
+	}
+
+	soon := time.Now().Add(50 * time.Millisecond)
+	c.Set(&model.APIKey{KeyHash: "soon", ExpiresAt: &soon}, c.Generation())
+	if _, ok := c.Get("soon"); !ok {
+		t.Fatal("key was not cached")
+	}
+	time.Sleep(100 * time.Millisecond)
+	if _, ok := c.Get("soon"); ok {
+		t.Error("key is still cached after it expired")
+	}
+}
@@ -2,6 +2,7 @@ package cache
 
 import (
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -18,6 +19,8 @@ type MemoryCache struct {
 	store   map[string]*cacheItem
 	mu      sync.RWMutex
 	maxSize int
+	hits    atomic.Uint64
+	misses  atomic.Uint64
 }
 
 // cacheItem 缓存项
@@ -37,22 +40,34 @@ func NewMemoryCache(maxSize int) *MemoryCache {
 // Get 获取缓存
 func (c *MemoryCache) Get(key string) (interface{}, bool) {
 	c.mu.RLock()
-	defer c.mu.RUnlock()
-
 	item, exists := c.store[key]
+	c.mu.RUnlock()
+
 	if !exists {
+		c.misses.Add(1)
 		return nil, false
 	}
 
-	// 检查是否过期
+	// 检查是否过期，删除需要写锁；加锁期间该键可能已被重新设置，只删除原来的缓存项
 	if time.Now().After(item.expireAt) {
-		delete(c.store, key)
+		c.mu.Lock()
+		if c.store[key] == item {
+			delete(c.store, key)
+		}
+		c.mu.Unlock()
+		c.misses.Add(1)
 		return nil, false
 	}
 
+	c.hits.Add(1)
 	return item.value, true
 }
 
+// Stats 返回累计的命中与未命中次数
+func (c *MemoryCache) Stats() (hits, misses uint64) {
+	return c.hits.Load(), c.misses.Load()
+}
+
 // Set 设置缓存
 func (c *MemoryCache) Set(key string, value interface{}, ttl time.Duration) {
 	c.mu.Lock()
@@ -149,6 +164,11 @@ func (u *URLCache) Set(shortCode string, originalURL string, expiresAt *time.Tim
 	u.cache.Set(shortCode, cached, ttl)
 }
 
+// Stats 返回累计的命中与未命中次数
+func (u *URLCache) Stats() (hits, misses uint64) {
+	return u.cache.Stats()
+}
+
 // Invalidate 使缓存失效
 func (u *URLCache) Invalidate(shortCode string) {
 	u.cache.Delete(shortCode)
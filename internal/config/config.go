@@ -3,8 +3,10 @@ package config
 import (
 	"fmt"
 	"os"
+	"slices"
 	"strconv"
 	"strings"
+	"time"
 )
 
 // Config 应用配置结构
@@ -13,7 +15,82 @@ type Config struct {
 	DatabaseURL     string           // 数据库连接字符串
 	BaseURL         string           // 基础URL，用于生成短链接
 	Debug           bool             // 调试模式
+	TrustedProxies  []string         // 受信任的反向代理（CIDR 或 IP），只信任来自这些地址的转发头
+	ForwardedHeader string           // 受信任代理设置的转发头：X-Forwarded-For 或 Forwarded，只读取这一个
 	RateLimitConfig *RateLimitConfig // 限流配置
+	AnalyticsConfig *AnalyticsConfig // 访问分析配置
+	MetricsConfig   *MetricsConfig   // 监控指标配置
+	ReportConfig    *ReportConfig    // 定期报告推送配置
+	APIKeyConfig    *APIKeyConfig    // API Key 管理配置
+	JWTConfig       *JWTConfig       // JWT（OIDC）认证配置
+}
+
+// JWTConfig JWT（OIDC）认证配置
+// 设置 JWKSFile 或 JWKSURL 后，认证中间件除 sk_ 开头的 API Key 外也接受身份提供方签发的 JWT
+type JWTConfig struct {
+	JWKSFile       string        // 本地 JWKS 文件路径
+	JWKSURL        string        // JWKS 地址，按 JWKSRefresh 间隔重新获取
+	JWKSRefresh    time.Duration // JWKS 的刷新间隔
+	Issuer         string        // 要求的 iss
+	Audience       string        // 要求 aud 中包含的值
+	ClockSkew      time.Duration // 校验 exp、nbf 时允许的时钟误差
+	Algorithms     []string      // 接受的签名算法
+	EmailClaim     string        // 映射到用户的邮箱声明
+	ScopeClaim     string        // 权限范围声明，空格分隔的字符串或字符串数组
+	WorkspaceClaim string        // 工作区 ID 声明
+}
+
+// jwtAlgorithms 支持的 JWT 签名算法
+var jwtAlgorithms = []string{"RS256", "RS384", "RS512", "PS256", "PS384", "PS512", "ES256", "ES384", "ES512"}
+
+// Enabled 是否配置了 JWT 认证
+func (c *JWTConfig) Enabled() bool {
+	return c.JWKSFile != "" || c.JWKSURL != ""
+}
+
+// APIKeyConfig API Key 管理配置
+// 默认只有持有 keys:admin 权限的 Key 才能创建新 Key；开启自助模式后匿名请求也可以创建不含管理权限的 Key
+type APIKeyConfig struct {
+	AdminKey           string // 启动时确保存在的管理员 Key，用于首次部署
+	SelfService        bool   // 是否允许匿名创建 Key
+	SelfServicePerHour int    // 每个 IP 每小时可自助创建的 Key 数量
+
+	// 自助创建的 Key 的用量限制，由配置决定，调用方不能自行指定
+	SelfServiceRequestsPerMinute int // 每分钟请求数
+	SelfServiceMonthlyLinkQuota  int // 每个自然月可创建的短链接数
+
+	RotationGracePeriod time.Duration // 轮换后旧 Key 默认继续有效的时间
+
+	UsageFlushInterval time.Duration // Key 使用情况从内存写入数据库的间隔
+	UsageRetentionDays int           // 按接口统计的使用记录保留天数，0 表示永久保留
+
+	// 白名单拒绝记录，同一 Key 和 IP 在间隔内只记录一次
+	DenialLogInterval   time.Duration // 同一 Key 和 IP 两次记录的最小间隔，0 表示每次都记录
+	DenialRetentionDays int           // 拒绝记录保留天数，0 表示永久保留
+
+	// 已验证 Key 的本地缓存，其他实例的撤销和修改通过轮询变更记录同步
+	CacheTTL          time.Duration // 缓存时间，0 表示不缓存
+	CacheSize         int           // 最多缓存的 Key 数
+	CachePollInterval time.Duration // 轮询变更记录的间隔
+}
+
+// ReportConfig 定期报告推送配置
+type ReportConfig struct {
+	CheckInterval  time.Duration // 检查到期订阅的间隔
+	MaxAttempts    int           // 每次推送的最大尝试次数
+	RetryBackoff   time.Duration // 首次重试前的等待时间，之后每次翻倍
+	WebhookTimeout time.Duration // 单次推送的超时时间
+	TopLinks       int           // 订阅所有链接时报告中列出的链接数
+	Workers        int           // 并发推送数，慢的接收方不会拖延其他订阅
+
+	AllowPrivateWebhooks bool // 是否允许推送到回环、私有和链路本地地址，仅用于开发和测试
+}
+
+// MetricsConfig 监控指标配置
+// 设置 Addr 时指标在独立端口上提供；否则只有设置了 Token 才会在主端口挂载 /metrics
+type MetricsConfig struct {
+	Addr  string // 独立监听地址，如 127.0.0.1:9090
+	Token string // 抓取时需携带的 Bearer Token
 }
 
 // RateLimitConfig 限流配置
@@ -23,6 +100,39 @@ type RateLimitConfig struct {
 	ExcludePaths      []string // 排除限流的路径列表
 }
 
+// AnalyticsConfig 访问分析配置
+type AnalyticsConfig struct {
+	RawRetentionDays int           // 原始访问记录保留天数，0 表示永久保留
+	RollupInterval   time.Duration // 后台汇总任务的执行间隔
+
+	// 追加到内置列表的流量来源域名
+	SearchDomains []string // 搜索引擎
+	SocialDomains []string // 社交网络
+	EmailDomains  []string // 网页邮箱
+
+	UserAgentRulesFile string // 自定义 User-Agent 识别规则文件（JSON），为空时使用内置规则
+
+	// 隐私保护
+	IPAnonymization string // IP 存储方式：keep、truncate 或 hash
+	IPHashKey       string // hash 模式下的哈希密钥
+	HonorDoNotTrack bool   // 请求带有 DNT 或 Sec-GPC 时不记录可识别访客的信息
+
+	// 点击追踪
+	ClickIDParam         string // 开启点击追踪的链接跳转时，点击 ID 追加到目标地址的参数名
+	ConversionWindowDays int    // 点击后可回传转化的天数，不受原始访问记录保留期影响，0 表示不限制
+
+	// 访问记录写入队列
+	VisitQueueSize    int // 队列容量，满时丢弃新的访问记录
+	VisitQueueWorkers int // 写入协程数
+
+	// 实时访问流
+	LiveMaxSubscribers int           // 整个进程的最大并发订阅数
+	LiveBufferSize     int           // 每个订阅者的事件缓冲区大小
+	LiveHeartbeat      time.Duration // 心跳间隔
+
+	LiveMaxSubscribersPerWorkspace int // 每个工作区的最大并发订阅数，避免单个工作区占满整个进程的名额
+}
+
 // LoadConfig 从环境变量加载配置
 func LoadConfig() *Config {
 	rateLimitConfig := &RateLimitConfig{
@@ -31,12 +141,87 @@ func LoadConfig() *Config {
 		ExcludePaths:      parseExcludePaths(os.Getenv("RATE_LIMIT_EXCLUDE_PATHS")),
 	}
 
+	analyticsConfig := &AnalyticsConfig{
+		RawRetentionDays: getEnvAsInt("VISIT_RETENTION_DAYS", 90),
+		RollupInterval:   time.Duration(getEnvAsInt("ROLLUP_INTERVAL_MINUTES", 5)) * time.Minute,
+		SearchDomains:    parseList(os.Getenv("TRAFFIC_SEARCH_DOMAINS")),
+		SocialDomains:    parseList(os.Getenv("TRAFFIC_SOCIAL_DOMAINS")),
+		EmailDomains:     parseList(os.Getenv("TRAFFIC_EMAIL_DOMAINS")),
+
+		UserAgentRulesFile: os.Getenv("UA_RULES_FILE"),
+
+		IPAnonymization: getEnv("IP_ANONYMIZATION", "keep"),
+		IPHashKey:       os.Getenv("IP_HASH_KEY"),
+		HonorDoNotTrack: getEnvAsBool("HONOR_DO_NOT_TRACK", true),
+
+		ClickIDParam:         getEnv("CLICK_ID_PARAM", "click_id"),
+		ConversionWindowDays: getEnvAsInt("CONVERSION_WINDOW_DAYS", 365),
+
+		VisitQueueSize:    getEnvAsInt("VISIT_QUEUE_SIZE", 10000),
+		VisitQueueWorkers: getEnvAsInt("VISIT_QUEUE_WORKERS", 4),
+
+		LiveMaxSubscribers: getEnvAsInt("LIVE_MAX_SUBSCRIBERS", 100),
+		LiveBufferSize:     getEnvAsInt("LIVE_BUFFER_SIZE", 64),
+		LiveHeartbeat:      time.Duration(getEnvAsInt("LIVE_HEARTBEAT_SECONDS", 15)) * time.Second,
+
+		LiveMaxSubscribersPerWorkspace: getEnvAsInt("LIVE_MAX_SUBSCRIBERS_PER_WORKSPACE", 10),
+	}
+
 	config := &Config{
 		Port:            getEnvAsInt("PORT", 8080),
 		DatabaseURL:     getEnv("DATABASE_URL", "./urls.db"),
 		BaseURL:         getEnv("BASE_URL", "http://localhost:8080"),
 		Debug:           getEnvAsBool("DEBUG", false),
+		TrustedProxies:  parseList(os.Getenv("TRUSTED_PROXIES")),
+		ForwardedHeader: getEnv("TRUSTED_PROXY_HEADER", "X-Forwarded-For"),
 		RateLimitConfig: rateLimitConfig,
+		AnalyticsConfig: analyticsConfig,
+		ReportConfig: &ReportConfig{
+			CheckInterval:  time.Duration(getEnvAsInt("REPORT_CHECK_INTERVAL_SECONDS", 60)) * time.Second,
+			MaxAttempts:    getEnvAsInt("REPORT_MAX_ATTEMPTS", 3),
+			RetryBackoff:   time.Duration(getEnvAsInt("REPORT_RETRY_BACKOFF_SECONDS", 5)) * time.Second,
+			WebhookTimeout: time.Duration(getEnvAsInt("REPORT_WEBHOOK_TIMEOUT_SECONDS", 10)) * time.Second,
+			TopLinks:       getEnvAsInt("REPORT_TOP_LINKS", 10),
+			Workers:        getEnvAsInt("REPORT_WORKERS", 4),
+
+			AllowPrivateWebhooks: getEnvAsBool("REPORT_ALLOW_PRIVATE_WEBHOOKS", false),
+		},
+		MetricsConfig: &MetricsConfig{
+			Addr:  os.Getenv("METRICS_ADDR"),
+			Token: os.Getenv("METRICS_TOKEN"),
+		},
+		APIKeyConfig: &APIKeyConfig{
+			AdminKey:           os.Getenv("ADMIN_API_KEY"),
+			SelfService:        getEnvAsBool("SELF_SERVICE_KEYS", false),
+			SelfServicePerHour: getEnvAsInt("SELF_SERVICE_KEYS_PER_HOUR", 5),
+
+			SelfServiceRequestsPerMinute: getEnvAsInt("SELF_SERVICE_REQUESTS_PER_MINUTE", 60),
+			SelfServiceMonthlyLinkQuota:  getEnvAsInt("SELF_SERVICE_MONTHLY_LINK_QUOTA", 100),
+
+			RotationGracePeriod: time.Duration(getEnvAsInt("API_KEY_ROTATION_GRACE_HOURS", 24)) * time.Hour,
+
+			UsageFlushInterval: time.Duration(getEnvAsInt("API_KEY_USAGE_FLUSH_SECONDS", 60)) * time.Second,
+			UsageRetentionDays: getEnvAsInt("API_KEY_USAGE_RETENTION_DAYS", 90),
+
+			DenialLogInterval:   time.Duration(getEnvAsInt("API_KEY_DENIAL_LOG_INTERVAL_SECONDS", 60)) * time.Second,
+			DenialRetentionDays: getEnvAsInt("API_KEY_DENIAL_RETENTION_DAYS", 30),
+
+			CacheTTL:          time.Duration(getEnvAsInt("API_KEY_CACHE_TTL_SECONDS", 30)) * time.Second,
+			CacheSize:         getEnvAsInt("API_KEY_CACHE_SIZE", 10000),
+			CachePollInterval: time.Duration(getEnvAsInt("API_KEY_CACHE_POLL_SECONDS", 5)) * time.Second,
+		},
+		JWTConfig: &JWTConfig{
+			JWKSFile:       os.Getenv("JWT_JWKS_FILE"),
+			JWKSURL:        os.Getenv("JWT_JWKS_URL"),
+			JWKSRefresh:    time.Duration(getEnvAsInt("JWT_JWKS_REFRESH_MINUTES", 60)) * time.Minute,
+			Issuer:         os.Getenv("JWT_ISSUER"),
+			Audience:       os.Getenv("JWT_AUDIENCE"),
+			ClockSkew:      time.Duration(getEnvAsInt("JWT_CLOCK_SKEW_SECONDS", 60)) * time.Second,
+			Algorithms:     parseList(getEnv("JWT_ALGORITHMS", "RS256,ES256")),
+			EmailClaim:     getEnv("JWT_EMAIL_CLAIM", "email"),
+			ScopeClaim:     getEnv("JWT_SCOPE_CLAIM", "scope"),
+			WorkspaceClaim: getEnv("JWT_WORKSPACE_CLAIM", "workspace_id"),
+		},
 	}
 
 	return config
@@ -78,10 +263,15 @@ func parseExcludePaths(env string) []string {
 	if env == "" {
 		return []string{"/health", "/docs", "/swagger"}
 	}
-	paths := strings.Split(env, ",")
-	result := make([]string, 0, len(paths))
-	for _, path := range paths {
-		trimmed := strings.TrimSpace(path)
+	return parseList(env)
+}
+
+// parseList 解析逗号分隔的列表，忽略空项
+func parseList(env string) []string {
+	items := strings.Split(env, ",")
+	result := make([]string, 0, len(items))
+	for _, item := range items {
+		trimmed := strings.TrimSpace(item)
 		if trimmed != "" {
 			result = append(result, trimmed)
 		}
@@ -95,6 +285,10 @@ func (c *Config) Validate() error {
 		return fmt.Errorf("invalid port: %d, port must be between 1 and 65535", c.Port)
 	}
 
+	if !strings.EqualFold(c.ForwardedHeader, "X-Forwarded-For") && !strings.EqualFold(c.ForwardedHeader, "Forwarded") {
+		return fmt.Errorf("invalid trusted proxy header: %q, must be X-Forwarded-For or Forwarded", c.ForwardedHeader)
+	}
+
 	if c.BaseURL == "" {
 		return fmt.Errorf("base URL cannot be empty")
 	}
@@ -109,5 +303,105 @@ func (c *Config) Validate() error {
 			c.RateLimitConfig.RequestsPerMinute)
 	}
 
+	if c.AnalyticsConfig.RawRetentionDays < 0 {
+		return fmt.Errorf("invalid visit retention: %d days, must be 0 (keep forever) or greater",
+			c.AnalyticsConfig.RawRetentionDays)
+	}
+
+	if c.AnalyticsConfig.RollupInterval <= 0 {
+		return fmt.Errorf("invalid rollup interval: %s, must be greater than 0", c.AnalyticsConfig.RollupInterval)
+	}
+
+	switch c.AnalyticsConfig.IPAnonymization {
+	case "keep", "truncate":
+	case "hash":
+		if c.AnalyticsConfig.IPHashKey == "" {
+			return fmt.Errorf("IP_HASH_KEY is required when IP_ANONYMIZATION is hash")
+		}
+	default:
+		return fmt.Errorf("invalid IP anonymization mode: %q, must be keep, truncate or hash",
+			c.AnalyticsConfig.IPAnonymization)
+	}
+
+	if c.AnalyticsConfig.ClickIDParam == "" {
+		return fmt.Errorf("click ID parameter name cannot be empty")
+	}
+
+	if c.AnalyticsConfig.ConversionWindowDays < 0 {
+		return fmt.Errorf("invalid conversion window: %d days, must be 0 (no limit) or greater",
+			c.AnalyticsConfig.ConversionWindowDays)
+	}
+
+	if c.AnalyticsConfig.VisitQueueSize <= 0 || c.AnalyticsConfig.VisitQueueWorkers <= 0 {
+		return fmt.Errorf("invalid visit queue settings: size and workers must be greater than 0")
+	}
+
+	if c.ReportConfig.CheckInterval <= 0 || c.ReportConfig.WebhookTimeout <= 0 {
+		return fmt.Errorf("invalid report settings: check interval and webhook timeout must be greater than 0")
+	}
+
+	if c.ReportConfig.MaxAttempts <= 0 || c.ReportConfig.RetryBackoff < 0 || c.ReportConfig.TopLinks <= 0 || c.ReportConfig.Workers <= 0 {
+		return fmt.Errorf("invalid report settings: max attempts, top links and workers must be greater than 0, retry backoff cannot be negative")
+	}
+
+	if key := c.APIKeyConfig.AdminKey; key != "" && (!strings.HasPrefix(key, "sk_") || len(key) < 35) {
+		return fmt.Errorf("invalid ADMIN_API_KEY: must start with sk_ followed by at least 32 characters")
+	}
+
+	if c.APIKeyConfig.SelfService && c.APIKeyConfig.SelfServicePerHour <= 0 {
+		return fmt.Errorf("invalid self-service key limit: %d, must be greater than 0", c.APIKeyConfig.SelfServicePerHour)
+	}
+
+	if c.APIKeyConfig.SelfServiceRequestsPerMinute < 0 || c.APIKeyConfig.SelfServiceMonthlyLinkQuota < 0 {
+		return fmt.Errorf("invalid self-service key usage limits: requests per minute and monthly link quota cannot be negative")
+	}
+
+	if c.APIKeyConfig.RotationGracePeriod < 0 || c.APIKeyConfig.RotationGracePeriod > 720*time.Hour {
+		return fmt.Errorf("invalid key rotation grace period: %s, must be between 0 and 720 hours", c.APIKeyConfig.RotationGracePeriod)
+	}
+
+	if c.APIKeyConfig.UsageFlushInterval <= 0 || c.APIKeyConfig.UsageRetentionDays < 0 {
+		return fmt.Errorf("invalid API key usage settings: flush interval must be greater than 0, retention cannot be negative")
+	}
+
+	if c.APIKeyConfig.DenialLogInterval < 0 || c.APIKeyConfig.DenialRetentionDays < 0 {
+		return fmt.Errorf("invalid API key denial settings: log interval and retention cannot be negative")
+	}
+
+	if c.APIKeyConfig.CacheTTL < 0 || c.APIKeyConfig.CacheSize <= 0 || c.APIKeyConfig.CachePollInterval <= 0 {
+		return fmt.Errorf("invalid API key cache settings: TTL cannot be negative, size and poll interval must be greater than 0")
+	}
+
+	if c.AnalyticsConfig.LiveMaxSubscribers <= 0 || c.AnalyticsConfig.LiveMaxSubscribersPerWorkspace <= 0 || c.AnalyticsConfig.LiveBufferSize <= 0 {
+		return fmt.Errorf("invalid live stream settings: max subscribers and buffer size must be greater than 0")
+	}
+
+	if c.AnalyticsConfig.LiveHeartbeat <= 0 {
+		return fmt.Errorf("invalid live heartbeat: %s, must be greater than 0", c.AnalyticsConfig.LiveHeartbeat)
+	}
+
+	if jwt := c.JWTConfig; jwt.Enabled() {
+		if jwt.JWKSFile != "" && jwt.JWKSURL != "" {
+			return fmt.Errorf("set only one of JWT_JWKS_FILE and JWT_JWKS_URL")
+		}
+		if jwt.Issuer == "" || jwt.Audience == "" {
+			return fmt.Errorf("JWT_ISSUER and JWT_AUDIENCE are required when JWT authentication is enabled")
+		}
+		if jwt.JWKSRefresh <= 0 || jwt.ClockSkew < 0 {
+			return fmt.Errorf("invalid JWT settings: JWKS refresh interval must be greater than 0, clock skew cannot be negative")
+		}
+		if len(jwt.Algorithms) == 0 {
+			return fmt.Errorf("JWT_ALGORITHMS cannot be empty")
+		}
+		for _, alg := range jwt.Algorithms {
+			if !slices.Contains(jwtAlgorithms, alg) {
+				return fmt.Errorf("unsupported JWT algorithm: %q, must be one of %s", alg, strings.Join(jwtAlgorithms, ", "))
+			}
+		}
+		if jwt.EmailClaim == "" || jwt.ScopeClaim == "" || jwt.WorkspaceClaim == "" {
+			return fmt.Errorf("JWT claim names cannot be empty")
+		}
+	}
+
 	return nil
 }
@@ -13,6 +13,7 @@ import (
 	"gorm.io/gorm/logger"
 
 	"url-shortener/internal/model"
+	"url-shortener/internal/utils"
 )
 
 type Database struct {
@@ -56,12 +57,44 @@ func NewDatabase() (*Database, error) {
 		return nil, fmt.Errorf("failed to connect to database: %w", err)
 	}
 
+	// 旧版本明文保存的 API Key 需先转换为哈希
+	if err := migrateAPIKeyHashes(db); err != nil {
+		return nil, fmt.Errorf("failed to migrate api keys: %w", err)
+	}
+
 	// 自动迁移表结构
-	err = db.AutoMigrate(&model.URL{}, &model.APIKey{})
+	err = db.AutoMigrate(
+		&model.URL{},
+		&model.APIKey{},
+		&model.VisitRecord{},
+		&model.HourlyVisitRollup{},
+		&model.DailyVisitRollup{},
+		&model.RollupWatermark{},
+		&model.Conversion{},
+		&model.Click{},
+		&model.ReportSubscription{},
+		&model.ReportDelivery{},
+		&model.APIKeyDenial{},
+		&model.APIKeyEndpointUsage{},
+		&model.APIKeyChange{},
+		&model.Workspace{},
+		&model.User{},
+		&model.WorkspaceMember{},
+	)
 	if err != nil {
 		return nil, fmt.Errorf("failed to migrate database: %w", err)
 	}
 
+	// 升级前创建的 API Key 没有权限范围，授予全部权限
+	if err := backfillAPIKeyScopes(db); err != nil {
+		return nil, fmt.Errorf("failed to backfill api key scopes: %w", err)
+	}
+
+	// 升级前的数据没有所属工作区，归入默认工作区
+	if err := backfillWorkspaces(db); err != nil {
+		return nil, fmt.Errorf("failed to backfill workspaces: %w", err)
+	}
+
 	return &Database{DB: db}, nil
 }
 
@@ -150,7 +183,7 @@ func (r *APIKeyRepository) Create(key *model.APIKey) error {
 // GetByKey 根据 Key 获取
 func (r *APIKeyRepository) GetByKey(key string) (*model.APIKey, error) {
 	var apiKey model.APIKey
-	err := r.DB.Where("key = ?", key).First(&apiKey).Error
+	err := r.DB.Where("key_hash = ?", utils.HashAPIKey(key)).First(&apiKey).Error
 	if err != nil {
 		return nil, err
 	}
@@ -160,7 +193,7 @@ func (r *APIKeyRepository) GetByKey(key string) (*model.APIKey, error) {
 // ValidateKey 验证 Key 是否有效
 func (r *APIKeyRepository) ValidateKey(key string) (*model.APIKey, error) {
 	var apiKey model.APIKey
-	err := r.DB.Where("key = ? AND is_active = ?", key, true).First(&apiKey).Error
+	err := r.DB.Where("key_hash = ? AND is_active = ?", utils.HashAPIKey(key), true).First(&apiKey).Error
 	if err != nil {
 		return nil, err
 	}
@@ -181,6 +214,6 @@ func (r *APIKeyRepository) GetAll() ([]model.APIKey, error) {
 }
 
 // Deactivate 禁用 API Key
-func (r *APIKeyRepository) Deactivate(key string) error {
-	return r.DB.Model(&model.APIKey{}).Where("key = ?", key).Update("is_active", false).Error
+func (r *APIKeyRepository) Deactivate(id uint) error {
+	return r.DB.Model(&model.APIKey{}).Where("id = ?", id).Update("is_active", false).Error
 }
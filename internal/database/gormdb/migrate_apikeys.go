@@ -0,0 +1,102 @@
+package gorm
+
+import (
+	"encoding/json"
+	"log"
+
+	"gorm.io/gorm"
+
+	"url-shortener/internal/model"
+	"url-shortener/internal/utils"
+)
+
+// legacyAPIKey 旧版本的 api_keys 表，key 列保存明文 Key
+type legacyAPIKey struct {
+	ID        uint
+	APIKey    string `gorm:"column:key;type:varchar(128);uniqueIndex"` // 字段名与旧模型一致，索引名才能对应上
+	KeyHash   string `gorm:"type:varchar(64)"`
+	KeyPrefix string `gorm:"type:varchar(16)"`
+}
+
+func (legacyAPIKey) TableName() string {
+	return "api_keys"
+}
+
+// migrateAPIKeyHashes 将旧版本明文保存的 API Key 转换为 SHA-256 哈希和可见前缀，然后删除明文列
+// 新增列先不加非空约束以便在已有数据的表上添加，回填完成后由 AutoMigrate 建立索引；已迁移或全新的数据库直接跳过
+func migrateAPIKeyHashes(db *gorm.DB) error {
+	if !db.Migrator().HasTable(&legacyAPIKey{}) {
+		return nil
+	}
+	// SQLite 的 HasColumn 按建表语句模糊匹配，key 会误匹配 key_hash 等列，这里按实际列名判断
+	columns, err := db.Migrator().ColumnTypes(&legacyAPIKey{})
+	if err != nil {
+		return err
+	}
+	hasPlainKey := false
+	for _, column := range columns {
+		if column.Name() == "key" {
+			hasPlainKey = true
+			break
+		}
+	}
+	if !hasPlainKey {
+		return nil
+	}
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		m := tx.Migrator()
+		for _, field := range []string{"KeyHash", "KeyPrefix"} {
+			if !m.HasColumn(&legacyAPIKey{}, field) {
+				if err := m.AddColumn(&legacyAPIKey{}, field); err != nil {
+					return err
+				}
+			}
+		}
+
+		var keys []legacyAPIKey
+		if err := tx.Select("id", "key").Find(&keys).Error; err != nil {
+			return err
+		}
+		for _, key := range keys {
+			err := tx.Model(&legacyAPIKey{}).Where("id = ?", key.ID).Updates(map[string]interface{}{
+				"key_hash":   utils.HashAPIKey(key.APIKey),
+				"key_prefix": utils.APIKeyPrefix(key.APIKey),
+			}).Error
+			if err != nil {
+				return err
+			}
+		}
+
+		// 部分数据库不允许删除带索引的列，先删除 key 列上的唯一索引
+		if m.HasIndex(&legacyAPIKey{}, "APIKey") {
+			if err := m.DropIndex(&legacyAPIKey{}, "APIKey"); err != nil {
+				return err
+			}
+		}
+		if err := m.DropColumn(&legacyAPIKey{}, "APIKey"); err != nil {
+			return err
+		}
+
+		log.Printf("Migrated %d API key(s) to hashed storage", len(keys))
+		return nil
+	})
+}
+
+// backfillAPIKeyScopes 为升级前创建、尚无权限范围的 API Key 授予默认权限
+// 升级前任何人都可以创建 Key，因此不授予 keys:admin；管理员 Key 需通过 ADMIN_API_KEY 或 bootstrap-admin 获得
+func backfillAPIKeyScopes(db *gorm.DB) error {
+	scopes, err := json.Marshal(model.DefaultScopes)
+	if err != nil {
+		return err
+	}
+	result := db.Model(&model.APIKey{}).Where("scopes IS NULL OR scopes = '' OR scopes = 'null'").
+		Update("scopes", gorm.Expr("?", string(scopes)))
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected > 0 {
+		log.Printf("Granted default scopes (without %s) to %d existing API key(s)", model.ScopeKeysAdmin, result.RowsAffected)
+	}
+	return nil
+}
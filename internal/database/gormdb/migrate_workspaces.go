@@ -0,0 +1,48 @@
+package gorm
+
+import (
+	"log"
+
+	"gorm.io/gorm"
+
+	"url-shortener/internal/model"
+)
+
+// backfillWorkspaces 将升级前创建、尚未归属工作区的短链接、API Key 和报告订阅归入默认工作区
+// 没有需要迁移的数据时不会创建默认工作区
+func backfillWorkspaces(db *gorm.DB) error {
+	tables := []string{model.URL{}.TableName(), model.APIKey{}.TableName(), model.ReportSubscription{}.TableName()}
+
+	pending := false
+	for _, table := range tables {
+		var count int64
+		if err := db.Table(table).Where("workspace_id = 0 OR workspace_id IS NULL").Count(&count).Error; err != nil {
+			return err
+		}
+		if count > 0 {
+			pending = true
+			break
+		}
+	}
+	if !pending {
+		return nil
+	}
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		isDefault := true
+		workspace := model.Workspace{Name: model.DefaultWorkspaceName, IsDefault: &isDefault}
+		if err := tx.Where("is_default = ?", true).FirstOrCreate(&workspace).Error; err != nil {
+			return err
+		}
+		for _, table := range tables {
+			result := tx.Table(table).Where("workspace_id = 0 OR workspace_id IS NULL").Update("workspace_id", workspace.ID)
+			if result.Error != nil {
+				return result.Error
+			}
+			if result.RowsAffected > 0 {
+				log.Printf("Moved %d existing row(s) of %s into workspace %q", result.RowsAffected, table, workspace.Name)
+			}
+		}
+		return nil
+	})
+}
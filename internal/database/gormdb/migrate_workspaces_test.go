@@ -0,0 +1,84 @@
+package gorm
+
+import (
+	"path/filepath"
+	"testing"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+
+	"url-shortener/internal/model"
+)
+
+// newTestDB 在临时目录中创建 SQLite 数据库并迁移工作区相关的表
+func newTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "test.db")), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+	if err != nil {
+		t.Fatalf("open database: %v", err)
+	}
+	if err := db.AutoMigrate(&model.URL{}, &model.APIKey{}, &model.ReportSubscription{}, &model.Workspace{}); err != nil {
+		t.Fatalf("migrate database: %v", err)
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatalf("get sql.DB: %v", err)
+	}
+	t.Cleanup(func() { sqlDB.Close() })
+	return db
+}
+
+func TestBackfillWorkspaces(t *testing.T) {
+	db := newTestDB(t)
+
+	// 没有需要迁移的数据时不创建默认工作区
+	if err := backfillWorkspaces(db); err != nil {
+		t.Fatalf("backfillWorkspaces: %v", err)
+	}
+	var count int64
+	if err := db.Model(&model.Workspace{}).Count(&count).Error; err != nil {
+		t.Fatalf("count workspaces: %v", err)
+	}
+	if count != 0 {
+		t.Fatalf("created %d workspace(s) without data to move", count)
+	}
+
+	// 自助创建的同名工作区不是默认工作区，升级前的数据不能归入其中
+	selfService := model.Workspace{Name: model.DefaultWorkspaceName}
+	if err := db.Create(&selfService).Error; err != nil {
+		t.Fatalf("create workspace: %v", err)
+	}
+	if err := db.Create(&model.URL{ShortCode: "abc", OriginalURL: "https://example.com"}).Error; err != nil {
+		t.Fatalf("create url: %v", err)
+	}
+	if err := db.Create(&model.APIKey{KeyHash: "hash", KeyPrefix: "sk_test", Name: "old", IsActive: true}).Error; err != nil {
+		t.Fatalf("create key: %v", err)
+	}
+
+	for i := 0; i < 2; i++ {
+		if err := backfillWorkspaces(db); err != nil {
+			t.Fatalf("backfillWorkspaces: %v", err)
+		}
+	}
+
+	var defaults []model.Workspace
+	if err := db.Where("is_default = ?", true).Find(&defaults).Error; err != nil {
+		t.Fatalf("find default workspace: %v", err)
+	}
+	if len(defaults) != 1 || defaults[0].ID == selfService.ID {
+		t.Fatalf("default workspaces = %+v, want one new workspace", defaults)
+	}
+	for _, table := range []string{model.URL{}.TableName(), model.APIKey{}.TableName()} {
+		var ids []uint
+		if err := db.Table(table).Distinct().Pluck("workspace_id", &ids).Error; err != nil {
+			t.Fatalf("read %s: %v", table, err)
+		}
+		if len(ids) != 1 || ids[0] != defaults[0].ID {
+			t.Errorf("%s workspace IDs = %v, want [%d]", table, ids, defaults[0].ID)
+		}
+	}
+}
@@ -1,7 +1,11 @@
 package handler
 
 import (
+	"errors"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
 
 	"url-shortener/internal/model"
 	"url-shortener/internal/service"
@@ -21,6 +25,10 @@ func NewAPIKeyHandler(service *service.APIKeyService) *APIKeyHandler {
 }
 
 // CreateKey handles POST /api/keys
+// Requests authenticated with a key must hold the keys:admin scope in the
+// target workspace. Anonymous requests only reach this handler when
+// self-service key creation is enabled and get a key without keys:admin in a
+// new workspace.
 func (h *APIKeyHandler) CreateKey(c *gin.Context) {
 	var req model.CreateAPIKeyRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -28,61 +36,333 @@ func (h *APIKeyHandler) CreateKey(c *gin.Context) {
 		return
 	}
 
-	response, err := h.service.GenerateKey(&req)
+	var (
+		response *model.APIKeyResponse
+		err      error
+	)
+	if p := principal(c); p == nil {
+		response, err = h.service.GenerateSelfServiceKey(&req)
+	} else {
+		response, err = h.service.GenerateKey(p, &req)
+	}
 	if err != nil {
-		utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to create API key: "+err.Error())
+		switch {
+		case errors.Is(err, utils.ErrForbidden):
+			utils.ErrorResponseWithCode(c, http.StatusForbidden, utils.ErrForbidden.Code, err.Error())
+		case errors.Is(err, utils.ErrInvalidInput):
+			utils.ErrorResponse(c, http.StatusBadRequest, "Invalid request: "+err.Error())
+		default:
+			utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to create API key: "+err.Error())
+		}
 		return
 	}
 
 	c.JSON(http.StatusCreated, gin.H{
-		"message": "API key created successfully",
+		"message": "API key created successfully. Store it now; it cannot be retrieved again.",
 		"data":    response,
 	})
 }
 
 // ListKeys handles GET /api/keys
+// Only keys in the caller's workspace are listed.
 func (h *APIKeyHandler) ListKeys(c *gin.Context) {
-	keys, err := h.service.ListKeys()
+	keys, err := h.service.ListKeys(c.GetUint("workspace_id"))
 	if err != nil {
 		utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to list API keys: "+err.Error())
 		return
 	}
 
-	// Mask the keys for security
-	maskedKeys := make([]model.APIKey, len(keys))
-	for i, key := range keys {
-		key.APIKey = maskKey(key.APIKey)
-		maskedKeys[i] = key
-	}
-
+	// Keys are stored hashed, so only the visible prefix is returned
 	c.JSON(http.StatusOK, gin.H{
-		"data": maskedKeys,
+		"data": keys,
 	})
 }
 
-// RevokeKey handles DELETE /api/keys/:key
+// RevokeKey handles DELETE /api/keys/:id
 func (h *APIKeyHandler) RevokeKey(c *gin.Context) {
-	key := c.Param("key")
-	if key == "" {
-		utils.ErrorResponse(c, http.StatusBadRequest, "API key is required")
+	id, ok := h.keyID(c)
+	if !ok {
 		return
 	}
 
-	if err := h.service.RevokeKey(key); err != nil {
+	apikey, err := h.service.RevokeKey(principal(c), id)
+	switch {
+	case err == nil:
+	case errors.Is(err, utils.ErrForbidden):
+		utils.ErrorResponseWithCode(c, http.StatusForbidden, utils.ErrForbidden.Code, err.Error())
+		return
+	case errors.Is(err, utils.ErrAPIKeyNotFound):
+		utils.ErrorResponse(c, http.StatusNotFound, "API key not found")
+		return
+	default:
 		utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to revoke API key: "+err.Error())
 		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{
 		"message": "API key revoked successfully",
+		"data":    apikey,
 	})
 }
 
+// UpdateKey handles PATCH /api/keys/:id
+// Only the fields present in the request body are changed.
+func (h *APIKeyHandler) UpdateKey(c *gin.Context) {
+	id, ok := h.keyID(c)
+	if !ok {
+		return
+	}
+
+	var req model.UpdateAPIKeyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Invalid request: "+err.Error())
+		return
+	}
+
+	apikey, err := h.service.UpdateKey(principal(c), id, &req)
+	switch {
+	case err == nil:
+	case errors.Is(err, utils.ErrForbidden):
+		utils.ErrorResponseWithCode(c, http.StatusForbidden, utils.ErrForbidden.Code, err.Error())
+		return
+	case errors.Is(err, utils.ErrAPIKeyNotFound):
+		utils.ErrorResponse(c, http.StatusNotFound, "API key not found")
+		return
+	case errors.Is(err, utils.ErrInvalidInput):
+		utils.ErrorResponse(c, http.StatusBadRequest, "Invalid request: "+err.Error())
+		return
+	default:
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to update API key: "+err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "API key updated successfully",
+		"data":    apikey,
+	})
+}
+
+// ListDenials handles GET /api/keys/:id/denials?limit=20
+// It lists recent requests rejected because they came from outside the key's IP allowlist.
+func (h *APIKeyHandler) ListDenials(c *gin.Context) {
+	id, ok := h.keyID(c)
+	if !ok {
+		return
+	}
+
+	limit := 20
+	if raw := c.Query("limit"); raw != "" {
+		parsed, err := strconv.Atoi(raw)
+		if err != nil || parsed < 1 || parsed > 100 {
+			utils.ErrorResponse(c, http.StatusBadRequest, "limit must be between 1 and 100")
+			return
+		}
+		limit = parsed
+	}
+
+	denials, err := h.service.ListDenials(c.GetUint("workspace_id"), id, limit)
+	switch {
+	case err == nil:
+	case errors.Is(err, utils.ErrAPIKeyNotFound):
+		utils.ErrorResponse(c, http.StatusNotFound, "API key not found")
+		return
+	default:
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to list denied requests: "+err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data": denials,
+	})
+}
+
+// ListActivity handles GET /api/keys/usage?days=30&idle=true
+// It lists every key with its request and error counts over the last days;
+// idle=true keeps only keys not used in that period.
+func (h *APIKeyHandler) ListActivity(c *gin.Context) {
+	since, ok := usageSince(c)
+	if !ok {
+		return
+	}
+
+	activity, err := h.service.Activity(c.GetUint("workspace_id"), since)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to load API key usage: "+err.Error())
+		return
+	}
+
+	if c.Query("idle") == "true" {
+		idle := activity[:0]
+		for _, key := range activity {
+			if key.Idle {
+				idle = append(idle, key)
+			}
+		}
+		activity = idle
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"since": since,
+		"data":  activity,
+	})
+}
+
+// GetActivity handles GET /api/keys/:id/usage?days=30
+// It reports the usage of one key broken down by endpoint.
+func (h *APIKeyHandler) GetActivity(c *gin.Context) {
+	id, ok := h.keyID(c)
+	if !ok {
+		return
+	}
+	since, ok := usageSince(c)
+	if !ok {
+		return
+	}
+
+	activity, err := h.service.KeyActivity(c.GetUint("workspace_id"), id, since)
+	switch {
+	case err == nil:
+	case errors.Is(err, utils.ErrAPIKeyNotFound):
+		utils.ErrorResponse(c, http.StatusNotFound, "API key not found")
+		return
+	default:
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to load API key usage: "+err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"since": since,
+		"data":  activity,
+	})
+}
+
+// usageSince parses the days query parameter into the start of the usage
+// period; usage is counted per UTC day, so the period starts at midnight UTC
+func usageSince(c *gin.Context) (time.Time, bool) {
+	days := 30
+	if raw := c.Query("days"); raw != "" {
+		parsed, err := strconv.Atoi(raw)
+		if err != nil || parsed < 1 || parsed > 365 {
+			utils.ErrorResponse(c, http.StatusBadRequest, "days must be between 1 and 365")
+			return time.Time{}, false
+		}
+		days = parsed
+	}
+
+	year, month, day := time.Now().UTC().Date()
+	return time.Date(year, month, day, 0, 0, 0, 0, time.UTC).AddDate(0, 0, 1-days), true
+}
+
+// Usage handles GET /api/keys/me/usage
+// It reports the limits and remaining quota of the key making the request.
+// Requests authenticated with a JWT have no key and get a 400.
+func (h *APIKeyHandler) Usage(c *gin.Context) {
+	if c.GetUint("api_key_id") == 0 {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Usage is only tracked for API keys; this request was authenticated with a token")
+		return
+	}
+	usage, err := h.service.Usage(c.GetUint("workspace_id"), c.GetUint("api_key_id"), time.Now())
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to load API key usage: "+err.Error())
+		return
+	}
+	if remaining, exists := c.Get("api_key_requests_remaining"); exists {
+		requestsRemaining := remaining.(int)
+		usage.Requests.Remaining = &requestsRemaining
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data": usage,
+	})
+}
+
+// RotateKey handles POST /api/keys/:id/rotate
+// The new key keeps the name, scopes and report subscriptions of the old one;
+// the old key keeps working until previous_key_expires_at.
+func (h *APIKeyHandler) RotateKey(c *gin.Context) {
+	id, ok := h.keyID(c)
+	if !ok {
+		return
+	}
+
+	var req model.RotateAPIKeyRequest
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			utils.ErrorResponse(c, http.StatusBadRequest, "Invalid request: "+err.Error())
+			return
+		}
+	}
+	var grace *time.Duration
+	if req.GracePeriodHours != nil {
+		period := time.Duration(*req.GracePeriodHours) * time.Hour
+		grace = &period
+	}
+
+	response, err := h.service.RotateKey(principal(c), id, grace)
+	switch {
+	case err == nil:
+	case errors.Is(err, utils.ErrForbidden):
+		utils.ErrorResponseWithCode(c, http.StatusForbidden, utils.ErrForbidden.Code, err.Error())
+		return
+	case errors.Is(err, utils.ErrAPIKeyNotFound):
+		utils.ErrorResponse(c, http.StatusNotFound, "API key not found")
+		return
+	case errors.Is(err, utils.ErrAPIKeyRotated):
+		utils.ErrorResponseWithCode(c, http.StatusConflict, utils.ErrAPIKeyRotated.Code, "API key has already been rotated; rotate its replacement instead")
+		return
+	case errors.Is(err, utils.ErrAPIKeyInactive):
+		utils.ErrorResponseWithCode(c, http.StatusConflict, utils.ErrAPIKeyInactive.Code, "Revoked or expired API keys cannot be rotated")
+		return
+	default:
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to rotate API key: "+err.Error())
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message": "API key rotated successfully. Store the new key now; it cannot be retrieved again.",
+		"data":    response,
+	})
+}
+
+// keyID resolves the :id path parameter to a key ID.
+// The key is identified by its numeric ID or its visible prefix (e.g. sk_3e5edccf),
+// never by the raw key, so secrets do not end up in access logs.
+func (h *APIKeyHandler) keyID(c *gin.Context) (uint, bool) {
+	ref := c.Param("id")
+	if id, err := strconv.ParseUint(ref, 10, 64); err == nil {
+		return uint(id), true
+	}
+	if len(ref) != utils.APIKeyPrefixLength || !strings.HasPrefix(ref, "sk_") {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Identify the key by its ID or its "+strconv.Itoa(utils.APIKeyPrefixLength)+"-character prefix, not the full key")
+		return 0, false
+	}
+
+	apikey, err := h.service.FindKeyByPrefix(c.GetUint("workspace_id"), ref)
+	switch {
+	case err == nil:
+		return apikey.ID, true
+	case errors.Is(err, utils.ErrAPIKeyNotFound):
+		utils.ErrorResponse(c, http.StatusNotFound, "API key not found")
+	case errors.Is(err, utils.ErrAmbiguousKeyPrefix):
+		utils.ErrorResponse(c, http.StatusConflict, "Key prefix matches more than one API key; use its ID instead")
+	default:
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to look up API key: "+err.Error())
+	}
+	return 0, false
+}
+
 // ValidateKey handles GET /api/keys/validate
+// The key is read from the Authorization header; keys in the query string are
+// rejected because URLs are routinely written to access logs.
 func (h *APIKeyHandler) ValidateKey(c *gin.Context) {
-	key := c.Query("key")
-	if key == "" {
-		utils.ErrorResponse(c, http.StatusBadRequest, "API key is required")
+	if c.Query("key") != "" {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Do not pass API keys in the URL. Use: Authorization: Bearer <api_key>")
+		return
+	}
+
+	key, ok := bearerToken(c)
+	if !ok {
+		utils.ErrorResponse(c, http.StatusBadRequest, "API key is required. Use: Authorization: Bearer <api_key>")
 		return
 	}
 
@@ -95,17 +375,21 @@ func (h *APIKeyHandler) ValidateKey(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{
 		"valid": true,
 		"data": gin.H{
-			"name":      apikey.Name,
+			"id":         apikey.ID,
+			"key_prefix": apikey.KeyPrefix,
+			"name":       apikey.Name,
 			"created_at": apikey.CreatedAt,
 			"last_used":  apikey.LastUsed,
+			"scopes":     apikey.Scopes,
 		},
 	})
 }
 
-// maskKey masks a portion of the API key for security
-func maskKey(key string) string {
-	if len(key) <= 8 {
-		return "****"
+// bearerToken extracts the token from an "Authorization: Bearer <token>" header
+func bearerToken(c *gin.Context) (string, bool) {
+	parts := strings.SplitN(c.GetHeader("Authorization"), " ", 2)
+	if len(parts) != 2 || !strings.EqualFold(parts[0], "Bearer") || parts[1] == "" {
+		return "", false
 	}
-	return key[:8] + "****" + key[len(key)-4:]
+	return parts[1], true
 }
@@ -0,0 +1,72 @@
+package handler
+
+import (
+	"net/http"
+
+	"url-shortener/internal/model"
+	"url-shortener/internal/service"
+	"url-shortener/internal/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// CompareAnalytics 对比两个时间段的分析数据
+// GET /api/analytics/:code/compare?since=2026-01-08&until=2026-01-14[&compare_since=2026-01-01&compare_until=2026-01-07][&tz=Asia/Shanghai]
+// 未指定 compare_since/compare_until 时与紧邻的上一个同等长度时间段对比
+func (h *EnhancedHandler) CompareAnalytics(c *gin.Context) {
+	var req model.VisitAnalyticsRequest
+	if err := c.ShouldBindUri(&req); err != nil {
+		c.JSON(http.StatusBadRequest, model.ErrorResponse{
+			Error: utils.ValidateAndFormatError(err),
+		})
+		return
+	}
+
+	// 查询不存在的短码不会出错，先确认短链接属于当前工作区
+	if _, err := h.service.GetLink(c.GetUint("workspace_id"), req.ShortCode); err != nil {
+		h.handleURLError(c, err)
+		return
+	}
+
+	loc, err := h.parseTimezoneParam(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, model.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	since, until, err := h.parseTimeRangeParams(c, loc)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, model.ErrorResponse{Error: err.Error()})
+		return
+	}
+	if since == nil || until == nil || !since.Before(*until) {
+		c.JSON(http.StatusBadRequest, model.ErrorResponse{Error: "since and until are required and since must not be after until"})
+		return
+	}
+	current := model.TimeRange{Since: *since, Until: *until}
+
+	compareSince, compareUntil, err := h.parseDateRangeParams(c, "compare_since", "compare_until", loc)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, model.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	var previous model.TimeRange
+	switch {
+	case compareSince == nil && compareUntil == nil:
+		previous = service.PreviousPeriod(current)
+	case compareSince != nil && compareUntil != nil && compareSince.Before(*compareUntil):
+		previous = model.TimeRange{Since: *compareSince, Until: *compareUntil}
+	default:
+		c.JSON(http.StatusBadRequest, model.ErrorResponse{Error: "compare_since and compare_until must be given together and compare_since must not be after compare_until"})
+		return
+	}
+
+	comparison, err := h.service.CompareAnalytics(c.GetUint("workspace_id"), req.ShortCode, current, previous, loc)
+	if err != nil {
+		h.handleURLError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, comparison)
+}
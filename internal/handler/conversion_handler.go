@@ -0,0 +1,59 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+
+	"url-shortener/internal/model"
+	"url-shortener/internal/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RecordConversion 接收转化回传
+// POST /api/conversions {"click_id": "clk_2s", "event": "signup", "value": 19.9}
+// 新记录返回 201，同一点击的同名事件重复回传时返回 200 和已有记录
+func (h *EnhancedHandler) RecordConversion(c *gin.Context) {
+	var req model.ConversionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, model.ErrorResponse{
+			Error: utils.ValidateAndFormatError(err),
+		})
+		return
+	}
+
+	conversion, created, err := h.service.RecordConversion(c.GetUint("workspace_id"), &req)
+	if err != nil {
+		if errors.Is(err, utils.ErrClickNotFound) {
+			c.JSON(http.StatusNotFound, model.ErrorResponse{Error: "Click ID not found"})
+			return
+		}
+		h.handleServiceError(c, err)
+		return
+	}
+
+	status := http.StatusOK
+	if created {
+		status = http.StatusCreated
+	}
+	c.JSON(status, conversion)
+}
+
+// SetClickTracking 开启或关闭短链接的点击 ID 追踪
+// PUT /api/urls/:code/click-tracking {"enabled": true}
+func (h *EnhancedHandler) SetClickTracking(c *gin.Context) {
+	var req model.SetClickTrackingRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, model.ErrorResponse{
+			Error: utils.ValidateAndFormatError(err),
+		})
+		return
+	}
+
+	if err := h.service.SetClickTracking(c.GetUint("workspace_id"), c.Param("code"), req.Enabled); err != nil {
+		h.handleURLError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Click tracking updated successfully"})
+}
@@ -0,0 +1,68 @@
+package handler
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"url-shortener/internal/model"
+	"url-shortener/internal/repository"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// defaultDashboardLimit 排行榜及链接列表的默认条目数
+	defaultDashboardLimit = 10
+	// maxDashboardLimit 排行榜及链接列表的最大条目数
+	maxDashboardLimit = 100
+	// defaultExpiringWithinHours 默认将 7 天内过期的链接视为即将过期
+	defaultExpiringWithinHours = 24 * 7
+)
+
+// GetDashboard 获取当前工作区内所有短链接的汇总数据看板
+// GET /api/dashboard?since=2026-01-01&until=2026-01-31&tz=Asia/Shanghai&limit=10&expiring_within_hours=168
+func (h *EnhancedHandler) GetDashboard(c *gin.Context) {
+	loc, err := h.parseTimezoneParam(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, model.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	since, until, err := h.parseTimeRangeParams(c, loc)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, model.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", strconv.Itoa(defaultDashboardLimit)))
+	if err != nil || limit <= 0 || limit > maxDashboardLimit {
+		c.JSON(http.StatusBadRequest, model.ErrorResponse{Error: "limit must be between 1 and 100"})
+		return
+	}
+
+	expiringWithin, err := strconv.Atoi(c.DefaultQuery("expiring_within_hours", strconv.Itoa(defaultExpiringWithinHours)))
+	if err != nil || expiringWithin <= 0 {
+		c.JSON(http.StatusBadRequest, model.ErrorResponse{Error: "expiring_within_hours must be a positive integer"})
+		return
+	}
+
+	dashboard, err := h.service.GetDashboard(&repository.DashboardQuery{
+		WorkspaceID:    c.GetUint("workspace_id"),
+		Since:          since,
+		Until:          until,
+		Location:       loc,
+		Limit:          limit,
+		ExpiringWithin: time.Duration(expiringWithin) * time.Hour,
+	})
+	if err != nil {
+		h.handleServiceError(c, err)
+		return
+	}
+
+	for _, link := range dashboard.NewLinks {
+		link.CreatedAt = link.CreatedAt.In(loc)
+	}
+
+	c.JSON(http.StatusOK, dashboard)
+}
@@ -3,7 +3,6 @@ package handler
 import (
 	"errors"
 	"fmt"
-	"net"
 	"net/http"
 	"strings"
 	"time"
@@ -39,7 +38,7 @@ func (h *EnhancedHandler) CreateShortURL(c *gin.Context) {
 	}
 
 	// 调用服务层创建短链接
-	resp, err := h.service.CreateShortURL(req.URL, req.CustomCode, req.ExpireIn)
+	resp, err := h.service.CreateShortURL(c.GetUint("workspace_id"), c.GetUint("api_key_id"), &req)
 	if err != nil {
 		h.handleServiceError(c, err)
 		return
@@ -52,29 +51,43 @@ func (h *EnhancedHandler) CreateShortURL(c *gin.Context) {
 func (h *EnhancedHandler) Redirect(c *gin.Context) {
 	shortCode := c.Param("code")
 
-	// 获取客户端IP地址
-	clientIP := h.getClientIP(c.Request)
+	// 获取客户端IP地址（已按受信任代理配置解析）
+	clientIP := utils.ClientIP(c)
 
 	// 获取User-Agent和Referer
 	userAgent := c.GetHeader("User-Agent")
 	referer := c.GetHeader("Referer")
 
-	// 获取短链接并记录分析数据
-	url, err := h.service.GetByShortCodeWithContext(c.Request.Context(), shortCode, clientIP, userAgent, referer)
+	// 获取跳转目标并记录分析数据
+	target, err := h.service.ResolveRedirect(c.Request.Context(), shortCode, &service.VisitInfo{
+		IPAddress: clientIP,
+		UserAgent: userAgent,
+		Referer:   referer,
+		Query:     c.Request.URL.Query(),
+
+		DoNotTrack: c.GetHeader("DNT") == "1" || c.GetHeader("Sec-GPC") == "1",
+	})
 	if err != nil {
 		h.handleURLError(c, err)
 		return
 	}
 
+	// 带点击 ID 的跳转每次都不同，使用 302 避免浏览器缓存
+	if target.ClickID != "" {
+		c.Header("Cache-Control", "no-store")
+		c.Redirect(http.StatusFound, target.Destination)
+		return
+	}
+
 	// 301永久重定向到原链接
-	c.Redirect(http.StatusMovedPermanently, url.OriginalURL)
+	c.Redirect(http.StatusMovedPermanently, target.Destination)
 }
 
 // GetStats 获取短链接统计信息
 func (h *EnhancedHandler) GetStats(c *gin.Context) {
 	shortCode := c.Param("code")
 
-	stats, err := h.service.GetStats(shortCode)
+	stats, err := h.service.GetStats(c.GetUint("workspace_id"), shortCode)
 	if err != nil {
 		h.handleURLError(c, err)
 		return
@@ -93,14 +106,20 @@ func (h *EnhancedHandler) GetAdvancedAnalytics(c *gin.Context) {
 		return
 	}
 
-	// 解析时间范围参数
-	since, until, parseErr := h.parseTimeRangeParams(c)
+	// 解析时区和时间范围参数
+	loc, parseErr := h.parseTimezoneParam(c)
 	if parseErr != nil {
 		c.JSON(http.StatusBadRequest, model.ErrorResponse{Error: parseErr.Error()})
 		return
 	}
 
-	analytics, err := h.service.GetAdvancedAnalytics(req.ShortCode, since, until)
+	since, until, parseErr := h.parseTimeRangeParams(c, loc)
+	if parseErr != nil {
+		c.JSON(http.StatusBadRequest, model.ErrorResponse{Error: parseErr.Error()})
+		return
+	}
+
+	analytics, err := h.service.GetAdvancedAnalytics(c.GetUint("workspace_id"), req.ShortCode, since, until, loc)
 	if err != nil {
 		h.handleURLError(c, err)
 		return
@@ -119,8 +138,14 @@ func (h *EnhancedHandler) GetRecentVisits(c *gin.Context) {
 		return
 	}
 
-	// 解析时间范围和分页参数
-	since, _, parseErr := h.parseTimeRangeParams(c)
+	// 解析时区、时间范围和分页参数
+	loc, parseErr := h.parseTimezoneParam(c)
+	if parseErr != nil {
+		c.JSON(http.StatusBadRequest, model.ErrorResponse{Error: parseErr.Error()})
+		return
+	}
+
+	since, _, parseErr := h.parseTimeRangeParams(c, loc)
 	if parseErr != nil {
 		c.JSON(http.StatusBadRequest, model.ErrorResponse{Error: parseErr.Error()})
 		return
@@ -129,18 +154,24 @@ func (h *EnhancedHandler) GetRecentVisits(c *gin.Context) {
 	// 解析分页参数
 	limit := h.parseLimitParam(c.DefaultQuery("limit", "100"))
 
-	visits, err := h.service.GetRecentVisits(req.ShortCode, limit, since)
+	visits, err := h.service.GetRecentVisits(c.GetUint("workspace_id"), req.ShortCode, limit, since)
 	if err != nil {
 		h.handleURLError(c, err)
 		return
 	}
 
+	for _, visit := range visits {
+		visit.VisitedAt = visit.VisitedAt.In(loc)
+	}
+
+	// 响应保持为访问记录数组，所用时区通过响应头返回
+	c.Header("X-Timezone", loc.String())
 	c.JSON(http.StatusOK, visits)
 }
 
 // ListURLs 列出所有URL（管理员功能）
 func (h *EnhancedHandler) ListURLs(c *gin.Context) {
-	urls, err := h.service.GetAllURLs()
+	urls, err := h.service.GetAllURLs(c.GetUint("workspace_id"))
 	if err != nil {
 		h.handleServiceError(c, err)
 		return
@@ -157,7 +188,7 @@ func (h *EnhancedHandler) GetURLsWithPagination(c *gin.Context) {
 	pageSize := h.parsePageParam(c.DefaultQuery("page_size", "10"))
 	keyword := c.Query("keyword")
 
-	result, err := h.service.GetURLsWithPagination(page, pageSize, keyword)
+	result, err := h.service.GetURLsWithPagination(c.GetUint("workspace_id"), page, pageSize, keyword)
 	if err != nil {
 		h.handleServiceError(c, err)
 		return
@@ -178,7 +209,7 @@ func (h *EnhancedHandler) SearchURLs(c *gin.Context) {
 	page := h.parsePageParam(c.DefaultQuery("page", "1"))
 	pageSize := h.parsePageParam(c.DefaultQuery("page_size", "10"))
 
-	result, err := h.service.SearchURLs(keyword, page, pageSize)
+	result, err := h.service.SearchURLs(c.GetUint("workspace_id"), keyword, page, pageSize)
 	if err != nil {
 		h.handleServiceError(c, err)
 		return
@@ -191,7 +222,7 @@ func (h *EnhancedHandler) SearchURLs(c *gin.Context) {
 func (h *EnhancedHandler) DeleteURL(c *gin.Context) {
 	shortCode := c.Param("code")
 
-	err := h.service.DeleteShortCode(shortCode)
+	err := h.service.DeleteShortCode(c.GetUint("workspace_id"), shortCode)
 	if err != nil {
 		h.handleURLError(c, err)
 		return
@@ -211,7 +242,7 @@ func (h *EnhancedHandler) HealthCheck(c *gin.Context) {
 
 // CleanupExpiredURLs 清理过期链接的API
 func (h *EnhancedHandler) CleanupExpiredURLs(c *gin.Context) {
-	err := h.service.CleanupExpiredURLs()
+	err := h.service.CleanupExpiredURLs(c.GetUint("workspace_id"))
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, model.ErrorResponse{
 			Error: "Failed to cleanup expired URLs: " + err.Error(),
@@ -222,23 +253,44 @@ func (h *EnhancedHandler) CleanupExpiredURLs(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"message": "Expired URLs cleaned up successfully"})
 }
 
-// 辅助方法：解析时间范围参数
-func (h *EnhancedHandler) parseTimeRangeParams(c *gin.Context) (*time.Time, *time.Time, error) {
+// 辅助方法：解析时区参数，未指定时使用 UTC
+func (h *EnhancedHandler) parseTimezoneParam(c *gin.Context) (*time.Location, error) {
+	tz := c.Query("tz")
+	if tz == "" {
+		return time.UTC, nil
+	}
+
+	loc, err := time.LoadLocation(tz)
+	if err != nil {
+		return nil, fmt.Errorf("invalid tz %q: must be an IANA time zone such as Asia/Shanghai", tz)
+	}
+	return loc, nil
+}
+
+// 辅助方法：解析时间范围参数，日期按 loc 时区的零点解析
+func (h *EnhancedHandler) parseTimeRangeParams(c *gin.Context, loc *time.Location) (*time.Time, *time.Time, error) {
+	return h.parseDateRangeParams(c, "since", "until", loc)
+}
+
+// 辅助方法：按指定的参数名解析日期范围，until 包含当天
+func (h *EnhancedHandler) parseDateRangeParams(c *gin.Context, sinceKey, untilKey string, loc *time.Location) (*time.Time, *time.Time, error) {
 	var since, until *time.Time
 
-	if c.Query("since") != "" {
-		parsedSince, err := time.Parse("2006-01-02", c.Query("since"))
+	if c.Query(sinceKey) != "" {
+		parsedSince, err := time.ParseInLocation("2006-01-02", c.Query(sinceKey), loc)
 		if err != nil {
 			return nil, nil, err
 		}
 		since = &parsedSince
 	}
 
-	if c.Query("until") != "" {
-		parsedUntil, err := time.Parse("2006-01-02", c.Query("until"))
+	if c.Query(untilKey) != "" {
+		parsedUntil, err := time.ParseInLocation("2006-01-02", c.Query(untilKey), loc)
 		if err != nil {
 			return nil, nil, err
 		}
+		// until 包含当天，转换为次日零点作为开区间上界
+		parsedUntil = parsedUntil.AddDate(0, 0, 1)
 		until = &parsedUntil
 	}
 
@@ -274,6 +326,8 @@ func (h *EnhancedHandler) handleServiceError(c *gin.Context, err error) {
 	switch {
 	case err == utils.ErrCustomCodeExists || err == utils.ErrInvalidCustomCode:
 		c.JSON(http.StatusBadRequest, model.ErrorResponse{Error: err.Error()})
+	case utils.IsAppError(err, utils.ErrInvalidInput.Code):
+		c.JSON(http.StatusBadRequest, model.ErrorResponse{Error: err.Error()})
 	case strings.Contains(err.Error(), "database"):
 		c.JSON(http.StatusInternalServerError, model.ErrorResponse{Error: "Database error occurred"})
 	default:
@@ -294,28 +348,3 @@ func (h *EnhancedHandler) handleURLError(c *gin.Context, err error) {
 		c.JSON(http.StatusInternalServerError, model.ErrorResponse{Error: err.Error()})
 	}
 }
-
-// getClientIP 获取客户端真实IP地址
-func (h *EnhancedHandler) getClientIP(r *http.Request) string {
-	// 检查 X-Forwarded-For 头部
-	forwarded := r.Header.Get("X-Forwarded-For")
-	if forwarded != "" {
-		// X-Forwarded-For 可能包含多个IP地址，取第一个
-		ip := strings.Split(forwarded, ",")[0]
-		return strings.TrimSpace(ip)
-	}
-
-	// 检查 X-Real-IP 头部
-	realIP := r.Header.Get("X-Real-IP")
-	if realIP != "" {
-		return realIP
-	}
-
-	// 使用 RemoteAddr
-	addr := r.RemoteAddr
-	ip, _, err := net.SplitHostPort(addr)
-	if err != nil {
-		return addr
-	}
-	return ip
-}
\ No newline at end of file
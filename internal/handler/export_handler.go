@@ -0,0 +1,166 @@
+package handler
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"url-shortener/internal/model"
+
+	"github.com/gin-gonic/gin"
+)
+
+// exportFlushInterval 每写出多少行刷新一次响应缓冲
+const exportFlushInterval = 500
+
+// visitExportColumns CSV 导出列，与 visitExportRow 的顺序一致
+var visitExportColumns = []string{
+	"id", "short_code", "visited_at", "ip_address", "user_agent", "referer", "referrer_host", "traffic_source",
+	"country", "city", "user_os", "os_version", "browser", "browser_version", "device_type", "device_model",
+	"utm_source", "utm_medium", "utm_campaign", "utm_term", "utm_content",
+}
+
+// visitExportRow 将访问记录转换为 CSV 行
+func visitExportRow(visit *model.VisitRecord) []string {
+	row := []string{
+		strconv.FormatInt(visit.ID, 10),
+		visit.ShortCode,
+		visit.VisitedAt.Format(time.RFC3339),
+		visit.IPAddress,
+		visit.UserAgent,
+		visit.Referer,
+		visit.ReferrerHost,
+		visit.TrafficSource,
+		visit.Country,
+		visit.City,
+		visit.UserOS,
+		visit.OSVersion,
+		visit.Browser,
+		visit.BrowserVersion,
+		visit.DeviceType,
+		visit.DeviceModel,
+		visit.UTMSource,
+		visit.UTMMedium,
+		visit.UTMCampaign,
+		visit.UTMTerm,
+		visit.UTMContent,
+	}
+	for i, cell := range row {
+		row[i] = escapeCSVFormula(cell)
+	}
+	return row
+}
+
+// escapeCSVFormula 在可能被电子表格当作公式执行的单元格前加上单引号
+// User-Agent、Referer 等字段由访问者控制，打开导出文件时不能被执行
+func escapeCSVFormula(cell string) string {
+	if cell != "" && strings.ContainsRune("=+-@\t\r", rune(cell[0])) {
+		return "'" + cell
+	}
+	return cell
+}
+
+// ExportVisits 导出单个短链接的访问记录
+// GET /api/visits/:code/export?format=csv|ndjson&since=2026-01-01&until=2026-01-31&tz=UTC
+func (h *EnhancedHandler) ExportVisits(c *gin.Context) {
+	h.exportVisits(c, c.Param("code"))
+}
+
+// ExportAllVisits 导出全部短链接的访问记录
+// GET /api/visits/export?format=csv|ndjson&since=2026-01-01&until=2026-01-31&tz=UTC
+func (h *EnhancedHandler) ExportAllVisits(c *gin.Context) {
+	h.exportVisits(c, "")
+}
+
+// exportVisits 以 CSV 或 NDJSON 流式输出访问记录
+func (h *EnhancedHandler) exportVisits(c *gin.Context, shortCode string) {
+	format := c.DefaultQuery("format", "csv")
+	if format != "csv" && format != "ndjson" {
+		c.JSON(http.StatusBadRequest, model.ErrorResponse{Error: "format must be csv or ndjson"})
+		return
+	}
+
+	loc, err := h.parseTimezoneParam(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, model.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	since, until, err := h.parseTimeRangeParams(c, loc)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, model.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	// 响应头发出后无法再返回错误状态，先确认短链接存在
+	filename := "visits"
+	if shortCode != "" {
+		if _, err := h.service.GetLink(c.GetUint("workspace_id"), shortCode); err != nil {
+			h.handleURLError(c, err)
+			return
+		}
+		filename += "-" + shortCode
+	}
+	filename += "." + format
+
+	contentType := "text/csv; charset=utf-8"
+	if format == "ndjson" {
+		contentType = "application/x-ndjson"
+	}
+	c.Header("Content-Type", contentType)
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, filename))
+	c.Header("Cache-Control", "no-store")
+	c.Status(http.StatusOK)
+
+	var write func(*model.VisitRecord) error
+	var flush func() error
+	if format == "csv" {
+		w := csv.NewWriter(c.Writer)
+		if err := w.Write(visitExportColumns); err != nil {
+			return
+		}
+		write = func(visit *model.VisitRecord) error {
+			return w.Write(visitExportRow(visit))
+		}
+		flush = func() error {
+			w.Flush()
+			return w.Error()
+		}
+	} else {
+		enc := json.NewEncoder(c.Writer)
+		write = func(visit *model.VisitRecord) error {
+			return enc.Encode(visit)
+		}
+		flush = func() error { return nil }
+	}
+
+	written := 0
+	err = h.service.ExportVisits(c.GetUint("workspace_id"), shortCode, since, until, func(visit *model.VisitRecord) error {
+		visit.VisitedAt = visit.VisitedAt.In(loc)
+		if err := write(visit); err != nil {
+			return err
+		}
+		written++
+		if written%exportFlushInterval == 0 {
+			if err := flush(); err != nil {
+				return err
+			}
+			c.Writer.Flush()
+		}
+		return nil
+	})
+	if err == nil {
+		err = flush()
+	}
+	c.Writer.Flush()
+
+	// 响应头已发送，出错时只能记录日志并中断输出
+	if err != nil {
+		log.Printf("Visit export interrupted after %d rows: %v", written, err)
+	}
+}
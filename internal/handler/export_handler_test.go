@@ -0,0 +1,56 @@
+package handler
+
+import (
+	"testing"
+	"time"
+
+	"url-shortener/internal/model"
+)
+
+func TestEscapeCSVFormula(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"", ""},
+		{"Mozilla/5.0", "Mozilla/5.0"},
+		{"=HYPERLINK(\"https://evil.example\")", "'=HYPERLINK(\"https://evil.example\")"},
+		{"+1", "'+1"},
+		{"-2+3", "'-2+3"},
+		{"@SUM(A1)", "'@SUM(A1)"},
+		{"\t=1", "'\t=1"},
+		{"\r=1", "'\r=1"},
+		{"a=1", "a=1"},
+	}
+	for _, tt := range tests {
+		if got := escapeCSVFormula(tt.in); got != tt.want {
+			t.Errorf("escapeCSVFormula(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestVisitExportRowEscapesFormulas(t *testing.T) {
+	visit := &model.VisitRecord{
+		ID:        1,
+		ShortCode: "abc",
+		VisitedAt: time.Date(2026, 5, 1, 12, 0, 0, 0, time.UTC),
+		UserAgent: "=cmd|' /C calc'!A0",
+		Referer:   "https://example.com/",
+		UTMSource: "-newsletter",
+	}
+	row := visitExportRow(visit)
+	if len(row) != len(visitExportColumns) {
+		t.Fatalf("row has %d cells, want %d", len(row), len(visitExportColumns))
+	}
+	want := map[string]string{
+		"id":         "1",
+		"visited_at": "2026-05-01T12:00:00Z",
+		"user_agent": "'=cmd|' /C calc'!A0",
+		"referer":    "https://example.com/",
+		"utm_source": "'-newsletter",
+	}
+	for i, column := range visitExportColumns {
+		if w, ok := want[column]; ok && row[i] != w {
+			t.Errorf("%s = %q, want %q", column, row[i], w)
+		}
+	}
+}
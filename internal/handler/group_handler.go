@@ -0,0 +1,69 @@
+package handler
+
+import (
+	"net/http"
+
+	"url-shortener/internal/model"
+	"url-shortener/internal/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// SetURLGroup 设置短链接的分组
+// PUT /api/urls/:code/group {"group": "spring-sale"}，group 为空时移出分组
+func (h *EnhancedHandler) SetURLGroup(c *gin.Context) {
+	var req model.SetGroupRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, model.ErrorResponse{
+			Error: utils.ValidateAndFormatError(err),
+		})
+		return
+	}
+
+	if err := h.service.SetGroup(c.GetUint("workspace_id"), c.Param("code"), req.Group); err != nil {
+		h.handleURLError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Group updated successfully"})
+}
+
+// ListGroups 列出所有分组及其短链接数量
+// GET /api/groups
+func (h *EnhancedHandler) ListGroups(c *gin.Context) {
+	groups, err := h.service.ListGroups(c.GetUint("workspace_id"))
+	if err != nil {
+		h.handleServiceError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, groups)
+}
+
+// GetGroupAnalytics 获取分组内所有短链接的汇总分析数据
+// GET /api/groups/:group/analytics?since=2026-01-01&until=2026-01-31&tz=Asia/Shanghai
+func (h *EnhancedHandler) GetGroupAnalytics(c *gin.Context) {
+	loc, err := h.parseTimezoneParam(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, model.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	since, until, err := h.parseTimeRangeParams(c, loc)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, model.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	analytics, err := h.service.GetGroupAnalytics(c.GetUint("workspace_id"), c.Param("group"), since, until, loc)
+	if err != nil {
+		h.handleServiceError(c, err)
+		return
+	}
+	if len(analytics.Links) == 0 {
+		c.JSON(http.StatusNotFound, model.ErrorResponse{Error: "Group not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, analytics)
+}
@@ -26,7 +26,7 @@ func (h *Handler) CreateShortURL(c *gin.Context) {
 		return
 	}
 
-	resp, err := h.service.CreateShortURL(req.URL, req.CustomCode, req.ExpireIn)
+	resp, err := h.service.CreateShortURL(c.GetUint("workspace_id"), req.URL, req.CustomCode, req.ExpireIn)
 	if err != nil {
 		if err == utils.ErrCustomCodeExists || err == utils.ErrInvalidCustomCode {
 			c.JSON(http.StatusBadRequest, model.ErrorResponse{Error: err.Error()})
@@ -61,7 +61,7 @@ func (h *Handler) Redirect(c *gin.Context) {
 func (h *Handler) GetStats(c *gin.Context) {
 	shortCode := c.Param("code")
 
-	stats, err := h.service.GetStats(shortCode)
+	stats, err := h.service.GetStats(c.GetUint("workspace_id"), shortCode)
 	if err != nil {
 		if err == utils.ErrURLNotFound {
 			c.JSON(http.StatusNotFound, model.ErrorResponse{Error: "URL not found"})
@@ -75,7 +75,7 @@ func (h *Handler) GetStats(c *gin.Context) {
 }
 
 func (h *Handler) ListURLs(c *gin.Context) {
-	urls, err := h.service.GetAllURLs()
+	urls, err := h.service.GetAllURLs(c.GetUint("workspace_id"))
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, model.ErrorResponse{Error: err.Error()})
 		return
@@ -87,7 +87,7 @@ func (h *Handler) ListURLs(c *gin.Context) {
 func (h *Handler) DeleteURL(c *gin.Context) {
 	shortCode := c.Param("code")
 
-	err := h.service.DeleteShortCode(shortCode)
+	err := h.service.DeleteShortCode(c.GetUint("workspace_id"), shortCode)
 	if err != nil {
 		if err == utils.ErrURLNotFound {
 			c.JSON(http.StatusNotFound, model.ErrorResponse{Error: "URL not found"})
@@ -106,7 +106,7 @@ func (h *Handler) HealthCheck(c *gin.Context) {
 
 // CleanupExpiredURLs 清理过期链接的API
 func (h *Handler) CleanupExpiredURLs(c *gin.Context) {
-	err := h.service.CleanupExpiredURLs()
+	err := h.service.CleanupExpiredURLs(c.GetUint("workspace_id"))
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, model.ErrorResponse{Error: "Failed to cleanup expired URLs"})
 		return
@@ -0,0 +1,92 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"url-shortener/internal/model"
+	"url-shortener/internal/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// StreamLiveVisits 以 Server-Sent Events 推送单个短链接的实时访问
+// GET /api/analytics/:code/live
+func (h *EnhancedHandler) StreamLiveVisits(c *gin.Context) {
+	h.streamLiveVisits(c, c.Param("code"))
+}
+
+// StreamAllLiveVisits 以 Server-Sent Events 推送所有短链接的实时访问
+// GET /api/analytics/live
+func (h *EnhancedHandler) StreamAllLiveVisits(c *gin.Context) {
+	h.streamLiveVisits(c, "")
+}
+
+// streamLiveVisits 推送访问事件（event: visit），定期发送心跳注释，
+// 缓冲区溢出时通过 event: dropped 告知客户端丢弃的事件数
+func (h *EnhancedHandler) streamLiveVisits(c *gin.Context, shortCode string) {
+	// 未知或其他工作区的短码永远不会收到事件，直接返回 404
+	if shortCode != "" {
+		if _, err := h.service.GetLink(c.GetUint("workspace_id"), shortCode); err != nil {
+			h.handleURLError(c, err)
+			return
+		}
+	}
+
+	sub, err := h.service.SubscribeVisits(c.GetUint("workspace_id"), shortCode)
+	if err != nil {
+		switch {
+		case errors.Is(err, utils.ErrRateLimitExceeded):
+			c.JSON(http.StatusTooManyRequests, model.ErrorResponse{Error: err.Error()})
+		case errors.Is(err, utils.ErrTooManySubscribers), errors.Is(err, utils.ErrServiceUnavailable):
+			c.JSON(http.StatusServiceUnavailable, model.ErrorResponse{Error: err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, model.ErrorResponse{Error: err.Error()})
+		}
+		return
+	}
+	defer sub.Close()
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no") // 禁用 Nginx 代理缓冲
+	c.Status(http.StatusOK)
+	fmt.Fprint(c.Writer, "retry: 3000\n\n")
+	c.Writer.Flush()
+
+	heartbeat := time.NewTicker(sub.HeartbeatInterval())
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-c.Request.Context().Done():
+			return
+
+		case visit, ok := <-sub.Events():
+			if !ok {
+				return
+			}
+			if dropped := sub.TakeDropped(); dropped > 0 {
+				fmt.Fprintf(c.Writer, "event: dropped\ndata: {\"count\":%d}\n\n", dropped)
+			}
+			data, err := json.Marshal(visit)
+			if err != nil {
+				continue
+			}
+			if _, err := fmt.Fprintf(c.Writer, "id: %d\nevent: visit\ndata: %s\n\n", visit.ID, data); err != nil {
+				return
+			}
+			c.Writer.Flush()
+
+		case <-heartbeat.C:
+			if _, err := fmt.Fprintf(c.Writer, ": heartbeat %d\n\n", time.Now().Unix()); err != nil {
+				return
+			}
+			c.Writer.Flush()
+		}
+	}
+}
@@ -0,0 +1,140 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"url-shortener/internal/model"
+	"url-shortener/internal/service"
+	"url-shortener/internal/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ReportHandler 报告订阅的 HTTP 处理器，订阅归属于请求所用的 API Key
+type ReportHandler struct {
+	service *service.ReportService
+}
+
+// NewReportHandler 创建报告订阅处理器
+func NewReportHandler(service *service.ReportService) *ReportHandler {
+	return &ReportHandler{service: service}
+}
+
+// CreateSubscription 创建报告订阅
+// POST /api/reports {"name": "weekly", "schedule": "weekly", "short_codes": ["abc123"], "webhook_url": "https://example.com/hook", "timezone": "Asia/Shanghai"}
+func (h *ReportHandler) CreateSubscription(c *gin.Context) {
+	var req model.CreateReportSubscriptionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, model.ErrorResponse{
+			Error: utils.ValidateAndFormatError(err),
+		})
+		return
+	}
+
+	sub, err := h.service.CreateSubscription(c.GetUint("workspace_id"), c.GetUint("api_key_id"), &req, time.Now())
+	if err != nil {
+		h.handleError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, sub)
+}
+
+// ListSubscriptions 列出当前 API Key 的报告订阅
+// GET /api/reports
+func (h *ReportHandler) ListSubscriptions(c *gin.Context) {
+	subs, err := h.service.ListSubscriptions(c.GetUint("workspace_id"), c.GetUint("api_key_id"))
+	if err != nil {
+		h.handleError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, subs)
+}
+
+// GetSubscription 获取报告订阅
+// GET /api/reports/:id
+func (h *ReportHandler) GetSubscription(c *gin.Context) {
+	id, ok := h.parseID(c)
+	if !ok {
+		return
+	}
+
+	sub, err := h.service.GetSubscription(c.GetUint("workspace_id"), c.GetUint("api_key_id"), id)
+	if err != nil {
+		h.handleError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, sub)
+}
+
+// DeleteSubscription 删除报告订阅及其投递记录
+// DELETE /api/reports/:id
+func (h *ReportHandler) DeleteSubscription(c *gin.Context) {
+	id, ok := h.parseID(c)
+	if !ok {
+		return
+	}
+
+	if err := h.service.DeleteSubscription(c.GetUint("workspace_id"), c.GetUint("api_key_id"), id); err != nil {
+		h.handleError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Report subscription deleted successfully"})
+}
+
+// ListDeliveries 列出报告订阅最近的投递记录
+// GET /api/reports/:id/deliveries?limit=20
+func (h *ReportHandler) ListDeliveries(c *gin.Context) {
+	id, ok := h.parseID(c)
+	if !ok {
+		return
+	}
+
+	limit := 20
+	if raw := c.Query("limit"); raw != "" {
+		parsed, err := strconv.Atoi(raw)
+		if err != nil || parsed < 1 || parsed > 100 {
+			c.JSON(http.StatusBadRequest, model.ErrorResponse{Error: "limit must be between 1 and 100"})
+			return
+		}
+		limit = parsed
+	}
+
+	deliveries, err := h.service.ListDeliveries(c.GetUint("workspace_id"), c.GetUint("api_key_id"), id, limit)
+	if err != nil {
+		h.handleError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, deliveries)
+}
+
+// 辅助方法：解析路径中的订阅 ID
+func (h *ReportHandler) parseID(c *gin.Context) (uint, bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil || id == 0 {
+		c.JSON(http.StatusBadRequest, model.ErrorResponse{Error: "invalid report subscription id"})
+		return 0, false
+	}
+	return uint(id), true
+}
+
+// 辅助方法：处理报告相关错误
+func (h *ReportHandler) handleError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, utils.ErrReportNotFound):
+		c.JSON(http.StatusNotFound, model.ErrorResponse{Error: "Report subscription not found"})
+	case errors.Is(err, utils.ErrURLNotFound):
+		c.JSON(http.StatusBadRequest, model.ErrorResponse{Error: "short_codes contains a link that does not exist"})
+	case errors.Is(err, utils.ErrInvalidInput):
+		c.JSON(http.StatusBadRequest, model.ErrorResponse{Error: err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, model.ErrorResponse{Error: err.Error()})
+	}
+}
@@ -0,0 +1,171 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"url-shortener/internal/model"
+	"url-shortener/internal/service"
+	"url-shortener/internal/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// WorkspaceHandler 工作区及成员管理的 HTTP 处理器，操作对象为请求凭据所在的工作区
+type WorkspaceHandler struct {
+	service *service.WorkspaceService
+}
+
+// NewWorkspaceHandler 创建工作区处理器
+func NewWorkspaceHandler(service *service.WorkspaceService) *WorkspaceHandler {
+	return &WorkspaceHandler{service: service}
+}
+
+// principal 返回认证中间件保存的请求身份，匿名请求返回 nil
+func principal(c *gin.Context) *service.Principal {
+	if p, exists := c.Get("principal"); exists {
+		return p.(*service.Principal)
+	}
+	return nil
+}
+
+// GetCurrent 获取当前工作区及调用方在其中的角色
+// GET /api/workspace
+func (h *WorkspaceHandler) GetCurrent(c *gin.Context) {
+	p := principal(c)
+	workspace, err := h.service.GetWorkspace(p)
+	if err != nil {
+		h.handleError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data": gin.H{
+			"workspace": workspace,
+			"user_id":   p.UserID,
+			"role":      p.Role,
+			"scopes":    p.Scopes,
+		},
+	})
+}
+
+// ListWorkspaces 列出调用方可以访问的工作区
+// GET /api/workspaces
+func (h *WorkspaceHandler) ListWorkspaces(c *gin.Context) {
+	workspaces, err := h.service.ListWorkspaces(principal(c))
+	if err != nil {
+		h.handleError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": workspaces})
+}
+
+// CreateWorkspace 创建工作区，调用方成为所有者，需使用属于用户的 Key
+// POST /api/workspaces {"name": "marketing"}
+func (h *WorkspaceHandler) CreateWorkspace(c *gin.Context) {
+	var req model.CreateWorkspaceRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Invalid request: "+err.Error())
+		return
+	}
+
+	workspace, err := h.service.CreateWorkspace(principal(c), &req)
+	if err != nil {
+		h.handleError(c, err)
+		return
+	}
+	c.JSON(http.StatusCreated, gin.H{"data": workspace})
+}
+
+// ListMembers 列出当前工作区的成员
+// GET /api/workspace/members
+func (h *WorkspaceHandler) ListMembers(c *gin.Context) {
+	members, err := h.service.ListMembers(principal(c))
+	if err != nil {
+		h.handleError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": members})
+}
+
+// AddMember 将用户加入当前工作区，邮箱对应的用户不存在时创建
+// POST /api/workspace/members {"email": "alice@example.com", "role": "member"}
+func (h *WorkspaceHandler) AddMember(c *gin.Context) {
+	var req model.AddMemberRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Invalid request: "+err.Error())
+		return
+	}
+
+	member, err := h.service.AddMember(principal(c), &req)
+	if err != nil {
+		h.handleError(c, err)
+		return
+	}
+	c.JSON(http.StatusCreated, gin.H{"data": member})
+}
+
+// UpdateMember 修改成员角色
+// PATCH /api/workspace/members/:user_id {"role": "viewer"}
+func (h *WorkspaceHandler) UpdateMember(c *gin.Context) {
+	userID, ok := h.parseUserID(c)
+	if !ok {
+		return
+	}
+
+	var req model.UpdateMemberRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Invalid request: "+err.Error())
+		return
+	}
+
+	if err := h.service.UpdateMember(principal(c), userID, &req); err != nil {
+		h.handleError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Member role updated successfully"})
+}
+
+// RemoveMember 将成员移出当前工作区，其名下的 API Key 随之失效
+// DELETE /api/workspace/members/:user_id
+func (h *WorkspaceHandler) RemoveMember(c *gin.Context) {
+	userID, ok := h.parseUserID(c)
+	if !ok {
+		return
+	}
+
+	if err := h.service.RemoveMember(principal(c), userID); err != nil {
+		h.handleError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Member removed successfully"})
+}
+
+// 辅助方法：解析路径中的用户 ID
+func (h *WorkspaceHandler) parseUserID(c *gin.Context) (uint, bool) {
+	id, err := strconv.ParseUint(c.Param("user_id"), 10, 64)
+	if err != nil || id == 0 {
+		utils.ErrorResponse(c, http.StatusBadRequest, "invalid user id")
+		return 0, false
+	}
+	return uint(id), true
+}
+
+// 辅助方法：处理工作区相关错误
+func (h *WorkspaceHandler) handleError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, utils.ErrForbidden):
+		utils.ErrorResponseWithCode(c, http.StatusForbidden, utils.ErrForbidden.Code, err.Error())
+	case errors.Is(err, utils.ErrWorkspaceNotFound):
+		utils.ErrorResponseWithCode(c, http.StatusNotFound, utils.ErrWorkspaceNotFound.Code, "Workspace not found")
+	case errors.Is(err, utils.ErrMemberNotFound):
+		utils.ErrorResponseWithCode(c, http.StatusNotFound, utils.ErrMemberNotFound.Code, "User is not a member of this workspace")
+	case errors.Is(err, utils.ErrAlreadyExists):
+		utils.ErrorResponseWithCode(c, http.StatusConflict, utils.ErrAlreadyExists.Code, "User is already a member of this workspace")
+	case errors.Is(err, utils.ErrLastOwner):
+		utils.ErrorResponseWithCode(c, http.StatusConflict, utils.ErrLastOwner.Code, "A workspace must keep at least one owner")
+	default:
+		utils.ErrorResponse(c, http.StatusInternalServerError, err.Error())
+	}
+}
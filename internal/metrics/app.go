@@ -0,0 +1,100 @@
+package metrics
+
+import (
+	"crypto/subtle"
+	"database/sql"
+	"net/http"
+	"strings"
+)
+
+// Default 服务默认使用的注册表
+var Default = NewRegistry()
+
+// 服务指标，各模块直接引用
+var (
+	HTTPRequests = Default.NewCounterVec("http_requests_total",
+		"HTTP requests by route, method and status code.", "route", "method", "status")
+	HTTPRequestDuration = Default.NewHistogramVec("http_request_duration_seconds",
+		"HTTP request latency by route, method and status code.", nil, "route", "method", "status")
+
+	Redirects = Default.NewCounterVec("redirects_total",
+		"Short link redirects by outcome (hit, not_found, expired, error).", "outcome")
+	ShortCodeRetries = Default.NewCounter("shortcode_generation_retries_total",
+		"Extra attempts made when a generated short code collided or random generation failed.")
+	ShortCodeFailures = Default.NewCounter("shortcode_generation_failures_total",
+		"Short code generations that gave up after the maximum number of attempts.")
+
+	VisitQueueDropped = Default.NewCounter("visit_queue_dropped_total",
+		"Visit records dropped because the recording queue was full or closed.")
+
+	RateLimitRejections = Default.NewCounter("rate_limit_rejections_total",
+		"Requests rejected by the rate limiter.")
+	APIKeyIPDenials = Default.NewCounter("api_key_ip_denials_total",
+		"Requests with a valid API key rejected because the client IP is not in the key's allowlist.")
+
+	// 缓存命中/未命中，由各缓存按名称注册取值函数
+	CacheHits = Default.NewCounterFuncVec("cache_hits_total",
+		"Cache lookups that found a live entry.", "cache")
+	CacheMisses = Default.NewCounterFuncVec("cache_misses_total",
+		"Cache lookups that found no entry or an expired one.", "cache")
+)
+
+func init() {
+	// 预先创建各跳转结果，未发生过的结果也输出 0
+	for _, outcome := range []string{"hit", "not_found", "expired", "error"} {
+		Redirects.With(outcome)
+	}
+}
+
+// CacheStats 可统计命中情况的缓存
+type CacheStats interface {
+	Stats() (hits, misses uint64)
+}
+
+// RegisterCache 以 name 为标签输出缓存的命中与未命中次数，命中率可由两者计算
+func RegisterCache(name string, c CacheStats) {
+	CacheHits.Set(func() float64 {
+		hits, _ := c.Stats()
+		return float64(hits)
+	}, name)
+	CacheMisses.Set(func() float64 {
+		_, misses := c.Stats()
+		return float64(misses)
+	}, name)
+}
+
+// RegisterDBStats 输出数据库连接池状态
+func RegisterDBStats(r *Registry, db *sql.DB) {
+	r.NewGaugeFunc("db_pool_max_open_connections", "Maximum number of open database connections.",
+		func() float64 { return float64(db.Stats().MaxOpenConnections) })
+	r.NewGaugeFunc("db_pool_open_connections", "Established database connections, in use and idle.",
+		func() float64 { return float64(db.Stats().OpenConnections) })
+	r.NewGaugeFunc("db_pool_in_use_connections", "Database connections currently in use.",
+		func() float64 { return float64(db.Stats().InUse) })
+	r.NewGaugeFunc("db_pool_idle_connections", "Idle database connections.",
+		func() float64 { return float64(db.Stats().Idle) })
+	r.NewCounterFunc("db_pool_wait_count_total", "Total number of times a caller waited for a database connection.",
+		func() float64 { return float64(db.Stats().WaitCount) })
+	r.NewCounterFunc("db_pool_wait_duration_seconds_total", "Total time spent waiting for a database connection.",
+		func() float64 { return db.Stats().WaitDuration.Seconds() })
+}
+
+// Handler 输出注册表内容的 HTTP 处理器，token 非空时要求 Authorization: Bearer <token>
+func Handler(r *Registry, token string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if token != "" {
+			provided, ok := strings.CutPrefix(req.Header.Get("Authorization"), "Bearer ")
+			if !ok || subtle.ConstantTimeCompare([]byte(provided), []byte(token)) != 1 {
+				w.Header().Set("WWW-Authenticate", `Bearer realm="metrics"`)
+				http.Error(w, "unauthorized", http.StatusUnauthorized)
+				return
+			}
+		}
+
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		if err := r.WriteText(w); err != nil {
+			// 输出已经开始，无法再改写状态码
+			return
+		}
+	})
+}
@@ -0,0 +1,203 @@
+// Package metrics 提供一个精简的指标注册表，以 Prometheus 文本格式输出
+// 只实现本服务用到的计数器、仪表盘和直方图，避免引入 Prometheus 客户端依赖
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Registry 指标注册表，按注册顺序输出
+type Registry struct {
+	mu         sync.RWMutex
+	collectors []collector
+	names      map[string]struct{}
+}
+
+// collector 单个指标族
+type collector interface {
+	describe() (name, help, kind string)
+	labelNames() []string
+	write(w io.Writer, name string) error
+}
+
+// NewRegistry 创建指标注册表
+func NewRegistry() *Registry {
+	return &Registry{names: make(map[string]struct{})}
+}
+
+var (
+	metricNameRE = regexp.MustCompile(`^[a-zA-Z_:][a-zA-Z0-9_:]*$`)
+	labelNameRE  = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+)
+
+// register 注册指标族，重名或名称不合法属于编程错误，直接 panic
+func (r *Registry) register(c collector) {
+	name, _, kind := c.describe()
+	if !metricNameRE.MatchString(name) {
+		panic(fmt.Sprintf("metrics: invalid metric name %q", name))
+	}
+	for _, label := range c.labelNames() {
+		// __ 开头的标签名由 Prometheus 保留，le 是直方图分桶的标签
+		if !labelNameRE.MatchString(label) || strings.HasPrefix(label, "__") || (kind == "histogram" && label == "le") {
+			panic(fmt.Sprintf("metrics: invalid label name %q for %s", label, name))
+		}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, exists := r.names[name]; exists {
+		panic(fmt.Sprintf("metrics: duplicate metric %q", name))
+	}
+	r.names[name] = struct{}{}
+	r.collectors = append(r.collectors, c)
+}
+
+// WriteText 以 Prometheus 文本格式（0.0.4）输出所有指标
+func (r *Registry) WriteText(w io.Writer) error {
+	r.mu.RLock()
+	collectors := append([]collector(nil), r.collectors...)
+	r.mu.RUnlock()
+
+	for _, c := range collectors {
+		name, help, kind := c.describe()
+		if _, err := fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, escapeHelp(help), name, kind); err != nil {
+			return err
+		}
+		if err := c.write(w, name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// desc 指标族的公共描述
+type desc struct {
+	name   string
+	help   string
+	labels []string
+}
+
+func (d *desc) labelNames() []string { return d.labels }
+
+// key 将标签值拼接为子指标的索引
+func (d *desc) key(values []string) string {
+	if len(values) != len(d.labels) {
+		panic(fmt.Sprintf("metrics: %s expects %d label values, got %d", d.name, len(d.labels), len(values)))
+	}
+	return strings.Join(values, "\xff")
+}
+
+// labelString 生成 {a="x",b="y"} 形式的标签串，extra 用于直方图的 le 标签
+func (d *desc) labelString(values []string, extra ...string) string {
+	if len(d.labels) == 0 && len(extra) == 0 {
+		return ""
+	}
+	var b strings.Builder
+	b.WriteByte('{')
+	for i, label := range d.labels {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(label)
+		b.WriteString(`="`)
+		b.WriteString(escapeLabel(values[i]))
+		b.WriteByte('"')
+	}
+	for i := 0; i+1 < len(extra); i += 2 {
+		if b.Len() > 1 {
+			b.WriteByte(',')
+		}
+		b.WriteString(extra[i])
+		b.WriteString(`="`)
+		b.WriteString(escapeLabel(extra[i+1]))
+		b.WriteByte('"')
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+// series 带标签的子指标集合，按标签值排序输出保证结果稳定
+type series[T any] struct {
+	mu     sync.RWMutex
+	values map[string]*T
+	labels map[string][]string
+}
+
+func newSeries[T any]() series[T] {
+	return series[T]{values: make(map[string]*T), labels: make(map[string][]string)}
+}
+
+// get 获取或创建子指标
+func (s *series[T]) get(key string, labelValues []string, create func() *T) *T {
+	s.mu.RLock()
+	v, ok := s.values[key]
+	s.mu.RUnlock()
+	if ok {
+		return v
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if v, ok = s.values[key]; ok {
+		return v
+	}
+	v = create()
+	s.values[key] = v
+	s.labels[key] = append([]string(nil), labelValues...)
+	return v
+}
+
+// each 按标签值顺序遍历子指标
+func (s *series[T]) each(fn func(labelValues []string, v *T) error) error {
+	s.mu.RLock()
+	keys := make([]string, 0, len(s.values))
+	for k := range s.values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	type entry struct {
+		labels []string
+		value  *T
+	}
+	entries := make([]entry, len(keys))
+	for i, k := range keys {
+		entries[i] = entry{s.labels[k], s.values[k]}
+	}
+	s.mu.RUnlock()
+
+	for _, e := range entries {
+		if err := fn(e.labels, e.value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// formatFloat 按 Prometheus 约定格式化数值
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+var (
+	helpEscaper  = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+	labelEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+)
+
+// 文本格式要求 UTF-8，标签值中的无效字节替换为 U+FFFD
+func escapeHelp(s string) string  { return helpEscaper.Replace(s) }
+func escapeLabel(s string) string { return labelEscaper.Replace(strings.ToValidUTF8(s, "\uFFFD")) }
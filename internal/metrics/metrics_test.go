@@ -0,0 +1,206 @@
+package metrics
+
+import (
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+// sampleLineRE 文本格式（0.0.4）中一行样本的语法：指标名、可选的标签串和数值
+var sampleLineRE = regexp.MustCompile(
+	`^[a-zA-Z_:][a-zA-Z0-9_:]*` +
+		`(\{[a-zA-Z_][a-zA-Z0-9_]*="(?:[^"\\\n]|\\[\\"n])*"(?:,[a-zA-Z_][a-zA-Z0-9_]*="(?:[^"\\\n]|\\[\\"n])*")*\})?` +
+		` (?:[+-]?Inf|NaN|[+-]?[0-9.]+(?:e[+-]?[0-9]+)?)$`)
+
+// checkExposition 检查输出的每一行都符合文本格式，且每个指标族先输出 HELP 和 TYPE
+func checkExposition(t *testing.T, text string) {
+	t.Helper()
+
+	if !strings.HasSuffix(text, "\n") {
+		t.Errorf("output does not end with a newline")
+	}
+	typed := map[string]string{}
+	var current string
+	for i, line := range strings.Split(strings.TrimSuffix(text, "\n"), "\n") {
+		switch {
+		case strings.HasPrefix(line, "# HELP "):
+			fields := strings.SplitN(line, " ", 4)
+			if len(fields) < 3 {
+				t.Errorf("line %d: malformed HELP: %q", i+1, line)
+				continue
+			}
+			current = fields[2]
+		case strings.HasPrefix(line, "# TYPE "):
+			fields := strings.Split(line, " ")
+			if len(fields) != 4 || fields[2] != current {
+				t.Errorf("line %d: TYPE does not follow HELP of the same metric: %q", i+1, line)
+				continue
+			}
+			if _, dup := typed[current]; dup {
+				t.Errorf("line %d: metric %s described twice", i+1, current)
+			}
+			typed[current] = fields[3]
+		default:
+			if !sampleLineRE.MatchString(line) {
+				t.Errorf("line %d: invalid sample line: %q", i+1, line)
+				continue
+			}
+			name := line[:strings.IndexAny(line, "{ ")]
+			if typed[current] == "histogram" {
+				name = strings.TrimSuffix(strings.TrimSuffix(strings.TrimSuffix(name, "_bucket"), "_sum"), "_count")
+			}
+			if name != current {
+				t.Errorf("line %d: sample of %s under metric %s", i+1, name, current)
+			}
+		}
+	}
+}
+
+func writeText(t *testing.T, r *Registry) string {
+	t.Helper()
+
+	var b strings.Builder
+	if err := r.WriteText(&b); err != nil {
+		t.Fatalf("WriteText: %v", err)
+	}
+	checkExposition(t, b.String())
+	return b.String()
+}
+
+func TestWriteText(t *testing.T) {
+	r := NewRegistry()
+	requests := r.NewCounterVec("requests_total", "Requests by route.", "route", "status")
+	requests.With("/b", "200").Add(2)
+	requests.With("/a", "500").Inc()
+	requests.With("/a", "500").Add(-5) // 计数器不会减少
+	r.NewGaugeVec("queue_length", "Queued items.").With().Set(-1.5)
+	r.NewGaugeFunc("pool_size", "Pool size.", func() float64 { return 4 })
+	hist := r.NewHistogramVec("latency_seconds", "Latency.", []float64{1, 0.1}, "route")
+	hist.With("/a").Observe(0.05)
+	hist.With("/a").Observe(0.1)
+	hist.With("/a").Observe(3)
+
+	want := `# HELP requests_total Requests by route.
+# TYPE requests_total counter
+requests_total{route="/a",status="500"} 1
+requests_total{route="/b",status="200"} 2
+# HELP queue_length Queued items.
+# TYPE queue_length gauge
+queue_length -1.5
+# HELP pool_size Pool size.
+# TYPE pool_size gauge
+pool_size 4
+# HELP latency_seconds Latency.
+# TYPE latency_seconds histogram
+latency_seconds_bucket{route="/a",le="0.1"} 2
+latency_seconds_bucket{route="/a",le="1"} 2
+latency_seconds_bucket{route="/a",le="+Inf"} 3
+latency_seconds_sum{route="/a"} 3.15
+latency_seconds_count{route="/a"} 3
+`
+	if got := writeText(t, r); got != want {
+		t.Errorf("WriteText output:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestWriteTextEscaping(t *testing.T) {
+	r := NewRegistry()
+	r.NewCounterVec("escaped_total", "Help with a \\ backslash\nand a newline.", "value").
+		With("quote \" backslash \\ newline \n invalid \xff end").Inc()
+
+	want := `# HELP escaped_total Help with a \\ backslash\nand a newline.
+# TYPE escaped_total counter
+escaped_total{value="quote \" backslash \\ newline \n invalid ` + "�" + ` end"} 1
+`
+	if got := writeText(t, r); got != want {
+		t.Errorf("WriteText output:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestFormatFloat(t *testing.T) {
+	tests := []struct {
+		in   float64
+		want string
+	}{
+		{0, "0"},
+		{42, "42"},
+		{0.25, "0.25"},
+		{1e21, "1e+21"},
+		{math.Inf(1), "+Inf"},
+		{math.Inf(-1), "-Inf"},
+		{math.NaN(), "NaN"},
+	}
+	for _, tt := range tests {
+		if got := formatFloat(tt.in); got != tt.want {
+			t.Errorf("formatFloat(%v) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestRegisterRejectsInvalidNames(t *testing.T) {
+	tests := []struct {
+		name     string
+		register func(r *Registry)
+	}{
+		{"duplicate", func(r *Registry) { r.NewCounter("dup_total", ""); r.NewGaugeFunc("dup_total", "", nil) }},
+		{"metric name", func(r *Registry) { r.NewCounter("http-requests", "") }},
+		{"metric name digit", func(r *Registry) { r.NewCounter("1xx_total", "") }},
+		{"label name", func(r *Registry) { r.NewCounterVec("ok_total", "", "bad-label") }},
+		{"reserved label", func(r *Registry) { r.NewCounterVec("ok_total", "", "__name__") }},
+		{"histogram le", func(r *Registry) { r.NewHistogramVec("ok_seconds", "", nil, "le") }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			defer func() {
+				if recover() == nil {
+					t.Error("register did not panic")
+				}
+			}()
+			tt.register(NewRegistry())
+		})
+	}
+}
+
+func TestDefaultRegistryExposition(t *testing.T) {
+	HTTPRequests.With("/api/stats/:code", "GET", "200").Inc()
+	HTTPRequestDuration.With("/api/stats/:code", "GET", "200").Observe(0.02)
+	writeText(t, Default)
+}
+
+func TestHandler(t *testing.T) {
+	r := NewRegistry()
+	r.NewCounter("up_total", "Up.").Inc()
+	handler := Handler(r, "secret")
+
+	tests := []struct {
+		auth   string
+		status int
+	}{
+		{"", http.StatusUnauthorized},
+		{"Bearer wrong", http.StatusUnauthorized},
+		{"secret", http.StatusUnauthorized},
+		{"Bearer secret", http.StatusOK},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+		if tt.auth != "" {
+			req.Header.Set("Authorization", tt.auth)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		if rec.Code != tt.status {
+			t.Errorf("Authorization %q: status = %d, want %d", tt.auth, rec.Code, tt.status)
+			continue
+		}
+		if tt.status != http.StatusOK {
+			continue
+		}
+		if ct := rec.Header().Get("Content-Type"); ct != "text/plain; version=0.0.4; charset=utf-8" {
+			t.Errorf("Content-Type = %q", ct)
+		}
+		checkExposition(t, rec.Body.String())
+	}
+}
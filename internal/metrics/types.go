@@ -0,0 +1,272 @@
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"sync"
+	"sync/atomic"
+)
+
+// atomicFloat 支持并发累加的浮点数
+type atomicFloat struct {
+	bits atomic.Uint64
+}
+
+func (f *atomicFloat) add(delta float64) {
+	for {
+		old := f.bits.Load()
+		next := math.Float64bits(math.Float64frombits(old) + delta)
+		if f.bits.CompareAndSwap(old, next) {
+			return
+		}
+	}
+}
+
+func (f *atomicFloat) set(v float64) { f.bits.Store(math.Float64bits(v)) }
+func (f *atomicFloat) load() float64 { return math.Float64frombits(f.bits.Load()) }
+
+// Counter 单调递增的计数器
+type Counter struct {
+	v atomicFloat
+}
+
+// Inc 计数加一
+func (c *Counter) Inc() { c.v.add(1) }
+
+// Add 计数增加 delta，负数会被忽略
+func (c *Counter) Add(delta float64) {
+	if delta > 0 {
+		c.v.add(delta)
+	}
+}
+
+// Value 当前计数
+func (c *Counter) Value() float64 { return c.v.load() }
+
+// CounterVec 带标签的计数器族
+type CounterVec struct {
+	desc
+	series series[Counter]
+}
+
+// NewCounterVec 创建并注册计数器族
+func (r *Registry) NewCounterVec(name, help string, labels ...string) *CounterVec {
+	v := &CounterVec{desc: desc{name: name, help: help, labels: labels}, series: newSeries[Counter]()}
+	r.register(v)
+	return v
+}
+
+// NewCounter 创建并注册不带标签的计数器
+func (r *Registry) NewCounter(name, help string) *Counter {
+	return r.NewCounterVec(name, help).With()
+}
+
+// With 按标签值获取计数器
+func (v *CounterVec) With(labelValues ...string) *Counter {
+	return v.series.get(v.key(labelValues), labelValues, func() *Counter { return &Counter{} })
+}
+
+func (v *CounterVec) describe() (string, string, string) { return v.name, v.help, "counter" }
+
+func (v *CounterVec) write(w io.Writer, name string) error {
+	return v.series.each(func(labelValues []string, c *Counter) error {
+		_, err := fmt.Fprintf(w, "%s%s %s\n", name, v.labelString(labelValues), formatFloat(c.Value()))
+		return err
+	})
+}
+
+// Gauge 可增可减的仪表盘
+type Gauge struct {
+	v atomicFloat
+}
+
+// Set 设置当前值
+func (g *Gauge) Set(v float64) { g.v.set(v) }
+
+// Add 增加 delta，可为负数
+func (g *Gauge) Add(delta float64) { g.v.add(delta) }
+
+// Value 当前值
+func (g *Gauge) Value() float64 { return g.v.load() }
+
+// GaugeVec 带标签的仪表盘族
+type GaugeVec struct {
+	desc
+	series series[Gauge]
+}
+
+// NewGaugeVec 创建并注册仪表盘族
+func (r *Registry) NewGaugeVec(name, help string, labels ...string) *GaugeVec {
+	v := &GaugeVec{desc: desc{name: name, help: help, labels: labels}, series: newSeries[Gauge]()}
+	r.register(v)
+	return v
+}
+
+// With 按标签值获取仪表盘
+func (v *GaugeVec) With(labelValues ...string) *Gauge {
+	return v.series.get(v.key(labelValues), labelValues, func() *Gauge { return &Gauge{} })
+}
+
+func (v *GaugeVec) describe() (string, string, string) { return v.name, v.help, "gauge" }
+
+func (v *GaugeVec) write(w io.Writer, name string) error {
+	return v.series.each(func(labelValues []string, g *Gauge) error {
+		_, err := fmt.Fprintf(w, "%s%s %s\n", name, v.labelString(labelValues), formatFloat(g.Value()))
+		return err
+	})
+}
+
+// funcMetric 采集时才计算取值的指标，用于连接池、队列长度等已有状态
+type funcMetric struct {
+	desc
+	kind string
+	mu   sync.RWMutex
+	fns  map[string]func() float64
+	lbls map[string][]string
+}
+
+// NewGaugeFunc 注册采集时调用 fn 取值的仪表盘
+func (r *Registry) NewGaugeFunc(name, help string, fn func() float64) {
+	m := r.newFuncMetric(name, help, "gauge")
+	m.add(nil, fn)
+}
+
+// NewCounterFunc 注册采集时调用 fn 取值的计数器，fn 必须单调递增
+func (r *Registry) NewCounterFunc(name, help string, fn func() float64) {
+	m := r.newFuncMetric(name, help, "counter")
+	m.add(nil, fn)
+}
+
+// FuncVec 带标签、采集时取值的指标族
+type FuncVec struct {
+	m *funcMetric
+}
+
+// NewGaugeFuncVec 创建并注册采集时取值的仪表盘族
+func (r *Registry) NewGaugeFuncVec(name, help string, labels ...string) *FuncVec {
+	m := r.newFuncMetric(name, help, "gauge", labels...)
+	return &FuncVec{m: m}
+}
+
+// NewCounterFuncVec 创建并注册采集时取值的计数器族
+func (r *Registry) NewCounterFuncVec(name, help string, labels ...string) *FuncVec {
+	m := r.newFuncMetric(name, help, "counter", labels...)
+	return &FuncVec{m: m}
+}
+
+// Set 为一组标签值设置取值函数，重复设置时覆盖
+func (v *FuncVec) Set(fn func() float64, labelValues ...string) {
+	v.m.add(labelValues, fn)
+}
+
+func (r *Registry) newFuncMetric(name, help, kind string, labels ...string) *funcMetric {
+	m := &funcMetric{
+		desc: desc{name: name, help: help, labels: labels},
+		kind: kind,
+		fns:  make(map[string]func() float64),
+		lbls: make(map[string][]string),
+	}
+	r.register(m)
+	return m
+}
+
+func (m *funcMetric) add(labelValues []string, fn func() float64) {
+	key := m.key(labelValues)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.fns[key] = fn
+	m.lbls[key] = append([]string(nil), labelValues...)
+}
+
+func (m *funcMetric) describe() (string, string, string) { return m.name, m.help, m.kind }
+
+func (m *funcMetric) write(w io.Writer, name string) error {
+	m.mu.RLock()
+	keys := make([]string, 0, len(m.fns))
+	for k := range m.fns {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	fns := make([]func() float64, len(keys))
+	lbls := make([][]string, len(keys))
+	for i, k := range keys {
+		fns[i], lbls[i] = m.fns[k], m.lbls[k]
+	}
+	m.mu.RUnlock()
+
+	for i, fn := range fns {
+		if _, err := fmt.Fprintf(w, "%s%s %s\n", name, m.labelString(lbls[i]), formatFloat(fn())); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// DefBuckets 默认的延迟分桶（秒）
+var DefBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// Histogram 累积分桶直方图
+type Histogram struct {
+	upperBounds []float64
+	counts      []atomic.Uint64 // 每个分桶（非累积）的计数，最后一个为 +Inf
+	sum         atomicFloat
+}
+
+// Observe 记录一次观测值
+func (h *Histogram) Observe(v float64) {
+	i := sort.SearchFloat64s(h.upperBounds, v)
+	h.counts[i].Add(1)
+	h.sum.add(v)
+}
+
+// HistogramVec 带标签的直方图族
+type HistogramVec struct {
+	desc
+	buckets []float64
+	series  series[Histogram]
+}
+
+// NewHistogramVec 创建并注册直方图族，buckets 为空时使用 DefBuckets
+func (r *Registry) NewHistogramVec(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	if len(buckets) == 0 {
+		buckets = DefBuckets
+	}
+	buckets = append([]float64(nil), buckets...)
+	sort.Float64s(buckets)
+	v := &HistogramVec{desc: desc{name: name, help: help, labels: labels}, buckets: buckets, series: newSeries[Histogram]()}
+	r.register(v)
+	return v
+}
+
+// With 按标签值获取直方图
+func (v *HistogramVec) With(labelValues ...string) *Histogram {
+	return v.series.get(v.key(labelValues), labelValues, func() *Histogram {
+		return &Histogram{upperBounds: v.buckets, counts: make([]atomic.Uint64, len(v.buckets)+1)}
+	})
+}
+
+func (v *HistogramVec) describe() (string, string, string) { return v.name, v.help, "histogram" }
+
+func (v *HistogramVec) write(w io.Writer, name string) error {
+	return v.series.each(func(labelValues []string, h *Histogram) error {
+		// 总数取各分桶之和，保证与 +Inf 分桶一致
+		var cumulative uint64
+		for i, bound := range v.buckets {
+			cumulative += h.counts[i].Load()
+			if _, err := fmt.Fprintf(w, "%s_bucket%s %d\n", name, v.labelString(labelValues, "le", formatFloat(bound)), cumulative); err != nil {
+				return err
+			}
+		}
+		cumulative += h.counts[len(v.buckets)].Load()
+		if _, err := fmt.Fprintf(w, "%s_bucket%s %d\n", name, v.labelString(labelValues, "le", "+Inf"), cumulative); err != nil {
+			return err
+		}
+		if _, err := fmt.Fprintf(w, "%s_sum%s %s\n", name, v.labelString(labelValues), formatFloat(h.sum.load())); err != nil {
+			return err
+		}
+		_, err := fmt.Fprintf(w, "%s_count%s %d\n", name, v.labelString(labelValues), cumulative)
+		return err
+	})
+}
@@ -1,8 +1,11 @@
 package middleware
 
 import (
+	"errors"
 	"net/http"
+	"strconv"
 	"strings"
+	"time"
 
 	"url-shortener/internal/service"
 	"url-shortener/internal/utils"
@@ -10,49 +13,227 @@ import (
 	"github.com/gin-gonic/gin"
 )
 
-// APIKeyAuthMiddleware validates API keys for protected routes
+// APIKeyAuthMiddleware validates API keys for protected routes and enforces
+// the permission checks of the authorization service. When JWT
+// authentication is configured, bearer tokens that are not sk_ keys are
+// verified as JWTs instead.
 type APIKeyAuthMiddleware struct {
 	service *service.APIKeyService
+	authz   *service.AuthorizationService
+	jwt     *service.JWTAuthenticator // nil when JWT authentication is disabled
+	usage   *service.APIKeyUsageTracker
 }
 
-// NewAPIKeyAuthMiddleware creates a new API key auth middleware
-func NewAPIKeyAuthMiddleware(service *service.APIKeyService) *APIKeyAuthMiddleware {
-	return &APIKeyAuthMiddleware{service: service}
+// NewAPIKeyAuthMiddleware creates a new API key auth middleware. jwt may be nil.
+func NewAPIKeyAuthMiddleware(service *service.APIKeyService, authz *service.AuthorizationService, jwt *service.JWTAuthenticator, usage *service.APIKeyUsageTracker) *APIKeyAuthMiddleware {
+	return &APIKeyAuthMiddleware{service: service, authz: authz, jwt: jwt, usage: usage}
 }
 
 // RequireAPIKey returns a Gin middleware function that requires a valid API key
 func (m *APIKeyAuthMiddleware) RequireAPIKey() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		// Get API key from header
-		authHeader := c.GetHeader("Authorization")
-		if authHeader == "" {
-			utils.ErrorResponse(c, http.StatusUnauthorized, "Authorization header is required")
-			c.Abort()
+		if !m.authenticate(c) {
 			return
 		}
+		c.Next()
+		m.recordUsage(c)
+	}
+}
+
+// OptionalAPIKey returns a Gin middleware function that authenticates the
+// request when an Authorization header is present and lets anonymous requests
+// through. An invalid key is still rejected rather than treated as anonymous.
+func (m *APIKeyAuthMiddleware) OptionalAPIKey() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.GetHeader("Authorization") == "" {
+			c.Next()
+			return
+		}
+		if !m.authenticate(c) {
+			return
+		}
+		c.Next()
+		m.recordUsage(c)
+	}
+}
+
+// recordUsage counts the finished request against the authenticated key.
+// Requests rejected by later middleware (scopes, rate limits) count as errors.
+// Requests authenticated with a JWT are not tracked.
+func (m *APIKeyAuthMiddleware) recordUsage(c *gin.Context) {
+	if c.GetUint("api_key_id") == 0 {
+		return
+	}
+	m.usage.Record(c.GetUint("api_key_id"), utils.ClientIP(c), c.Request.Method, c.FullPath(), c.Writer.Status(), time.Now())
+}
+
+// authenticate validates the bearer key and stores its details in the context.
+// It writes the error response and aborts when the key is missing or invalid.
+func (m *APIKeyAuthMiddleware) authenticate(c *gin.Context) bool {
+	// Get API key from header
+	authHeader := c.GetHeader("Authorization")
+	if authHeader == "" {
+		utils.ErrorResponse(c, http.StatusUnauthorized, "Authorization header is required")
+		c.Abort()
+		return false
+	}
+
+	// Check for Bearer token format
+	parts := strings.SplitN(authHeader, " ", 2)
+	if len(parts) != 2 || !strings.EqualFold(parts[0], "Bearer") {
+		utils.ErrorResponse(c, http.StatusUnauthorized, "Invalid authorization format. Use: Bearer <api_key>")
+		c.Abort()
+		return false
+	}
+
+	apiKey := parts[1]
+	if m.jwt != nil && !strings.HasPrefix(apiKey, "sk_") && service.IsJWT(apiKey) {
+		return m.authenticateJWT(c, apiKey)
+	}
+
+	// Validate the key
+	apikey, err := m.service.ValidateKey(apiKey)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusUnauthorized, "Invalid API key")
+		c.Abort()
+		return false
+	}
+
+	// Keys with an IP allowlist only work from those networks
+	if err := m.service.AuthorizeClientIP(apikey, utils.ClientIP(c), c.Request.Method, c.Request.URL.Path); err != nil {
+		utils.ErrorResponseWithCode(c, http.StatusForbidden, utils.ErrIPNotAllowed.Code, "API key cannot be used from this IP address")
+		c.Abort()
+		return false
+	}
+
+	// Resolve the workspace and role the key acts with. Keys of users who
+	// have left the workspace stop working here.
+	principal, err := m.authz.PrincipalForKey(apikey)
+	if err != nil {
+		if errors.Is(err, utils.ErrForbidden) {
+			utils.ErrorResponseWithCode(c, http.StatusForbidden, utils.ErrForbidden.Code, "API key owner is no longer a member of its workspace")
+		} else {
+			utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to resolve API key permissions: "+err.Error())
+		}
+		c.Abort()
+		return false
+	}
+
+	// Store the key info in context
+	c.Set("principal", principal)
+	c.Set("workspace_id", apikey.WorkspaceID)
+	c.Set("api_key", apiKey)
+	c.Set("api_key_id", apikey.ID)
+	c.Set("api_key_name", apikey.Name)
+	c.Set("api_key_scopes", apikey.Scopes)
+	c.Set("api_key_requests_per_minute", apikey.RequestsPerMinute)
+	c.Set("api_key_monthly_link_quota", apikey.MonthlyLinkQuota)
+
+	// A rotated key still works until its grace period ends; tell the client
+	// (RFC 9745 Deprecation, RFC 8594 Sunset)
+	if apikey.IsDeprecated() {
+		if apikey.RotatedAt != nil {
+			c.Header("Deprecation", "@"+strconv.FormatInt(apikey.RotatedAt.Unix(), 10))
+		}
+		if apikey.ExpiresAt != nil {
+			c.Header("Sunset", apikey.ExpiresAt.UTC().Format(http.TimeFormat))
+		}
+	}
+	return true
+}
 
-		// Check for Bearer token format
-		parts := strings.SplitN(authHeader, " ", 2)
-		if len(parts) != 2 || !strings.EqualFold(parts[0], "Bearer") {
-			utils.ErrorResponse(c, http.StatusUnauthorized, "Invalid authorization format. Use: Bearer <api_key>")
+// authenticateJWT verifies a bearer JWT and stores the principal it maps to.
+// Clients pick the workspace with the X-Workspace-ID header when the token
+// does not name one.
+func (m *APIKeyAuthMiddleware) authenticateJWT(c *gin.Context, token string) bool {
+	var workspaceID uint
+	if header := c.GetHeader("X-Workspace-ID"); header != "" {
+		id, err := strconv.ParseUint(header, 10, 64)
+		if err != nil || id == 0 {
+			utils.ErrorResponse(c, http.StatusBadRequest, "Invalid X-Workspace-ID header")
+			c.Abort()
+			return false
+		}
+		workspaceID = uint(id)
+	}
+
+	principal, err := m.jwt.Authenticate(token, workspaceID, time.Now())
+	if err != nil {
+		switch {
+		case errors.Is(err, utils.ErrUnauthorized):
+			utils.ErrorResponseWithCode(c, http.StatusUnauthorized, utils.ErrUnauthorized.Code, "Invalid token: "+err.Error())
+		case errors.Is(err, utils.ErrForbidden):
+			utils.ErrorResponseWithCode(c, http.StatusForbidden, utils.ErrForbidden.Code, err.Error())
+		case errors.Is(err, utils.ErrInvalidInput):
+			utils.ErrorResponse(c, http.StatusBadRequest, err.Error())
+		default:
+			utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to resolve token permissions: "+err.Error())
+		}
+		c.Abort()
+		return false
+	}
+
+	c.Set("principal", principal)
+	c.Set("workspace_id", principal.WorkspaceID)
+	return true
+}
+
+// RequireScope returns a Gin middleware function that requires the authenticated
+// key to hold every listed scope, and the role of the key's user to grant it.
+// It must run after RequireAPIKey.
+func (m *APIKeyAuthMiddleware) RequireScope(scopes ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		value, exists := c.Get("principal")
+		if !exists {
+			utils.ErrorResponse(c, http.StatusUnauthorized, "Authorization header is required")
 			c.Abort()
 			return
 		}
+		principal := value.(*service.Principal)
+		for _, scope := range scopes {
+			if err := m.authz.Authorize(principal, scope); err != nil {
+				utils.ErrorResponseWithCode(c, http.StatusForbidden, utils.ErrForbidden.Code, err.Error())
+				c.Abort()
+				return
+			}
+		}
+
+		c.Next()
+	}
+}
 
-		apiKey := parts[1]
+// RequireLinkQuota returns a Gin middleware function that rejects link creation
+// once the key has used its monthly link quota. It must run after RequireAPIKey.
+// Concurrent requests near the limit may each pass the check, so the quota can
+// be exceeded by a few links.
+func (m *APIKeyAuthMiddleware) RequireLinkQuota() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		quota := c.GetInt("api_key_monthly_link_quota")
+		if quota <= 0 {
+			c.Next()
+			return
+		}
 
-		// Validate the key
-		apikey, err := m.service.ValidateKey(apiKey)
+		usage, err := m.service.LinkUsage(c.GetUint("api_key_id"), quota, time.Now())
 		if err != nil {
-			utils.ErrorResponse(c, http.StatusUnauthorized, "Invalid API key")
+			utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to check link quota: "+err.Error())
 			c.Abort()
 			return
 		}
 
-		// Store the key info in context
-		c.Set("api_key", apiKey)
-		c.Set("api_key_name", apikey.Name)
+		remaining := *usage.Remaining
+		c.Header("X-Quota-Limit", strconv.Itoa(quota))
+		c.Header("X-Quota-Reset", strconv.FormatInt(usage.PeriodEnd.Unix(), 10))
+		if remaining <= 0 {
+			c.Header("X-Quota-Remaining", "0")
+			utils.ErrorResponseWithCode(c, http.StatusTooManyRequests, utils.ErrQuotaExceeded.Code,
+				"Monthly link quota of "+strconv.Itoa(quota)+" exceeded; it resets at "+usage.PeriodEnd.Format(time.RFC3339))
+			c.Abort()
+			return
+		}
 
+		// Count the link this request is about to create
+		c.Header("X-Quota-Remaining", strconv.FormatInt(remaining-1, 10))
 		c.Next()
 	}
 }
@@ -0,0 +1,15 @@
+package middleware
+
+import (
+	"url-shortener/internal/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ClientIPMiddleware 解析客户端 IP 并存入上下文，后续通过 utils.ClientIP 读取
+func ClientIPMiddleware(resolver *utils.ClientIPResolver) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Set(utils.ClientIPKey, resolver.Resolve(c.Request))
+		c.Next()
+	}
+}
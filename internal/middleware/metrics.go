@@ -0,0 +1,28 @@
+package middleware
+
+import (
+	"strconv"
+	"time"
+
+	"url-shortener/internal/metrics"
+
+	"github.com/gin-gonic/gin"
+)
+
+// MetricsMiddleware 按路由、方法和状态码统计请求数与耗时
+// 路由使用注册时的模板（如 /api/stats/:code），未匹配的请求归入 unmatched，避免标签基数随路径膨胀
+func MetricsMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+		status := strconv.Itoa(c.Writer.Status())
+
+		metrics.HTTPRequests.With(route, c.Request.Method, status).Inc()
+		metrics.HTTPRequestDuration.With(route, c.Request.Method, status).Observe(time.Since(start).Seconds())
+	}
+}
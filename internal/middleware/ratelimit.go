@@ -7,6 +7,8 @@ import (
 	"time"
 
 	"url-shortener/internal/config"
+	"url-shortener/internal/metrics"
+	"url-shortener/internal/utils"
 
 	"github.com/gin-gonic/gin"
 )
@@ -17,11 +19,12 @@ type RateLimiter interface {
 	Reset(key string)
 }
 
-// MemoryRateLimiter 基于内存的限流器
+// MemoryRateLimiter 基于内存的固定窗口限流器
 type MemoryRateLimiter struct {
 	limits map[string]*rateLimit
 	mu     sync.RWMutex
-	config *config.RateLimitConfig
+	limit  int   // 每个窗口允许的请求数
+	window int64 // 窗口长度（秒）
 }
 
 // rateLimit 单个键的限流状态
@@ -30,11 +33,17 @@ type rateLimit struct {
 	windowEnd int64
 }
 
-// NewMemoryRateLimiter 创建新的内存限流器
+// NewMemoryRateLimiter 创建新的内存限流器，按每分钟请求数限流
 func NewMemoryRateLimiter(cfg *config.RateLimitConfig) *MemoryRateLimiter {
+	return NewWindowRateLimiter(cfg.RequestsPerMinute, time.Minute)
+}
+
+// NewWindowRateLimiter 创建每个 window 内最多允许 limit 次请求的内存限流器
+func NewWindowRateLimiter(limit int, window time.Duration) *MemoryRateLimiter {
 	return &MemoryRateLimiter{
 		limits: make(map[string]*rateLimit),
-		config: cfg,
+		limit:  limit,
+		window: int64(window / time.Second),
 	}
 }
 
@@ -44,14 +53,14 @@ func (rl *MemoryRateLimiter) Allow(key string) (bool, int) {
 	defer rl.mu.Unlock()
 
 	now := time.Now().Unix()
-	limit := rl.config.RequestsPerMinute
+	limit := rl.limit
 
 	// 检查或创建限流状态
 	state, exists := rl.limits[key]
 	if !exists {
 		rl.limits[key] = &rateLimit{
 			count:     1,
-			windowEnd: now + 60,
+			windowEnd: now + rl.window,
 		}
 		return true, limit - 1
 	}
@@ -59,7 +68,7 @@ func (rl *MemoryRateLimiter) Allow(key string) (bool, int) {
 	// 如果时间窗口已过，重置计数
 	if now >= state.windowEnd {
 		state.count = 1
-		state.windowEnd = now + 60
+		state.windowEnd = now + rl.window
 		return true, limit - 1
 	}
 
@@ -80,6 +89,16 @@ func (rl *MemoryRateLimiter) Reset(key string) {
 	delete(rl.limits, key)
 }
 
+// retryAfter 返回键所在窗口结束前的秒数
+func (rl *MemoryRateLimiter) retryAfter(key string) int64 {
+	rl.mu.RLock()
+	defer rl.mu.RUnlock()
+	if state, exists := rl.limits[key]; exists {
+		return max(state.windowEnd-time.Now().Unix(), 0)
+	}
+	return rl.window
+}
+
 // Cleanup 清理过期的限流状态
 func (rl *MemoryRateLimiter) Cleanup() {
 	rl.mu.Lock()
@@ -111,7 +130,7 @@ func RateLimitMiddleware(limiter RateLimiter, excludePaths []string) gin.Handler
 		if apiKey != "" {
 			key = "apikey:" + apiKey
 		} else {
-			key = "ip:" + c.ClientIP()
+			key = "ip:" + utils.ClientIP(c)
 		}
 
 		// 检查是否允许请求
@@ -122,6 +141,8 @@ func RateLimitMiddleware(limiter RateLimiter, excludePaths []string) gin.Handler
 		c.Header("X-RateLimit-Remaining", fmt.Sprintf("%d", remaining))
 
 		if !allowed {
+			metrics.RateLimitRejections.Inc()
+
 			// 获取等待时间
 			limiterData, ok := limiter.(*MemoryRateLimiter)
 			if ok {
@@ -171,6 +192,7 @@ func APIKeyRateLimitMiddleware(limiter RateLimiter) gin.HandlerFunc {
 		c.Header("X-RateLimit-Remaining", fmt.Sprintf("%d", remaining))
 
 		if !allowed {
+			metrics.RateLimitRejections.Inc()
 			c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{
 				"error":       "rate limit exceeded",
 				"message":     "API rate limit exceeded for this key",
@@ -182,3 +204,117 @@ func APIKeyRateLimitMiddleware(limiter RateLimiter) gin.HandlerFunc {
 		c.Next()
 	}
 }
+
+// SelfServiceKeyRateLimit 自助创建 API Key 的限流中间件，按客户端 IP 计数
+// 已通过 API Key 或 JWT 认证的请求（管理员创建）不受此限制
+func SelfServiceKeyRateLimit(limiter *MemoryRateLimiter) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if _, authenticated := c.Get("principal"); authenticated {
+			c.Next()
+			return
+		}
+
+		key := "selfservice:" + utils.ClientIP(c)
+		allowed, remaining := limiter.Allow(key)
+		c.Header("X-RateLimit-Limit", fmt.Sprintf("%d", limiter.limit))
+		c.Header("X-RateLimit-Remaining", fmt.Sprintf("%d", remaining))
+
+		if !allowed {
+			metrics.RateLimitRejections.Inc()
+
+			retryAfter := limiter.retryAfter(key)
+			c.Header("Retry-After", fmt.Sprintf("%d", retryAfter))
+
+			c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{
+				"error":       "rate limit exceeded",
+				"message":     "Too many API keys created from this address. Please try again later.",
+				"retry_after": retryAfter,
+			})
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// KeyRateLimiter 按 API Key 各自的每分钟请求数限流
+// 相同限制值的 Key 共用一个 RateLimiter，按 Key ID 分别计数
+type KeyRateLimiter struct {
+	mu         sync.Mutex
+	limiters   map[int]RateLimiter
+	newLimiter func(limit int) RateLimiter
+}
+
+// NewKeyRateLimiter 创建按 API Key 限流的限流器，每种限制值使用一个内存限流器
+func NewKeyRateLimiter() *KeyRateLimiter {
+	return &KeyRateLimiter{
+		limiters: make(map[int]RateLimiter),
+		newLimiter: func(limit int) RateLimiter {
+			return NewWindowRateLimiter(limit, time.Minute)
+		},
+	}
+}
+
+// limiter 返回每分钟 limit 次请求的限流器，不存在时创建
+func (kl *KeyRateLimiter) limiter(limit int) RateLimiter {
+	kl.mu.Lock()
+	defer kl.mu.Unlock()
+	limiter, exists := kl.limiters[limit]
+	if !exists {
+		limiter = kl.newLimiter(limit)
+		kl.limiters[limit] = limiter
+	}
+	return limiter
+}
+
+// Cleanup 清理所有内存限流器中过期的限流状态
+func (kl *KeyRateLimiter) Cleanup() {
+	kl.mu.Lock()
+	limiters := make([]RateLimiter, 0, len(kl.limiters))
+	for _, limiter := range kl.limiters {
+		limiters = append(limiters, limiter)
+	}
+	kl.mu.Unlock()
+
+	for _, limiter := range limiters {
+		if memoryLimiter, ok := limiter.(*MemoryRateLimiter); ok {
+			memoryLimiter.Cleanup()
+		}
+	}
+}
+
+// KeyRateLimitMiddleware 按 API Key 设置的每分钟请求数限流，需在 RequireAPIKey 之后使用
+// 未设置限制的 Key 不受影响；设置了限制时 X-RateLimit-* 响应头反映该 Key 的额度
+func KeyRateLimitMiddleware(kl *KeyRateLimiter) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		limit := c.GetInt("api_key_requests_per_minute")
+		if limit <= 0 {
+			c.Next()
+			return
+		}
+
+		limiter := kl.limiter(limit)
+		key := fmt.Sprintf("key:%d", c.GetUint("api_key_id"))
+		allowed, remaining := limiter.Allow(key)
+
+		c.Set("api_key_requests_remaining", remaining)
+		c.Header("X-RateLimit-Limit", fmt.Sprintf("%d", limit))
+		c.Header("X-RateLimit-Remaining", fmt.Sprintf("%d", remaining))
+
+		if !allowed {
+			metrics.RateLimitRejections.Inc()
+
+			retryAfter := int64(60)
+			if memoryLimiter, ok := limiter.(*MemoryRateLimiter); ok {
+				retryAfter = memoryLimiter.retryAfter(key)
+			}
+			c.Header("Retry-After", fmt.Sprintf("%d", retryAfter))
+			utils.ErrorResponseWithCode(c, http.StatusTooManyRequests, utils.ErrRateLimitExceeded.Code,
+				fmt.Sprintf("API key rate limit of %d requests per minute exceeded; retry in %d seconds", limit, retryAfter))
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
@@ -4,43 +4,142 @@ import "time"
 
 // VisitRecord 存储每次访问的详细信息
 type VisitRecord struct {
-	ID           int64     `json:"id" db:"id"`
-	ShortCode    string    `json:"short_code" db:"short_code"`
-	IPAddress    string    `json:"ip_address" db:"ip_address"`
-	UserAgent    string    `json:"user_agent" db:"user_agent"`
-	Referer      string    `json:"referer" db:"referer"`
-	Country      string    `json:"country,omitempty" db:"country"`
-	City         string    `json:"city,omitempty" db:"city"`
-	UserOS       string    `json:"user_os,omitempty" db:"user_os"`
-	Browser      string    `json:"browser,omitempty" db:"browser"`
-	DeviceType   string    `json:"device_type,omitempty" db:"device_type"`
-	VisitedAt    time.Time `json:"visited_at" db:"visited_at"`
+	ID             int64     `gorm:"primaryKey" json:"id"`
+	ShortCode      string    `gorm:"type:varchar(50);index;not null" json:"short_code"`
+	IPAddress      string    `gorm:"type:varchar(64)" json:"ip_address"`
+	UserAgent      string    `gorm:"type:text" json:"user_agent"`
+	Referer        string    `gorm:"type:text" json:"referer"`
+	ReferrerHost   string    `gorm:"type:varchar(255)" json:"referrer_host,omitempty"`
+	TrafficSource  string    `gorm:"type:varchar(20)" json:"traffic_source,omitempty"` // direct/search/social/email/other
+	Country        string    `gorm:"type:varchar(100)" json:"country,omitempty"`
+	City           string    `gorm:"type:varchar(100)" json:"city,omitempty"`
+	UserOS         string    `gorm:"type:varchar(50)" json:"user_os,omitempty"`
+	OSVersion      string    `gorm:"type:varchar(50)" json:"os_version,omitempty"`
+	Browser        string    `gorm:"type:varchar(50)" json:"browser,omitempty"`
+	BrowserVersion string    `gorm:"type:varchar(50)" json:"browser_version,omitempty"`
+	DeviceType     string    `gorm:"type:varchar(20)" json:"device_type,omitempty"`
+	DeviceModel    string    `gorm:"type:varchar(100)" json:"device_model,omitempty"`
+	UTMSource      string    `gorm:"type:varchar(255)" json:"utm_source,omitempty"`
+	UTMMedium      string    `gorm:"type:varchar(255)" json:"utm_medium,omitempty"`
+	UTMCampaign    string    `gorm:"type:varchar(255)" json:"utm_campaign,omitempty"`
+	UTMTerm        string    `gorm:"type:varchar(255)" json:"utm_term,omitempty"`
+	UTMContent     string    `gorm:"type:varchar(255)" json:"utm_content,omitempty"`
+	VisitedAt      time.Time `gorm:"index;not null" json:"visited_at"`
+}
+
+func (VisitRecord) TableName() string {
+	return "visit_records"
 }
 
 // AnalyticsSummary 统计摘要
 type AnalyticsSummary struct {
-	TotalVisits     int64                    `json:"total_visits"`
-	UniqueVisitors  int64                    `json:"unique_visitors"`
-	TopCountries    map[string]int           `json:"top_countries"`
-	TopDevices      map[string]int           `json:"top_devices"`
-	TopBrowsers     map[string]int           `json:"top_browsers"`
-	TopOS           map[string]int           `json:"top_os"`
-	DailyVisits     map[string]int           `json:"daily_visits"` // YYYY-MM-DD as key
-	HourlyVisits    map[int]int              `json:"hourly_visits"` // 0-23 as key
-	TopReferrers    map[string]int           `json:"top_referrers"`
-	VisitTimeline   []TimelinePoint          `json:"visit_timeline"`
+	TotalVisits      int64           `json:"total_visits"`
+	UniqueVisitors   int64           `json:"unique_visitors"`
+	TopCountries     map[string]int  `json:"top_countries"`
+	TopDevices       map[string]int  `json:"top_devices"`
+	TopBrowsers      map[string]int  `json:"top_browsers"`
+	TopOS            map[string]int  `json:"top_os"`
+	DailyVisits      map[string]int  `json:"daily_visits"`  // YYYY-MM-DD as key
+	HourlyVisits     map[int]int     `json:"hourly_visits"` // 0-23 as key
+	TopReferrers     map[string]int  `json:"top_referrers"`
+	UTMSources       map[string]int  `json:"utm_sources"`
+	UTMMediums       map[string]int  `json:"utm_mediums"`
+	UTMCampaigns     map[string]int  `json:"utm_campaigns"`
+	TrafficSources   map[string]int  `json:"traffic_sources"`   // direct/search/social/email/other
+	ReferringDomains map[string]int  `json:"referring_domains"` // 规范化后的来源域名
+	VisitTimeline    []TimelinePoint `json:"visit_timeline"`
+	Timezone         string          `json:"timezone"` // 时间分桶使用的 IANA 时区
+
+	// 独立访客数是否为近似值：原始记录已清理的时间段只能将各时间桶、各链接的独立访客数相加，
+	// 同一访客出现在多个时间桶或多个链接中时会被重复计算
+	UniqueVisitorsApproximate bool `json:"unique_visitors_approximate"`
+
+	// 转化：按对应点击的时间归入时间段
+	Conversions      int64          `json:"conversions"`
+	ConvertedVisits  int64          `json:"converted_visits"` // 至少产生一次转化的访问数
+	ConversionRate   float64        `json:"conversion_rate"`  // converted_visits / total_visits 的百分比，保留两位小数
+	ConversionValue  float64        `json:"conversion_value"`
+	ConversionEvents map[string]int `json:"conversion_events"`
 }
 
 // TimelinePoint 时间线数据点
 type TimelinePoint struct {
-	Date  string `json:"date"`  // YYYY-MM-DD
+	Date  string `json:"date"` // YYYY-MM-DD
 	Count int    `json:"count"`
 }
 
 // VisitAnalyticsRequest 请求体结构
 type VisitAnalyticsRequest struct {
 	ShortCode string `uri:"code" binding:"required"`
-	Since     string `form:"since"`     // 格式: YYYY-MM-DD
-	Until     string `form:"until"`     // 格式: YYYY-MM-DD
+	Since     string `form:"since"` // 格式: YYYY-MM-DD
+	Until     string `form:"until"` // 格式: YYYY-MM-DD
+	Timezone  string `form:"tz"`    // IANA 时区，如 Asia/Shanghai，默认 UTC
 	Limit     int    `form:"limit,default=100"`
-}
\ No newline at end of file
+}
+
+// TimeRange 左闭右开的时间范围
+type TimeRange struct {
+	Since time.Time `json:"since"`
+	Until time.Time `json:"until"`
+}
+
+// AnalyticsComparison 两个时间段的统计对比
+type AnalyticsComparison struct {
+	CurrentRange   TimeRange                         `json:"current_range"`
+	PreviousRange  TimeRange                         `json:"previous_range"`
+	Current        *AnalyticsSummary                 `json:"current"`
+	Previous       *AnalyticsSummary                 `json:"previous"`
+	TotalVisits    MetricDelta                       `json:"total_visits"`
+	UniqueVisitors MetricDelta                       `json:"unique_visitors"`
+	Dimensions     map[string]map[string]MetricDelta `json:"dimensions"` // 维度 -> 取值 -> 变化，维度名与摘要字段一致
+	Timezone       string                            `json:"timezone"`
+}
+
+// MetricDelta 单个指标在两个时间段之间的变化
+type MetricDelta struct {
+	Current       int64    `json:"current"`
+	Previous      int64    `json:"previous"`
+	Change        int64    `json:"change"`
+	PercentChange *float64 `json:"percent_change"` // 上一时间段为 0 时为 null
+}
+
+// DashboardSummary 账户级数据看板，汇总所有短链接在指定时间范围内的访问
+type DashboardSummary struct {
+	TotalClicks      int64           `json:"total_clicks"`
+	UniqueVisitors   int64           `json:"unique_visitors"`
+	TopLinks         []LinkVisitStat `json:"top_links"`
+	NewLinksCount    int64           `json:"new_links_count"`
+	NewLinks         []*URL          `json:"new_links"`     // 时间范围内新建的短链接，最新的在前
+	ExpiringSoon     []*URL          `json:"expiring_soon"` // 即将过期的短链接，最早过期的在前
+	TopCountries     map[string]int  `json:"top_countries"`
+	TopDevices       map[string]int  `json:"top_devices"`
+	TopReferrers     map[string]int  `json:"top_referrers"`
+	ReferringDomains map[string]int  `json:"referring_domains"`
+	TrafficSources   map[string]int  `json:"traffic_sources"`
+	VisitTimeline    []TimelinePoint `json:"visit_timeline"`
+	Timezone         string          `json:"timezone"`
+
+	UniqueVisitorsApproximate bool `json:"unique_visitors_approximate"` // 含义同 AnalyticsSummary
+}
+
+// LinkVisitStat 单个短链接的访问量
+type LinkVisitStat struct {
+	ShortCode   string `json:"short_code"`
+	OriginalURL string `json:"original_url"`
+	Visits      int64  `json:"visits"`
+}
+
+// GroupAnalytics 分组内所有短链接的汇总统计
+type GroupAnalytics struct {
+	Group   string             `json:"group"`
+	Summary *AnalyticsSummary  `json:"summary"`
+	Links   []LinkContribution `json:"links"` // 按访问量从高到低排列，包含没有访问的链接
+}
+
+// LinkContribution 单个短链接对分组访问量的贡献
+type LinkContribution struct {
+	ShortCode   string  `json:"short_code"`
+	OriginalURL string  `json:"original_url"`
+	Visits      int64   `json:"visits"`
+	Share       float64 `json:"share"` // 占分组总访问量的百分比，保留两位小数
+}
@@ -7,30 +7,214 @@ import (
 // APIKey API Key 实体
 type APIKey struct {
 	ID        uint       `gorm:"primaryKey" json:"id"`
-	APIKey    string     `gorm:"type:varchar(128);uniqueIndex;not null;column:key" json:"key"`
+	KeyHash   string     `gorm:"type:varchar(64);uniqueIndex;not null" json:"-"`    // 完整 Key 的 SHA-256 摘要，Key 本身不落库
+	KeyPrefix string     `gorm:"type:varchar(16);index;not null" json:"key_prefix"` // 可见前缀，用于识别和撤销 Key
 	Name      string     `gorm:"type:varchar(100);not null" json:"name"`
 	CreatedAt time.Time  `gorm:"autoCreateTime" json:"created_at"`
 	ExpiresAt *time.Time `gorm:"index" json:"expires_at,omitempty"`
 	LastUsed  *time.Time `json:"last_used,omitempty"`
+	LastIP    string     `gorm:"type:varchar(45)" json:"last_ip,omitempty"` // 最近一次使用的客户端 IP
 	IsActive  bool       `gorm:"default:true" json:"is_active"`
+	Scopes    []string   `gorm:"type:text;serializer:json" json:"scopes"` // Key 可访问的接口范围
+
+	// 单个 Key 的用量限制，0 表示不限制
+	RequestsPerMinute int `gorm:"default:0" json:"requests_per_minute"` // 每分钟请求数
+	MonthlyLinkQuota  int `gorm:"default:0" json:"monthly_link_quota"`  // 每个自然月（UTC）可创建的短链接数
+
+	// 允许使用该 Key 的客户端网段（CIDR），为空时不限制来源
+	AllowedCIDRs []string `gorm:"column:allowed_cidrs;type:text;serializer:json" json:"allowed_cidrs,omitempty"`
+
+	// 轮换后旧 Key 在宽限期内仍可使用，到期时间记录在 ExpiresAt
+	ReplacedByID *uint      `json:"replaced_by_id,omitempty"` // 轮换生成的新 Key
+	RotatedAt    *time.Time `json:"rotated_at,omitempty"`
+
+	WorkspaceID uint  `gorm:"index;not null;default:0" json:"workspace_id"`
+	UserID      *uint `gorm:"index" json:"user_id,omitempty"` // 代表的工作区成员，权限不超过其角色；为空时为工作区服务 Key
+
+	// UserID 在工作区中的角色，不落库；验证 Key 时读取并随 Key 一起缓存，成员变更时通过变更记录清除缓存
+	MemberRole string `gorm:"-" json:"-"`
+}
+
+// IsDeprecated 是否为已轮换、处于宽限期内的旧 Key
+func (k *APIKey) IsDeprecated() bool {
+	return k.ReplacedByID != nil
 }
 
 func (APIKey) TableName() string {
 	return "api_keys"
 }
 
+// API Key 权限范围
+const (
+	ScopeLinksRead        = "links:read"        // 查看短链接、分组和统计
+	ScopeLinksWrite       = "links:write"       // 创建、修改、删除短链接
+	ScopeAnalyticsRead    = "analytics:read"    // 分析数据、看板、访问记录与导出
+	ScopeConversionsWrite = "conversions:write" // 回传转化事件
+	ScopeReportsRead      = "reports:read"      // 查看报告订阅及投递记录
+	ScopeReportsWrite     = "reports:write"     // 创建、删除报告订阅
+	ScopeKeysAdmin        = "keys:admin"        // 管理 API Key
+)
+
+// AllScopes 所有权限范围
+var AllScopes = []string{
+	ScopeLinksRead,
+	ScopeLinksWrite,
+	ScopeAnalyticsRead,
+	ScopeConversionsWrite,
+	ScopeReportsRead,
+	ScopeReportsWrite,
+	ScopeKeysAdmin,
+}
+
+// DefaultScopes 创建时未指定权限范围的 Key 拥有除 Key 管理外的全部权限
+var DefaultScopes = []string{
+	ScopeLinksRead,
+	ScopeLinksWrite,
+	ScopeAnalyticsRead,
+	ScopeConversionsWrite,
+	ScopeReportsRead,
+	ScopeReportsWrite,
+}
+
 // CreateAPIKeyRequest 创建 API Key 的请求参数
 type CreateAPIKeyRequest struct {
-	Name      string `json:"name" binding:"required,max=100"`
-	ExpiresIn int    `json:"expires_in"`
+	Name      string   `json:"name" binding:"required,max=100"`
+	ExpiresIn int      `json:"expires_in"`
+	Scopes    []string `json:"scopes,omitempty" binding:"omitempty,dive,oneof=links:read links:write analytics:read conversions:write reports:read reports:write keys:admin"` // 为空时使用 DefaultScopes
+
+	RequestsPerMinute int `json:"requests_per_minute,omitempty" binding:"min=0,max=10000"` // 0 表示不限制
+	MonthlyLinkQuota  int `json:"monthly_link_quota,omitempty" binding:"min=0"`            // 0 表示不限制
+
+	AllowedCIDRs []string `json:"allowed_cidrs,omitempty" binding:"max=100"` // CIDR 或单个 IP，为空时不限制来源
+
+	UserID      *uint `json:"user_id,omitempty"`      // 代表的工作区成员，为空时创建工作区服务 Key
+	WorkspaceID uint  `json:"workspace_id,omitempty"` // 为空时使用调用方所在的工作区
+}
+
+// UpdateAPIKeyRequest 修改 API Key 的请求参数，只修改请求中出现的字段
+type UpdateAPIKeyRequest struct {
+	Name              *string `json:"name,omitempty" binding:"omitempty,min=1,max=100"`
+	RequestsPerMinute *int    `json:"requests_per_minute,omitempty" binding:"omitempty,min=0,max=10000"`
+	MonthlyLinkQuota  *int    `json:"monthly_link_quota,omitempty" binding:"omitempty,min=0"`
+
+	AllowedCIDRs *[]string `json:"allowed_cidrs,omitempty" binding:"omitempty,max=100"` // 传空数组取消来源限制
+}
+
+// APIKeyDenial 来自允许网段之外的 API Key 请求记录
+type APIKeyDenial struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	APIKeyID  uint      `gorm:"index;not null" json:"api_key_id"`
+	IPAddress string    `gorm:"type:varchar(45)" json:"ip_address"`
+	Method    string    `gorm:"type:varchar(10)" json:"method"`
+	Path      string    `gorm:"type:varchar(2048)" json:"path"`
+	CreatedAt time.Time `gorm:"autoCreateTime;index" json:"created_at"`
 }
 
-// APIKeyResponse API Key 响应
+func (APIKeyDenial) TableName() string {
+	return "api_key_denials"
+}
+
+// RotateAPIKeyRequest 轮换 API Key 的请求参数
+type RotateAPIKeyRequest struct {
+	GracePeriodHours *int `json:"grace_period_hours,omitempty" binding:"omitempty,min=0,max=720"` // 旧 Key 继续有效的小时数，为空时使用配置的默认值
+}
+
+// RotateAPIKeyResponse 轮换 API Key 的响应，新 Key 只返回一次
+type RotateAPIKeyResponse struct {
+	*APIKeyResponse
+	PreviousKeyID        uint      `json:"previous_key_id"`
+	PreviousKeyExpiresAt time.Time `json:"previous_key_expires_at"`
+}
+
+// APIKeyResponse API Key 响应，Key 只在创建时返回一次
 type APIKeyResponse struct {
 	ID        uint      `json:"id"`
 	Key       string    `json:"key"`
+	KeyPrefix string    `json:"key_prefix"`
 	Name      string    `json:"name"`
 	CreatedAt time.Time `json:"created_at"`
 	ExpiresAt time.Time `json:"expires_at"`
 	IsActive  bool      `json:"is_active"`
+	Scopes    []string  `json:"scopes"`
+
+	RequestsPerMinute int      `json:"requests_per_minute"`
+	MonthlyLinkQuota  int      `json:"monthly_link_quota"`
+	AllowedCIDRs      []string `json:"allowed_cidrs,omitempty"`
+
+	WorkspaceID uint  `json:"workspace_id"`
+	UserID      *uint `json:"user_id,omitempty"`
+}
+
+// APIKeyChange API Key 变更记录（撤销、修改、轮换、删除），其他实例据此清除本地缓存
+type APIKeyChange struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	APIKeyID  uint      `gorm:"not null" json:"api_key_id"`
+	KeyHash   string    `gorm:"type:varchar(64);not null" json:"-"`
+	ChangedAt time.Time `gorm:"index;not null" json:"changed_at"`
+}
+
+func (APIKeyChange) TableName() string {
+	return "api_key_changes"
+}
+
+// APIKeyEndpointUsage 每个 Key 每天（UTC）在各接口上的请求数，由内存中的统计定期累加写入
+type APIKeyEndpointUsage struct {
+	ID       uint      `gorm:"primaryKey" json:"-"`
+	APIKeyID uint      `gorm:"uniqueIndex:idx_api_key_usage_endpoint_day;not null" json:"api_key_id"`
+	Day      time.Time `gorm:"uniqueIndex:idx_api_key_usage_endpoint_day;index;not null" json:"day"`
+	Method   string    `gorm:"uniqueIndex:idx_api_key_usage_endpoint_day;type:varchar(10);not null" json:"method"`
+	Route    string    `gorm:"uniqueIndex:idx_api_key_usage_endpoint_day;type:varchar(255);not null" json:"route"` // 路由模板，如 /api/stats/:code
+	Requests int64     `gorm:"not null;default:0" json:"requests"`
+	Errors   int64     `gorm:"not null;default:0" json:"errors"` // 状态码 >= 400 的请求数
+}
+
+func (APIKeyEndpointUsage) TableName() string {
+	return "api_key_endpoint_usage"
+}
+
+// EndpointUsage 一段时间内某个接口的请求数
+type EndpointUsage struct {
+	Method   string `json:"method"`
+	Route    string `json:"route"`
+	Requests int64  `json:"requests"`
+	Errors   int64  `json:"errors"`
+}
+
+// APIKeyActivity 一段时间内 API Key 的使用情况，用于找出闲置的 Key
+type APIKeyActivity struct {
+	KeyID     uint            `json:"key_id"`
+	KeyPrefix string          `json:"key_prefix"`
+	Name      string          `json:"name"`
+	IsActive  bool            `json:"is_active"`
+	CreatedAt time.Time       `json:"created_at"`
+	LastUsed  *time.Time      `json:"last_used,omitempty"`
+	LastIP    string          `json:"last_ip,omitempty"`
+	Requests  int64           `json:"requests"`
+	Errors    int64           `json:"errors"`
+	Idle      bool            `json:"idle"`                // 统计期内未使用
+	Endpoints []EndpointUsage `json:"endpoints,omitempty"` // 只在查询单个 Key 时返回
+}
+
+// APIKeyUsage API Key 当前的用量和剩余额度
+type APIKeyUsage struct {
+	KeyID     uint             `json:"key_id"`
+	KeyPrefix string           `json:"key_prefix"`
+	Name      string           `json:"name"`
+	Requests  RequestRateUsage `json:"requests"`
+	Links     LinkQuotaUsage   `json:"links"`
+}
+
+// RequestRateUsage 每分钟请求数限制及当前窗口的剩余次数，未设置限制时 Remaining 为空
+type RequestRateUsage struct {
+	LimitPerMinute int  `json:"limit_per_minute"`
+	Remaining      *int `json:"remaining,omitempty"`
+}
+
+// LinkQuotaUsage 本月（UTC）已创建的短链接数和剩余配额，未设置配额时 Remaining 为空
+type LinkQuotaUsage struct {
+	MonthlyQuota int       `json:"monthly_quota"`
+	Created      int64     `json:"created"`
+	Remaining    *int64    `json:"remaining,omitempty"`
+	PeriodStart  time.Time `json:"period_start"`
+	PeriodEnd    time.Time `json:"period_end"`
 }
@@ -0,0 +1,42 @@
+package model
+
+import "time"
+
+// Conversion 一次转化事件，通过点击 ID 归因到产生它的访问记录和短链接
+type Conversion struct {
+	ID        int64     `gorm:"primaryKey" json:"id"`
+	VisitID   int64     `gorm:"uniqueIndex:idx_conversion_visit_event;not null" json:"visit_id"`
+	Event     string    `gorm:"type:varchar(100);uniqueIndex:idx_conversion_visit_event;not null" json:"event"`
+	ShortCode string    `gorm:"type:varchar(50);index;not null" json:"short_code"`
+	Value     float64   `gorm:"default:0" json:"value"`
+	ClickedAt time.Time `gorm:"index" json:"clicked_at"` // 对应访问的时间，统计时按点击时间归入时间段
+	CreatedAt time.Time `gorm:"autoCreateTime" json:"created_at"`
+}
+
+func (Conversion) TableName() string {
+	return "conversions"
+}
+
+// Click 开启点击追踪的链接产生的点击，点击 ID 即访问记录 ID
+// 与原始访问记录分开保存，访问记录按保留期清理后仍能归因转化，超过转化窗口后清理
+type Click struct {
+	VisitID   int64     `gorm:"primaryKey;autoIncrement:false" json:"visit_id"`
+	ShortCode string    `gorm:"type:varchar(50);index;not null" json:"short_code"`
+	ClickedAt time.Time `gorm:"index;not null" json:"clicked_at"`
+}
+
+func (Click) TableName() string {
+	return "clicks"
+}
+
+// ConversionRequest 转化回传请求
+type ConversionRequest struct {
+	ClickID string  `json:"click_id" binding:"required,max=64"`
+	Event   string  `json:"event" binding:"required,max=100"`
+	Value   float64 `json:"value"`
+}
+
+// SetClickTrackingRequest 开启或关闭点击 ID 追踪
+type SetClickTrackingRequest struct {
+	Enabled bool `json:"enabled"`
+}
@@ -0,0 +1,82 @@
+package model
+
+import (
+	"time"
+)
+
+// 报告发送周期
+const (
+	ReportScheduleDaily  = "daily"  // 每天 0 点发送前一天的报告
+	ReportScheduleWeekly = "weekly" // 每周一 0 点发送上一周的报告
+)
+
+// 报告投递状态
+const (
+	ReportDeliveryDelivered = "delivered"
+	ReportDeliveryFailed    = "failed"
+)
+
+// ReportSubscription 定期推送访问统计报告的订阅，归属于创建它的 API Key
+type ReportSubscription struct {
+	ID          uint       `gorm:"primaryKey" json:"id"`
+	APIKeyID    uint       `gorm:"index;not null" json:"api_key_id"`
+	WorkspaceID uint       `gorm:"index;not null;default:0" json:"workspace_id"` // 报告只汇总该工作区的短链接
+	Name        string     `gorm:"type:varchar(100);not null" json:"name"`
+	Schedule    string     `gorm:"type:varchar(10);not null" json:"schedule"`
+	ShortCodes  []string   `gorm:"type:text;serializer:json" json:"short_codes"` // 为空时汇总所有短链接
+	WebhookURL  string     `gorm:"type:varchar(2048);not null" json:"webhook_url"`
+	Secret      string     `gorm:"type:varchar(64);not null" json:"-"` // 用于签名推送内容，只在创建时返回
+	Timezone    string     `gorm:"type:varchar(64);not null" json:"timezone"`
+	IsActive    bool       `gorm:"default:true" json:"is_active"`
+	NextRunAt   time.Time  `gorm:"index" json:"next_run_at"` // 下一次发送时间，也是该次报告统计区间的结束时间
+	LastRunAt   *time.Time `json:"last_run_at,omitempty"`
+	CreatedAt   time.Time  `gorm:"autoCreateTime" json:"created_at"`
+}
+
+func (ReportSubscription) TableName() string {
+	return "report_subscriptions"
+}
+
+// ReportDelivery 一次报告推送的结果
+type ReportDelivery struct {
+	ID             uint      `gorm:"primaryKey" json:"id"`
+	SubscriptionID uint      `gorm:"index;not null" json:"subscription_id"`
+	PeriodStart    time.Time `json:"period_start"`
+	PeriodEnd      time.Time `json:"period_end"`
+	Status         string    `gorm:"type:varchar(20);not null" json:"status"`
+	Attempts       int       `json:"attempts"`
+	StatusCode     int       `json:"status_code,omitempty"` // 最后一次尝试的 HTTP 状态码，连接失败时为 0
+	Error          string    `gorm:"type:varchar(500)" json:"error,omitempty"`
+	CreatedAt      time.Time `gorm:"autoCreateTime" json:"created_at"`
+}
+
+func (ReportDelivery) TableName() string {
+	return "report_deliveries"
+}
+
+// CreateReportSubscriptionRequest 创建报告订阅的请求参数
+type CreateReportSubscriptionRequest struct {
+	Name       string   `json:"name" binding:"required,max=100"`
+	Schedule   string   `json:"schedule" binding:"required,oneof=daily weekly"`
+	ShortCodes []string `json:"short_codes" binding:"max=50,dive,required,max=50"`
+	WebhookURL string   `json:"webhook_url" binding:"required,url,max=2048"`
+	Timezone   string   `json:"timezone,omitempty" binding:"max=64"` // 划分天和周的时区，默认 UTC
+}
+
+// CreateReportSubscriptionResponse 创建报告订阅的响应，签名密钥只在此返回一次
+type CreateReportSubscriptionResponse struct {
+	*ReportSubscription
+	Secret string `json:"secret"`
+}
+
+// ReportPayload 推送到 webhook 的报告内容
+type ReportPayload struct {
+	SubscriptionID uint              `json:"subscription_id"`
+	Name           string            `json:"name"`
+	Schedule       string            `json:"schedule"`
+	Timezone       string            `json:"timezone"`
+	Period         TimeRange         `json:"period"`
+	GeneratedAt    time.Time         `json:"generated_at"`
+	Summary        *AnalyticsSummary `json:"summary"`
+	Links          []LinkVisitStat   `json:"links"` // 订阅指定的链接全部列出，订阅所有链接时只列出访问量最高的若干个
+}
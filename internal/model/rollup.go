@@ -0,0 +1,66 @@
+package model
+
+import "time"
+
+// 汇总维度名称
+const (
+	DimensionTotal        = "total"         // 访问总数
+	DimensionUnique       = "unique"        // 独立访客数
+	DimensionHour         = "hour"          // 一天中的小时（仅天粒度汇总）
+	DimensionCountry      = "country"       // 国家
+	DimensionDevice       = "device"        // 设备类型
+	DimensionBrowser      = "browser"       // 浏览器
+	DimensionOS           = "os"            // 操作系统
+	DimensionReferrer     = "referrer"      // 来源
+	DimensionUTMSource    = "utm_source"    // UTM 来源
+	DimensionUTMMedium    = "utm_medium"    // UTM 媒介
+	DimensionUTMCampaign  = "utm_campaign"  // UTM 活动
+	DimensionSource       = "source"        // 流量来源分类
+	DimensionReferrerHost = "referrer_host" // 来源域名
+)
+
+// 汇总进度名称
+const (
+	WatermarkHourly = "hourly" // 小时汇总已完成到的时间点
+	WatermarkDaily  = "daily"  // 天汇总已完成到的时间点
+	WatermarkPurge  = "purge"  // 原始访问记录已清理到的时间点
+)
+
+// VisitRollup 按短码、时间桶和维度汇总的访问计数
+type VisitRollup struct {
+	ID          int64     `gorm:"primaryKey" json:"-"`
+	ShortCode   string    `gorm:"type:varchar(50);index;not null" json:"short_code"`
+	BucketStart time.Time `gorm:"index;not null" json:"bucket_start"` // UTC 时间桶起点
+	Dimension   string    `gorm:"type:varchar(32);not null" json:"dimension"`
+	Value       string    `gorm:"type:varchar(2048)" json:"value"`
+	Count       int64     `gorm:"not null" json:"count"`
+}
+
+// HourlyVisitRollup 小时粒度汇总
+type HourlyVisitRollup struct {
+	VisitRollup
+}
+
+func (HourlyVisitRollup) TableName() string {
+	return "visit_rollups_hourly"
+}
+
+// DailyVisitRollup 天粒度汇总
+type DailyVisitRollup struct {
+	VisitRollup
+}
+
+func (DailyVisitRollup) TableName() string {
+	return "visit_rollups_daily"
+}
+
+// RollupWatermark 记录汇总与清理任务的进度
+type RollupWatermark struct {
+	Name      string    `gorm:"type:varchar(32);primaryKey"`
+	Watermark time.Time `gorm:"not null"`
+	UpdatedAt time.Time `gorm:"autoUpdateTime"`
+}
+
+func (RollupWatermark) TableName() string {
+	return "rollup_watermarks"
+}
@@ -6,13 +6,17 @@ import (
 
 // URL 表示一个短链接实体
 type URL struct {
-	ID          uint      `gorm:"primaryKey" json:"id"`
-	OriginalURL string    `gorm:"type:varchar(2048);not null" json:"original_url"`
-	ShortCode   string    `gorm:"type:varchar(50);uniqueIndex;not null" json:"short_code"`
-	CreatedAt   time.Time `gorm:"autoCreateTime" json:"created_at"`
+	ID          uint       `gorm:"primaryKey" json:"id"`
+	OriginalURL string     `gorm:"type:varchar(2048);not null" json:"original_url"`
+	ShortCode   string     `gorm:"type:varchar(50);uniqueIndex;not null" json:"short_code"`
+	CreatedAt   time.Time  `gorm:"autoCreateTime" json:"created_at"`
 	ExpiresAt   *time.Time `gorm:"index" json:"expires_at,omitempty"`
-	Clicks      int64     `gorm:"default:0" json:"clicks"`
-	IsActive    bool      `gorm:"default:true" json:"is_active"`
+	Clicks      int64      `gorm:"default:0" json:"clicks"`
+	IsActive    bool       `gorm:"default:true" json:"is_active"`
+	Group       string     `gorm:"column:link_group;type:varchar(100);index" json:"group,omitempty"` // 分组或营销活动标签，group 是 SQL 保留字，列名使用 link_group
+	TrackClicks bool       `gorm:"default:false" json:"track_clicks"`                                // 跳转时在目标地址追加点击 ID，用于转化归因
+	APIKeyID    *uint      `gorm:"index" json:"api_key_id,omitempty"`                                // 创建链接的 API Key，用于统计每月配额
+	WorkspaceID uint       `gorm:"index;not null;default:0" json:"workspace_id"`                     // 所属工作区
 }
 
 func (URL) TableName() string {
@@ -21,18 +25,43 @@ func (URL) TableName() string {
 
 // CreateURLRequest 创建短链接的请求参数
 type CreateURLRequest struct {
-	URL        string `json:"url" binding:"required,url"`
-	CustomCode string `json:"custom_code,omitempty"`
-	ExpireIn   int    `json:"expire_in,omitempty"`
+	URL         string     `json:"url" binding:"required,url"`
+	CustomCode  string     `json:"custom_code,omitempty"`
+	ExpireIn    int        `json:"expire_in,omitempty"`
+	UTM         *UTMParams `json:"utm,omitempty"` // 追加到目标地址的 UTM 参数
+	Group       string     `json:"group,omitempty" binding:"max=100"`
+	TrackClicks bool       `json:"track_clicks,omitempty"` // 跳转时在目标地址追加点击 ID，用于转化回传
+}
+
+// SetGroupRequest 设置短链接分组的请求参数，group 为空时移出分组
+type SetGroupRequest struct {
+	Group string `json:"group" binding:"max=100"`
+}
+
+// LinkGroup 分组及其包含的短链接数量
+type LinkGroup struct {
+	Group string `json:"group"`
+	Links int64  `json:"links"`
+}
+
+// UTMParams UTM 营销参数
+type UTMParams struct {
+	Source   string `json:"source,omitempty" binding:"max=255"`
+	Medium   string `json:"medium,omitempty" binding:"max=255"`
+	Campaign string `json:"campaign,omitempty" binding:"max=255"`
+	Term     string `json:"term,omitempty" binding:"max=255"`
+	Content  string `json:"content,omitempty" binding:"max=255"`
 }
 
 // CreateURLResponse 创建短链接的响应结果
 type CreateURLResponse struct {
-	ShortURL  string `json:"short_url"`
-	Code      string `json:"code"`
-	Original  string `json:"original"`
-	CreatedAt string `json:"created_at"`
-	ExpiresAt string `json:"expires_at,omitempty"`
+	ShortURL    string `json:"short_url"`
+	Code        string `json:"code"`
+	Original    string `json:"original"`
+	CreatedAt   string `json:"created_at"`
+	ExpiresAt   string `json:"expires_at,omitempty"`
+	Group       string `json:"group,omitempty"`
+	TrackClicks bool   `json:"track_clicks,omitempty"`
 }
 
 // StatsResponse 短链接统计信息响应
@@ -43,6 +72,8 @@ type StatsResponse struct {
 	CreatedAt   string `json:"created_at"`
 	ExpiresAt   string `json:"expires_at,omitempty"`
 	IsActive    bool   `json:"is_active"`
+	Group       string `json:"group,omitempty"`
+	TrackClicks bool   `json:"track_clicks"`
 }
 
 // ErrorResponse 用于统一错误响应格式
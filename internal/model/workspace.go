@@ -0,0 +1,89 @@
+package model
+
+import (
+	"time"
+)
+
+// Workspace 工作区，短链接、API Key 和报告订阅都归属于一个工作区
+type Workspace struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	Name      string    `gorm:"type:varchar(100);not null" json:"name"`
+	IsDefault *bool     `gorm:"uniqueIndex" json:"is_default,omitempty"` // 只有默认工作区为 true，其余为 NULL，唯一索引保证至多一个默认工作区
+	CreatedAt time.Time `gorm:"autoCreateTime" json:"created_at"`
+}
+
+func (Workspace) TableName() string {
+	return "workspaces"
+}
+
+// DefaultWorkspaceName 默认工作区的名称，升级前的数据及引导创建的管理员 Key 归入该工作区
+// 名称不唯一（自助创建的工作区可以同名），默认工作区以 IsDefault 标识
+const DefaultWorkspaceName = "Default"
+
+// User 用户，通过工作区成员关系获得角色
+type User struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	Email     string    `gorm:"type:varchar(255);uniqueIndex;not null" json:"email"` // 保存为小写
+	Name      string    `gorm:"type:varchar(100)" json:"name,omitempty"`
+	CreatedAt time.Time `gorm:"autoCreateTime" json:"created_at"`
+}
+
+func (User) TableName() string {
+	return "users"
+}
+
+// WorkspaceMember 用户在工作区中的角色
+type WorkspaceMember struct {
+	ID          uint      `gorm:"primaryKey" json:"-"`
+	WorkspaceID uint      `gorm:"uniqueIndex:idx_workspace_member;not null" json:"workspace_id"`
+	UserID      uint      `gorm:"uniqueIndex:idx_workspace_member;index;not null" json:"user_id"`
+	Role        string    `gorm:"type:varchar(20);not null" json:"role"`
+	CreatedAt   time.Time `gorm:"autoCreateTime" json:"created_at"`
+}
+
+func (WorkspaceMember) TableName() string {
+	return "workspace_members"
+}
+
+// 工作区成员角色，权限依次递减
+const (
+	RoleOwner  = "owner"  // 全部权限，可以指定或移除其他所有者
+	RoleAdmin  = "admin"  // 全部权限，包括管理 API Key 和非所有者成员
+	RoleMember = "member" // 读写短链接、回传转化、管理报告订阅
+	RoleViewer = "viewer" // 只读：短链接、分析数据和报告
+)
+
+// Roles 所有角色，权限从高到低
+var Roles = []string{RoleOwner, RoleAdmin, RoleMember, RoleViewer}
+
+// Member 工作区成员及其用户信息
+type Member struct {
+	UserID    uint      `json:"user_id"`
+	Email     string    `json:"email"`
+	Name      string    `json:"name,omitempty"`
+	Role      string    `json:"role"`
+	CreatedAt time.Time `json:"created_at"` // 加入工作区的时间
+}
+
+// WorkspaceMembership 用户所在的工作区及其角色
+type WorkspaceMembership struct {
+	Workspace
+	Role string `json:"role"`
+}
+
+// CreateWorkspaceRequest 创建工作区的请求参数
+type CreateWorkspaceRequest struct {
+	Name string `json:"name" binding:"required,max=100"`
+}
+
+// AddMemberRequest 添加工作区成员的请求参数，邮箱对应的用户不存在时自动创建
+type AddMemberRequest struct {
+	Email string `json:"email" binding:"required,email,max=255"`
+	Name  string `json:"name,omitempty" binding:"max=100"`
+	Role  string `json:"role" binding:"required,oneof=owner admin member viewer"`
+}
+
+// UpdateMemberRequest 修改成员角色的请求参数
+type UpdateMemberRequest struct {
+	Role string `json:"role" binding:"required,oneof=owner admin member viewer"`
+}
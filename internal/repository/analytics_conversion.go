@@ -0,0 +1,92 @@
+package repository
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"url-shortener/internal/model"
+	"url-shortener/internal/utils"
+)
+
+// RecordClick 保存点击
+func (r *AnalyticsRepository) RecordClick(click *model.Click) error {
+	return r.db.Create(click).Error
+}
+
+// GetClick 按点击 ID 对应的访问记录 ID 获取工作区内短链接的点击，属于其他工作区时视为不存在
+// 单独保存点击之前产生的点击从原始访问记录读取
+func (r *AnalyticsRepository) GetClick(workspaceID uint, visitID int64) (*model.Click, error) {
+	var clicks []model.Click
+	if err := r.db.Scopes(r.inWorkspace(workspaceID)).Where("visit_id = ?", visitID).Limit(1).Find(&clicks).Error; err != nil {
+		return nil, err
+	}
+	if len(clicks) > 0 {
+		return &clicks[0], nil
+	}
+
+	var visit model.VisitRecord
+	if err := r.db.Scopes(r.inWorkspace(workspaceID)).First(&visit, visitID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, fmt.Errorf("visit %d: %w", visitID, utils.ErrClickNotFound)
+		}
+		return nil, err
+	}
+	return &model.Click{VisitID: visit.ID, ShortCode: visit.ShortCode, ClickedAt: visit.VisitedAt}, nil
+}
+
+// PurgeClicksBefore 删除指定时间之前的点击
+func (r *AnalyticsRepository) PurgeClicksBefore(t time.Time) (int64, error) {
+	result := r.db.Where("clicked_at < ?", t.UTC()).Delete(&model.Click{})
+	return result.RowsAffected, result.Error
+}
+
+// RecordConversion 保存转化事件，同一访问的同名事件只记录一次
+// 返回 created 为 false 表示该事件已存在，conversion 为已有记录
+func (r *AnalyticsRepository) RecordConversion(conversion *model.Conversion) (created bool, err error) {
+	result := r.db.Clauses(clause.OnConflict{DoNothing: true}).Create(conversion)
+	if result.Error != nil {
+		return false, result.Error
+	}
+	if result.RowsAffected > 0 {
+		return true, nil
+	}
+
+	err = r.db.Where("visit_id = ? AND event = ?", conversion.VisitID, conversion.Event).First(conversion).Error
+	return false, err
+}
+
+// addConversions 统计 [from, to) 范围内点击产生的转化
+func (r *AnalyticsRepository) addConversions(b *summaryBuilder, scope func(*gorm.DB) *gorm.DB, from, to time.Time) error {
+	query := func() *gorm.DB {
+		return r.db.Model(&model.Conversion{}).Scopes(scope).
+			Where("clicked_at >= ? AND clicked_at < ?", from.UTC(), to.UTC())
+	}
+
+	var totals struct {
+		Count int64
+		Value float64
+	}
+	if err := query().Select("COUNT(*) AS count, COALESCE(SUM(value), 0) AS value").Scan(&totals).Error; err != nil {
+		return err
+	}
+	b.summary.Conversions = totals.Count
+	b.summary.ConversionValue = totals.Value
+
+	if err := query().Distinct("visit_id").Count(&b.summary.ConvertedVisits).Error; err != nil {
+		return err
+	}
+
+	var events []dimensionCount
+	if err := query().Select("event AS value, COUNT(*) AS count").Group("event").Scan(&events).Error; err != nil {
+		return err
+	}
+	for _, e := range events {
+		b.summary.ConversionEvents[e.Value] += int(e.Count)
+	}
+
+	return nil
+}
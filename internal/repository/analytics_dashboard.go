@@ -0,0 +1,162 @@
+package repository
+
+import (
+	"sort"
+	"time"
+
+	"gorm.io/gorm"
+
+	"url-shortener/internal/model"
+)
+
+// DashboardQuery 数据看板查询参数
+type DashboardQuery struct {
+	WorkspaceID    uint
+	Since          *time.Time
+	Until          *time.Time
+	Location       *time.Location
+	Limit          int           // 排行榜及新建链接列表的条目数
+	ExpiringWithin time.Duration // 从当前时间起多久内过期视为即将过期
+}
+
+// GetDashboard 汇总工作区内所有短链接在指定时间范围内的访问数据
+// 访问统计复用单链接摘要的汇总逻辑，排行榜按短码分组统计，不逐个查询链接
+func (r *AnalyticsRepository) GetDashboard(q *DashboardQuery) (*model.DashboardSummary, error) {
+	scope := r.inWorkspace(q.WorkspaceID)
+	summary, err := r.summarize(scope, q.Since, q.Until, q.Location)
+	if err != nil {
+		return nil, err
+	}
+
+	dashboard := &model.DashboardSummary{
+		TotalClicks:      summary.TotalVisits,
+		UniqueVisitors:   summary.UniqueVisitors,
+		TopCountries:     summary.TopCountries,
+		TopDevices:       summary.TopDevices,
+		TopReferrers:     summary.TopReferrers,
+		ReferringDomains: summary.ReferringDomains,
+		TrafficSources:   summary.TrafficSources,
+		VisitTimeline:    summary.VisitTimeline,
+		Timezone:         summary.Timezone,
+
+		UniqueVisitorsApproximate: summary.UniqueVisitorsApproximate,
+	}
+
+	counts, err := r.linkVisitCounts(scope, q.Since, q.Until)
+	if err != nil {
+		return nil, err
+	}
+	if dashboard.TopLinks, err = r.topLinks(counts, q.Limit); err != nil {
+		return nil, err
+	}
+
+	newLinks := r.db.Model(&model.URL{}).Scopes(inWorkspace(q.WorkspaceID)).Where("is_active = ?", true)
+	if q.Since != nil {
+		newLinks = newLinks.Where("created_at >= ?", q.Since.UTC())
+	}
+	if q.Until != nil {
+		newLinks = newLinks.Where("created_at < ?", q.Until.UTC())
+	}
+	if err := newLinks.Session(&gorm.Session{}).Count(&dashboard.NewLinksCount).Error; err != nil {
+		return nil, err
+	}
+	dashboard.NewLinks = []*model.URL{}
+	if err := newLinks.Order("created_at DESC").Limit(q.Limit).Find(&dashboard.NewLinks).Error; err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	dashboard.ExpiringSoon = []*model.URL{}
+	err = r.db.Scopes(inWorkspace(q.WorkspaceID)).Where("is_active = ? AND expires_at > ? AND expires_at <= ?", true, now, now.Add(q.ExpiringWithin)).
+		Order("expires_at ASC").Limit(q.Limit).Find(&dashboard.ExpiringSoon).Error
+	if err != nil {
+		return nil, err
+	}
+
+	return dashboard, nil
+}
+
+// linkVisitCounts 按短码统计 [since, until) 范围内的访问量
+// 已被清理的时间段读取汇总表的 total 维度，其余时间段读取原始访问记录
+func (r *AnalyticsRepository) linkVisitCounts(scope func(*gorm.DB) *gorm.DB, since, until *time.Time) (map[string]int64, error) {
+	counts := make(map[string]int64)
+	from, to := normalizeRange(since, until)
+	if !from.Before(to) {
+		return counts, nil
+	}
+
+	purgedBefore, err := r.GetRollupWatermark(model.WatermarkPurge)
+	if err != nil {
+		return nil, err
+	}
+
+	if from.Before(purgedBefore) {
+		for _, seg := range rollupSegments(from, minTime(to, purgedBefore), true) {
+			var rows []shortCodeCount
+			err := r.db.Model(seg.table).Scopes(scope).
+				Select("short_code, SUM(count) AS count").
+				Where("dimension = ? AND bucket_start >= ? AND bucket_start < ?", model.DimensionTotal, seg.from.UTC(), seg.to.UTC()).
+				Group("short_code").Scan(&rows).Error
+			if err != nil {
+				return nil, err
+			}
+			for _, row := range rows {
+				counts[row.ShortCode] += row.Count
+			}
+		}
+	}
+
+	if rawFrom := maxTime(from, purgedBefore); rawFrom.Before(to) {
+		var rows []shortCodeCount
+		err := r.db.Model(&model.VisitRecord{}).Scopes(scope).
+			Select("short_code, COUNT(*) AS count").
+			Where("visited_at >= ? AND visited_at < ?", rawFrom.UTC(), to.UTC()).
+			Group("short_code").Scan(&rows).Error
+		if err != nil {
+			return nil, err
+		}
+		for _, row := range rows {
+			counts[row.ShortCode] += row.Count
+		}
+	}
+
+	return counts, nil
+}
+
+// topLinks 取访问量最高的 limit 个短链接并补充目标地址
+func (r *AnalyticsRepository) topLinks(counts map[string]int64, limit int) ([]model.LinkVisitStat, error) {
+	stats := make([]model.LinkVisitStat, 0, len(counts))
+	for code, visits := range counts {
+		stats = append(stats, model.LinkVisitStat{ShortCode: code, Visits: visits})
+	}
+	sort.Slice(stats, func(i, j int) bool {
+		if stats[i].Visits != stats[j].Visits {
+			return stats[i].Visits > stats[j].Visits
+		}
+		return stats[i].ShortCode < stats[j].ShortCode
+	})
+	if limit > 0 && len(stats) > limit {
+		stats = stats[:limit]
+	}
+	if len(stats) == 0 {
+		return stats, nil
+	}
+
+	codes := make([]string, len(stats))
+	for i, stat := range stats {
+		codes[i] = stat.ShortCode
+	}
+	var urls []model.URL
+	if err := r.db.Select("short_code, original_url").Where("short_code IN ?", codes).Find(&urls).Error; err != nil {
+		return nil, err
+	}
+	originals := make(map[string]string, len(urls))
+	for _, u := range urls {
+		originals[u.ShortCode] = u.OriginalURL
+	}
+	for i := range stats {
+		stats[i].OriginalURL = originals[stats[i].ShortCode]
+	}
+
+	return stats, nil
+}
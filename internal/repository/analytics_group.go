@@ -0,0 +1,66 @@
+package repository
+
+import (
+	"math"
+	"sort"
+	"time"
+
+	"gorm.io/gorm"
+
+	"url-shortener/internal/model"
+)
+
+// GetGroupAnalytics 汇总分组内所有短链接的访问数据，并给出每个链接的贡献
+// 复用单链接摘要和看板排行榜的分组查询，只是将过滤条件换成分组内的短码
+func (r *AnalyticsRepository) GetGroupAnalytics(workspaceID uint, group string, since, until *time.Time, loc *time.Location) (*model.GroupAnalytics, error) {
+	scope := r.byGroup(workspaceID, group)
+
+	summary, err := r.summarize(scope, since, until, loc)
+	if err != nil {
+		return nil, err
+	}
+
+	counts, err := r.linkVisitCounts(scope, since, until)
+	if err != nil {
+		return nil, err
+	}
+
+	var links []model.URL
+	if err := r.db.Select("short_code, original_url").Where("workspace_id = ? AND link_group = ?", workspaceID, group).Find(&links).Error; err != nil {
+		return nil, err
+	}
+
+	contributions := make([]model.LinkContribution, 0, len(links))
+	for _, link := range links {
+		visits := counts[link.ShortCode]
+		contribution := model.LinkContribution{
+			ShortCode:   link.ShortCode,
+			OriginalURL: link.OriginalURL,
+			Visits:      visits,
+		}
+		if summary.TotalVisits > 0 {
+			contribution.Share = math.Round(float64(visits)/float64(summary.TotalVisits)*10000) / 100
+		}
+		contributions = append(contributions, contribution)
+	}
+	sort.Slice(contributions, func(i, j int) bool {
+		if contributions[i].Visits != contributions[j].Visits {
+			return contributions[i].Visits > contributions[j].Visits
+		}
+		return contributions[i].ShortCode < contributions[j].ShortCode
+	})
+
+	return &model.GroupAnalytics{
+		Group:   group,
+		Summary: summary,
+		Links:   contributions,
+	}, nil
+}
+
+// byGroup 按工作区内的分组过滤，访问记录和汇总表通过短码子查询关联到分组
+func (r *AnalyticsRepository) byGroup(workspaceID uint, group string) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		codes := r.db.Model(&model.URL{}).Select("short_code").Where("workspace_id = ? AND link_group = ?", workspaceID, group)
+		return db.Where("short_code IN (?)", codes)
+	}
+}
@@ -1,13 +1,43 @@
 package repository
 
 import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
 	"time"
 
+	"gorm.io/driver/mysql"
 	"gorm.io/gorm"
 
 	"url-shortener/internal/model"
 )
 
+// topDimensionLimit 摘要中每个维度最多返回的条目数
+const topDimensionLimit = 10
+
+// visitDimensionColumns 汇总维度与原始访问记录列的对应关系
+var visitDimensionColumns = map[string]string{
+	model.DimensionCountry:      "country",
+	model.DimensionDevice:       "device_type",
+	model.DimensionBrowser:      "browser",
+	model.DimensionOS:           "user_os",
+	model.DimensionReferrer:     "referer",
+	model.DimensionUTMSource:    "utm_source",
+	model.DimensionUTMMedium:    "utm_medium",
+	model.DimensionUTMCampaign:  "utm_campaign",
+	model.DimensionSource:       "traffic_source",
+	model.DimensionReferrerHost: "referrer_host",
+}
+
+// optionalDimensions 值为空表示未设置的维度，摘要中不计入 Unknown
+var optionalDimensions = map[string]bool{
+	model.DimensionUTMSource:    true,
+	model.DimensionUTMMedium:    true,
+	model.DimensionUTMCampaign:  true,
+	model.DimensionReferrerHost: true,
+}
+
 // AnalyticsRepository 分析数据仓储
 type AnalyticsRepository struct {
 	db *gorm.DB
@@ -21,34 +51,497 @@ func (r *AnalyticsRepository) RecordVisit(record *model.VisitRecord) error {
 	return r.db.Create(record).Error
 }
 
-func (r *AnalyticsRepository) GetAnalyticsSummary(shortCode string, since, until *time.Time) (*model.AnalyticsSummary, error) {
-	var totalVisits int64
-	r.db.Model(&model.VisitRecord{}).Where("short_code = ?", shortCode).Count(&totalVisits)
+// GetAnalyticsSummary 获取统计摘要，按 loc 时区划分天和小时
+func (r *AnalyticsRepository) GetAnalyticsSummary(workspaceID uint, shortCode string, since, until *time.Time, loc *time.Location) (*model.AnalyticsSummary, error) {
+	return r.summarize(r.byShortCode(workspaceID, shortCode), since, until, loc)
+}
+
+// summarize 汇总 scope 范围内短链接的访问数据
+// 已被清理的时间段读取汇总表，其余时间段读取原始访问记录
+func (r *AnalyticsRepository) summarize(scope func(*gorm.DB) *gorm.DB, since, until *time.Time, loc *time.Location) (*model.AnalyticsSummary, error) {
+	if loc == nil {
+		loc = time.UTC
+	}
+	from, to := normalizeRange(since, until)
+	if !from.Before(to) {
+		return newSummaryBuilder(loc).build(), nil
+	}
+
+	purgedBefore, err := r.GetRollupWatermark(model.WatermarkPurge)
+	if err != nil {
+		return nil, err
+	}
 
-	var uniqueVisitors int64
-	r.db.Model(&model.VisitRecord{}).Where("short_code = ?", shortCode).Distinct("ip_address").Count(&uniqueVisitors)
+	builder := newSummaryBuilder(loc)
 
-	summary := &model.AnalyticsSummary{
-		TotalVisits:    totalVisits,
-		UniqueVisitors: uniqueVisitors,
-		TopCountries:  make(map[string]int),
-		TopDevices:    make(map[string]int),
-		TopBrowsers:   make(map[string]int),
-		TopOS:         make(map[string]int),
-		DailyVisits:   make(map[string]int),
-		HourlyVisits:  make(map[int]int),
-		TopReferrers:  make(map[string]int),
+	if from.Before(purgedBefore) {
+		if err := r.addRollups(builder, scope, from, minTime(to, purgedBefore)); err != nil {
+			return nil, err
+		}
 	}
 
-	return summary, nil
+	if rawFrom := maxTime(from, purgedBefore); rawFrom.Before(to) {
+		if err := r.addRawVisits(builder, scope, rawFrom, to); err != nil {
+			return nil, err
+		}
+	}
+
+	// 转化记录不会被清理，始终按点击时间直接统计
+	if err := r.addConversions(builder, scope, from, to); err != nil {
+		return nil, err
+	}
+
+	return builder.build(), nil
 }
 
-func (r *AnalyticsRepository) GetRecentVisits(shortCode string, limit int, since *time.Time) ([]*model.VisitRecord, error) {
+func (r *AnalyticsRepository) GetRecentVisits(workspaceID uint, shortCode string, limit int, since *time.Time) ([]*model.VisitRecord, error) {
 	var visits []*model.VisitRecord
-	query := r.db.Where("short_code = ?", shortCode)
+	query := r.db.Scopes(r.byShortCode(workspaceID, shortCode))
 	if since != nil {
-		query = query.Where("visited_at >= ?", *since)
+		query = query.Where("visited_at >= ?", since.UTC())
 	}
 	err := query.Order("visited_at DESC").Limit(limit).Find(&visits).Error
 	return visits, err
 }
+
+// StreamVisits 按访问时间顺序逐行读取原始访问记录，shortCode 为空时读取工作区内全部短链接
+// 使用数据库游标读取，不会一次性加载到内存；fn 返回错误时停止读取
+func (r *AnalyticsRepository) StreamVisits(workspaceID uint, shortCode string, since, until *time.Time, fn func(*model.VisitRecord) error) error {
+	scope := r.inWorkspace(workspaceID)
+	if shortCode != "" {
+		scope = r.byShortCode(workspaceID, shortCode)
+	}
+	query := r.db.Model(&model.VisitRecord{}).Scopes(scope)
+	if since != nil {
+		query = query.Where("visited_at >= ?", since.UTC())
+	}
+	if until != nil {
+		query = query.Where("visited_at < ?", until.UTC())
+	}
+
+	rows, err := query.Order("visited_at ASC, id ASC").Rows()
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var visit model.VisitRecord
+		if err := r.db.ScanRows(rows, &visit); err != nil {
+			return err
+		}
+		if err := fn(&visit); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// GetRollupWatermark 获取汇总进度，未开始时返回零值
+func (r *AnalyticsRepository) GetRollupWatermark(name string) (time.Time, error) {
+	var marks []model.RollupWatermark
+	if err := r.db.Where("name = ?", name).Limit(1).Find(&marks).Error; err != nil {
+		return time.Time{}, err
+	}
+	if len(marks) == 0 {
+		return time.Time{}, nil
+	}
+	return marks[0].Watermark.UTC(), nil
+}
+
+// SetRollupWatermark 更新汇总进度
+func (r *AnalyticsRepository) SetRollupWatermark(name string, t time.Time) error {
+	return r.db.Save(&model.RollupWatermark{Name: name, Watermark: t.UTC()}).Error
+}
+
+// --- 摘要查询 ---
+
+// dimensionCount 分组计数结果
+type dimensionCount struct {
+	Dimension string
+	Value     string
+	Count     int64
+}
+
+// bucketCount 时间桶计数结果
+type bucketCount struct {
+	BucketStart time.Time
+	Count       int64
+}
+
+// rollupSegment 汇总表中的一段查询范围
+type rollupSegment struct {
+	table    interface{}
+	from, to time.Time
+}
+
+// rollupSegments 将 [from, to) 拆分为汇总表查询范围
+// 完整的 UTC 自然日读取天汇总，首尾不足一天的部分读取小时汇总；useDaily 为 false 时只读小时汇总
+func rollupSegments(from, to time.Time, useDaily bool) []rollupSegment {
+	firstDay := ceilDay(from)
+	lastDay := to.Truncate(24 * time.Hour)
+	if !useDaily || !firstDay.Before(lastDay) {
+		return []rollupSegment{{&model.HourlyVisitRollup{}, from, to}}
+	}
+
+	return []rollupSegment{
+		{&model.HourlyVisitRollup{}, from, firstDay},
+		{&model.DailyVisitRollup{}, firstDay, lastDay},
+		{&model.HourlyVisitRollup{}, lastDay, to},
+	}
+}
+
+// addRollups 从汇总表读取 [from, to) 范围内的数据
+// 天汇总按 UTC 自然日划分，仅在 UTC 时区下使用，其余情况读取小时汇总
+// 非整点偏移的时区（如 Asia/Kolkata）按小时桶起点归入本地时间，边界处为近似值
+func (r *AnalyticsRepository) addRollups(b *summaryBuilder, scope func(*gorm.DB) *gorm.DB, from, to time.Time) error {
+	for _, seg := range rollupSegments(from, to, b.loc == time.UTC) {
+		if err := r.addRollupRange(b, seg.table, scope, seg.from, seg.to); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// addRollupRange 从指定汇总表读取 bucket_start 位于 [from, to) 的数据
+func (r *AnalyticsRepository) addRollupRange(b *summaryBuilder, table interface{}, scope func(*gorm.DB) *gorm.DB, from, to time.Time) error {
+	if !from.Before(to) {
+		return nil
+	}
+	_, daily := table.(*model.DailyVisitRollup)
+
+	query := func() *gorm.DB {
+		return r.db.Model(table).Scopes(scope).
+			Where("bucket_start >= ? AND bucket_start < ?", from.UTC(), to.UTC())
+	}
+
+	var totals []bucketCount
+	err := query().Select("bucket_start, SUM(count) AS count").
+		Where("dimension = ?", model.DimensionTotal).
+		Group("bucket_start").Scan(&totals).Error
+	if err != nil {
+		return err
+	}
+	for _, t := range totals {
+		b.addVisits(t.BucketStart, t.Count, !daily)
+	}
+
+	// 每行是一个短码在一个时间桶内的独立访客数，多行相加时为近似值
+	var unique struct {
+		Count   int64
+		Buckets int
+	}
+	err = query().Select("COALESCE(SUM(count), 0) AS count, COUNT(*) AS buckets").
+		Where("dimension = ?", model.DimensionUnique).Scan(&unique).Error
+	if err != nil {
+		return err
+	}
+	b.addUnique(unique.Count, unique.Buckets)
+
+	var counts []dimensionCount
+	err = query().Select("dimension, value, SUM(count) AS count").
+		Where("dimension NOT IN ?", []string{model.DimensionTotal, model.DimensionUnique}).
+		Group("dimension, value").Scan(&counts).Error
+	if err != nil {
+		return err
+	}
+	for _, c := range counts {
+		b.addDimension(c.Dimension, c.Value, c.Count)
+	}
+
+	return nil
+}
+
+// addRawVisits 从原始访问记录读取 [from, to) 范围内的数据
+func (r *AnalyticsRepository) addRawVisits(b *summaryBuilder, scope func(*gorm.DB) *gorm.DB, from, to time.Time) error {
+	query := func() *gorm.DB {
+		return r.db.Model(&model.VisitRecord{}).Scopes(scope).
+			Where("visited_at >= ? AND visited_at < ?", from.UTC(), to.UTC())
+	}
+
+	// 在数据库中按时间桶分组计数，再换算到 loc 时区的天和小时
+	// 两个时区相差不是整小时（如 Asia/Kolkata 与 UTC）时按分钟分组，保证结果精确
+	stored := r.storedTimeLocation()
+	byMinute := !wholeHourOffset(from, b.loc, stored) || !wholeHourOffset(to, b.loc, stored)
+	bucket := r.timeBucketExpr("visited_at", byMinute)
+	var buckets []struct {
+		Bucket string
+		Count  int64
+	}
+	err := query().Select(bucket + " AS bucket, COUNT(*) AS count").Group(bucket).Scan(&buckets).Error
+	if err != nil {
+		return err
+	}
+	for _, bc := range buckets {
+		start, err := time.ParseInLocation(timeBucketLayout, bc.Bucket, stored)
+		if err != nil {
+			return fmt.Errorf("parse visit time bucket %q: %w", bc.Bucket, err)
+		}
+		b.addVisits(start, bc.Count, true)
+	}
+
+	var unique int64
+	// 未记录 IP 的访问（如 Do-Not-Track）不计入独立访客
+	if err := query().Where("ip_address <> ''").Distinct("ip_address").Count(&unique).Error; err != nil {
+		return err
+	}
+	if unique > 0 {
+		b.addUnique(unique, 1)
+	}
+
+	for dimension, column := range visitDimensionColumns {
+		var counts []dimensionCount
+		err := query().Select(column + " AS value, COUNT(*) AS count").
+			Group(column).Scan(&counts).Error
+		if err != nil {
+			return err
+		}
+		for _, c := range counts {
+			b.addDimension(dimension, c.Value, c.Count)
+		}
+	}
+
+	return nil
+}
+
+// timeBucketLayout 时间桶表达式的输出格式
+const timeBucketLayout = "2006-01-02 15:04:05"
+
+// timeBucketExpr 返回将 column 截断到 storedTimeLocation 时区的整小时（byMinute 为 true 时截断到分钟）
+// 并按 timeBucketLayout 格式化的 SQL 表达式
+func (r *AnalyticsRepository) timeBucketExpr(column string, byMinute bool) string {
+	switch r.db.Dialector.Name() {
+	case "mysql":
+		if byMinute {
+			return "DATE_FORMAT(" + column + ", '%Y-%m-%d %H:%i:00')"
+		}
+		return "DATE_FORMAT(" + column + ", '%Y-%m-%d %H:00:00')"
+	case "postgres":
+		if byMinute {
+			return "to_char(" + column + " AT TIME ZONE 'UTC', 'YYYY-MM-DD HH24:MI:00')"
+		}
+		return "to_char(" + column + " AT TIME ZONE 'UTC', 'YYYY-MM-DD HH24:00:00')"
+	default:
+		if byMinute {
+			return "strftime('%Y-%m-%d %H:%M:00', " + column + ")"
+		}
+		return "strftime('%Y-%m-%d %H:00:00', " + column + ")"
+	}
+}
+
+// storedTimeLocation 数据库中时间值的时区
+// MySQL 的 DATETIME 不带时区，驱动按连接参数 loc 读写；SQLite 和 PostgreSQL 在表达式中换算到 UTC
+func (r *AnalyticsRepository) storedTimeLocation() *time.Location {
+	if d, ok := r.db.Dialector.(*mysql.Dialector); ok && d.DSNConfig != nil && d.DSNConfig.Loc != nil {
+		return d.DSNConfig.Loc
+	}
+	return time.UTC
+}
+
+// wholeHourOffset 报告 t 时刻 loc 与 stored 两个时区的偏移是否相差整小时
+func wholeHourOffset(t time.Time, loc, stored *time.Location) bool {
+	_, offset := t.In(loc).Zone()
+	_, storedOffset := t.In(stored).Zone()
+	return (offset-storedOffset)%3600 == 0
+}
+
+// inWorkspace 按工作区过滤，访问记录和汇总表通过短码子查询关联到工作区
+func (r *AnalyticsRepository) inWorkspace(workspaceID uint) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		codes := r.db.Model(&model.URL{}).Select("short_code").Where("workspace_id = ?", workspaceID)
+		return db.Where("short_code IN (?)", codes)
+	}
+}
+
+// byShortCode 按短码过滤，短链接不属于工作区时不匹配任何记录
+func (r *AnalyticsRepository) byShortCode(workspaceID uint, shortCode string) func(*gorm.DB) *gorm.DB {
+	scope := r.inWorkspace(workspaceID)
+	return func(db *gorm.DB) *gorm.DB {
+		return scope(db.Where("short_code = ?", shortCode))
+	}
+}
+
+// --- 摘要构建 ---
+
+// summaryBuilder 合并汇总表与原始记录的查询结果
+type summaryBuilder struct {
+	summary     *model.AnalyticsSummary
+	loc         *time.Location
+	uniqueParts int // 相加得到独立访客数的分组数，超过 1 时为近似值
+}
+
+func newSummaryBuilder(loc *time.Location) *summaryBuilder {
+	return &summaryBuilder{
+		loc: loc,
+		summary: &model.AnalyticsSummary{
+			Timezone:         loc.String(),
+			TopCountries:     make(map[string]int),
+			TopDevices:       make(map[string]int),
+			TopBrowsers:      make(map[string]int),
+			TopOS:            make(map[string]int),
+			DailyVisits:      make(map[string]int),
+			HourlyVisits:     make(map[int]int),
+			TopReferrers:     make(map[string]int),
+			UTMSources:       make(map[string]int),
+			UTMMediums:       make(map[string]int),
+			UTMCampaigns:     make(map[string]int),
+			TrafficSources:   make(map[string]int),
+			ReferringDomains: make(map[string]int),
+			ConversionEvents: make(map[string]int),
+		},
+	}
+}
+
+// addVisits 累加某一时刻的访问数，withHour 为 false 时小时分布由 hour 维度提供
+func (b *summaryBuilder) addVisits(at time.Time, count int64, withHour bool) {
+	at = at.In(b.loc)
+	b.summary.TotalVisits += count
+	b.summary.DailyVisits[at.Format("2006-01-02")] += int(count)
+	if withHour {
+		b.summary.HourlyVisits[at.Hour()] += int(count)
+	}
+}
+
+// addUnique 累加由 parts 个分组的独立访客数相加得到的计数
+func (b *summaryBuilder) addUnique(count int64, parts int) {
+	b.summary.UniqueVisitors += count
+	b.uniqueParts += parts
+}
+
+// addDimension 累加维度计数
+func (b *summaryBuilder) addDimension(dimension, value string, count int64) {
+	if dimension == model.DimensionHour {
+		if hour, err := strconv.Atoi(value); err == nil {
+			b.summary.HourlyVisits[hour] += int(count)
+		}
+		return
+	}
+
+	if target := b.dimensionMap(dimension); target != nil {
+		if value == "" {
+			if optionalDimensions[dimension] {
+				return
+			}
+			value = "Unknown"
+		}
+		target[value] += int(count)
+	}
+}
+
+// dimensionMap 维度对应的摘要字段
+func (b *summaryBuilder) dimensionMap(dimension string) map[string]int {
+	switch dimension {
+	case model.DimensionCountry:
+		return b.summary.TopCountries
+	case model.DimensionDevice:
+		return b.summary.TopDevices
+	case model.DimensionBrowser:
+		return b.summary.TopBrowsers
+	case model.DimensionOS:
+		return b.summary.TopOS
+	case model.DimensionReferrer:
+		return b.summary.TopReferrers
+	case model.DimensionUTMSource:
+		return b.summary.UTMSources
+	case model.DimensionUTMMedium:
+		return b.summary.UTMMediums
+	case model.DimensionUTMCampaign:
+		return b.summary.UTMCampaigns
+	case model.DimensionSource:
+		return b.summary.TrafficSources
+	case model.DimensionReferrerHost:
+		return b.summary.ReferringDomains
+	}
+	return nil
+}
+
+// build 截取各维度的前 N 项并生成时间线
+func (b *summaryBuilder) build() *model.AnalyticsSummary {
+	s := b.summary
+	s.TopCountries = topN(s.TopCountries, topDimensionLimit)
+	s.TopDevices = topN(s.TopDevices, topDimensionLimit)
+	s.TopBrowsers = topN(s.TopBrowsers, topDimensionLimit)
+	s.TopOS = topN(s.TopOS, topDimensionLimit)
+	s.TopReferrers = topN(s.TopReferrers, topDimensionLimit)
+	s.UTMSources = topN(s.UTMSources, topDimensionLimit)
+	s.UTMMediums = topN(s.UTMMediums, topDimensionLimit)
+	s.UTMCampaigns = topN(s.UTMCampaigns, topDimensionLimit)
+	s.ReferringDomains = topN(s.ReferringDomains, topDimensionLimit)
+	s.UniqueVisitorsApproximate = b.uniqueParts > 1
+
+	if s.TotalVisits > 0 {
+		s.ConversionRate = math.Round(float64(s.ConvertedVisits)/float64(s.TotalVisits)*10000) / 100
+	}
+
+	s.VisitTimeline = make([]model.TimelinePoint, 0, len(s.DailyVisits))
+	for date, count := range s.DailyVisits {
+		s.VisitTimeline = append(s.VisitTimeline, model.TimelinePoint{Date: date, Count: count})
+	}
+	sort.Slice(s.VisitTimeline, func(i, j int) bool {
+		return s.VisitTimeline[i].Date < s.VisitTimeline[j].Date
+	})
+
+	return s
+}
+
+// topN 保留计数最高的 n 项
+func topN(counts map[string]int, n int) map[string]int {
+	if len(counts) <= n {
+		return counts
+	}
+
+	keys := make([]string, 0, len(counts))
+	for k := range counts {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if counts[keys[i]] != counts[keys[j]] {
+			return counts[keys[i]] > counts[keys[j]]
+		}
+		return keys[i] < keys[j]
+	})
+
+	result := make(map[string]int, n)
+	for _, k := range keys[:n] {
+		result[k] = counts[k]
+	}
+	return result
+}
+
+// --- 时间辅助 ---
+
+// normalizeRange 将可选的时间范围转换为 [from, to)，未指定时分别为最早时间和当前时间
+func normalizeRange(since, until *time.Time) (time.Time, time.Time) {
+	from := time.Unix(0, 0).UTC()
+	if since != nil {
+		from = since.UTC()
+	}
+	to := time.Now().UTC()
+	if until != nil {
+		to = until.UTC()
+	}
+	return from, to
+}
+
+// ceilDay 向上取整到 UTC 零点
+func ceilDay(t time.Time) time.Time {
+	day := t.UTC().Truncate(24 * time.Hour)
+	if day.Before(t) {
+		day = day.Add(24 * time.Hour)
+	}
+	return day
+}
+
+func minTime(a, b time.Time) time.Time {
+	if a.Before(b) {
+		return a
+	}
+	return b
+}
+
+func maxTime(a, b time.Time) time.Time {
+	if a.After(b) {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,126 @@
+package repository
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"gorm.io/driver/mysql"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+
+	"url-shortener/internal/model"
+)
+
+func TestAnalyticsSummaryTimeline(t *testing.T) {
+	db := newTestDB(t)
+	repo := NewAnalyticsRepository(db)
+	if err := db.Create(&model.URL{ShortCode: "abc", OriginalURL: "https://example.com", WorkspaceID: 1}).Error; err != nil {
+		t.Fatalf("create url: %v", err)
+	}
+
+	visits := []time.Time{
+		time.Date(2026, 5, 1, 0, 10, 0, 0, time.UTC),
+		time.Date(2026, 5, 1, 0, 40, 0, 0, time.UTC),
+		time.Date(2026, 5, 1, 0, 59, 59, 999000000, time.UTC),
+		time.Date(2026, 5, 1, 18, 20, 0, 0, time.UTC),
+		time.Date(2026, 5, 1, 18, 35, 0, 0, time.UTC),
+		time.Date(2026, 5, 2, 3, 0, 0, 0, time.UTC),
+	}
+	for _, at := range visits {
+		if err := repo.RecordVisit(&model.VisitRecord{ShortCode: "abc", IPAddress: "192.0.2.1", VisitedAt: at}); err != nil {
+			t.Fatalf("record visit: %v", err)
+		}
+	}
+
+	kolkata, err := time.LoadLocation("Asia/Kolkata")
+	if err != nil {
+		t.Skipf("load time zone: %v", err)
+	}
+	newYork, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skipf("load time zone: %v", err)
+	}
+
+	tests := []struct {
+		loc    *time.Location
+		daily  map[string]int
+		hourly map[int]int
+	}{
+		{
+			loc:    time.UTC,
+			daily:  map[string]int{"2026-05-01": 5, "2026-05-02": 1},
+			hourly: map[int]int{0: 3, 18: 2, 3: 1},
+		},
+		{
+			loc:    newYork,
+			daily:  map[string]int{"2026-04-30": 3, "2026-05-01": 3},
+			hourly: map[int]int{20: 3, 14: 2, 23: 1},
+		},
+		{
+			// +05:30，同一 UTC 小时内的访问落在不同的本地小时和日期
+			loc:    kolkata,
+			daily:  map[string]int{"2026-05-01": 4, "2026-05-02": 2},
+			hourly: map[int]int{5: 1, 6: 2, 23: 1, 0: 1, 8: 1},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.loc.String(), func(t *testing.T) {
+			summary, err := repo.GetAnalyticsSummary(1, "abc", nil, nil, tt.loc)
+			if err != nil {
+				t.Fatalf("GetAnalyticsSummary: %v", err)
+			}
+			if summary.TotalVisits != int64(len(visits)) {
+				t.Errorf("TotalVisits = %d, want %d", summary.TotalVisits, len(visits))
+			}
+			if !reflect.DeepEqual(summary.DailyVisits, tt.daily) {
+				t.Errorf("DailyVisits = %v, want %v", summary.DailyVisits, tt.daily)
+			}
+			if !reflect.DeepEqual(summary.HourlyVisits, tt.hourly) {
+				t.Errorf("HourlyVisits = %v, want %v", summary.HourlyVisits, tt.hourly)
+			}
+		})
+	}
+}
+
+func TestStoredTimeLocation(t *testing.T) {
+	tests := []struct {
+		dialector gorm.Dialector
+		want      *time.Location
+	}{
+		{mysql.Open("user:pass@tcp(localhost:3306)/db?parseTime=True&loc=Local"), time.Local},
+		{mysql.Open("user:pass@tcp(localhost:3306)/db?parseTime=True"), time.UTC},
+		{sqlite.Open("file.db"), time.UTC},
+	}
+	for _, tt := range tests {
+		repo := NewAnalyticsRepository(&gorm.DB{Config: &gorm.Config{Dialector: tt.dialector}})
+		if got := repo.storedTimeLocation(); got != tt.want {
+			t.Errorf("%s: storedTimeLocation() = %v, want %v", tt.dialector.Name(), got, tt.want)
+		}
+	}
+}
+
+func TestWholeHourOffset(t *testing.T) {
+	at := time.Date(2026, 5, 1, 12, 0, 0, 0, time.UTC)
+	kolkata := time.FixedZone("IST", 5*3600+1800)
+	kathmandu := time.FixedZone("NPT", 5*3600+2700)
+	newYork := time.FixedZone("EDT", -4*3600)
+
+	tests := []struct {
+		loc, stored *time.Location
+		want        bool
+	}{
+		{time.UTC, time.UTC, true},
+		{newYork, time.UTC, true},
+		{kolkata, time.UTC, false},
+		{kathmandu, time.UTC, false},
+		{kolkata, kolkata, true},
+		{time.UTC, kolkata, false},
+		{kathmandu, kolkata, false},
+	}
+	for _, tt := range tests {
+		if got := wholeHourOffset(at, tt.loc, tt.stored); got != tt.want {
+			t.Errorf("wholeHourOffset(%v, %v) = %v, want %v", tt.loc, tt.stored, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,48 @@
+package repository
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+
+	"url-shortener/internal/model"
+)
+
+// GetReportAnalytics 汇总报告覆盖的短链接在 [since, until) 内的访问数据
+// shortCodes 为空时覆盖工作区内所有短链接，只列出访问量最高的 limit 个；否则列出全部指定的链接，没有访问的计为 0
+func (r *AnalyticsRepository) GetReportAnalytics(workspaceID uint, shortCodes []string, since, until *time.Time, loc *time.Location, limit int) (*model.AnalyticsSummary, []model.LinkVisitStat, error) {
+	scope := r.inWorkspace(workspaceID)
+	if len(shortCodes) > 0 {
+		scope = r.byShortCodes(workspaceID, shortCodes)
+		limit = 0
+	}
+
+	summary, err := r.summarize(scope, since, until, loc)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	counts, err := r.linkVisitCounts(scope, since, until)
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, code := range shortCodes {
+		if _, ok := counts[code]; !ok {
+			counts[code] = 0
+		}
+	}
+
+	links, err := r.topLinks(counts, limit)
+	if err != nil {
+		return nil, nil, err
+	}
+	return summary, links, nil
+}
+
+// byShortCodes 按工作区内的一组短码过滤
+func (r *AnalyticsRepository) byShortCodes(workspaceID uint, shortCodes []string) func(*gorm.DB) *gorm.DB {
+	scope := r.inWorkspace(workspaceID)
+	return func(db *gorm.DB) *gorm.DB {
+		return scope(db.Where("short_code IN ?", shortCodes))
+	}
+}
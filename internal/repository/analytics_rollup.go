@@ -0,0 +1,204 @@
+package repository
+
+import (
+	"strconv"
+	"time"
+	"unicode/utf8"
+
+	"gorm.io/gorm"
+
+	"url-shortener/internal/model"
+)
+
+const (
+	// rollupBatchSize 汇总行批量写入大小
+	rollupBatchSize = 500
+	// maxRollupValueLength 汇总值的最大字符数，与 VisitRollup.Value 的列宽一致
+	// 原始记录中的来源地址不限长度，超长的值截断后写入，避免汇总失败后一直重试同一小时
+	maxRollupValueLength = 2048
+)
+
+// shortCodeCount 按短码分组的计数结果
+type shortCodeCount struct {
+	ShortCode string
+	Value     string
+	Count     int64
+}
+
+// EarliestVisitTime 获取最早一条原始访问记录的时间，没有记录时返回 nil
+func (r *AnalyticsRepository) EarliestVisitTime() (*time.Time, error) {
+	var visit model.VisitRecord
+	err := r.db.Select("visited_at").Order("visited_at ASC").Limit(1).Find(&visit).Error
+	if err != nil {
+		return nil, err
+	}
+	if visit.VisitedAt.IsZero() {
+		return nil, nil
+	}
+	t := visit.VisitedAt.UTC()
+	return &t, nil
+}
+
+// RollupHour 重新计算以 start 开始的小时汇总，可重复执行
+func (r *AnalyticsRepository) RollupHour(start time.Time) error {
+	start = start.UTC()
+	end := start.Add(time.Hour)
+
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		visits := func() *gorm.DB {
+			return tx.Model(&model.VisitRecord{}).
+				Where("visited_at >= ? AND visited_at < ?", start, end)
+		}
+
+		var rows []*model.HourlyVisitRollup
+		add := func(dimension string, counts []shortCodeCount) {
+			for _, c := range counts {
+				rows = append(rows, &model.HourlyVisitRollup{VisitRollup: model.VisitRollup{
+					ShortCode:   c.ShortCode,
+					BucketStart: start,
+					Dimension:   dimension,
+					Value:       truncateRollupValue(c.Value),
+					Count:       c.Count,
+				}})
+			}
+		}
+
+		var totals []shortCodeCount
+		if err := visits().Select("short_code, COUNT(*) AS count").
+			Group("short_code").Scan(&totals).Error; err != nil {
+			return err
+		}
+		if len(totals) == 0 {
+			return tx.Where("bucket_start = ?", start).Delete(&model.HourlyVisitRollup{}).Error
+		}
+		add(model.DimensionTotal, totals)
+
+		var uniques []shortCodeCount
+		if err := visits().Select("short_code, COUNT(DISTINCT NULLIF(ip_address, '')) AS count").
+			Group("short_code").Scan(&uniques).Error; err != nil {
+			return err
+		}
+		add(model.DimensionUnique, uniques)
+
+		for dimension, column := range visitDimensionColumns {
+			var counts []shortCodeCount
+			if err := visits().Select("short_code, " + column + " AS value, COUNT(*) AS count").
+				Group("short_code, " + column).Scan(&counts).Error; err != nil {
+				return err
+			}
+			add(dimension, counts)
+		}
+
+		if err := tx.Where("bucket_start = ?", start).Delete(&model.HourlyVisitRollup{}).Error; err != nil {
+			return err
+		}
+		return tx.CreateInBatches(rows, rollupBatchSize).Error
+	})
+}
+
+// HourlyRollupStale 判断以 start 开始的小时汇总是否落后于原始访问记录
+// 汇总之后才写入的迟到记录会使原始记录数与汇总的总访问量不一致
+func (r *AnalyticsRepository) HourlyRollupStale(start time.Time) (bool, error) {
+	start = start.UTC()
+
+	var visits int64
+	if err := r.db.Model(&model.VisitRecord{}).
+		Where("visited_at >= ? AND visited_at < ?", start, start.Add(time.Hour)).
+		Count(&visits).Error; err != nil {
+		return false, err
+	}
+
+	var rolledUp int64
+	if err := r.db.Model(&model.HourlyVisitRollup{}).Select("COALESCE(SUM(count), 0)").
+		Where("bucket_start = ? AND dimension = ?", start, model.DimensionTotal).
+		Scan(&rolledUp).Error; err != nil {
+		return false, err
+	}
+	return visits != rolledUp, nil
+}
+
+// RollupDay 基于小时汇总重新计算以 start 开始的天汇总，可重复执行
+// 独立访客数无法由小时数据相加得到，仍从原始访问记录计算
+func (r *AnalyticsRepository) RollupDay(start time.Time) error {
+	start = start.UTC()
+	end := start.Add(24 * time.Hour)
+
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		hourly := func() *gorm.DB {
+			return tx.Model(&model.HourlyVisitRollup{}).
+				Where("bucket_start >= ? AND bucket_start < ?", start, end)
+		}
+
+		var rows []*model.DailyVisitRollup
+		add := func(shortCode, dimension, value string, count int64) {
+			rows = append(rows, &model.DailyVisitRollup{VisitRollup: model.VisitRollup{
+				ShortCode:   shortCode,
+				BucketStart: start,
+				Dimension:   dimension,
+				Value:       value,
+				Count:       count,
+			}})
+		}
+
+		var counts []struct {
+			ShortCode string
+			Dimension string
+			Value     string
+			Count     int64
+		}
+		if err := hourly().Select("short_code, dimension, value, SUM(count) AS count").
+			Where("dimension <> ?", model.DimensionUnique).
+			Group("short_code, dimension, value").Scan(&counts).Error; err != nil {
+			return err
+		}
+		for _, c := range counts {
+			add(c.ShortCode, c.Dimension, c.Value, c.Count)
+		}
+
+		var hours []struct {
+			ShortCode   string
+			BucketStart time.Time
+			Count       int64
+		}
+		if err := hourly().Select("short_code, bucket_start, count").
+			Where("dimension = ?", model.DimensionTotal).Scan(&hours).Error; err != nil {
+			return err
+		}
+		for _, h := range hours {
+			add(h.ShortCode, model.DimensionHour, strconv.Itoa(h.BucketStart.UTC().Hour()), h.Count)
+		}
+
+		var uniques []shortCodeCount
+		if err := tx.Model(&model.VisitRecord{}).
+			Select("short_code, COUNT(DISTINCT NULLIF(ip_address, '')) AS count").
+			Where("visited_at >= ? AND visited_at < ?", start, end).
+			Group("short_code").Scan(&uniques).Error; err != nil {
+			return err
+		}
+		for _, u := range uniques {
+			add(u.ShortCode, model.DimensionUnique, "", u.Count)
+		}
+
+		if err := tx.Where("bucket_start = ?", start).Delete(&model.DailyVisitRollup{}).Error; err != nil {
+			return err
+		}
+		if len(rows) == 0 {
+			return nil
+		}
+		return tx.CreateInBatches(rows, rollupBatchSize).Error
+	})
+}
+
+// truncateRollupValue 按字符截断汇总值，截断后相同的值在查询时合并计数
+func truncateRollupValue(value string) string {
+	if utf8.RuneCountInString(value) <= maxRollupValueLength {
+		return value
+	}
+	return string([]rune(value)[:maxRollupValueLength])
+}
+
+// PurgeVisitsBefore 删除指定时间之前的原始访问记录
+func (r *AnalyticsRepository) PurgeVisitsBefore(t time.Time) (int64, error) {
+	result := r.db.Where("visited_at < ?", t.UTC()).Delete(&model.VisitRecord{})
+	return result.RowsAffected, result.Error
+}
@@ -5,6 +5,7 @@ import (
 	"time"
 
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 
 	"url-shortener/internal/model"
 	"url-shortener/internal/utils"
@@ -28,9 +29,10 @@ func (r *APIKeyRepository) Create(key *model.APIKey) error {
 	return r.db.Create(key).Error
 }
 
+// GetByKey looks up a key by the hash of its raw value
 func (r *APIKeyRepository) GetByKey(key string) (*model.APIKey, error) {
 	var apiKey model.APIKey
-	err := r.db.Where("`key` = ?", key).First(&apiKey).Error
+	err := r.db.Where("key_hash = ?", utils.HashAPIKey(key)).First(&apiKey).Error
 	if err != nil {
 		if err == gorm.ErrRecordNotFound {
 			return nil, nil
@@ -42,7 +44,7 @@ func (r *APIKeyRepository) GetByKey(key string) (*model.APIKey, error) {
 
 func (r *APIKeyRepository) ValidateKey(key string) (*model.APIKey, error) {
 	var apiKey model.APIKey
-	err := r.db.Where("`key` = ? AND is_active = ?", key, true).First(&apiKey).Error
+	err := r.db.Where("key_hash = ? AND is_active = ?", utils.HashAPIKey(key), true).First(&apiKey).Error
 	if err != nil {
 		if err == gorm.ErrRecordNotFound {
 			return nil, fmt.Errorf("invalid API key: %w", utils.ErrUnauthorized)
@@ -53,21 +55,235 @@ func (r *APIKeyRepository) ValidateKey(key string) (*model.APIKey, error) {
 	if apiKey.ExpiresAt != nil && apiKey.ExpiresAt.Before(time.Now()) {
 		return nil, fmt.Errorf("API key has expired: %w", utils.ErrUnauthorized)
 	}
-	// 更新最后使用时间
-	r.db.Model(&apiKey).Update("last_used", time.Now())
+	// 最后使用时间由 APIKeyUsageTracker 定期批量写入
 	return &apiKey, nil
 }
 
-func (r *APIKeyRepository) GetAll() ([]model.APIKey, error) {
+// GetAll returns every key in the workspace
+func (r *APIKeyRepository) GetAll(workspaceID uint) ([]model.APIKey, error) {
 	var keys []model.APIKey
-	err := r.db.Order("created_at DESC").Find(&keys).Error
+	err := r.db.Scopes(inWorkspace(workspaceID)).Order("created_at DESC").Find(&keys).Error
 	return keys, err
 }
 
-func (r *APIKeyRepository) Deactivate(key string) error {
-	return r.db.Model(&model.APIKey{}).Where("`key` = ?", key).Update("is_active", false).Error
+// GetByID returns the key with the given ID. Keys in other workspaces are
+// reported as not found.
+func (r *APIKeyRepository) GetByID(workspaceID, id uint) (*model.APIKey, error) {
+	var apiKey model.APIKey
+	if err := r.db.Scopes(inWorkspace(workspaceID)).First(&apiKey, id).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, fmt.Errorf("API key %d: %w", id, utils.ErrAPIKeyNotFound)
+		}
+		return nil, err
+	}
+	return &apiKey, nil
+}
+
+// FindByPrefix returns all keys in the workspace whose visible prefix equals prefix
+func (r *APIKeyRepository) FindByPrefix(workspaceID uint, prefix string) ([]model.APIKey, error) {
+	var keys []model.APIKey
+	err := r.db.Scopes(inWorkspace(workspaceID)).Where("key_prefix = ?", prefix).Find(&keys).Error
+	return keys, err
+}
+
+// Deactivate marks the key with the given ID as inactive
+func (r *APIKeyRepository) Deactivate(id uint) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&model.APIKey{}).Where("id = ?", id).Update("is_active", false).Error; err != nil {
+			return err
+		}
+		return recordChange(tx, id)
+	})
+}
+
+// Update saves the given fields of key
+func (r *APIKeyRepository) Update(key *model.APIKey, fields ...string) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(key).Select(fields).Updates(key).Error; err != nil {
+			return err
+		}
+		return recordChange(tx, key.ID)
+	})
+}
+
+// RecordDenial stores a request rejected by the key's IP allowlist
+func (r *APIKeyRepository) RecordDenial(denial *model.APIKeyDenial) error {
+	return r.db.Create(denial).Error
+}
+
+// ListDenials returns the most recent rejected requests for the key with the given ID
+func (r *APIKeyRepository) ListDenials(id uint, limit int) ([]model.APIKeyDenial, error) {
+	var denials []model.APIKeyDenial
+	err := r.db.Where("api_key_id = ?", id).Order("created_at DESC, id DESC").Limit(limit).Find(&denials).Error
+	return denials, err
+}
+
+// PruneDenialsBefore deletes rejected requests recorded before the given time
+func (r *APIKeyRepository) PruneDenialsBefore(before time.Time) (int64, error) {
+	result := r.db.Where("created_at < ?", before).Delete(&model.APIKeyDenial{})
+	return result.RowsAffected, result.Error
+}
+
+// Delete permanently removes the key with the given ID
+func (r *APIKeyRepository) Delete(id uint) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := recordChange(tx, id); err != nil {
+			return err
+		}
+		return tx.Delete(&model.APIKey{}, id).Error
+	})
+}
+
+// recordChange appends the key with the given ID to the change feed, so other
+// instances drop it from their caches
+func recordChange(tx *gorm.DB, id uint) error {
+	return tx.Exec("INSERT INTO api_key_changes (api_key_id, key_hash, changed_at) SELECT id, key_hash, ? FROM api_keys WHERE id = ?",
+		time.Now(), id).Error
+}
+
+// recordMemberChange appends the keys of a workspace member to the change feed
+// when their role changes or they leave, so cached roles are dropped as well
+func recordMemberChange(tx *gorm.DB, workspaceID, userID uint) error {
+	return tx.Exec("INSERT INTO api_key_changes (api_key_id, key_hash, changed_at) SELECT id, key_hash, ? FROM api_keys WHERE workspace_id = ? AND user_id = ?",
+		time.Now(), workspaceID, userID).Error
+}
+
+// ChangedKeyHashes returns the hashes of keys changed since the given time
+func (r *APIKeyRepository) ChangedKeyHashes(since time.Time) ([]string, error) {
+	var hashes []string
+	err := r.db.Model(&model.APIKeyChange{}).Where("changed_at >= ?", since).Distinct().Pluck("key_hash", &hashes).Error
+	return hashes, err
+}
+
+// PruneChangesBefore deletes change feed entries older than the given time
+func (r *APIKeyRepository) PruneChangesBefore(before time.Time) (int64, error) {
+	result := r.db.Where("changed_at < ?", before).Delete(&model.APIKeyChange{})
+	return result.RowsAffected, result.Error
+}
+
+// CountActiveWithScope counts active, unexpired keys that were granted scope
+func (r *APIKeyRepository) CountActiveWithScope(scope string) (int64, error) {
+	var count int64
+	// scopes 以 JSON 数组保存，按带引号的权限名匹配，避免部分重名
+	err := r.db.Model(&model.APIKey{}).
+		Where("is_active = ? AND (expires_at IS NULL OR expires_at > ?)", true, time.Now()).
+		Where("scopes LIKE ?", `%"`+scope+`"%`).
+		Count(&count).Error
+	return count, err
+}
+
+// Rotate stores next as the replacement of old. The old key stays valid until
+// graceEnd, and report subscriptions and links owned by it move to the new key.
+// Returns ErrAPIKeyRotated if old was rotated concurrently.
+func (r *APIKeyRepository) Rotate(old, next *model.APIKey, rotatedAt, graceEnd time.Time) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(next).Error; err != nil {
+			return err
+		}
+
+		result := tx.Model(&model.APIKey{}).
+			Where("id = ? AND is_active = ? AND replaced_by_id IS NULL", old.ID, true).
+			Updates(map[string]interface{}{
+				"replaced_by_id": next.ID,
+				"rotated_at":     rotatedAt,
+				"expires_at":     graceEnd,
+			})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return fmt.Errorf("API key %d: %w", old.ID, utils.ErrAPIKeyRotated)
+		}
+		if err := recordChange(tx, old.ID); err != nil {
+			return err
+		}
+
+		if err := tx.Model(&model.ReportSubscription{}).Where("api_key_id = ?", old.ID).
+			Update("api_key_id", next.ID).Error; err != nil {
+			return err
+		}
+		// 链接随 Key 一起转移，本月配额继续累计
+		if err := tx.Model(&model.URL{}).Where("api_key_id = ?", old.ID).
+			Update("api_key_id", next.ID).Error; err != nil {
+			return err
+		}
+
+		old.ReplacedByID = &next.ID
+		old.RotatedAt = &rotatedAt
+		old.ExpiresAt = &graceEnd
+		return nil
+	})
+}
+
+// SaveUsage adds the usage collected in memory for one key. last_used only
+// moves forward, so flushes from several instances can run in any order.
+func (r *APIKeyRepository) SaveUsage(id uint, lastUsed time.Time, lastIP string, endpoints []model.APIKeyEndpointUsage) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(&model.APIKey{}).
+			Where("id = ? AND (last_used IS NULL OR last_used < ?)", id, lastUsed).
+			Updates(map[string]interface{}{"last_used": lastUsed, "last_ip": lastIP}).Error
+		if err != nil {
+			return err
+		}
+
+		// 多个实例可能同时写入同一行，用 upsert 代替先更新后插入，避免唯一索引冲突
+		table := model.APIKeyEndpointUsage{}.TableName()
+		for i := range endpoints {
+			usage := &endpoints[i]
+			usage.APIKeyID = id
+			err := tx.Clauses(clause.OnConflict{
+				Columns: []clause.Column{{Name: "api_key_id"}, {Name: "day"}, {Name: "method"}, {Name: "route"}},
+				DoUpdates: clause.Assignments(map[string]interface{}{
+					"requests": gorm.Expr(table+".requests + ?", usage.Requests),
+					"errors":   gorm.Expr(table+".errors + ?", usage.Errors),
+				}),
+			}).Create(usage).Error
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// PruneUsageBefore deletes per-endpoint usage older than day
+func (r *APIKeyRepository) PruneUsageBefore(day time.Time) (int64, error) {
+	result := r.db.Where("day < ?", day).Delete(&model.APIKeyEndpointUsage{})
+	return result.RowsAffected, result.Error
+}
+
+// UsageTotals returns the request and error counts of every key in the workspace since day
+func (r *APIKeyRepository) UsageTotals(workspaceID uint, since time.Time) (map[uint]model.EndpointUsage, error) {
+	var rows []struct {
+		APIKeyID uint
+		Requests int64
+		Errors   int64
+	}
+	err := r.db.Model(&model.APIKeyEndpointUsage{}).
+		Select("api_key_id, SUM(requests) AS requests, SUM(errors) AS errors").
+		Where("day >= ?", since).
+		Where("api_key_id IN (?)", r.db.Model(&model.APIKey{}).Select("id").Scopes(inWorkspace(workspaceID))).
+		Group("api_key_id").
+		Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+
+	totals := make(map[uint]model.EndpointUsage, len(rows))
+	for _, row := range rows {
+		totals[row.APIKeyID] = model.EndpointUsage{Requests: row.Requests, Errors: row.Errors}
+	}
+	return totals, nil
 }
 
-func (r *APIKeyRepository) Delete(key string) error {
-	return r.db.Where("`key` = ?", key).Delete(&model.APIKey{}).Error
+// EndpointUsage returns the request and error counts of one key per endpoint since day
+func (r *APIKeyRepository) EndpointUsage(id uint, since time.Time) ([]model.EndpointUsage, error) {
+	var usage []model.EndpointUsage
+	err := r.db.Model(&model.APIKeyEndpointUsage{}).
+		Select("method, route, SUM(requests) AS requests, SUM(errors) AS errors").
+		Where("api_key_id = ? AND day >= ?", id, since).
+		Group("method, route").
+		Order("requests DESC").
+		Scan(&usage).Error
+	return usage, err
 }
@@ -0,0 +1,50 @@
+package repository
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"url-shortener/internal/model"
+)
+
+func TestSaveUsageAccumulates(t *testing.T) {
+	db := newTestDB(t)
+	repo := NewAPIKeyRepository(db)
+	key := &model.APIKey{KeyHash: "hash", KeyPrefix: "sk_test", Name: "test", IsActive: true}
+	if err := repo.Create(key); err != nil {
+		t.Fatalf("create key: %v", err)
+	}
+
+	day := time.Date(2026, 5, 1, 0, 0, 0, 0, time.UTC)
+	const flushes = 8
+	var wg sync.WaitGroup
+	for i := 0; i < flushes; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			usage := []model.APIKeyEndpointUsage{
+				{Day: day, Method: "GET", Route: "/api/stats/:code", Requests: 3, Errors: 1},
+				{Day: day, Method: "POST", Route: "/api/shorten", Requests: 1},
+			}
+			if err := repo.SaveUsage(key.ID, day.Add(time.Duration(i)*time.Minute), "192.0.2.1", usage); err != nil {
+				t.Errorf("SaveUsage: %v", err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	var rows []model.APIKeyEndpointUsage
+	if err := db.Order("method ASC").Find(&rows).Error; err != nil {
+		t.Fatalf("load usage: %v", err)
+	}
+	if len(rows) != 2 {
+		t.Fatalf("got %d usage rows, want 2", len(rows))
+	}
+	if rows[0].Requests != 3*flushes || rows[0].Errors != flushes {
+		t.Errorf("GET usage = %d requests, %d errors, want %d, %d", rows[0].Requests, rows[0].Errors, 3*flushes, flushes)
+	}
+	if rows[1].Requests != flushes || rows[1].Errors != 0 {
+		t.Errorf("POST usage = %d requests, %d errors, want %d, 0", rows[1].Requests, rows[1].Errors, flushes)
+	}
+}
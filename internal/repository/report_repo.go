@@ -0,0 +1,94 @@
+package repository
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+
+	"url-shortener/internal/model"
+	"url-shortener/internal/utils"
+)
+
+// ReportRepository 报告订阅及投递记录仓储
+type ReportRepository struct {
+	db *gorm.DB
+}
+
+// NewReportRepository 创建报告订阅仓储
+func NewReportRepository(db *gorm.DB) *ReportRepository {
+	return &ReportRepository{db: db}
+}
+
+// Create 保存报告订阅
+func (r *ReportRepository) Create(sub *model.ReportSubscription) error {
+	return r.db.Create(sub).Error
+}
+
+// ListByAPIKey 列出工作区内 API Key 的所有报告订阅
+func (r *ReportRepository) ListByAPIKey(workspaceID, apiKeyID uint) ([]model.ReportSubscription, error) {
+	subs := []model.ReportSubscription{}
+	err := r.db.Scopes(inWorkspace(workspaceID)).Where("api_key_id = ?", apiKeyID).Order("id ASC").Find(&subs).Error
+	return subs, err
+}
+
+// GetByID 获取工作区内 API Key 名下的报告订阅，不属于该 Key 时视为不存在
+func (r *ReportRepository) GetByID(workspaceID, apiKeyID, id uint) (*model.ReportSubscription, error) {
+	var sub model.ReportSubscription
+	err := r.db.Scopes(inWorkspace(workspaceID)).Where("id = ? AND api_key_id = ?", id, apiKeyID).First(&sub).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, fmt.Errorf("report subscription %d: %w", id, utils.ErrReportNotFound)
+		}
+		return nil, err
+	}
+	return &sub, nil
+}
+
+// Delete 删除工作区内 API Key 名下的报告订阅及其投递记录
+func (r *ReportRepository) Delete(workspaceID, apiKeyID, id uint) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Scopes(inWorkspace(workspaceID)).Where("id = ? AND api_key_id = ?", id, apiKeyID).Delete(&model.ReportSubscription{})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return fmt.Errorf("report subscription %d: %w", id, utils.ErrReportNotFound)
+		}
+		return tx.Where("subscription_id = ?", id).Delete(&model.ReportDelivery{}).Error
+	})
+}
+
+// ListDue 列出到期需要发送的报告订阅
+func (r *ReportRepository) ListDue(now time.Time, limit int) ([]model.ReportSubscription, error) {
+	var subs []model.ReportSubscription
+	err := r.db.Where("is_active = ? AND next_run_at <= ?", true, now.UTC()).
+		Order("next_run_at ASC").Limit(limit).Find(&subs).Error
+	return subs, err
+}
+
+// Claim 将订阅的下一次发送时间推进到 next
+// 以当前的 next_run_at 作为条件更新，多个实例同时运行时只有一个能认领同一次发送
+func (r *ReportRepository) Claim(sub *model.ReportSubscription, next, now time.Time) (bool, error) {
+	result := r.db.Model(&model.ReportSubscription{}).
+		Where("id = ? AND next_run_at = ?", sub.ID, sub.NextRunAt).
+		Updates(map[string]interface{}{"next_run_at": next.UTC(), "last_run_at": now.UTC()})
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected == 1, nil
+}
+
+// RecordDelivery 保存一次投递结果
+func (r *ReportRepository) RecordDelivery(delivery *model.ReportDelivery) error {
+	return r.db.Create(delivery).Error
+}
+
+// ListDeliveries 列出订阅最近的投递记录，最新的在前
+func (r *ReportRepository) ListDeliveries(subscriptionID uint, limit int) ([]model.ReportDelivery, error) {
+	deliveries := []model.ReportDelivery{}
+	err := r.db.Where("subscription_id = ?", subscriptionID).
+		Order("id DESC").Limit(limit).Find(&deliveries).Error
+	return deliveries, err
+}
@@ -0,0 +1,46 @@
+package repository
+
+import (
+	"path/filepath"
+	"testing"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+
+	"url-shortener/internal/model"
+)
+
+// newTestDB 在临时目录中创建 SQLite 数据库并迁移所有表
+// 并发写入时等待锁释放，而不是立即返回 database is locked
+func newTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "test.db")+"?_busy_timeout=5000"), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+	if err != nil {
+		t.Fatalf("open database: %v", err)
+	}
+	err = db.AutoMigrate(
+		&model.URL{},
+		&model.APIKey{},
+		&model.VisitRecord{},
+		&model.HourlyVisitRollup{},
+		&model.DailyVisitRollup{},
+		&model.RollupWatermark{},
+		&model.Conversion{},
+		&model.Click{},
+		&model.APIKeyEndpointUsage{},
+	)
+	if err != nil {
+		t.Fatalf("migrate database: %v", err)
+	}
+
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatalf("get sql.DB: %v", err)
+	}
+	t.Cleanup(func() { sqlDB.Close() })
+	return db
+}
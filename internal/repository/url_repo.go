@@ -12,9 +12,10 @@ import (
 
 // PaginatedQuery 分页查询
 type PaginatedQuery struct {
-	Page     int
-	PageSize int
-	Keyword  string
+	WorkspaceID uint
+	Page        int
+	PageSize    int
+	Keyword     string
 }
 
 // PaginatedResult 分页结果
@@ -37,16 +38,23 @@ func NewURLRepository(db *gorm.DB) *URLRepository {
 	return &URLRepository{db: db}
 }
 
-func (r *URLRepository) CreateWithExpiry(originalURL, shortCode string, expiresAt *time.Time) error {
+func (r *URLRepository) CreateWithExpiry(workspaceID uint, originalURL, shortCode string, expiresAt *time.Time) error {
 	url := &model.URL{
 		OriginalURL: originalURL,
 		ShortCode:   shortCode,
 		ExpiresAt:   expiresAt,
 		IsActive:    true,
+		WorkspaceID: workspaceID,
 	}
 	return r.db.Create(url).Error
 }
 
+// Create 保存短链接
+func (r *URLRepository) Create(url *model.URL) error {
+	return r.db.Create(url).Error
+}
+
+// GetByShortCode 按短码获取有效的短链接，不区分工作区，用于跳转和检查短码是否已被占用
 func (r *URLRepository) GetByShortCode(code string) (*model.URL, error) {
 	var url model.URL
 	err := r.db.Where("short_code = ? AND is_active = ?", code, true).First(&url).Error
@@ -59,13 +67,26 @@ func (r *URLRepository) GetByShortCode(code string) (*model.URL, error) {
 	return &url, nil
 }
 
+// GetByShortCodeInWorkspace 获取工作区内有效的短链接，属于其他工作区时视为不存在
+func (r *URLRepository) GetByShortCodeInWorkspace(workspaceID uint, code string) (*model.URL, error) {
+	var url model.URL
+	err := r.db.Scopes(inWorkspace(workspaceID)).Where("short_code = ? AND is_active = ?", code, true).First(&url).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, fmt.Errorf("URL not found: %w", utils.ErrURLNotFound)
+		}
+		return nil, err
+	}
+	return &url, nil
+}
+
 func (r *URLRepository) IncrementClicks(shortCode string) error {
 	return r.db.Model(&model.URL{}).Where("short_code = ?", shortCode).UpdateColumn("clicks", gorm.Expr("clicks + ?", 1)).Error
 }
 
-func (r *URLRepository) GetAll() ([]*model.URL, error) {
+func (r *URLRepository) GetAll(workspaceID uint) ([]*model.URL, error) {
 	var urls []*model.URL
-	err := r.db.Where("is_active = ?", true).Order("created_at DESC").Find(&urls).Error
+	err := r.db.Scopes(inWorkspace(workspaceID)).Where("is_active = ?", true).Order("created_at DESC").Find(&urls).Error
 	return urls, err
 }
 
@@ -73,10 +94,10 @@ func (r *URLRepository) GetWithPagination(query *PaginatedQuery) (*PaginatedResu
 	var urls []*model.URL
 	var total int64
 
-	db := r.db.Model(&model.URL{}).Where("is_active = ?", true)
+	db := r.db.Model(&model.URL{}).Scopes(inWorkspace(query.WorkspaceID)).Where("is_active = ?", true)
 	
 	if query.Keyword != "" {
-		db = db.Where("original_url LIKE ? OR short_code LIKE ?", "%"+query.Keyword+"%", "%"+query.Keyword+"%")
+		db = db.Where("(original_url LIKE ? OR short_code LIKE ?)", "%"+query.Keyword+"%", "%"+query.Keyword+"%")
 	}
 
 	db.Count(&total)
@@ -103,18 +124,71 @@ func (r *URLRepository) GetWithPagination(query *PaginatedQuery) (*PaginatedResu
 	}, nil
 }
 
-func (r *URLRepository) SearchURLs(keyword string, page, pageSize int) (*PaginatedResult, error) {
+func (r *URLRepository) SearchURLs(workspaceID uint, keyword string, page, pageSize int) (*PaginatedResult, error) {
 	return r.GetWithPagination(&PaginatedQuery{
-		Page:     page,
-		PageSize: pageSize,
-		Keyword:  keyword,
+		WorkspaceID: workspaceID,
+		Page:        page,
+		PageSize:    pageSize,
+		Keyword:     keyword,
 	})
 }
 
-func (r *URLRepository) DeleteByShortCode(code string) error {
-	return r.db.Model(&model.URL{}).Where("short_code = ?", code).Update("is_active", false).Error
+func (r *URLRepository) DeleteByShortCode(workspaceID uint, code string) error {
+	return r.db.Model(&model.URL{}).Scopes(inWorkspace(workspaceID)).Where("short_code = ?", code).Update("is_active", false).Error
+}
+
+// UpdateGroup 设置短链接的分组，group 为空时移出分组
+func (r *URLRepository) UpdateGroup(workspaceID uint, code, group string) error {
+	result := r.db.Model(&model.URL{}).Scopes(inWorkspace(workspaceID)).Where("short_code = ? AND is_active = ?", code, true).Update("link_group", group)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("URL not found: %w", utils.ErrURLNotFound)
+	}
+	return nil
+}
+
+// UpdateTrackClicks 开启或关闭短链接的点击 ID 追踪
+func (r *URLRepository) UpdateTrackClicks(workspaceID uint, code string, enabled bool) error {
+	result := r.db.Model(&model.URL{}).Scopes(inWorkspace(workspaceID)).Where("short_code = ? AND is_active = ?", code, true).Update("track_clicks", enabled)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("URL not found: %w", utils.ErrURLNotFound)
+	}
+	return nil
+}
+
+// ListGroups 列出工作区内所有分组及其有效短链接数量
+func (r *URLRepository) ListGroups(workspaceID uint) ([]model.LinkGroup, error) {
+	var rows []struct {
+		LinkGroup string
+		Links     int64
+	}
+	err := r.db.Model(&model.URL{}).Scopes(inWorkspace(workspaceID)).
+		Select("link_group, COUNT(*) AS links").
+		Where("link_group <> '' AND is_active = ?", true).
+		Group("link_group").Order("link_group").Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+
+	groups := make([]model.LinkGroup, len(rows))
+	for i, row := range rows {
+		groups[i] = model.LinkGroup{Group: row.LinkGroup, Links: row.Links}
+	}
+	return groups, nil
+}
+
+// CountCreatedByAPIKey 统计 API Key 自 since 起创建的短链接数，已删除的链接同样计入
+func (r *URLRepository) CountCreatedByAPIKey(apiKeyID uint, since time.Time) (int64, error) {
+	var count int64
+	err := r.db.Model(&model.URL{}).Where("api_key_id = ? AND created_at >= ?", apiKeyID, since).Count(&count).Error
+	return count, err
 }
 
-func (r *URLRepository) DeleteExpiredURLs() error {
-	return r.db.Model(&model.URL{}).Where("expires_at IS NOT NULL AND expires_at < ? AND is_active = ?", time.Now(), true).Update("is_active", false).Error
+func (r *URLRepository) DeleteExpiredURLs(workspaceID uint) error {
+	return r.db.Model(&model.URL{}).Scopes(inWorkspace(workspaceID)).Where("expires_at IS NOT NULL AND expires_at < ? AND is_active = ?", time.Now(), true).Update("is_active", false).Error
 }
@@ -0,0 +1,187 @@
+package repository
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"gorm.io/gorm"
+
+	"url-shortener/internal/model"
+	"url-shortener/internal/utils"
+)
+
+// inWorkspace 只查询属于工作区的记录，用于带 workspace_id 列的表
+func inWorkspace(workspaceID uint) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Where("workspace_id = ?", workspaceID)
+	}
+}
+
+// WorkspaceRepository 工作区、用户及成员关系仓储
+type WorkspaceRepository struct {
+	db *gorm.DB
+}
+
+// NewWorkspaceRepository 创建工作区仓储
+func NewWorkspaceRepository(db *gorm.DB) *WorkspaceRepository {
+	return &WorkspaceRepository{db: db}
+}
+
+// Create 创建工作区，ownerID 不为空时将该用户设为所有者
+func (r *WorkspaceRepository) Create(workspace *model.Workspace, ownerID *uint) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(workspace).Error; err != nil {
+			return err
+		}
+		if ownerID == nil {
+			return nil
+		}
+		return tx.Create(&model.WorkspaceMember{WorkspaceID: workspace.ID, UserID: *ownerID, Role: model.RoleOwner}).Error
+	})
+}
+
+// GetByID 获取工作区
+func (r *WorkspaceRepository) GetByID(id uint) (*model.Workspace, error) {
+	var workspace model.Workspace
+	if err := r.db.First(&workspace, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, fmt.Errorf("workspace %d: %w", id, utils.ErrWorkspaceNotFound)
+		}
+		return nil, err
+	}
+	return &workspace, nil
+}
+
+// Default 获取默认工作区，不存在时创建
+// 按 is_default 标识查找，不按名称，同名的自助工作区不会被当作默认工作区
+func (r *WorkspaceRepository) Default() (*model.Workspace, error) {
+	isDefault := true
+	workspace := model.Workspace{Name: model.DefaultWorkspaceName, IsDefault: &isDefault}
+	err := r.db.Where("is_default = ?", true).FirstOrCreate(&workspace).Error
+	if err != nil {
+		// 并发创建时唯一索引冲突，读取另一方创建的工作区
+		var existing model.Workspace
+		if r.db.Where("is_default = ?", true).First(&existing).Error == nil {
+			return &existing, nil
+		}
+		return nil, err
+	}
+	return &workspace, nil
+}
+
+// ListForUser 列出用户所在的工作区及其角色
+func (r *WorkspaceRepository) ListForUser(userID uint) ([]model.WorkspaceMembership, error) {
+	memberships := []model.WorkspaceMembership{}
+	err := r.db.Table("workspaces").
+		Select("workspaces.*, workspace_members.role").
+		Joins("JOIN workspace_members ON workspace_members.workspace_id = workspaces.id").
+		Where("workspace_members.user_id = ?", userID).
+		Order("workspaces.id ASC").Scan(&memberships).Error
+	return memberships, err
+}
+
+// FindOrCreateUser 按邮箱（不区分大小写）获取用户，不存在时创建
+func (r *WorkspaceRepository) FindOrCreateUser(email, name string) (*model.User, error) {
+	user := model.User{Email: strings.ToLower(email)}
+	err := r.db.Where("email = ?", user.Email).Attrs(model.User{Name: name}).FirstOrCreate(&user).Error
+	return &user, err
+}
+
+// GetUserByEmail 按邮箱（不区分大小写）获取用户，不存在时返回 ErrNotFound
+func (r *WorkspaceRepository) GetUserByEmail(email string) (*model.User, error) {
+	var users []model.User
+	if err := r.db.Where("email = ?", strings.ToLower(email)).Limit(1).Find(&users).Error; err != nil {
+		return nil, err
+	}
+	if len(users) == 0 {
+		return nil, fmt.Errorf("user %s: %w", email, utils.ErrNotFound)
+	}
+	return &users[0], nil
+}
+
+// Role 获取用户在工作区中的角色，不是成员时返回 ErrMemberNotFound
+func (r *WorkspaceRepository) Role(workspaceID, userID uint) (string, error) {
+	var members []model.WorkspaceMember
+	err := r.db.Where("workspace_id = ? AND user_id = ?", workspaceID, userID).Limit(1).Find(&members).Error
+	if err != nil {
+		return "", err
+	}
+	if len(members) == 0 {
+		return "", fmt.Errorf("user %d in workspace %d: %w", userID, workspaceID, utils.ErrMemberNotFound)
+	}
+	return members[0].Role, nil
+}
+
+// ListMembers 列出工作区的成员
+func (r *WorkspaceRepository) ListMembers(workspaceID uint) ([]model.Member, error) {
+	members := []model.Member{}
+	err := r.db.Table("workspace_members").
+		Select("users.id AS user_id, users.email, users.name, workspace_members.role, workspace_members.created_at").
+		Joins("JOIN users ON users.id = workspace_members.user_id").
+		Where("workspace_members.workspace_id = ?", workspaceID).
+		Order("workspace_members.id ASC").Scan(&members).Error
+	return members, err
+}
+
+// AddMember 添加工作区成员，用户已是成员时返回 ErrAlreadyExists
+func (r *WorkspaceRepository) AddMember(member *model.WorkspaceMember) error {
+	if _, err := r.Role(member.WorkspaceID, member.UserID); err == nil {
+		return fmt.Errorf("user %d in workspace %d: %w", member.UserID, member.WorkspaceID, utils.ErrAlreadyExists)
+	} else if !errors.Is(err, utils.ErrMemberNotFound) {
+		return err
+	}
+	return r.db.Create(member).Error
+}
+
+// UpdateRole 修改成员角色，不允许降级工作区唯一的所有者
+// 成员名下 API Key 缓存的角色通过变更记录清除
+func (r *WorkspaceRepository) UpdateRole(workspaceID, userID uint, role string) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if role != model.RoleOwner {
+			if err := ensureOtherOwner(tx, workspaceID, userID); err != nil {
+				return err
+			}
+		}
+		result := tx.Model(&model.WorkspaceMember{}).Where("workspace_id = ? AND user_id = ?", workspaceID, userID).Update("role", role)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return fmt.Errorf("user %d in workspace %d: %w", userID, workspaceID, utils.ErrMemberNotFound)
+		}
+		return recordMemberChange(tx, workspaceID, userID)
+	})
+}
+
+// RemoveMember 移除工作区成员，不允许移除唯一的所有者
+// 成员名下的 API Key 随之失效（见 AuthorizationService.PrincipalForKey），缓存通过变更记录清除
+func (r *WorkspaceRepository) RemoveMember(workspaceID, userID uint) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := ensureOtherOwner(tx, workspaceID, userID); err != nil {
+			return err
+		}
+		result := tx.Where("workspace_id = ? AND user_id = ?", workspaceID, userID).Delete(&model.WorkspaceMember{})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return fmt.Errorf("user %d in workspace %d: %w", userID, workspaceID, utils.ErrMemberNotFound)
+		}
+		return recordMemberChange(tx, workspaceID, userID)
+	})
+}
+
+// ensureOtherOwner 用户是工作区所有者时，确认还有其他所有者
+func ensureOtherOwner(tx *gorm.DB, workspaceID, userID uint) error {
+	var owners []uint
+	err := tx.Model(&model.WorkspaceMember{}).Where("workspace_id = ? AND role = ?", workspaceID, model.RoleOwner).
+		Pluck("user_id", &owners).Error
+	if err != nil {
+		return err
+	}
+	if len(owners) == 1 && owners[0] == userID {
+		return fmt.Errorf("workspace %d: %w", workspaceID, utils.ErrLastOwner)
+	}
+	return nil
+}
@@ -0,0 +1,81 @@
+package service
+
+import (
+	"math"
+	"time"
+
+	"url-shortener/internal/model"
+)
+
+// CompareAnalytics 对比同一短链接在两个时间段的统计摘要
+// 维度对比基于各时间段的 Top 列表，只出现在一侧 Top 列表中的取值另一侧按 0 计算
+func (s *AnalyticsService) CompareAnalytics(workspaceID uint, shortCode string, current, previous model.TimeRange, loc *time.Location) (*model.AnalyticsComparison, error) {
+	currentSummary, err := s.analyticsRepo.GetAnalyticsSummary(workspaceID, shortCode, &current.Since, &current.Until, loc)
+	if err != nil {
+		return nil, err
+	}
+	previousSummary, err := s.analyticsRepo.GetAnalyticsSummary(workspaceID, shortCode, &previous.Since, &previous.Until, loc)
+	if err != nil {
+		return nil, err
+	}
+
+	return &model.AnalyticsComparison{
+		CurrentRange:   current,
+		PreviousRange:  previous,
+		Current:        currentSummary,
+		Previous:       previousSummary,
+		TotalVisits:    newMetricDelta(currentSummary.TotalVisits, previousSummary.TotalVisits),
+		UniqueVisitors: newMetricDelta(currentSummary.UniqueVisitors, previousSummary.UniqueVisitors),
+		Dimensions: map[string]map[string]model.MetricDelta{
+			"top_countries":     compareDimension(currentSummary.TopCountries, previousSummary.TopCountries),
+			"top_devices":       compareDimension(currentSummary.TopDevices, previousSummary.TopDevices),
+			"top_browsers":      compareDimension(currentSummary.TopBrowsers, previousSummary.TopBrowsers),
+			"top_os":            compareDimension(currentSummary.TopOS, previousSummary.TopOS),
+			"top_referrers":     compareDimension(currentSummary.TopReferrers, previousSummary.TopReferrers),
+			"utm_sources":       compareDimension(currentSummary.UTMSources, previousSummary.UTMSources),
+			"utm_mediums":       compareDimension(currentSummary.UTMMediums, previousSummary.UTMMediums),
+			"utm_campaigns":     compareDimension(currentSummary.UTMCampaigns, previousSummary.UTMCampaigns),
+			"traffic_sources":   compareDimension(currentSummary.TrafficSources, previousSummary.TrafficSources),
+			"referring_domains": compareDimension(currentSummary.ReferringDomains, previousSummary.ReferringDomains),
+		},
+		Timezone: currentSummary.Timezone,
+	}, nil
+}
+
+// PreviousPeriod 返回紧邻 r 之前、天数相同的时间段
+// 按自然日回退而不是按固定时长，跨越夏令时切换时仍以本地零点对齐
+func PreviousPeriod(r model.TimeRange) model.TimeRange {
+	days := int(math.Round(r.Until.Sub(r.Since).Hours() / 24))
+	if days <= 0 {
+		return model.TimeRange{Since: r.Since.Add(-r.Until.Sub(r.Since)), Until: r.Since}
+	}
+	return model.TimeRange{Since: r.Since.AddDate(0, 0, -days), Until: r.Since}
+}
+
+// compareDimension 按取值对比两个时间段的维度分布
+func compareDimension(current, previous map[string]int) map[string]model.MetricDelta {
+	deltas := make(map[string]model.MetricDelta, len(current)+len(previous))
+	for value, count := range current {
+		deltas[value] = newMetricDelta(int64(count), int64(previous[value]))
+	}
+	for value, count := range previous {
+		if _, ok := current[value]; !ok {
+			deltas[value] = newMetricDelta(0, int64(count))
+		}
+	}
+	return deltas
+}
+
+// newMetricDelta 计算绝对变化和百分比变化，百分比保留两位小数
+func newMetricDelta(current, previous int64) model.MetricDelta {
+	delta := model.MetricDelta{
+		Current:  current,
+		Previous: previous,
+		Change:   current - previous,
+	}
+	if previous != 0 {
+		pct := math.Round(float64(delta.Change)/float64(previous)*10000) / 100
+		delta.PercentChange = &pct
+	}
+	return delta
+}
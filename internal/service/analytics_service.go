@@ -4,90 +4,146 @@ import (
 	"context"
 	"fmt"
 	"net"
+	"net/url"
 	"strings"
 	"time"
+	"unicode/utf8"
+	"url-shortener/internal/config"
 	"url-shortener/internal/model"
 	"url-shortener/internal/repository"
 	"url-shortener/internal/utils"
 )
 
 type AnalyticsService struct {
-	urlRepo         *repository.URLRepository
-	analyticsRepo   *repository.AnalyticsRepository
+	urlRepo       *repository.URLRepository
+	analyticsRepo *repository.AnalyticsRepository
+	referrers     *utils.ReferrerClassifier
+	anonymizer    *utils.IPAnonymizer
+	userAgents    *utils.UserAgentParser
+	clickIDParam  string
+	honorDNT      bool
+	broker        *VisitBroker
+
+	conversionWindow time.Duration // 点击后可回传转化的时长，0 表示不限制
 }
 
-func NewAnalyticsService(urlRepo *repository.URLRepository, analyticsRepo *repository.AnalyticsRepository) *AnalyticsService {
+func NewAnalyticsService(urlRepo *repository.URLRepository, analyticsRepo *repository.AnalyticsRepository, broker *VisitBroker, userAgents *utils.UserAgentParser, cfg *config.AnalyticsConfig) *AnalyticsService {
 	return &AnalyticsService{
 		urlRepo:       urlRepo,
 		analyticsRepo: analyticsRepo,
+		referrers:     utils.NewReferrerClassifier(cfg.SearchDomains, cfg.SocialDomains, cfg.EmailDomains),
+		anonymizer:    utils.NewIPAnonymizer(cfg.IPAnonymization, cfg.IPHashKey),
+		honorDNT:      cfg.HonorDoNotTrack,
+		userAgents:    userAgents,
+		clickIDParam:  cfg.ClickIDParam,
+		broker:        broker,
+
+		conversionWindow: time.Duration(cfg.ConversionWindowDays) * 24 * time.Hour,
 	}
 }
 
-// RecordVisit 记录访问事件
-func (s *AnalyticsService) RecordVisit(ctx context.Context, shortCode, ipAddress, userAgent, referer string) error {
-	// 获取真实IP地址（处理代理情况）
-	realIP := s.getRealIP(ctx, ipAddress)
+// VisitInfo 一次短链接访问的请求信息
+type VisitInfo struct {
+	IPAddress string
+	UserAgent string
+	Referer   string
+	Query     url.Values // 短链接请求自身携带的查询参数
+	// DoNotTrack 请求带有 DNT: 1 或 Sec-GPC: 1
+	DoNotTrack bool
+}
+
+// RecordVisit 记录访问事件，返回保存后的访问记录
+func (s *AnalyticsService) RecordVisit(ctx context.Context, link *model.URL, info *VisitInfo) (*model.VisitRecord, error) {
+	// 客户端IP已由处理器按受信任代理配置解析
+	realIP := info.IPAddress
 
 	// 解析用户代理信息
-	userAgentInfo := utils.ParseUserAgent(userAgent)
+	userAgentInfo := s.userAgents.Parse(info.UserAgent)
+
+	// UTM 参数：短链接请求中的参数优先于目标地址中的参数
+	utm := utils.MergeUTMParams(utils.UTMParamsFromURL(link.OriginalURL), utils.UTMParamsFromQuery(info.Query))
+
+	// 规范化来源域名并判断流量来源
+	referrerHost, trafficSource := s.referrers.Classify(info.Referer, utm.Medium)
 
 	// TODO: 实现IP地理位置解析
 	// 这里只是一个模拟实现，实际部署时可以集成真实的IP地理位置服务
 	country, city := s.getLocationFromIP(realIP)
 
-	// 创建访问记录
+	visitedAt := time.Now().UTC()
+
+	// 创建访问记录，IP 按隐私配置匿名化后存储
 	visitRecord := &model.VisitRecord{
-		ShortCode:  shortCode,
-		IPAddress:  realIP,
-		UserAgent:  userAgent,
-		Referer:    referer,
-		Country:    country,
-		City:       city,
-		UserOS:     userAgentInfo.OS,
-		Browser:    userAgentInfo.Browser,
-		DeviceType: userAgentInfo.DeviceType,
-		VisitedAt:  time.Now(),
+		ShortCode:      link.ShortCode,
+		IPAddress:      s.anonymizer.Anonymize(realIP, visitedAt),
+		UserAgent:      info.UserAgent,
+		Referer:        info.Referer,
+		ReferrerHost:   referrerHost,
+		TrafficSource:  trafficSource,
+		Country:        country,
+		City:           city,
+		UserOS:         truncate(userAgentInfo.OS, 50),
+		OSVersion:      truncate(userAgentInfo.OSVersion, 50),
+		Browser:        truncate(userAgentInfo.Browser, 50),
+		BrowserVersion: truncate(userAgentInfo.Version, 50),
+		DeviceType:     truncate(userAgentInfo.DeviceType, 20),
+		DeviceModel:    truncate(userAgentInfo.Device, 100),
+		UTMSource:      truncate(utm.Source, 255),
+		UTMMedium:      truncate(utm.Medium, 255),
+		UTMCampaign:    truncate(utm.Campaign, 255),
+		UTMTerm:        truncate(utm.Term, 255),
+		UTMContent:     truncate(utm.Content, 255),
+		VisitedAt:      visitedAt,
+	}
+
+	// 访客要求不跟踪时只保留汇总维度，去掉 IP、User-Agent、完整来源地址和城市
+	if !s.TrackingAllowed(info) {
+		visitRecord.IPAddress = ""
+		visitRecord.UserAgent = ""
+		visitRecord.Referer = ""
+		visitRecord.City = ""
 	}
 
 	// 保存访问记录
 	err := s.analyticsRepo.RecordVisit(visitRecord)
 	if err != nil {
-		return fmt.Errorf("failed to record visit: %w", err)
+		return nil, fmt.Errorf("failed to record visit: %w", err)
 	}
 
-	return nil
+	// 推送给实时访问流的订阅者
+	s.broker.Publish(link.WorkspaceID, visitRecord)
+
+	return visitRecord, nil
 }
 
-// GetAnalyticsSummary 获取统计摘要
-func (s *AnalyticsService) GetAnalyticsSummary(shortCode string, since *time.Time, until *time.Time) (*model.AnalyticsSummary, error) {
-	return s.analyticsRepo.GetAnalyticsSummary(shortCode, since, until)
+// GetAnalyticsSummary 获取统计摘要，按 loc 时区划分天和小时
+func (s *AnalyticsService) GetAnalyticsSummary(workspaceID uint, shortCode string, since *time.Time, until *time.Time, loc *time.Location) (*model.AnalyticsSummary, error) {
+	return s.analyticsRepo.GetAnalyticsSummary(workspaceID, shortCode, since, until, loc)
 }
 
-// GetRecentVisits 获取最近访问记录
-func (s *AnalyticsService) GetRecentVisits(shortCode string, limit int, since *time.Time) ([]*model.VisitRecord, error) {
-	return s.analyticsRepo.GetRecentVisits(shortCode, limit, since)
+// GetGroupAnalytics 获取分组内所有短链接的汇总分析数据
+func (s *AnalyticsService) GetGroupAnalytics(workspaceID uint, group string, since, until *time.Time, loc *time.Location) (*model.GroupAnalytics, error) {
+	return s.analyticsRepo.GetGroupAnalytics(workspaceID, group, since, until, loc)
 }
 
-// getRealIP 获取真实IP地址（处理代理情况）
-func (s *AnalyticsService) getRealIP(ctx context.Context, ipAddress string) string {
-	// 在上下文中可能有更准确的IP信息
-	// 这里简单处理，实际实现可能需要检查X-Forwarded-For、X-Real-IP等头部
-	if forwardedFor := ctx.Value("X-Forwarded-For"); forwardedFor != nil {
-		if forwardedStr, ok := forwardedFor.(string); ok {
-			ips := strings.Split(forwardedStr, ",")
-			if len(ips) > 0 {
-				return strings.TrimSpace(ips[0])
-			}
-		}
-	}
+// GetDashboard 获取工作区内所有短链接的汇总数据看板
+func (s *AnalyticsService) GetDashboard(q *repository.DashboardQuery) (*model.DashboardSummary, error) {
+	return s.analyticsRepo.GetDashboard(q)
+}
 
-	if realIP := ctx.Value("X-Real-IP"); realIP != nil {
-		if realIPStr, ok := realIP.(string); ok {
-			return realIPStr
-		}
-	}
+// GetRecentVisits 获取最近访问记录
+func (s *AnalyticsService) GetRecentVisits(workspaceID uint, shortCode string, limit int, since *time.Time) ([]*model.VisitRecord, error) {
+	return s.analyticsRepo.GetRecentVisits(workspaceID, shortCode, limit, since)
+}
+
+// SubscribeVisits 订阅工作区内短链接的实时访问事件，shortCode 为空时订阅工作区内所有短链接
+func (s *AnalyticsService) SubscribeVisits(workspaceID uint, shortCode string) (*VisitSubscription, error) {
+	return s.broker.Subscribe(workspaceID, shortCode)
+}
 
-	return ipAddress
+// StreamVisits 逐行读取访问记录，shortCode 为空时读取工作区内全部短链接
+func (s *AnalyticsService) StreamVisits(workspaceID uint, shortCode string, since, until *time.Time, fn func(*model.VisitRecord) error) error {
+	return s.analyticsRepo.StreamVisits(workspaceID, shortCode, since, until, fn)
 }
 
 // getLocationFromIP 从IP获取地理位置信息（模拟实现）
@@ -98,12 +154,12 @@ func (s *AnalyticsService) getLocationFromIP(ip string) (country, city string) {
 	// - IPinfo
 	// - ip-api.com
 	// - 其他第三方服务
-	
+
 	// 对于私有IP地址，返回特殊标记
 	if s.isPrivateIP(ip) {
 		return "Local", "Private Network"
 	}
-	
+
 	// 这里可以集成真实的地理位置服务
 	// 目前返回未知
 	return "Unknown", "Unknown"
@@ -115,7 +171,7 @@ func (s *AnalyticsService) isPrivateIP(ip string) bool {
 	if parsedIP == nil {
 		return true // 如果无法解析，假设是私有的
 	}
-	
+
 	// 检查是否为私有IP段
 	privateCIDRs := []string{
 		"10.0.0.0/8",     // RFC 1918
@@ -124,13 +180,23 @@ func (s *AnalyticsService) isPrivateIP(ip string) bool {
 		"127.0.0.0/8",    // localhost
 		"::1/128",        // IPv6 localhost
 	}
-	
+
 	for _, cidr := range privateCIDRs {
 		_, network, _ := net.ParseCIDR(cidr)
 		if network.Contains(parsedIP) {
 			return true
 		}
 	}
-	
+
 	return false
-}
\ No newline at end of file
+}
+
+// truncate 按字符截断字符串，避免超出列宽（MySQL 和 PostgreSQL 的 varchar 长度按字符计算）
+// 无效的 UTF-8 字节替换为 U+FFFD，不会在多字节字符中间截断
+func truncate(s string, n int) string {
+	s = strings.ToValidUTF8(s, "\uFFFD")
+	if utf8.RuneCountInString(s) <= n {
+		return s
+	}
+	return string([]rune(s)[:n])
+}
@@ -0,0 +1,32 @@
+package service
+
+import (
+	"testing"
+	"unicode/utf8"
+)
+
+func TestTruncate(t *testing.T) {
+	tests := []struct {
+		in   string
+		n    int
+		want string
+	}{
+		{"chrome", 10, "chrome"},
+		{"chrome", 6, "chrome"},
+		{"chrome", 3, "chr"},
+		{"春季促销活动", 4, "春季促销"},
+		{"a春b", 2, "a春"},
+		{"emoji 🎉🎉", 7, "emoji 🎉"},
+		{"bad \xff\xfe byte", 100, "bad � byte"},
+		{"", 5, ""},
+	}
+	for _, tt := range tests {
+		got := truncate(tt.in, tt.n)
+		if got != tt.want {
+			t.Errorf("truncate(%q, %d) = %q, want %q", tt.in, tt.n, got, tt.want)
+		}
+		if !utf8.ValidString(got) {
+			t.Errorf("truncate(%q, %d) returned invalid UTF-8", tt.in, tt.n)
+		}
+	}
+}
@@ -0,0 +1,92 @@
+package service
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	"url-shortener/internal/cache"
+	"url-shortener/internal/config"
+	"url-shortener/internal/repository"
+)
+
+const (
+	// changeFeedLookback is how far each poll reaches back before the previous
+	// one, covering clock skew between instances and slow commits
+	changeFeedLookback = 10 * time.Second
+	// changeFeedRetention is how long change feed entries are kept
+	changeFeedRetention = time.Hour
+)
+
+// APIKeyCacheWatcher polls the API key change feed and drops changed keys
+// from the local cache, so revocations made on other instances take effect
+// within one poll interval. The cache TTL still bounds staleness if polling fails.
+type APIKeyCacheWatcher struct {
+	repo     *repository.APIKeyRepository
+	cache    *cache.APIKeyCache
+	interval time.Duration
+	stop     chan struct{}
+	done     chan struct{}
+	stopOnce sync.Once
+}
+
+// NewAPIKeyCacheWatcher creates a change feed watcher for keyCache
+func NewAPIKeyCacheWatcher(repo *repository.APIKeyRepository, keyCache *cache.APIKeyCache, cfg *config.APIKeyConfig) *APIKeyCacheWatcher {
+	return &APIKeyCacheWatcher{
+		repo:     repo,
+		cache:    keyCache,
+		interval: cfg.CachePollInterval,
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+}
+
+// Start polls the change feed in the background
+func (w *APIKeyCacheWatcher) Start() {
+	go func() {
+		defer close(w.done)
+
+		ticker := time.NewTicker(w.interval)
+		defer ticker.Stop()
+
+		lastPoll := time.Now()
+		for {
+			select {
+			case <-ticker.C:
+			case <-w.stop:
+				return
+			}
+
+			now := time.Now()
+			if err := w.poll(lastPoll.Add(-changeFeedLookback)); err != nil {
+				log.Printf("Failed to poll API key changes: %v", err)
+				continue
+			}
+			lastPoll = now
+
+			if _, err := w.repo.PruneChangesBefore(now.Add(-changeFeedRetention)); err != nil {
+				log.Printf("Failed to prune API key changes: %v", err)
+			}
+		}
+	}()
+}
+
+// Stop stops polling
+func (w *APIKeyCacheWatcher) Stop() {
+	w.stopOnce.Do(func() {
+		close(w.stop)
+	})
+	<-w.done
+}
+
+// poll drops every key changed since the given time from the cache
+func (w *APIKeyCacheWatcher) poll(since time.Time) error {
+	hashes, err := w.repo.ChangedKeyHashes(since)
+	if err != nil {
+		return err
+	}
+	for _, hash := range hashes {
+		w.cache.Invalidate(hash)
+	}
+	return nil
+}
@@ -0,0 +1,60 @@
+package service
+
+import (
+	"sync"
+	"time"
+)
+
+// maxDenialThrottleEntries bounds the number of key and IP pairs remembered by
+// denialThrottle. When it is reached, pairs whose interval has passed are dropped.
+const maxDenialThrottleEntries = 10000
+
+// denialThrottle limits how often requests rejected by a key's IP allowlist
+// are logged and stored, so a misconfigured client retrying in a loop cannot
+// turn every rejected request into a database write
+type denialThrottle struct {
+	interval time.Duration
+
+	mu   sync.Mutex
+	last map[denialSource]time.Time
+}
+
+// denialSource is a key used from a disallowed address
+type denialSource struct {
+	keyID uint
+	ip    string
+}
+
+func newDenialThrottle(interval time.Duration) *denialThrottle {
+	return &denialThrottle{interval: interval, last: make(map[denialSource]time.Time)}
+}
+
+// allow reports whether a denial of keyID from ip at now should be recorded.
+// The first denial of each pair is recorded, then at most one per interval.
+func (d *denialThrottle) allow(keyID uint, ip string, now time.Time) bool {
+	if d.interval <= 0 {
+		return true
+	}
+	source := denialSource{keyID: keyID, ip: ip}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if last, ok := d.last[source]; ok && now.Sub(last) < d.interval {
+		return false
+	}
+	if len(d.last) >= maxDenialThrottleEntries {
+		for s, last := range d.last {
+			if now.Sub(last) >= d.interval {
+				delete(d.last, s)
+			}
+		}
+		// Every pair is still within its interval, so this is a flood from
+		// many addresses: skip recording until entries expire. The denial is
+		// still counted by the api_key_ip_denials_total metric.
+		if len(d.last) >= maxDenialThrottleEntries {
+			return false
+		}
+	}
+	d.last[source] = now
+	return true
+}
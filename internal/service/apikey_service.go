@@ -3,30 +3,120 @@ package service
 import (
 	"crypto/rand"
 	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
 	"time"
 
+	"url-shortener/internal/cache"
+	"url-shortener/internal/config"
+	"url-shortener/internal/metrics"
 	"url-shortener/internal/model"
 	"url-shortener/internal/repository"
+	"url-shortener/internal/utils"
 )
 
 // APIKeyService handles API key business logic
 type APIKeyService struct {
-	repo *repository.APIKeyRepository
+	repo       *repository.APIKeyRepository
+	urlRepo    *repository.URLRepository
+	workspaces *repository.WorkspaceRepository
+	authz      *AuthorizationService
+	cache      *cache.APIKeyCache // nil disables caching
+	cfg        *config.APIKeyConfig
+	denials    *denialThrottle
 }
 
-// NewAPIKeyService creates a new API key service
-func NewAPIKeyService(repo *repository.APIKeyRepository) *APIKeyService {
-	return &APIKeyService{repo: repo}
+// NewAPIKeyService creates a new API key service. keyCache may be nil.
+func NewAPIKeyService(repo *repository.APIKeyRepository, urlRepo *repository.URLRepository, workspaces *repository.WorkspaceRepository,
+	authz *AuthorizationService, keyCache *cache.APIKeyCache, cfg *config.APIKeyConfig) *APIKeyService {
+	return &APIKeyService{repo: repo, urlRepo: urlRepo, workspaces: workspaces, authz: authz, cache: keyCache, cfg: cfg,
+		denials: newDenialThrottle(cfg.DenialLogInterval)}
 }
 
-// GenerateKey generates a new API key
-func (s *APIKeyService) GenerateKey(req *model.CreateAPIKeyRequest) (*model.APIKeyResponse, error) {
-	// Generate random key
-	keyBytes := make([]byte, 32)
-	if _, err := rand.Read(keyBytes); err != nil {
+// BootstrapKeyName is the name given to admin keys created at startup or by
+// the bootstrap-admin command
+const BootstrapKeyName = "bootstrap-admin"
+
+// GenerateKey generates a new API key on behalf of p. The key is created in
+// p's workspace unless req names another workspace in which p's user has
+// keys:admin. A key that acts for a user can only hold scopes the user's role
+// grants. Keys that could manage owners (keys for an owner, or workspace
+// service keys with keys:admin) can only be created by owners.
+func (s *APIKeyService) GenerateKey(p *Principal, req *model.CreateAPIKeyRequest) (*model.APIKeyResponse, error) {
+	workspaceID := p.WorkspaceID
+	if req.WorkspaceID != 0 {
+		workspaceID = req.WorkspaceID
+	}
+	if err := s.authz.AuthorizeWorkspace(p, workspaceID, model.ScopeKeysAdmin); err != nil {
+		return nil, err
+	}
+
+	scopes := normalizeScopes(req.Scopes)
+	if req.UserID != nil {
+		role, err := s.workspaces.Role(workspaceID, *req.UserID)
+		if err != nil {
+			if errors.Is(err, utils.ErrMemberNotFound) {
+				return nil, fmt.Errorf("user %d is not a member of workspace %d: %w", *req.UserID, workspaceID, utils.ErrInvalidInput)
+			}
+			return nil, err
+		}
+		for _, scope := range scopes {
+			if !RoleAllows(role, scope) {
+				return nil, fmt.Errorf("scope %s exceeds the %s role of user %d: %w", scope, role, *req.UserID, utils.ErrInvalidInput)
+			}
+		}
+		if role == model.RoleOwner && !s.canManageOwners(p, workspaceID) {
+			return nil, fmt.Errorf("only owners can create keys for an owner: %w", utils.ErrForbidden)
+		}
+	} else if slices.Contains(scopes, model.ScopeKeysAdmin) && !s.canManageOwners(p, workspaceID) {
+		return nil, fmt.Errorf("only owners can create workspace service keys with the %s scope: %w", model.ScopeKeysAdmin, utils.ErrForbidden)
+	}
+
+	return s.generateKey(workspaceID, req.UserID, scopes, req)
+}
+
+// canManageOwners reports whether p can manage the owners of the given workspace
+func (s *APIKeyService) canManageOwners(p *Principal, workspaceID uint) bool {
+	if workspaceID == p.WorkspaceID {
+		return s.authz.CanManageOwners(p)
+	}
+	// AuthorizeWorkspace already confirmed p's user is a member of the workspace
+	role, err := s.workspaces.Role(workspaceID, *p.UserID)
+	return err == nil && role == model.RoleOwner
+}
+
+// authorizeKeyChange checks that p may rotate, update, revoke or delete the
+// target key. Keys of owners and service keys with keys:admin can only be
+// managed by those who could have created them (see GenerateKey).
+func (s *APIKeyService) authorizeKeyChange(p *Principal, target *model.APIKey) error {
+	if s.canManageOwners(p, target.WorkspaceID) {
+		return nil
+	}
+	if target.UserID == nil {
+		if slices.Contains(target.Scopes, model.ScopeKeysAdmin) {
+			return fmt.Errorf("only owners can manage workspace service keys with the %s scope: %w", model.ScopeKeysAdmin, utils.ErrForbidden)
+		}
+		return nil
+	}
+
+	role, err := s.workspaces.Role(target.WorkspaceID, *target.UserID)
+	if err != nil && !errors.Is(err, utils.ErrMemberNotFound) {
+		return err
+	}
+	if role == model.RoleOwner {
+		return fmt.Errorf("only owners can manage the keys of an owner: %w", utils.ErrForbidden)
+	}
+	return nil
+}
+
+// generateKey stores a new key in the workspace with the settings from req
+func (s *APIKeyService) generateKey(workspaceID uint, userID *uint, scopes []string, req *model.CreateAPIKeyRequest) (*model.APIKeyResponse, error) {
+	key, err := newRawKey()
+	if err != nil {
 		return nil, err
 	}
-	key := "sk_" + hex.EncodeToString(keyBytes)
 
 	// Calculate expiry
 	var expiresAt *time.Time
@@ -35,18 +125,176 @@ func (s *APIKeyService) GenerateKey(req *model.CreateAPIKeyRequest) (*model.APIK
 		expiresAt = &exp
 	}
 
-	apikey := &model.APIKey{
-		APIKey:    key,
-		Name:      req.Name,
-		CreatedAt: time.Now(),
-		ExpiresAt: expiresAt,
-		IsActive:  true,
+	cidrs, err := normalizeCIDRs(req.AllowedCIDRs)
+	if err != nil {
+		return nil, err
+	}
+
+	apikey := newAPIKey(key, req.Name, expiresAt, scopes)
+	apikey.WorkspaceID = workspaceID
+	apikey.UserID = userID
+	apikey.AllowedCIDRs = cidrs
+	apikey.RequestsPerMinute = req.RequestsPerMinute
+	apikey.MonthlyLinkQuota = req.MonthlyLinkQuota
+	return s.storeKey(key, apikey)
+}
+
+// RotateKey issues a new secret with the same name, scopes and report
+// subscriptions as the key with the given ID. The old secret keeps working for
+// grace (the configured default when nil) or until its own expiry, whichever
+// comes first. A key with an expiry gets the same lifetime again.
+func (s *APIKeyService) RotateKey(p *Principal, id uint, grace *time.Duration) (*model.RotateAPIKeyResponse, error) {
+	old, err := s.repo.GetByID(p.WorkspaceID, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.authorizeKeyChange(p, old); err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	if old.ReplacedByID != nil {
+		return nil, fmt.Errorf("API key %d: %w", id, utils.ErrAPIKeyRotated)
+	}
+	if !old.IsActive || (old.ExpiresAt != nil && !old.ExpiresAt.After(now)) {
+		return nil, fmt.Errorf("API key %d: %w", id, utils.ErrAPIKeyInactive)
 	}
 
+	key, err := newRawKey()
+	if err != nil {
+		return nil, err
+	}
+
+	var expiresAt *time.Time
+	if old.ExpiresAt != nil {
+		exp := now.Add(old.ExpiresAt.Sub(old.CreatedAt))
+		expiresAt = &exp
+	}
+	next := newAPIKey(key, old.Name, expiresAt, old.Scopes)
+	next.WorkspaceID = old.WorkspaceID
+	next.UserID = old.UserID
+	next.RequestsPerMinute = old.RequestsPerMinute
+	next.MonthlyLinkQuota = old.MonthlyLinkQuota
+	next.AllowedCIDRs = old.AllowedCIDRs
+
+	period := s.cfg.RotationGracePeriod
+	if grace != nil {
+		period = *grace
+	}
+	graceEnd := now.Add(period)
+	if old.ExpiresAt != nil && old.ExpiresAt.Before(graceEnd) {
+		graceEnd = *old.ExpiresAt
+	}
+
+	if err := s.repo.Rotate(old, next, now, graceEnd); err != nil {
+		return nil, err
+	}
+	s.invalidate(old)
+
+	return &model.RotateAPIKeyResponse{
+		APIKeyResponse:       keyResponse(key, next),
+		PreviousKeyID:        old.ID,
+		PreviousKeyExpiresAt: graceEnd,
+	}, nil
+}
+
+// GenerateSelfServiceKey generates a key for an unauthenticated caller in a
+// new workspace of its own. Self-service keys can never manage other keys, and
+// their usage limits come from the configuration rather than the request.
+func (s *APIKeyService) GenerateSelfServiceKey(req *model.CreateAPIKeyRequest) (*model.APIKeyResponse, error) {
+	for _, scope := range req.Scopes {
+		if scope == model.ScopeKeysAdmin {
+			return nil, fmt.Errorf("self-service keys cannot have the %s scope: %w", model.ScopeKeysAdmin, utils.ErrForbidden)
+		}
+	}
+	if req.UserID != nil || req.WorkspaceID != 0 {
+		return nil, fmt.Errorf("self-service keys cannot set user_id or workspace_id: %w", utils.ErrForbidden)
+	}
+	if req.RequestsPerMinute != 0 || req.MonthlyLinkQuota != 0 {
+		return nil, fmt.Errorf("self-service keys cannot set requests_per_minute or monthly_link_quota: %w", utils.ErrForbidden)
+	}
+
+	workspace := &model.Workspace{Name: req.Name}
+	if err := s.workspaces.Create(workspace, nil); err != nil {
+		return nil, fmt.Errorf("failed to create workspace: %w", err)
+	}
+	limited := *req
+	limited.RequestsPerMinute = s.cfg.SelfServiceRequestsPerMinute
+	limited.MonthlyLinkQuota = s.cfg.SelfServiceMonthlyLinkQuota
+	return s.generateKey(workspace.ID, nil, normalizeScopes(req.Scopes), &limited)
+}
+
+// GenerateAdminKey generates a workspace service key for the default
+// workspace with every scope, including keys:admin
+func (s *APIKeyService) GenerateAdminKey(name string) (*model.APIKeyResponse, error) {
+	workspace, err := s.workspaces.Default()
+	if err != nil {
+		return nil, err
+	}
+	return s.generateKey(workspace.ID, nil, append([]string(nil), model.AllScopes...), &model.CreateAPIKeyRequest{Name: name})
+}
+
+// EnsureAdminKey stores key as an admin key if it is not known yet and
+// reports whether it was created. A key that exists but was revoked stays
+// revoked, so removing it from the environment is not required after revocation.
+func (s *APIKeyService) EnsureAdminKey(key string) (bool, error) {
+	existing, err := s.repo.GetByKey(key)
+	if err != nil {
+		return false, err
+	}
+	if existing != nil {
+		return false, nil
+	}
+	workspace, err := s.workspaces.Default()
+	if err != nil {
+		return false, err
+	}
+	apikey := newAPIKey(key, BootstrapKeyName, nil, append([]string(nil), model.AllScopes...))
+	apikey.WorkspaceID = workspace.ID
+	if _, err := s.storeKey(key, apikey); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// HasAdminKey reports whether an active, unexpired key with the keys:admin scope exists
+func (s *APIKeyService) HasAdminKey() (bool, error) {
+	count, err := s.repo.CountActiveWithScope(model.ScopeKeysAdmin)
+	return count > 0, err
+}
+
+// storeKey saves the hash of key and returns the response carrying the raw key
+func (s *APIKeyService) storeKey(key string, apikey *model.APIKey) (*model.APIKeyResponse, error) {
 	if err := s.repo.Create(apikey); err != nil {
 		return nil, err
 	}
+	return keyResponse(key, apikey), nil
+}
+
+// newRawKey generates a random key
+func newRawKey() (string, error) {
+	keyBytes := make([]byte, 32)
+	if _, err := rand.Read(keyBytes); err != nil {
+		return "", err
+	}
+	return "sk_" + hex.EncodeToString(keyBytes), nil
+}
+
+// newAPIKey builds the stored form of key. Only the hash and a short prefix
+// are stored; the raw key is returned once.
+func newAPIKey(key, name string, expiresAt *time.Time, scopes []string) *model.APIKey {
+	return &model.APIKey{
+		KeyHash:   utils.HashAPIKey(key),
+		KeyPrefix: utils.APIKeyPrefix(key),
+		Name:      name,
+		CreatedAt: time.Now(),
+		ExpiresAt: expiresAt,
+		IsActive:  true,
+		Scopes:    scopes,
+	}
+}
 
+// keyResponse builds the response returned when a key is created
+func keyResponse(key string, apikey *model.APIKey) *model.APIKeyResponse {
 	var expiresAtTime time.Time
 	if apikey.ExpiresAt != nil {
 		expiresAtTime = *apikey.ExpiresAt
@@ -54,30 +302,329 @@ func (s *APIKeyService) GenerateKey(req *model.CreateAPIKeyRequest) (*model.APIK
 
 	return &model.APIKeyResponse{
 		ID:        apikey.ID,
-		Key:       apikey.APIKey,
+		Key:       key,
+		KeyPrefix: apikey.KeyPrefix,
 		Name:      apikey.Name,
 		CreatedAt: apikey.CreatedAt,
 		ExpiresAt: expiresAtTime,
 		IsActive:  apikey.IsActive,
-	}, nil
+		Scopes:    apikey.Scopes,
+
+		RequestsPerMinute: apikey.RequestsPerMinute,
+		MonthlyLinkQuota:  apikey.MonthlyLinkQuota,
+		AllowedCIDRs:      apikey.AllowedCIDRs,
+
+		WorkspaceID: apikey.WorkspaceID,
+		UserID:      apikey.UserID,
+	}
+}
+
+// normalizeScopes removes duplicates and falls back to the default scopes,
+// keeping the order of model.AllScopes so stored values are stable
+func normalizeScopes(requested []string) []string {
+	if len(requested) == 0 {
+		return append([]string(nil), model.DefaultScopes...)
+	}
+	wanted := make(map[string]bool, len(requested))
+	for _, scope := range requested {
+		wanted[scope] = true
+	}
+	scopes := make([]string, 0, len(wanted))
+	for _, scope := range model.AllScopes {
+		if wanted[scope] {
+			scopes = append(scopes, scope)
+		}
+	}
+	return scopes
+}
+
+// normalizeCIDRs validates an IP allowlist and stores each entry as a
+// canonical CIDR range (a single IP becomes /32 or /128)
+func normalizeCIDRs(entries []string) ([]string, error) {
+	if len(entries) == 0 {
+		return nil, nil
+	}
+	cidrs := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		network, err := utils.ParseNetwork(entry)
+		if err != nil {
+			return nil, fmt.Errorf("allowed_cidrs: %v: %w", err, utils.ErrInvalidInput)
+		}
+		if cidr := network.String(); !slices.Contains(cidrs, cidr) {
+			cidrs = append(cidrs, cidr)
+		}
+	}
+	return cidrs, nil
 }
 
-// ListKeys lists all API keys (without showing the full key for security)
-func (s *APIKeyService) ListKeys() ([]model.APIKey, error) {
-	return s.repo.GetAll()
+// ListKeys lists the API keys in the workspace; only the visible prefix of each key is available
+func (s *APIKeyService) ListKeys(workspaceID uint) ([]model.APIKey, error) {
+	return s.repo.GetAll(workspaceID)
 }
 
-// ValidateKey validates an API key
+// ValidateKey validates an API key. Valid keys are cached by hash for a short
+// time together with their owner's workspace role; invalid keys are always
+// checked against the database. A key that is invalidated while it is being
+// loaded is not cached, so a revocation racing with validation cannot put the
+// revoked key back into the cache.
 func (s *APIKeyService) ValidateKey(key string) (*model.APIKey, error) {
-	return s.repo.ValidateKey(key)
+	if s.cache == nil {
+		return s.repo.ValidateKey(key)
+	}
+
+	hash := utils.HashAPIKey(key)
+	if apikey, ok := s.cache.Get(hash); ok {
+		return apikey, nil
+	}
+	generation := s.cache.Generation()
+	apikey, err := s.repo.ValidateKey(key)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.authz.ResolveRole(apikey); err != nil {
+		return nil, err
+	}
+	s.cache.Set(apikey, generation)
+	return apikey, nil
+}
+
+// invalidate drops a changed key from the local cache. Other instances learn
+// about the change from the change feed (see APIKeyCacheWatcher).
+func (s *APIKeyService) invalidate(apikey *model.APIKey) {
+	if s.cache != nil {
+		s.cache.Invalidate(apikey.KeyHash)
+	}
+}
+
+// RevokeKey deactivates the API key with the given ID
+func (s *APIKeyService) RevokeKey(p *Principal, id uint) (*model.APIKey, error) {
+	apikey, err := s.repo.GetByID(p.WorkspaceID, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.authorizeKeyChange(p, apikey); err != nil {
+		return nil, err
+	}
+	if err := s.repo.Deactivate(apikey.ID); err != nil {
+		return nil, err
+	}
+	s.invalidate(apikey)
+	apikey.IsActive = false
+	return apikey, nil
+}
+
+// FindKeyByPrefix returns the API key with the given visible prefix.
+// The prefix must identify exactly one key.
+func (s *APIKeyService) FindKeyByPrefix(workspaceID uint, prefix string) (*model.APIKey, error) {
+	keys, err := s.repo.FindByPrefix(workspaceID, prefix)
+	if err != nil {
+		return nil, err
+	}
+	switch len(keys) {
+	case 0:
+		return nil, fmt.Errorf("API key prefix %q: %w", prefix, utils.ErrAPIKeyNotFound)
+	case 1:
+		return &keys[0], nil
+	default:
+		return nil, fmt.Errorf("API key prefix %q: %w", prefix, utils.ErrAmbiguousKeyPrefix)
+	}
 }
 
-// RevokeKey deactivates an API key
-func (s *APIKeyService) RevokeKey(key string) error {
-	return s.repo.Deactivate(key)
+// UpdateKey changes the name, limits and IP allowlist of the key with the given ID
+func (s *APIKeyService) UpdateKey(p *Principal, id uint, req *model.UpdateAPIKeyRequest) (*model.APIKey, error) {
+	apikey, err := s.repo.GetByID(p.WorkspaceID, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.authorizeKeyChange(p, apikey); err != nil {
+		return nil, err
+	}
+
+	var fields []string
+	if req.Name != nil {
+		apikey.Name = *req.Name
+		fields = append(fields, "Name")
+	}
+	if req.RequestsPerMinute != nil {
+		apikey.RequestsPerMinute = *req.RequestsPerMinute
+		fields = append(fields, "RequestsPerMinute")
+	}
+	if req.MonthlyLinkQuota != nil {
+		apikey.MonthlyLinkQuota = *req.MonthlyLinkQuota
+		fields = append(fields, "MonthlyLinkQuota")
+	}
+	if req.AllowedCIDRs != nil {
+		cidrs, err := normalizeCIDRs(*req.AllowedCIDRs)
+		if err != nil {
+			return nil, err
+		}
+		apikey.AllowedCIDRs = cidrs
+		fields = append(fields, "AllowedCIDRs")
+	}
+	if len(fields) == 0 {
+		return apikey, nil
+	}
+
+	if err := s.repo.Update(apikey, fields...); err != nil {
+		return nil, err
+	}
+	s.invalidate(apikey)
+	return apikey, nil
+}
+
+// Usage returns the limits of the key with the given ID and the links it
+// created this month. The remaining requests in the current minute are only
+// known to the rate limiter, so callers fill in Requests.Remaining.
+func (s *APIKeyService) Usage(workspaceID, id uint, now time.Time) (*model.APIKeyUsage, error) {
+	apikey, err := s.repo.GetByID(workspaceID, id)
+	if err != nil {
+		return nil, err
+	}
+	links, err := s.LinkUsage(apikey.ID, apikey.MonthlyLinkQuota, now)
+	if err != nil {
+		return nil, err
+	}
+	return &model.APIKeyUsage{
+		KeyID:     apikey.ID,
+		KeyPrefix: apikey.KeyPrefix,
+		Name:      apikey.Name,
+		Requests:  model.RequestRateUsage{LimitPerMinute: apikey.RequestsPerMinute},
+		Links:     *links,
+	}, nil
+}
+
+// LinkUsage counts the links created by the key in the calendar month (UTC)
+// containing now
+func (s *APIKeyService) LinkUsage(id uint, quota int, now time.Time) (*model.LinkQuotaUsage, error) {
+	year, month, _ := now.UTC().Date()
+	start := time.Date(year, month, 1, 0, 0, 0, 0, time.UTC)
+
+	created, err := s.urlRepo.CountCreatedByAPIKey(id, start)
+	if err != nil {
+		return nil, err
+	}
+
+	usage := &model.LinkQuotaUsage{
+		MonthlyQuota: quota,
+		Created:      created,
+		PeriodStart:  start,
+		PeriodEnd:    start.AddDate(0, 1, 0),
+	}
+	if quota > 0 {
+		remaining := max(int64(quota)-created, 0)
+		usage.Remaining = &remaining
+	}
+	return usage, nil
+}
+
+// AuthorizeClientIP checks ip against the key's allowlist. Rejected
+// requests are recorded so they can be reviewed with ListDenials; repeated
+// rejections of the same key from the same address are recorded once per
+// DenialLogInterval and only counted by the metric in between.
+func (s *APIKeyService) AuthorizeClientIP(apikey *model.APIKey, ip, method, path string) error {
+	if len(apikey.AllowedCIDRs) == 0 || utils.IPInNetworks(ip, apikey.AllowedCIDRs) {
+		return nil
+	}
+
+	metrics.APIKeyIPDenials.Inc()
+	err := fmt.Errorf("API key %d from %s: %w", apikey.ID, ip, utils.ErrIPNotAllowed)
+	if !s.denials.allow(apikey.ID, ip, time.Now()) {
+		return err
+	}
+	if len(path) > 2048 {
+		path = path[:2048]
+	}
+	log.Printf("API key %d (%s) used from disallowed IP %s: %s %s", apikey.ID, apikey.KeyPrefix, ip, method, path)
+	if err := s.repo.RecordDenial(&model.APIKeyDenial{
+		APIKeyID:  apikey.ID,
+		IPAddress: ip,
+		Method:    method,
+		Path:      path,
+	}); err != nil {
+		log.Printf("Failed to record denied request for API key %d: %v", apikey.ID, err)
+	}
+	return err
+}
+
+// ListDenials returns the most recent requests rejected by the allowlist of
+// the key with the given ID
+func (s *APIKeyService) ListDenials(workspaceID, id uint, limit int) ([]model.APIKeyDenial, error) {
+	if _, err := s.repo.GetByID(workspaceID, id); err != nil {
+		return nil, err
+	}
+	return s.repo.ListDenials(id, limit)
+}
+
+// Activity returns every key in the workspace with its request and error
+// counts since the given time. Keys not used since then are marked idle.
+// Recent requests show up after the usage tracker's next flush.
+func (s *APIKeyService) Activity(workspaceID uint, since time.Time) ([]model.APIKeyActivity, error) {
+	keys, err := s.repo.GetAll(workspaceID)
+	if err != nil {
+		return nil, err
+	}
+	totals, err := s.repo.UsageTotals(workspaceID, since)
+	if err != nil {
+		return nil, err
+	}
+
+	activity := make([]model.APIKeyActivity, len(keys))
+	for i := range keys {
+		activity[i] = keyActivity(&keys[i], totals[keys[i].ID], since)
+	}
+	return activity, nil
+}
+
+// KeyActivity returns the usage of the key with the given ID since the given
+// time, broken down by endpoint
+func (s *APIKeyService) KeyActivity(workspaceID, id uint, since time.Time) (*model.APIKeyActivity, error) {
+	apikey, err := s.repo.GetByID(workspaceID, id)
+	if err != nil {
+		return nil, err
+	}
+	endpoints, err := s.repo.EndpointUsage(id, since)
+	if err != nil {
+		return nil, err
+	}
+
+	var total model.EndpointUsage
+	for _, endpoint := range endpoints {
+		total.Requests += endpoint.Requests
+		total.Errors += endpoint.Errors
+	}
+	activity := keyActivity(apikey, total, since)
+	activity.Endpoints = endpoints
+	return &activity, nil
+}
+
+// keyActivity builds the activity summary of a key
+func keyActivity(apikey *model.APIKey, total model.EndpointUsage, since time.Time) model.APIKeyActivity {
+	return model.APIKeyActivity{
+		KeyID:     apikey.ID,
+		KeyPrefix: apikey.KeyPrefix,
+		Name:      apikey.Name,
+		IsActive:  apikey.IsActive,
+		CreatedAt: apikey.CreatedAt,
+		LastUsed:  apikey.LastUsed,
+		LastIP:    apikey.LastIP,
+		Requests:  total.Requests,
+		Errors:    total.Errors,
+		Idle:      apikey.LastUsed == nil || apikey.LastUsed.Before(since),
+	}
 }
 
 // DeleteKey permanently deletes an API key
-func (s *APIKeyService) DeleteKey(key string) error {
-	return s.repo.Delete(key)
+func (s *APIKeyService) DeleteKey(p *Principal, id uint) error {
+	apikey, err := s.repo.GetByID(p.WorkspaceID, id)
+	if err != nil {
+		return err
+	}
+	if err := s.authorizeKeyChange(p, apikey); err != nil {
+		return err
+	}
+	if err := s.repo.Delete(id); err != nil {
+		return err
+	}
+	s.invalidate(apikey)
+	return nil
 }
@@ -0,0 +1,232 @@
+package service
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"url-shortener/internal/cache"
+	"url-shortener/internal/config"
+	"url-shortener/internal/model"
+	"url-shortener/internal/repository"
+	"url-shortener/internal/utils"
+)
+
+// newTestAPIKeyService returns an API key service without a cache backed by db
+func newTestAPIKeyService(t *testing.T, cfg *config.APIKeyConfig) (*APIKeyService, *repository.WorkspaceRepository) {
+	t.Helper()
+
+	db := newTestDB(t)
+	workspaces := repository.NewWorkspaceRepository(db)
+	if cfg == nil {
+		cfg = &config.APIKeyConfig{SelfService: true}
+	}
+	svc := NewAPIKeyService(repository.NewAPIKeyRepository(db), repository.NewURLRepository(db), workspaces,
+		NewAuthorizationService(workspaces), nil, cfg)
+	return svc, workspaces
+}
+
+func TestAdminKeyIgnoresSelfServiceDefaultWorkspace(t *testing.T) {
+	svc, workspaces := newTestAPIKeyService(t, nil)
+
+	selfService, err := svc.GenerateSelfServiceKey(&model.CreateAPIKeyRequest{Name: model.DefaultWorkspaceName})
+	if err != nil {
+		t.Fatalf("GenerateSelfServiceKey: %v", err)
+	}
+	admin, err := svc.GenerateAdminKey(BootstrapKeyName)
+	if err != nil {
+		t.Fatalf("GenerateAdminKey: %v", err)
+	}
+	if admin.WorkspaceID == selfService.WorkspaceID {
+		t.Fatalf("admin key was created in the self-service workspace %d", selfService.WorkspaceID)
+	}
+
+	def, err := workspaces.Default()
+	if err != nil {
+		t.Fatalf("Default: %v", err)
+	}
+	if def.ID != admin.WorkspaceID {
+		t.Errorf("Default() = workspace %d, want the admin key's workspace %d", def.ID, admin.WorkspaceID)
+	}
+	again, err := workspaces.Default()
+	if err != nil {
+		t.Fatalf("Default: %v", err)
+	}
+	if again.ID != def.ID {
+		t.Errorf("second Default() = workspace %d, want %d", again.ID, def.ID)
+	}
+}
+
+func TestSelfServiceKeyLimitsComeFromConfig(t *testing.T) {
+	svc, _ := newTestAPIKeyService(t, &config.APIKeyConfig{
+		SelfService:                  true,
+		SelfServiceRequestsPerMinute: 30,
+		SelfServiceMonthlyLinkQuota:  50,
+	})
+
+	key, err := svc.GenerateSelfServiceKey(&model.CreateAPIKeyRequest{Name: "script"})
+	if err != nil {
+		t.Fatalf("GenerateSelfServiceKey: %v", err)
+	}
+	if key.RequestsPerMinute != 30 || key.MonthlyLinkQuota != 50 {
+		t.Errorf("limits = %d/min, %d/month, want 30/min, 50/month", key.RequestsPerMinute, key.MonthlyLinkQuota)
+	}
+
+	for _, req := range []*model.CreateAPIKeyRequest{
+		{Name: "unlimited", RequestsPerMinute: 100000},
+		{Name: "unlimited", MonthlyLinkQuota: 100000},
+	} {
+		if _, err := svc.GenerateSelfServiceKey(req); !errors.Is(err, utils.ErrForbidden) {
+			t.Errorf("GenerateSelfServiceKey(%+v) error = %v, want ErrForbidden", *req, err)
+		}
+	}
+}
+
+func TestAuthorizeClientIPThrottlesDenialRecords(t *testing.T) {
+	svc, _ := newTestAPIKeyService(t, &config.APIKeyConfig{DenialLogInterval: time.Hour})
+	key := &model.APIKey{KeyHash: "hash", KeyPrefix: "sk_test", Name: "test", IsActive: true, AllowedCIDRs: []string{"192.0.2.0/24"}}
+	if err := svc.repo.Create(key); err != nil {
+		t.Fatalf("create key: %v", err)
+	}
+
+	if err := svc.AuthorizeClientIP(key, "192.0.2.10", "GET", "/api/urls"); err != nil {
+		t.Fatalf("allowed address rejected: %v", err)
+	}
+	for i := 0; i < 5; i++ {
+		for _, ip := range []string{"198.51.100.1", "198.51.100.2"} {
+			if err := svc.AuthorizeClientIP(key, ip, "GET", "/api/urls"); !errors.Is(err, utils.ErrIPNotAllowed) {
+				t.Fatalf("AuthorizeClientIP(%s) error = %v, want ErrIPNotAllowed", ip, err)
+			}
+		}
+	}
+
+	denials, err := svc.ListDenials(key.WorkspaceID, key.ID, 100)
+	if err != nil {
+		t.Fatalf("ListDenials: %v", err)
+	}
+	if len(denials) != 2 {
+		t.Errorf("recorded %d denials, want one per address", len(denials))
+	}
+}
+
+func TestDenialThrottle(t *testing.T) {
+	now := time.Date(2026, 5, 1, 12, 0, 0, 0, time.UTC)
+	d := newDenialThrottle(time.Minute)
+
+	steps := []struct {
+		keyID uint
+		ip    string
+		after time.Duration
+		want  bool
+	}{
+		{1, "198.51.100.1", 0, true},
+		{1, "198.51.100.1", 30 * time.Second, false},
+		{1, "198.51.100.2", 30 * time.Second, true},
+		{2, "198.51.100.1", 30 * time.Second, true},
+		{1, "198.51.100.1", time.Minute, true},
+		{1, "198.51.100.1", 90 * time.Second, false},
+	}
+	for _, step := range steps {
+		if got := d.allow(step.keyID, step.ip, now.Add(step.after)); got != step.want {
+			t.Errorf("allow(%d, %s) after %s = %v, want %v", step.keyID, step.ip, step.after, got, step.want)
+		}
+	}
+
+	if !newDenialThrottle(0).allow(1, "198.51.100.1", now) || !newDenialThrottle(0).allow(1, "198.51.100.1", now) {
+		t.Error("zero interval should record every denial")
+	}
+}
+
+func TestDenialThrottleBounded(t *testing.T) {
+	now := time.Date(2026, 5, 1, 12, 0, 0, 0, time.UTC)
+	d := newDenialThrottle(time.Minute)
+	for i := 0; i < maxDenialThrottleEntries; i++ {
+		d.allow(uint(i), "198.51.100.1", now)
+	}
+	if d.allow(1, "198.51.100.2", now) {
+		t.Error("new pair recorded while every remembered pair is within its interval")
+	}
+	if !d.allow(1, "198.51.100.2", now.Add(time.Minute)) {
+		t.Error("new pair not recorded after remembered pairs expired")
+	}
+	if len(d.last) != 1 {
+		t.Errorf("remembered %d pairs after expiry, want 1", len(d.last))
+	}
+}
+
+func TestValidateKeyCachesMemberRole(t *testing.T) {
+	db := newTestDB(t)
+	workspaces := repository.NewWorkspaceRepository(db)
+	keys := repository.NewAPIKeyRepository(db)
+	authz := NewAuthorizationService(workspaces)
+	keyCache := cache.NewAPIKeyCache(10, time.Minute)
+	svc := NewAPIKeyService(keys, repository.NewURLRepository(db), workspaces, authz, keyCache, &config.APIKeyConfig{})
+	watcher := NewAPIKeyCacheWatcher(keys, keyCache, &config.APIKeyConfig{})
+
+	owner, err := workspaces.FindOrCreateUser("owner@example.com", "Owner")
+	if err != nil {
+		t.Fatalf("FindOrCreateUser: %v", err)
+	}
+	member, err := workspaces.FindOrCreateUser("member@example.com", "Member")
+	if err != nil {
+		t.Fatalf("FindOrCreateUser: %v", err)
+	}
+	workspace := &model.Workspace{Name: "team"}
+	if err := workspaces.Create(workspace, &owner.ID); err != nil {
+		t.Fatalf("create workspace: %v", err)
+	}
+	if err := workspaces.AddMember(&model.WorkspaceMember{WorkspaceID: workspace.ID, UserID: member.ID, Role: model.RoleMember}); err != nil {
+		t.Fatalf("AddMember: %v", err)
+	}
+	const raw = "sk_test_member"
+	key := &model.APIKey{KeyHash: utils.HashAPIKey(raw), KeyPrefix: "sk_test", Name: "member", IsActive: true,
+		Scopes: model.AllScopes, WorkspaceID: workspace.ID, UserID: &member.ID}
+	if err := keys.Create(key); err != nil {
+		t.Fatalf("create key: %v", err)
+	}
+
+	role := func() (string, error) {
+		t.Helper()
+		apikey, err := svc.ValidateKey(raw)
+		if err != nil {
+			t.Fatalf("ValidateKey: %v", err)
+		}
+		p, err := authz.PrincipalForKey(apikey)
+		if err != nil {
+			return "", err
+		}
+		return p.Role, nil
+	}
+
+	if got, err := role(); err != nil || got != model.RoleMember {
+		t.Fatalf("role = %q, %v, want %q", got, err, model.RoleMember)
+	}
+	// The role is served from the cache until the membership changes through the repository
+	if err := db.Model(&model.WorkspaceMember{}).Where("user_id = ?", member.ID).Update("role", model.RoleViewer).Error; err != nil {
+		t.Fatalf("update role: %v", err)
+	}
+	if got, err := role(); err != nil || got != model.RoleMember {
+		t.Fatalf("cached role = %q, %v, want %q", got, err, model.RoleMember)
+	}
+
+	since := time.Now().Add(-time.Second)
+	if err := workspaces.UpdateRole(workspace.ID, member.ID, model.RoleAdmin); err != nil {
+		t.Fatalf("UpdateRole: %v", err)
+	}
+	if err := watcher.poll(since); err != nil {
+		t.Fatalf("poll: %v", err)
+	}
+	if got, err := role(); err != nil || got != model.RoleAdmin {
+		t.Fatalf("role after update = %q, %v, want %q", got, err, model.RoleAdmin)
+	}
+
+	if err := workspaces.RemoveMember(workspace.ID, member.ID); err != nil {
+		t.Fatalf("RemoveMember: %v", err)
+	}
+	if err := watcher.poll(since); err != nil {
+		t.Fatalf("poll: %v", err)
+	}
+	if _, err := role(); !errors.Is(err, utils.ErrForbidden) {
+		t.Errorf("PrincipalForKey after removal error = %v, want ErrForbidden", err)
+	}
+}
@@ -0,0 +1,153 @@
+package service
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	"url-shortener/internal/config"
+	"url-shortener/internal/model"
+	"url-shortener/internal/repository"
+)
+
+// APIKeyUsageTracker collects per-key usage in memory and writes it to the
+// database periodically, so authenticated requests do not cost a write each
+type APIKeyUsageTracker struct {
+	repo      *repository.APIKeyRepository
+	interval  time.Duration
+	retention int // days of per-endpoint usage to keep, 0 keeps everything
+
+	denialRetention int // days of rejected requests to keep, 0 keeps everything
+
+	mu      sync.Mutex
+	pending map[uint]*keyUsage
+
+	stop     chan struct{}
+	done     chan struct{}
+	stopOnce sync.Once
+}
+
+// keyUsage is the usage of one key since the last flush
+type keyUsage struct {
+	lastUsed  time.Time
+	lastIP    string
+	endpoints map[endpointDay]*model.APIKeyEndpointUsage
+}
+
+// endpointDay identifies a per-endpoint counter
+type endpointDay struct {
+	day    time.Time
+	method string
+	route  string
+}
+
+// NewAPIKeyUsageTracker creates a usage tracker
+func NewAPIKeyUsageTracker(repo *repository.APIKeyRepository, cfg *config.APIKeyConfig) *APIKeyUsageTracker {
+	return &APIKeyUsageTracker{
+		repo:      repo,
+		interval:  cfg.UsageFlushInterval,
+		retention: cfg.UsageRetentionDays,
+		pending:   make(map[uint]*keyUsage),
+		stop:      make(chan struct{}),
+		done:      make(chan struct{}),
+
+		denialRetention: cfg.DenialRetentionDays,
+	}
+}
+
+// Record counts one request made with the key. route is the route template
+// (e.g. /api/stats/:code) so counters do not grow with every short code.
+func (t *APIKeyUsageTracker) Record(keyID uint, ip, method, route string, status int, at time.Time) {
+	at = at.UTC()
+	year, month, day := at.Date()
+	counter := endpointDay{day: time.Date(year, month, day, 0, 0, 0, 0, time.UTC), method: method, route: route}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	usage, exists := t.pending[keyID]
+	if !exists {
+		usage = &keyUsage{endpoints: make(map[endpointDay]*model.APIKeyEndpointUsage)}
+		t.pending[keyID] = usage
+	}
+	if at.After(usage.lastUsed) {
+		usage.lastUsed = at
+		usage.lastIP = ip
+	}
+
+	endpoint, exists := usage.endpoints[counter]
+	if !exists {
+		endpoint = &model.APIKeyEndpointUsage{Day: counter.day, Method: method, Route: route}
+		usage.endpoints[counter] = endpoint
+	}
+	endpoint.Requests++
+	if status >= 400 {
+		endpoint.Errors++
+	}
+}
+
+// Start flushes the collected usage at the configured interval
+func (t *APIKeyUsageTracker) Start() {
+	go func() {
+		defer close(t.done)
+
+		ticker := time.NewTicker(t.interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				t.Flush()
+				t.prune(time.Now())
+			case <-t.stop:
+				t.Flush()
+				return
+			}
+		}
+	}()
+}
+
+// Stop stops the background flush and writes what is still pending
+func (t *APIKeyUsageTracker) Stop() {
+	t.stopOnce.Do(func() {
+		close(t.stop)
+	})
+	<-t.done
+}
+
+// Flush writes the usage collected since the last flush. Usage of a key that
+// fails to save is dropped and logged rather than kept, so a database outage
+// cannot grow memory without bound.
+func (t *APIKeyUsageTracker) Flush() {
+	t.mu.Lock()
+	pending := t.pending
+	t.pending = make(map[uint]*keyUsage)
+	t.mu.Unlock()
+
+	for keyID, usage := range pending {
+		endpoints := make([]model.APIKeyEndpointUsage, 0, len(usage.endpoints))
+		for _, endpoint := range usage.endpoints {
+			endpoints = append(endpoints, *endpoint)
+		}
+		if err := t.repo.SaveUsage(keyID, usage.lastUsed, usage.lastIP, endpoints); err != nil {
+			log.Printf("Failed to save usage of API key %d: %v", keyID, err)
+		}
+	}
+}
+
+// prune deletes per-endpoint usage and rejected requests older than their
+// retention periods
+func (t *APIKeyUsageTracker) prune(now time.Time) {
+	if t.retention > 0 {
+		year, month, day := now.UTC().Date()
+		cutoff := time.Date(year, month, day, 0, 0, 0, 0, time.UTC).AddDate(0, 0, -t.retention)
+		if _, err := t.repo.PruneUsageBefore(cutoff); err != nil {
+			log.Printf("Failed to prune API key usage: %v", err)
+		}
+	}
+	if t.denialRetention > 0 {
+		if _, err := t.repo.PruneDenialsBefore(now.AddDate(0, 0, -t.denialRetention)); err != nil {
+			log.Printf("Failed to prune API key denials: %v", err)
+		}
+	}
+}
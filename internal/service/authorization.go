@@ -0,0 +1,141 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+
+	"url-shortener/internal/model"
+	"url-shortener/internal/repository"
+	"url-shortener/internal/utils"
+)
+
+// Principal 已认证请求的身份：所在工作区、代表的用户及其角色、凭据的权限范围
+type Principal struct {
+	APIKeyID    uint
+	WorkspaceID uint
+	UserID      *uint    // 为空时为工作区服务 Key，不受角色限制
+	Role        string   // UserID 在工作区中的角色
+	Scopes      []string // 凭据本身的权限范围
+}
+
+// roleScopes 各角色允许使用的权限范围，凭据的实际权限是其权限范围与角色的交集
+var roleScopes = map[string][]string{
+	model.RoleOwner: model.AllScopes,
+	model.RoleAdmin: model.AllScopes,
+	model.RoleMember: {
+		model.ScopeLinksRead,
+		model.ScopeLinksWrite,
+		model.ScopeAnalyticsRead,
+		model.ScopeConversionsWrite,
+		model.ScopeReportsRead,
+		model.ScopeReportsWrite,
+	},
+	model.RoleViewer: {
+		model.ScopeLinksRead,
+		model.ScopeAnalyticsRead,
+		model.ScopeReportsRead,
+	},
+}
+
+// RoleAllows 角色是否允许使用权限范围
+func RoleAllows(role, scope string) bool {
+	return slices.Contains(roleScopes[role], scope)
+}
+
+// AuthorizationService 权限检查，由中间件在每个受保护的路由上调用
+type AuthorizationService struct {
+	workspaces *repository.WorkspaceRepository
+}
+
+// NewAuthorizationService 创建权限检查服务
+func NewAuthorizationService(workspaces *repository.WorkspaceRepository) *AuthorizationService {
+	return &AuthorizationService{workspaces: workspaces}
+}
+
+// ResolveRole 读取 Key 所属用户在工作区中的角色并记在 Key 上，Key 缓存后 PrincipalForKey 不再查询数据库
+// 用户已不是成员时不记录角色，由 PrincipalForKey 拒绝
+func (s *AuthorizationService) ResolveRole(apikey *model.APIKey) error {
+	if apikey.UserID == nil {
+		return nil
+	}
+	role, err := s.workspaces.Role(apikey.WorkspaceID, *apikey.UserID)
+	if err != nil && !errors.Is(err, utils.ErrMemberNotFound) {
+		return err
+	}
+	apikey.MemberRole = role
+	return nil
+}
+
+// PrincipalForKey 获取 API Key 代表的身份，优先使用 ResolveRole 记下的角色
+// Key 所属用户已不是工作区成员时返回 ErrForbidden，该 Key 不再可用
+func (s *AuthorizationService) PrincipalForKey(apikey *model.APIKey) (*Principal, error) {
+	principal := &Principal{
+		APIKeyID:    apikey.ID,
+		WorkspaceID: apikey.WorkspaceID,
+		UserID:      apikey.UserID,
+		Scopes:      apikey.Scopes,
+	}
+	if apikey.UserID == nil {
+		return principal, nil
+	}
+
+	if apikey.MemberRole != "" {
+		principal.Role = apikey.MemberRole
+		return principal, nil
+	}
+	role, err := s.workspaces.Role(apikey.WorkspaceID, *apikey.UserID)
+	if err != nil {
+		if errors.Is(err, utils.ErrMemberNotFound) {
+			return nil, fmt.Errorf("user %d is no longer a member of workspace %d: %w", *apikey.UserID, apikey.WorkspaceID, utils.ErrForbidden)
+		}
+		return nil, err
+	}
+	principal.Role = role
+	return principal, nil
+}
+
+// Authorize 检查身份在其工作区内是否拥有权限范围
+func (s *AuthorizationService) Authorize(p *Principal, scope string) error {
+	if !slices.Contains(p.Scopes, scope) {
+		return fmt.Errorf("missing required scope %s: %w", scope, utils.ErrForbidden)
+	}
+	if p.UserID != nil && !RoleAllows(p.Role, scope) {
+		return fmt.Errorf("workspace role %s does not grant scope %s: %w", p.Role, scope, utils.ErrForbidden)
+	}
+	return nil
+}
+
+// AuthorizeWorkspace 检查身份在指定工作区内是否拥有权限范围
+// 其他工作区只能由用户身份按其在该工作区的角色访问，服务 Key 只能访问自己的工作区
+func (s *AuthorizationService) AuthorizeWorkspace(p *Principal, workspaceID uint, scope string) error {
+	if workspaceID == p.WorkspaceID {
+		return s.Authorize(p, scope)
+	}
+	if p.UserID == nil {
+		return fmt.Errorf("workspace service keys cannot access workspace %d: %w", workspaceID, utils.ErrForbidden)
+	}
+	if !slices.Contains(p.Scopes, scope) {
+		return fmt.Errorf("missing required scope %s: %w", scope, utils.ErrForbidden)
+	}
+
+	role, err := s.workspaces.Role(workspaceID, *p.UserID)
+	if err != nil {
+		if errors.Is(err, utils.ErrMemberNotFound) {
+			return fmt.Errorf("not a member of workspace %d: %w", workspaceID, utils.ErrForbidden)
+		}
+		return err
+	}
+	if !RoleAllows(role, scope) {
+		return fmt.Errorf("workspace role %s does not grant scope %s: %w", role, scope, utils.ErrForbidden)
+	}
+	return nil
+}
+
+// CanManageOwners 身份能否指定或移除工作区所有者：所有者本人，或拥有 keys:admin 的工作区服务 Key
+func (s *AuthorizationService) CanManageOwners(p *Principal) bool {
+	if p.UserID != nil {
+		return p.Role == model.RoleOwner
+	}
+	return slices.Contains(p.Scopes, model.ScopeKeysAdmin)
+}
@@ -0,0 +1,101 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"url-shortener/internal/model"
+	"url-shortener/internal/utils"
+)
+
+// clickIDPrefix 点击 ID 前缀，后接访问记录 ID 的 36 进制表示
+const clickIDPrefix = "clk_"
+
+// EncodeClickID 由访问记录 ID 生成点击 ID
+func EncodeClickID(visitID int64) string {
+	return clickIDPrefix + strconv.FormatInt(visitID, 36)
+}
+
+// DecodeClickID 解析点击 ID，返回对应的访问记录 ID
+func DecodeClickID(clickID string) (int64, error) {
+	encoded, ok := strings.CutPrefix(strings.TrimSpace(clickID), clickIDPrefix)
+	if !ok || encoded == "" {
+		return 0, utils.NewAppError(utils.ErrInvalidInput.Code, "invalid click ID")
+	}
+	id, err := strconv.ParseInt(encoded, 36, 64)
+	if err != nil || id <= 0 {
+		return 0, utils.NewAppError(utils.ErrInvalidInput.Code, "invalid click ID")
+	}
+	return id, nil
+}
+
+// TrackingAllowed 访客是否允许被追踪，开启 Do-Not-Track 支持且请求带有 DNT/GPC 时返回 false
+func (s *AnalyticsService) TrackingAllowed(info *VisitInfo) bool {
+	return !(s.honorDNT && info.DoNotTrack)
+}
+
+// RecordClick 同步记录访问和点击，返回点击 ID 和追加了点击 ID 的跳转地址
+func (s *AnalyticsService) RecordClick(ctx context.Context, link *model.URL, info *VisitInfo) (clickID, destination string, err error) {
+	visit, err := s.RecordVisit(ctx, link, info)
+	if err != nil {
+		return "", "", err
+	}
+	click := &model.Click{VisitID: visit.ID, ShortCode: visit.ShortCode, ClickedAt: visit.VisitedAt}
+	if err := s.analyticsRepo.RecordClick(click); err != nil {
+		return "", "", fmt.Errorf("failed to record click: %w", err)
+	}
+
+	parsed, err := url.Parse(link.OriginalURL)
+	if err != nil {
+		return "", "", fmt.Errorf("invalid destination URL: %w", err)
+	}
+	// 追加到查询串末尾，保留目标地址原有参数的顺序
+	clickID = EncodeClickID(visit.ID)
+	param := url.Values{s.clickIDParam: {clickID}}.Encode()
+	if parsed.RawQuery == "" {
+		parsed.RawQuery = param
+	} else {
+		parsed.RawQuery += "&" + param
+	}
+
+	return clickID, parsed.String(), nil
+}
+
+// RecordConversion 记录转化回传并归因到点击对应的短链接
+// 点击不属于工作区内的短链接或超过转化窗口时视为不存在
+// 同一点击的同名事件重复回传时返回已有记录，created 为 false
+func (s *AnalyticsService) RecordConversion(workspaceID uint, req *model.ConversionRequest) (conversion *model.Conversion, created bool, err error) {
+	visitID, err := DecodeClickID(req.ClickID)
+	if err != nil {
+		return nil, false, err
+	}
+
+	click, err := s.analyticsRepo.GetClick(workspaceID, visitID)
+	if err != nil {
+		return nil, false, err
+	}
+	if s.conversionWindow > 0 && time.Since(click.ClickedAt) > s.conversionWindow {
+		return nil, false, fmt.Errorf("click %s is outside the conversion window: %w", req.ClickID, utils.ErrClickNotFound)
+	}
+
+	conversion = &model.Conversion{
+		VisitID:   click.VisitID,
+		Event:     strings.TrimSpace(req.Event),
+		ShortCode: click.ShortCode,
+		Value:     req.Value,
+		ClickedAt: click.ClickedAt,
+	}
+	if conversion.Event == "" {
+		return nil, false, utils.NewAppError(utils.ErrInvalidInput.Code, "event is required")
+	}
+
+	created, err = s.analyticsRepo.RecordConversion(conversion)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to record conversion: %w", err)
+	}
+	return conversion, created, nil
+}
@@ -0,0 +1,89 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"url-shortener/internal/config"
+	"url-shortener/internal/model"
+	"url-shortener/internal/repository"
+	"url-shortener/internal/utils"
+)
+
+func TestRecordConversionAfterVisitPurge(t *testing.T) {
+	db := newTestDB(t)
+	analyticsRepo := repository.NewAnalyticsRepository(db)
+	parser, err := utils.LoadUserAgentParser("")
+	if err != nil {
+		t.Fatalf("LoadUserAgentParser: %v", err)
+	}
+	cfg := &config.AnalyticsConfig{
+		IPAnonymization:                "keep",
+		ClickIDParam:                   "click_id",
+		ConversionWindowDays:           30,
+		LiveMaxSubscribers:             1,
+		LiveMaxSubscribersPerWorkspace: 1,
+		LiveBufferSize:                 1,
+		LiveHeartbeat:                  time.Second,
+	}
+	svc := NewAnalyticsService(repository.NewURLRepository(db), analyticsRepo, NewVisitBroker(cfg), parser, cfg)
+
+	link := &model.URL{ShortCode: "abc", OriginalURL: "https://example.com/landing", WorkspaceID: 1, TrackClicks: true}
+	if err := db.Create(link).Error; err != nil {
+		t.Fatalf("create url: %v", err)
+	}
+	clickID, _, err := svc.RecordClick(context.Background(), link, &VisitInfo{IPAddress: "192.0.2.1"})
+	if err != nil {
+		t.Fatalf("RecordClick: %v", err)
+	}
+
+	// 原始访问记录按保留期清理后，点击仍可归因
+	if _, err := analyticsRepo.PurgeVisitsBefore(time.Now().Add(time.Hour)); err != nil {
+		t.Fatalf("PurgeVisitsBefore: %v", err)
+	}
+	conversion, created, err := svc.RecordConversion(1, &model.ConversionRequest{ClickID: clickID, Event: "signup"})
+	if err != nil {
+		t.Fatalf("RecordConversion: %v", err)
+	}
+	if !created || conversion.ShortCode != "abc" {
+		t.Errorf("conversion = %+v, created = %v, want a new conversion for abc", conversion, created)
+	}
+
+	if _, _, err := svc.RecordConversion(2, &model.ConversionRequest{ClickID: clickID, Event: "signup"}); !errors.Is(err, utils.ErrClickNotFound) {
+		t.Errorf("conversion from another workspace error = %v, want ErrClickNotFound", err)
+	}
+
+	// 超过转化窗口的点击视为不存在
+	if err := db.Model(&model.Click{}).Where("1 = 1").Update("clicked_at", time.Now().Add(-31*24*time.Hour)).Error; err != nil {
+		t.Fatalf("age click: %v", err)
+	}
+	if _, _, err := svc.RecordConversion(1, &model.ConversionRequest{ClickID: clickID, Event: "purchase"}); !errors.Is(err, utils.ErrClickNotFound) {
+		t.Errorf("conversion outside the window error = %v, want ErrClickNotFound", err)
+	}
+}
+
+func TestRecordConversionForVisitWithoutClick(t *testing.T) {
+	db := newTestDB(t)
+	analyticsRepo := repository.NewAnalyticsRepository(db)
+	cfg := &config.AnalyticsConfig{IPAnonymization: "keep", ClickIDParam: "click_id"}
+	svc := NewAnalyticsService(repository.NewURLRepository(db), analyticsRepo, nil, nil, cfg)
+
+	if err := db.Create(&model.URL{ShortCode: "abc", OriginalURL: "https://example.com", WorkspaceID: 1}).Error; err != nil {
+		t.Fatalf("create url: %v", err)
+	}
+	// 单独保存点击之前记录的访问
+	visit := &model.VisitRecord{ShortCode: "abc", VisitedAt: time.Now().UTC().Add(-time.Hour)}
+	if err := analyticsRepo.RecordVisit(visit); err != nil {
+		t.Fatalf("record visit: %v", err)
+	}
+
+	conversion, _, err := svc.RecordConversion(1, &model.ConversionRequest{ClickID: EncodeClickID(visit.ID), Event: "signup"})
+	if err != nil {
+		t.Fatalf("RecordConversion: %v", err)
+	}
+	if conversion.VisitID != visit.ID || conversion.ShortCode != "abc" {
+		t.Errorf("conversion = %+v, want visit %d of abc", conversion, visit.ID)
+	}
+}
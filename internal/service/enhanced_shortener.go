@@ -5,9 +5,12 @@ import (
 	"crypto/rand"
 	"errors"
 	"fmt"
+	"log"
 	"math/big"
+	"strings"
 	"sync"
 	"time"
+	"url-shortener/internal/metrics"
 	"url-shortener/internal/model"
 	"url-shortener/internal/repository"
 	"url-shortener/internal/utils"
@@ -17,6 +20,7 @@ const (
 	Base62Chars             = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
 	DefaultShortCodeLength  = 6
 	MaxRetries              = 10
+	maxOriginalURLLength    = 2048 // 与 urls.original_url 列宽一致
 )
 
 // EnhancedShortenerService 提供短链接服务的主要业务逻辑
@@ -24,6 +28,7 @@ type EnhancedShortenerService struct {
 	repo           *repository.URLRepository
 	analyticsRepo  *repository.AnalyticsRepository
 	analyticsSvc   *AnalyticsService
+	visits         *VisitQueue
 	baseURL        string
 	mutex          sync.Mutex // 用于保护生成唯一短码的过程
 }
@@ -32,21 +37,36 @@ type EnhancedShortenerService struct {
 func NewEnhancedShortenerService(
 	repo *repository.URLRepository, 
 	analyticsRepo *repository.AnalyticsRepository, 
+	analyticsSvc *AnalyticsService,
+	visits *VisitQueue,
 	baseURL string) *EnhancedShortenerService {
 	
-	analyticsSvc := NewAnalyticsService(repo, analyticsRepo)
-	
 	return &EnhancedShortenerService{
 		repo:          repo,
 		analyticsRepo: analyticsRepo,
 		analyticsSvc:  analyticsSvc,
+		visits:        visits,
 		baseURL:       baseURL,
 	}
 }
 
-// CreateShortURL 创建一个新的短链接
-func (s *EnhancedShortenerService) CreateShortURL(originalURL string, customCode string, expireInHours int) (*model.CreateURLResponse, error) {
+// CreateShortURL 在工作区内创建一个新的短链接，链接归属于 apiKeyID（为 0 时不记录）
+// 短码在所有工作区之间唯一
+func (s *EnhancedShortenerService) CreateShortURL(workspaceID, apiKeyID uint, req *model.CreateURLRequest) (*model.CreateURLResponse, error) {
 	var shortCode string
+	originalURL, customCode, expireInHours := req.URL, req.CustomCode, req.ExpireIn
+
+	// 使用 UTM 构建器时，将参数追加到目标地址
+	if req.UTM != nil {
+		taggedURL, err := utils.AppendUTMParams(originalURL, *req.UTM)
+		if err != nil {
+			return nil, utils.WrapError(err, utils.ErrInvalidInput.Code, "invalid URL")
+		}
+		if len(taggedURL) > maxOriginalURLLength {
+			return nil, utils.NewAppError(utils.ErrInvalidInput.Code, "URL with UTM parameters exceeds 2048 characters")
+		}
+		originalURL = taggedURL
+	}
 
 	// 如果提供了自定义短码，验证并使用它
 	if customCode != "" {
@@ -67,12 +87,43 @@ func (s *EnhancedShortenerService) CreateShortURL(originalURL string, customCode
 	expiresAt := s.calculateExpirationTime(expireInHours)
 
 	// 保存到数据库
-	if err := s.repo.CreateWithExpiry(originalURL, shortCode, expiresAt); err != nil {
+	group := strings.TrimSpace(req.Group)
+	url := &model.URL{
+		OriginalURL: originalURL,
+		ShortCode:   shortCode,
+		ExpiresAt:   expiresAt,
+		IsActive:    true,
+		Group:       group,
+		TrackClicks: req.TrackClicks,
+		WorkspaceID: workspaceID,
+	}
+	if apiKeyID != 0 {
+		url.APIKeyID = &apiKeyID
+	}
+	if err := s.repo.Create(url); err != nil {
 		return nil, fmt.Errorf("failed to create URL with expiry: %w", err)
 	}
 
 	// 构建响应
-	return s.buildCreateResponse(shortCode, originalURL, expiresAt), nil
+	response := s.buildCreateResponse(shortCode, originalURL, expiresAt)
+	response.Group = group
+	response.TrackClicks = req.TrackClicks
+	return response, nil
+}
+
+// SetGroup 设置短链接的分组，group 为空时移出分组
+func (s *EnhancedShortenerService) SetGroup(workspaceID uint, shortCode, group string) error {
+	return s.repo.UpdateGroup(workspaceID, shortCode, strings.TrimSpace(group))
+}
+
+// ListGroups 列出工作区内所有分组
+func (s *EnhancedShortenerService) ListGroups(workspaceID uint) ([]model.LinkGroup, error) {
+	return s.repo.ListGroups(workspaceID)
+}
+
+// GetGroupAnalytics 获取分组内所有短链接的汇总分析数据
+func (s *EnhancedShortenerService) GetGroupAnalytics(workspaceID uint, group string, since, until *time.Time, loc *time.Location) (*model.GroupAnalytics, error) {
+	return s.analyticsSvc.GetGroupAnalytics(workspaceID, group, since, until, loc)
 }
 
 // GetByShortCode 获取短链接信息（不记录访问）
@@ -93,30 +144,66 @@ func (s *EnhancedShortenerService) GetByShortCode(shortCode string) (*model.URL,
 	return url, nil
 }
 
-// GetByShortCodeWithContext 通过上下文获取短链接（用于记录分析数据）
-func (s *EnhancedShortenerService) GetByShortCodeWithContext(ctx context.Context, shortCode, ipAddress, userAgent, referer string) (*model.URL, error) {
+// RedirectTarget 短链接的跳转目标
+type RedirectTarget struct {
+	URL         *model.URL
+	Destination string // 跳转地址，开启点击追踪时带有点击 ID
+	ClickID     string // 未追踪时为空
+}
+
+// ResolveRedirect 获取短链接的跳转目标并记录访问
+// 开启点击追踪的链接同步写入访问记录，以便将记录 ID 作为点击 ID 追加到跳转地址
+func (s *EnhancedShortenerService) ResolveRedirect(ctx context.Context, shortCode string, info *VisitInfo) (*RedirectTarget, error) {
 	url, err := s.repo.GetByShortCode(shortCode)
 	if err != nil {
+		if errors.Is(err, utils.ErrURLNotFound) {
+			metrics.Redirects.With("not_found").Inc()
+		} else {
+			metrics.Redirects.With("error").Inc()
+		}
 		return nil, err
 	}
 
 	// 检查链接是否已过期
 	if s.isURLExpired(url) {
+		metrics.Redirects.With("expired").Inc()
 		return nil, utils.ErrURLExpired
 	}
+	metrics.Redirects.With("hit").Inc()
 
-	// 异步记录访问分析数据
-	s.recordVisitAsync(ctx, shortCode, ipAddress, userAgent, referer)
+	target := &RedirectTarget{URL: url, Destination: url.OriginalURL}
+	if url.TrackClicks && s.analyticsSvc.TrackingAllowed(info) {
+		clickID, destination, err := s.analyticsSvc.RecordClick(ctx, url, info)
+		if err != nil {
+			// 记录失败不影响跳转，只是本次访问没有点击 ID
+			log.Printf("Failed to record click for %s: %v", shortCode, err)
+		} else {
+			target.ClickID, target.Destination = clickID, destination
+		}
+	} else {
+		// 异步记录访问分析数据，队列满时丢弃
+		s.visits.Enqueue(url, info)
+	}
 
 	// 异步增加点击次数以提高性能
 	s.incrementClicksAsync(shortCode)
 
-	return url, nil
+	return target, nil
+}
+
+// SetClickTracking 开启或关闭短链接的点击 ID 追踪
+func (s *EnhancedShortenerService) SetClickTracking(workspaceID uint, shortCode string, enabled bool) error {
+	return s.repo.UpdateTrackClicks(workspaceID, shortCode, enabled)
+}
+
+// RecordConversion 记录转化回传
+func (s *EnhancedShortenerService) RecordConversion(workspaceID uint, req *model.ConversionRequest) (*model.Conversion, bool, error) {
+	return s.analyticsSvc.RecordConversion(workspaceID, req)
 }
 
 // GetStats 获取短链接统计信息
-func (s *EnhancedShortenerService) GetStats(shortCode string) (*model.StatsResponse, error) {
-	url, err := s.repo.GetByShortCode(shortCode)
+func (s *EnhancedShortenerService) GetStats(workspaceID uint, shortCode string) (*model.StatsResponse, error) {
+	url, err := s.repo.GetByShortCodeInWorkspace(workspaceID, shortCode)
 	if err != nil {
 		return nil, err
 	}
@@ -124,43 +211,69 @@ func (s *EnhancedShortenerService) GetStats(shortCode string) (*model.StatsRespo
 	return s.buildStatsResponse(url), nil
 }
 
-// GetAdvancedAnalytics 获取高级分析数据
-func (s *EnhancedShortenerService) GetAdvancedAnalytics(shortCode string, since *time.Time, until *time.Time) (*model.AnalyticsSummary, error) {
-	return s.analyticsSvc.GetAnalyticsSummary(shortCode, since, until)
+// GetLink 获取工作区内的短链接，已删除或属于其他工作区的短码返回 ErrURLNotFound
+func (s *EnhancedShortenerService) GetLink(workspaceID uint, shortCode string) (*model.URL, error) {
+	return s.repo.GetByShortCodeInWorkspace(workspaceID, shortCode)
+}
+
+// GetAdvancedAnalytics 获取高级分析数据，按 loc 时区划分天和小时
+func (s *EnhancedShortenerService) GetAdvancedAnalytics(workspaceID uint, shortCode string, since *time.Time, until *time.Time, loc *time.Location) (*model.AnalyticsSummary, error) {
+	return s.analyticsSvc.GetAnalyticsSummary(workspaceID, shortCode, since, until, loc)
+}
+
+// CompareAnalytics 对比两个时间段的分析数据
+func (s *EnhancedShortenerService) CompareAnalytics(workspaceID uint, shortCode string, current, previous model.TimeRange, loc *time.Location) (*model.AnalyticsComparison, error) {
+	return s.analyticsSvc.CompareAnalytics(workspaceID, shortCode, current, previous, loc)
+}
+
+// GetDashboard 获取工作区内所有短链接的汇总数据看板
+func (s *EnhancedShortenerService) GetDashboard(q *repository.DashboardQuery) (*model.DashboardSummary, error) {
+	return s.analyticsSvc.GetDashboard(q)
 }
 
 // GetRecentVisits 获取最近访问记录
-func (s *EnhancedShortenerService) GetRecentVisits(shortCode string, limit int, since *time.Time) ([]*model.VisitRecord, error) {
-	return s.analyticsSvc.GetRecentVisits(shortCode, limit, since)
+func (s *EnhancedShortenerService) GetRecentVisits(workspaceID uint, shortCode string, limit int, since *time.Time) ([]*model.VisitRecord, error) {
+	return s.analyticsSvc.GetRecentVisits(workspaceID, shortCode, limit, since)
 }
 
-// GetAllURLs 获取所有URL（管理员功能）
-func (s *EnhancedShortenerService) GetAllURLs() ([]*model.URL, error) {
-	return s.repo.GetAll()
+// SubscribeVisits 订阅实时访问事件，shortCode 为空时订阅工作区内所有短链接
+func (s *EnhancedShortenerService) SubscribeVisits(workspaceID uint, shortCode string) (*VisitSubscription, error) {
+	return s.analyticsSvc.SubscribeVisits(workspaceID, shortCode)
 }
 
-// GetURLsWithPagination 分页获取URL列表
-func (s *EnhancedShortenerService) GetURLsWithPagination(page, pageSize int, keyword string) (*repository.PaginatedResult, error) {
+// ExportVisits 逐行导出访问记录，shortCode 为空时导出工作区内全部短链接
+func (s *EnhancedShortenerService) ExportVisits(workspaceID uint, shortCode string, since, until *time.Time, fn func(*model.VisitRecord) error) error {
+	return s.analyticsSvc.StreamVisits(workspaceID, shortCode, since, until, fn)
+}
+
+// GetAllURLs 获取工作区内所有URL
+func (s *EnhancedShortenerService) GetAllURLs(workspaceID uint) ([]*model.URL, error) {
+	return s.repo.GetAll(workspaceID)
+}
+
+// GetURLsWithPagination 分页获取工作区内的URL列表
+func (s *EnhancedShortenerService) GetURLsWithPagination(workspaceID uint, page, pageSize int, keyword string) (*repository.PaginatedResult, error) {
 	return s.repo.GetWithPagination(&repository.PaginatedQuery{
-		Page:     page,
-		PageSize: pageSize,
-		Keyword:  keyword,
+		WorkspaceID: workspaceID,
+		Page:        page,
+		PageSize:    pageSize,
+		Keyword:     keyword,
 	})
 }
 
-// SearchURLs 搜索URL
-func (s *EnhancedShortenerService) SearchURLs(keyword string, page, pageSize int) (*repository.PaginatedResult, error) {
-	return s.repo.SearchURLs(keyword, page, pageSize)
+// SearchURLs 搜索工作区内的URL
+func (s *EnhancedShortenerService) SearchURLs(workspaceID uint, keyword string, page, pageSize int) (*repository.PaginatedResult, error) {
+	return s.repo.SearchURLs(workspaceID, keyword, page, pageSize)
 }
 
-// DeleteShortCode 删除指定的短链接
-func (s *EnhancedShortenerService) DeleteShortCode(shortCode string) error {
-	return s.repo.DeleteByShortCode(shortCode)
+// DeleteShortCode 删除工作区内指定的短链接
+func (s *EnhancedShortenerService) DeleteShortCode(workspaceID uint, shortCode string) error {
+	return s.repo.DeleteByShortCode(workspaceID, shortCode)
 }
 
-// CleanupExpiredURLs 清理过期链接
-func (s *EnhancedShortenerService) CleanupExpiredURLs() error {
-	return s.repo.DeleteExpiredURLs()
+// CleanupExpiredURLs 清理工作区内的过期链接
+func (s *EnhancedShortenerService) CleanupExpiredURLs(workspaceID uint) error {
+	return s.repo.DeleteExpiredURLs(workspaceID)
 }
 
 // --- 私有辅助方法 ---
@@ -226,13 +339,6 @@ func (s *EnhancedShortenerService) incrementClicksAsync(shortCode string) {
 	}()
 }
 
-// recordVisitAsync 异步记录访问分析数据
-func (s *EnhancedShortenerService) recordVisitAsync(ctx context.Context, shortCode, ipAddress, userAgent, referer string) {
-	go func() {
-		_ = s.analyticsSvc.RecordVisit(ctx, shortCode, ipAddress, userAgent, referer)
-	}()
-}
-
 // buildStatsResponse 构建统计响应
 func (s *EnhancedShortenerService) buildStatsResponse(url *model.URL) *model.StatsResponse {
 	// 检查链接是否活跃
@@ -247,6 +353,8 @@ func (s *EnhancedShortenerService) buildStatsResponse(url *model.URL) *model.Sta
 		Clicks:      url.Clicks,
 		CreatedAt:   url.CreatedAt.Format(time.RFC3339),
 		IsActive:    isActive,
+		Group:       url.Group,
+		TrackClicks: url.TrackClicks,
 	}
 
 	if url.ExpiresAt != nil {
@@ -263,11 +371,17 @@ func (s *EnhancedShortenerService) generateUniqueShortCode() (string, error) {
 	defer s.mutex.Unlock()
 
 	for i := 0; i < MaxRetries; i++ {
+		if i > 0 {
+			metrics.ShortCodeRetries.Inc()
+		}
 		shortCode, err := s.generateRandomString(DefaultShortCodeLength)
 		if err != nil {
 			// 如果随机数生成失败，记录错误并继续尝试
 			continue
 		}
+		if utils.IsReservedShortCode(shortCode) {
+			continue
+		}
 
 		// 检查短码是否已存在
 		_, err = s.repo.GetByShortCode(shortCode)
@@ -282,6 +396,7 @@ func (s *EnhancedShortenerService) generateUniqueShortCode() (string, error) {
 		// 如果没有错误，说明短码已存在，继续循环
 	}
 
+	metrics.ShortCodeFailures.Inc()
 	return "", utils.ErrGenerateShortCode
 }
 
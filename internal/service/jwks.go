@@ -0,0 +1,340 @@
+package service
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	_ "crypto/sha256"
+	_ "crypto/sha512"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math/big"
+	"net/http"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"url-shortener/internal/config"
+)
+
+// jwksMinRefetch is the minimum time between reloads, so tokens with made-up
+// key IDs cannot be used to hammer the JWKS endpoint and a failing endpoint
+// is retried at most once a minute.
+const jwksMinRefetch = time.Minute
+
+// jwksMaxSize caps the size of a JWKS document.
+const jwksMaxSize = 1 << 20
+
+// jwk is a public key from the key set that can verify signatures.
+type jwk struct {
+	kid string
+	alg string // optional; when set the key may only be used with this algorithm
+	key crypto.PublicKey
+}
+
+// JWKS holds the public keys used to verify JWT signatures. Keys are read
+// from a local file or a URL and reloaded every refresh interval, and when a
+// token names a key ID that is not in the set, which is how identity
+// providers roll over their signing keys. Reloads after startup run in the
+// background; requests are always checked against the keys already loaded.
+type JWKS struct {
+	file    string
+	url     string
+	refresh time.Duration
+	client  *http.Client
+
+	reloadMu  sync.Mutex  // serializes reloads
+	reloading atomic.Bool // a background reload is running
+	mu        sync.RWMutex
+	keys      []jwk
+	loadedAt  time.Time
+	tried     time.Time // last reload attempt, successful or not
+}
+
+// NewJWKS loads the key set configured in cfg. It fails when the key set
+// cannot be loaded, so a misconfiguration shows up at startup.
+func NewJWKS(cfg *config.JWTConfig) (*JWKS, error) {
+	s := &JWKS{
+		file:    cfg.JWKSFile,
+		url:     cfg.JWKSURL,
+		refresh: cfg.JWKSRefresh,
+		client:  &http.Client{Timeout: 10 * time.Second},
+	}
+	if err := s.reload(time.Now()); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Keys returns the keys that may have signed a token with the given key ID.
+// Tokens without a key ID may have been signed by any key in the set.
+// It never waits for the key set to be fetched: when the set is stale or
+// the key ID is unknown it starts a background reload, and a token signed
+// with a key that was just rolled out is accepted once that reload is done.
+func (s *JWKS) Keys(kid string, now time.Time) []jwk {
+	s.mu.RLock()
+	stale := now.Sub(s.loadedAt) >= s.refresh
+	s.mu.RUnlock()
+
+	keys := s.find(kid)
+	if stale || (len(keys) == 0 && kid != "") {
+		s.reloadAsync(now)
+	}
+	return keys
+}
+
+// reloadAsync starts a background reload unless one is running or the last
+// attempt was less than jwksMinRefetch ago
+func (s *JWKS) reloadAsync(now time.Time) {
+	s.mu.RLock()
+	recent := !s.tried.IsZero() && now.Sub(s.tried) < jwksMinRefetch
+	s.mu.RUnlock()
+	if recent || !s.reloading.CompareAndSwap(false, true) {
+		return
+	}
+	go func() {
+		defer s.reloading.Store(false)
+		s.reloadLogged(now)
+	}()
+}
+
+// find returns the keys matching kid
+func (s *JWKS) find(kid string) []jwk {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if kid == "" {
+		return s.keys
+	}
+	for _, key := range s.keys {
+		if key.kid == kid {
+			return []jwk{key}
+		}
+	}
+	return nil
+}
+
+// reloadLogged reloads the key set and keeps the current keys on failure
+func (s *JWKS) reloadLogged(now time.Time) {
+	if err := s.reload(now); err != nil {
+		log.Printf("Failed to reload JWKS, keeping %d cached keys: %v", len(s.find("")), err)
+	}
+}
+
+// reload reads and parses the key set. It does nothing when the last attempt
+// was less than jwksMinRefetch ago, which also makes callers that waited for
+// a concurrent reload skip their own.
+func (s *JWKS) reload(now time.Time) error {
+	s.reloadMu.Lock()
+	defer s.reloadMu.Unlock()
+
+	s.mu.RLock()
+	recent := !s.tried.IsZero() && now.Sub(s.tried) < jwksMinRefetch
+	s.mu.RUnlock()
+	if recent {
+		return nil
+	}
+
+	s.mu.Lock()
+	s.tried = now
+	s.mu.Unlock()
+
+	data, err := s.read()
+	if err != nil {
+		return err
+	}
+	keys, err := parseJWKS(data)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	s.keys = keys
+	s.loadedAt = now
+	s.mu.Unlock()
+	return nil
+}
+
+// read fetches the raw key set document
+func (s *JWKS) read() ([]byte, error) {
+	if s.file != "" {
+		data, err := os.ReadFile(s.file)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read JWKS file: %w", err)
+		}
+		return data, nil
+	}
+
+	resp, err := s.client.Get(s.url)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch JWKS: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to fetch JWKS: %s returned %s", s.url, resp.Status)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, jwksMaxSize))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read JWKS response: %w", err)
+	}
+	return data, nil
+}
+
+// parseJWKS parses a JWK Set (RFC 7517). Keys that are not signature keys or
+// use unsupported key types are skipped.
+func parseJWKS(data []byte) ([]jwk, error) {
+	var set struct {
+		Keys []struct {
+			Kty string `json:"kty"`
+			Kid string `json:"kid"`
+			Use string `json:"use"`
+			Alg string `json:"alg"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+			Crv string `json:"crv"`
+			X   string `json:"x"`
+			Y   string `json:"y"`
+		} `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &set); err != nil {
+		return nil, fmt.Errorf("invalid JWKS: %w", err)
+	}
+
+	keys := make([]jwk, 0, len(set.Keys))
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+
+		var (
+			key crypto.PublicKey
+			err error
+		)
+		switch k.Kty {
+		case "RSA":
+			key, err = parseRSAKey(k.N, k.E)
+		case "EC":
+			key, err = parseECKey(k.Crv, k.X, k.Y)
+		default:
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid JWKS key %q: %w", k.Kid, err)
+		}
+		keys = append(keys, jwk{kid: k.Kid, alg: k.Alg, key: key})
+	}
+	if len(keys) == 0 {
+		return nil, errors.New("JWKS contains no RSA or EC signature keys")
+	}
+	return keys, nil
+}
+
+func parseRSAKey(n, e string) (*rsa.PublicKey, error) {
+	modulus, err := base64.RawURLEncoding.DecodeString(n)
+	if err != nil {
+		return nil, fmt.Errorf("invalid modulus: %w", err)
+	}
+	exponent, err := base64.RawURLEncoding.DecodeString(e)
+	if err != nil {
+		return nil, fmt.Errorf("invalid exponent: %w", err)
+	}
+	if len(modulus) < 256 {
+		return nil, errors.New("RSA keys must be at least 2048 bits")
+	}
+	if len(exponent) == 0 || len(exponent) > 4 {
+		return nil, errors.New("invalid exponent")
+	}
+	return &rsa.PublicKey{
+		N: new(big.Int).SetBytes(modulus),
+		E: int(new(big.Int).SetBytes(exponent).Int64()),
+	}, nil
+}
+
+func parseECKey(crv, x, y string) (*ecdsa.PublicKey, error) {
+	var curve elliptic.Curve
+	switch crv {
+	case "P-256":
+		curve = elliptic.P256()
+	case "P-384":
+		curve = elliptic.P384()
+	case "P-521":
+		curve = elliptic.P521()
+	default:
+		return nil, fmt.Errorf("unsupported curve %q", crv)
+	}
+
+	xBytes, err := base64.RawURLEncoding.DecodeString(x)
+	if err != nil {
+		return nil, fmt.Errorf("invalid x coordinate: %w", err)
+	}
+	yBytes, err := base64.RawURLEncoding.DecodeString(y)
+	if err != nil {
+		return nil, fmt.Errorf("invalid y coordinate: %w", err)
+	}
+	key := &ecdsa.PublicKey{Curve: curve, X: new(big.Int).SetBytes(xBytes), Y: new(big.Int).SetBytes(yBytes)}
+	if !curve.IsOnCurve(key.X, key.Y) {
+		return nil, errors.New("point is not on the curve")
+	}
+	return key, nil
+}
+
+// verifyJWS checks a JWS signature over signingInput made with alg and key
+func verifyJWS(alg string, key crypto.PublicKey, signingInput, signature []byte) error {
+	if len(alg) != 5 {
+		return fmt.Errorf("unsupported algorithm %s", alg)
+	}
+	var hash crypto.Hash
+	switch alg[2:] {
+	case "256":
+		hash = crypto.SHA256
+	case "384":
+		hash = crypto.SHA384
+	case "512":
+		hash = crypto.SHA512
+	default:
+		return fmt.Errorf("unsupported algorithm %s", alg)
+	}
+	h := hash.New()
+	h.Write(signingInput)
+	digest := h.Sum(nil)
+
+	switch alg[:2] {
+	case "RS", "PS":
+		pub, ok := key.(*rsa.PublicKey)
+		if !ok {
+			return fmt.Errorf("algorithm %s needs an RSA key", alg)
+		}
+		if alg[:2] == "RS" {
+			return rsa.VerifyPKCS1v15(pub, hash, digest, signature)
+		}
+		return rsa.VerifyPSS(pub, hash, digest, signature, &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash})
+	case "ES":
+		pub, ok := key.(*ecdsa.PublicKey)
+		if !ok {
+			return fmt.Errorf("algorithm %s needs an EC key", alg)
+		}
+		// ES256 uses P-256, ES384 P-384 and ES512 P-521
+		params := pub.Curve.Params()
+		if wantBits := map[string]int{"256": 256, "384": 384, "512": 521}[alg[2:]]; params.BitSize != wantBits {
+			return fmt.Errorf("algorithm %s does not match curve %s", alg, params.Name)
+		}
+		size := (params.BitSize + 7) / 8
+		if len(signature) != 2*size {
+			return errors.New("invalid signature length")
+		}
+		r := new(big.Int).SetBytes(signature[:size])
+		s := new(big.Int).SetBytes(signature[size:])
+		if !ecdsa.Verify(pub, digest, r, s) {
+			return errors.New("signature verification failed")
+		}
+		return nil
+	default:
+		return fmt.Errorf("unsupported algorithm %s", alg)
+	}
+}
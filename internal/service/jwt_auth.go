@@ -0,0 +1,308 @@
+package service
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"url-shortener/internal/config"
+	"url-shortener/internal/model"
+	"url-shortener/internal/repository"
+	"url-shortener/internal/utils"
+)
+
+// JWTAuthenticator authenticates bearer JWTs issued by the configured OIDC
+// identity provider and maps their claims to a principal:
+//
+//   - tokens with an email claim act as that user, with the user's role in
+//     the workspace named by the workspace claim or the X-Workspace-ID header
+//     (or the user's only workspace)
+//   - tokens without an email claim, such as client-credentials tokens, act
+//     as a workspace service principal and must carry the workspace claim
+//
+// Scopes come from the scope claim. User tokens without it get every scope
+// their role allows; service tokens without it get none.
+type JWTAuthenticator struct {
+	keys       *JWKS
+	workspaces *repository.WorkspaceRepository
+	cfg        *config.JWTConfig
+}
+
+// NewJWTAuthenticator creates a JWT authenticator and loads its key set
+func NewJWTAuthenticator(workspaces *repository.WorkspaceRepository, cfg *config.JWTConfig) (*JWTAuthenticator, error) {
+	keys, err := NewJWKS(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return &JWTAuthenticator{keys: keys, workspaces: workspaces, cfg: cfg}, nil
+}
+
+// IsJWT reports whether a bearer credential has the shape of a compact JWS
+func IsJWT(token string) bool {
+	return strings.Count(token, ".") == 2
+}
+
+// Authenticate verifies the token and returns the principal it acts as.
+// workspaceID is the workspace the client asked for (0 when none); it must
+// agree with the token's workspace claim when both are set.
+// Invalid tokens return ErrUnauthorized; valid tokens that grant no access
+// to the workspace return ErrForbidden.
+func (a *JWTAuthenticator) Authenticate(token string, workspaceID uint, now time.Time) (*Principal, error) {
+	claims, err := a.verify(token, now)
+	if err != nil {
+		return nil, fmt.Errorf("%v: %w", err, utils.ErrUnauthorized)
+	}
+
+	claimedWorkspace, err := uintClaim(claims, a.cfg.WorkspaceClaim)
+	if err != nil {
+		return nil, fmt.Errorf("%v: %w", err, utils.ErrUnauthorized)
+	}
+	if claimedWorkspace != 0 {
+		if workspaceID != 0 && workspaceID != claimedWorkspace {
+			return nil, fmt.Errorf("token is issued for workspace %d, not %d: %w", claimedWorkspace, workspaceID, utils.ErrForbidden)
+		}
+		workspaceID = claimedWorkspace
+	}
+
+	scopes, hasScopes, err := a.scopes(claims)
+	if err != nil {
+		return nil, fmt.Errorf("%v: %w", err, utils.ErrUnauthorized)
+	}
+
+	email, _ := claims[a.cfg.EmailClaim].(string)
+	if email == "" {
+		// Service tokens may only act in the workspace the issuer put in the token
+		if claimedWorkspace == 0 {
+			return nil, fmt.Errorf("token has neither a %s nor a %s claim: %w", a.cfg.EmailClaim, a.cfg.WorkspaceClaim, utils.ErrForbidden)
+		}
+		if _, err := a.workspaces.GetByID(claimedWorkspace); err != nil {
+			if errors.Is(err, utils.ErrWorkspaceNotFound) {
+				return nil, fmt.Errorf("%v: %w", err, utils.ErrForbidden)
+			}
+			return nil, err
+		}
+		if len(scopes) == 0 {
+			return nil, fmt.Errorf("token grants no scopes: %w", utils.ErrForbidden)
+		}
+		return &Principal{WorkspaceID: claimedWorkspace, Scopes: scopes}, nil
+	}
+
+	if verified, ok := claims["email_verified"].(bool); ok && !verified {
+		return nil, fmt.Errorf("token email %s is not verified: %w", email, utils.ErrForbidden)
+	}
+	user, err := a.workspaces.GetUserByEmail(email)
+	if err != nil {
+		if errors.Is(err, utils.ErrNotFound) {
+			return nil, fmt.Errorf("no user with email %s; add them to a workspace first: %w", email, utils.ErrForbidden)
+		}
+		return nil, err
+	}
+
+	if workspaceID == 0 {
+		memberships, err := a.workspaces.ListForUser(user.ID)
+		if err != nil {
+			return nil, err
+		}
+		if len(memberships) != 1 {
+			return nil, fmt.Errorf("user %s belongs to %d workspaces; choose one with the X-Workspace-ID header: %w",
+				email, len(memberships), utils.ErrInvalidInput)
+		}
+		workspaceID = memberships[0].ID
+	}
+
+	role, err := a.workspaces.Role(workspaceID, user.ID)
+	if err != nil {
+		if errors.Is(err, utils.ErrMemberNotFound) {
+			return nil, fmt.Errorf("user %s is not a member of workspace %d: %w", email, workspaceID, utils.ErrForbidden)
+		}
+		return nil, err
+	}
+	if !hasScopes {
+		scopes = slices.Clone(roleScopes[role])
+	}
+
+	return &Principal{WorkspaceID: workspaceID, UserID: &user.ID, Role: role, Scopes: scopes}, nil
+}
+
+// verify checks the signature and the registered claims of a compact JWS
+// token and returns its claims
+func (a *JWTAuthenticator) verify(token string, now time.Time) (map[string]any, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, errors.New("malformed token")
+	}
+
+	var header struct {
+		Alg  string   `json:"alg"`
+		Kid  string   `json:"kid"`
+		Crit []string `json:"crit"`
+	}
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, fmt.Errorf("malformed token header: %v", err)
+	}
+	if !slices.Contains(a.cfg.Algorithms, header.Alg) {
+		return nil, fmt.Errorf("token algorithm %q is not accepted", header.Alg)
+	}
+	if len(header.Crit) > 0 {
+		return nil, fmt.Errorf("unsupported critical header parameters %v", header.Crit)
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, errors.New("malformed token signature")
+	}
+
+	keys := a.keys.Keys(header.Kid, now)
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("unknown signing key %q", header.Kid)
+	}
+	signingInput := []byte(parts[0] + "." + parts[1])
+	verified := false
+	for _, key := range keys {
+		if key.alg != "" && key.alg != header.Alg {
+			continue
+		}
+		if verifyJWS(header.Alg, key.key, signingInput, signature) == nil {
+			verified = true
+			break
+		}
+	}
+	if !verified {
+		return nil, errors.New("invalid token signature")
+	}
+
+	var claims map[string]any
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, fmt.Errorf("malformed token claims: %v", err)
+	}
+	if err := a.checkRegisteredClaims(claims, now); err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
+
+// checkRegisteredClaims checks iss, aud, exp and nbf. exp is required.
+func (a *JWTAuthenticator) checkRegisteredClaims(claims map[string]any, now time.Time) error {
+	if iss, _ := claims["iss"].(string); iss != a.cfg.Issuer {
+		return fmt.Errorf("token issuer %q is not trusted", iss)
+	}
+
+	var audience []string
+	switch aud := claims["aud"].(type) {
+	case string:
+		audience = []string{aud}
+	case []any:
+		for _, v := range aud {
+			if s, ok := v.(string); ok {
+				audience = append(audience, s)
+			}
+		}
+	}
+	if !slices.Contains(audience, a.cfg.Audience) {
+		return fmt.Errorf("token audience does not include %q", a.cfg.Audience)
+	}
+
+	exp, ok, err := timeClaim(claims, "exp")
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return errors.New("token has no exp claim")
+	}
+	if now.After(exp.Add(a.cfg.ClockSkew)) {
+		return fmt.Errorf("token expired at %s", exp.UTC().Format(time.RFC3339))
+	}
+
+	nbf, ok, err := timeClaim(claims, "nbf")
+	if err != nil {
+		return err
+	}
+	if ok && now.Add(a.cfg.ClockSkew).Before(nbf) {
+		return fmt.Errorf("token is not valid before %s", nbf.UTC().Format(time.RFC3339))
+	}
+	return nil
+}
+
+// scopes reads the scope claim, either a space-separated string (OAuth 2.0)
+// or an array of strings. Scopes this service does not define are ignored.
+func (a *JWTAuthenticator) scopes(claims map[string]any) ([]string, bool, error) {
+	var values []string
+	switch v := claims[a.cfg.ScopeClaim].(type) {
+	case nil:
+		return nil, false, nil
+	case string:
+		values = strings.Fields(v)
+	case []any:
+		for _, item := range v {
+			s, ok := item.(string)
+			if !ok {
+				return nil, false, fmt.Errorf("invalid %s claim", a.cfg.ScopeClaim)
+			}
+			values = append(values, s)
+		}
+	default:
+		return nil, false, fmt.Errorf("invalid %s claim", a.cfg.ScopeClaim)
+	}
+
+	scopes := []string{}
+	for _, scope := range model.AllScopes {
+		if slices.Contains(values, scope) {
+			scopes = append(scopes, scope)
+		}
+	}
+	return scopes, true, nil
+}
+
+// decodeSegment decodes a base64url JSON segment of a token, keeping numbers
+// as json.Number so large IDs and timestamps are not rounded
+func decodeSegment(segment string, v any) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	return decoder.Decode(v)
+}
+
+// timeClaim reads a NumericDate claim
+func timeClaim(claims map[string]any, name string) (time.Time, bool, error) {
+	value, exists := claims[name]
+	if !exists {
+		return time.Time{}, false, nil
+	}
+	number, ok := value.(json.Number)
+	if !ok {
+		return time.Time{}, false, fmt.Errorf("invalid %s claim", name)
+	}
+	seconds, err := number.Float64()
+	if err != nil {
+		return time.Time{}, false, fmt.Errorf("invalid %s claim", name)
+	}
+	return time.Unix(int64(seconds), 0), true, nil
+}
+
+// uintClaim reads an ID claim given as a number or a numeric string; 0 when absent
+func uintClaim(claims map[string]any, name string) (uint, error) {
+	var text string
+	switch v := claims[name].(type) {
+	case nil:
+		return 0, nil
+	case json.Number:
+		text = v.String()
+	case string:
+		text = v
+	default:
+		return 0, fmt.Errorf("invalid %s claim", name)
+	}
+	id, err := strconv.ParseUint(text, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s claim", name)
+	}
+	return uint(id), nil
+}
@@ -0,0 +1,500 @@
+package service
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"url-shortener/internal/config"
+	"url-shortener/internal/model"
+	"url-shortener/internal/repository"
+	"url-shortener/internal/utils"
+)
+
+const (
+	testIssuer   = "https://idp.example.com/"
+	testAudience = "url-shortener"
+)
+
+// testKey is a signing key together with its public JWK
+type testKey struct {
+	kid    string
+	alg    string // pinned alg published in the JWK, if any
+	use    string // defaults to sig
+	signer crypto.Signer
+}
+
+func newRSAKey(t *testing.T, kid string) testKey {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("generate RSA key: %v", err)
+	}
+	return testKey{kid: kid, signer: key}
+}
+
+func newECKey(t *testing.T, kid string, curve elliptic.Curve) testKey {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(curve, rand.Reader)
+	if err != nil {
+		t.Fatalf("generate EC key: %v", err)
+	}
+	return testKey{kid: kid, signer: key}
+}
+
+// jwk returns the public key as a JWK
+func (k testKey) jwk() map[string]string {
+	b64 := func(b []byte) string { return base64.RawURLEncoding.EncodeToString(b) }
+	jwk := map[string]string{"kid": k.kid, "use": "sig"}
+	if k.use != "" {
+		jwk["use"] = k.use
+	}
+	if k.alg != "" {
+		jwk["alg"] = k.alg
+	}
+	switch pub := k.signer.Public().(type) {
+	case *rsa.PublicKey:
+		jwk["kty"] = "RSA"
+		jwk["n"] = b64(pub.N.Bytes())
+		jwk["e"] = b64(big.NewInt(int64(pub.E)).Bytes())
+	case *ecdsa.PublicKey:
+		size := (pub.Curve.Params().BitSize + 7) / 8
+		jwk["kty"] = "EC"
+		jwk["crv"] = pub.Curve.Params().Name
+		jwk["x"] = b64(pub.X.FillBytes(make([]byte, size)))
+		jwk["y"] = b64(pub.Y.FillBytes(make([]byte, size)))
+	}
+	return jwk
+}
+
+func writeJWKS(t *testing.T, path string, keys ...testKey) {
+	t.Helper()
+	set := struct {
+		Keys []map[string]string `json:"keys"`
+	}{}
+	for _, k := range keys {
+		set.Keys = append(set.Keys, k.jwk())
+	}
+	data, err := json.Marshal(set)
+	if err != nil {
+		t.Fatalf("marshal JWKS: %v", err)
+	}
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatalf("write JWKS: %v", err)
+	}
+}
+
+// signToken builds a compact JWS. The hash comes from alg and the signature
+// scheme from the key type, so tokens can claim an alg that does not match
+// the key that signed them.
+func signToken(t *testing.T, alg string, key testKey, header map[string]any, claims map[string]any) string {
+	t.Helper()
+	h := map[string]any{"alg": alg, "typ": "JWT"}
+	if key.kid != "" {
+		h["kid"] = key.kid
+	}
+	for name, value := range header {
+		if value == nil {
+			delete(h, name)
+		} else {
+			h[name] = value
+		}
+	}
+	headerJSON, _ := json.Marshal(h)
+	claimsJSON, _ := json.Marshal(claims)
+	input := base64.RawURLEncoding.EncodeToString(headerJSON) + "." + base64.RawURLEncoding.EncodeToString(claimsJSON)
+
+	hash := map[string]crypto.Hash{"256": crypto.SHA256, "384": crypto.SHA384, "512": crypto.SHA512}[alg[len(alg)-3:]]
+	if hash == 0 {
+		return input + "."
+	}
+	digester := hash.New()
+	digester.Write([]byte(input))
+	digest := digester.Sum(nil)
+
+	var signature []byte
+	var err error
+	switch priv := key.signer.(type) {
+	case *rsa.PrivateKey:
+		if strings.HasPrefix(alg, "PS") {
+			signature, err = rsa.SignPSS(rand.Reader, priv, hash, digest, &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash})
+		} else {
+			signature, err = rsa.SignPKCS1v15(rand.Reader, priv, hash, digest)
+		}
+	case *ecdsa.PrivateKey:
+		var r, s *big.Int
+		r, s, err = ecdsa.Sign(rand.Reader, priv, digest)
+		if err == nil {
+			size := (priv.Curve.Params().BitSize + 7) / 8
+			signature = append(r.FillBytes(make([]byte, size)), s.FillBytes(make([]byte, size))...)
+		}
+	}
+	if err != nil {
+		t.Fatalf("sign token: %v", err)
+	}
+	return input + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+func testJWTConfig(jwksFile string) *config.JWTConfig {
+	return &config.JWTConfig{
+		JWKSFile:       jwksFile,
+		JWKSRefresh:    time.Hour,
+		Issuer:         testIssuer,
+		Audience:       testAudience,
+		ClockSkew:      30 * time.Second,
+		Algorithms:     []string{"RS256", "PS256", "ES256", "ES384"},
+		EmailClaim:     "email",
+		ScopeClaim:     "scope",
+		WorkspaceClaim: "workspace_id",
+	}
+}
+
+// validClaims returns registered claims valid at now, merged with extra.
+// A nil value in extra removes the claim.
+func validClaims(now time.Time, extra map[string]any) map[string]any {
+	claims := map[string]any{
+		"iss": testIssuer,
+		"aud": testAudience,
+		"iat": now.Unix(),
+		"exp": now.Add(5 * time.Minute).Unix(),
+	}
+	for name, value := range extra {
+		if value == nil {
+			delete(claims, name)
+		} else {
+			claims[name] = value
+		}
+	}
+	return claims
+}
+
+func TestJWTVerify(t *testing.T) {
+	now := time.Date(2026, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	rsaKey := newRSAKey(t, "rsa-1")
+	ecKey := newECKey(t, "ec-1", elliptic.P256())
+	ec384Key := newECKey(t, "ec-384", elliptic.P384())
+	pinnedKey := newRSAKey(t, "rsa-pinned")
+	pinnedKey.alg = "RS256"
+	encKey := newRSAKey(t, "rsa-enc")
+	encKey.use = "enc"
+	unlistedKey := newRSAKey(t, "rsa-1") // same kid as rsaKey, not in the JWKS
+
+	jwksFile := filepath.Join(t.TempDir(), "jwks.json")
+	writeJWKS(t, jwksFile, rsaKey, ecKey, ec384Key, pinnedKey, encKey)
+	auth, err := NewJWTAuthenticator(nil, testJWTConfig(jwksFile))
+	if err != nil {
+		t.Fatalf("NewJWTAuthenticator: %v", err)
+	}
+
+	valid := validClaims(now, nil)
+	tamper := func(token string) string {
+		parts := strings.Split(token, ".")
+		claims, _ := json.Marshal(validClaims(now, map[string]any{"scope": "keys:admin"}))
+		return parts[0] + "." + base64.RawURLEncoding.EncodeToString(claims) + "." + parts[2]
+	}
+
+	tests := []struct {
+		name    string
+		token   string
+		wantErr string // substring of the error, empty when the token is valid
+	}{
+		{"RS256", signToken(t, "RS256", rsaKey, nil, valid), ""},
+		{"PS256", signToken(t, "PS256", rsaKey, nil, valid), ""},
+		{"ES256", signToken(t, "ES256", ecKey, nil, valid), ""},
+		{"ES384", signToken(t, "ES384", ec384Key, nil, valid), ""},
+		{"pinned key with its alg", signToken(t, "RS256", pinnedKey, nil, valid), ""},
+		{"no kid tries every key", signToken(t, "ES256", ecKey, map[string]any{"kid": nil}, valid), ""},
+
+		{"malformed", "abc.def", "malformed token"},
+		{"bad header encoding", "!!!." + strings.SplitN(signToken(t, "RS256", rsaKey, nil, valid), ".", 2)[1], "malformed token header"},
+		{"alg none", signToken(t, "none", rsaKey, nil, valid), `algorithm "none" is not accepted`},
+		{"alg HS256", signToken(t, "HS256", rsaKey, nil, valid), `algorithm "HS256" is not accepted`},
+		{"alg not configured", signToken(t, "RS384", rsaKey, nil, valid), `algorithm "RS384" is not accepted`},
+		{"crit header", signToken(t, "RS256", rsaKey, map[string]any{"crit": []string{"exp"}}, valid), "critical header"},
+		{"unknown kid", signToken(t, "RS256", newRSAKey(t, "rsa-unknown"), nil, valid), `unknown signing key "rsa-unknown"`},
+		{"key not in the set", signToken(t, "RS256", unlistedKey, nil, valid), "invalid token signature"},
+		{"tampered claims", tamper(signToken(t, "RS256", rsaKey, nil, valid)), "invalid token signature"},
+		{"EC alg with RSA kid", signToken(t, "ES256", ecKey, map[string]any{"kid": "rsa-1"}, valid), "invalid token signature"},
+		{"RSA alg with EC kid", signToken(t, "RS256", rsaKey, map[string]any{"kid": "ec-1"}, valid), "invalid token signature"},
+		{"ES384 with a P-256 key", signToken(t, "ES384", ecKey, nil, valid), "invalid token signature"},
+		{"ES256 with a P-384 key", signToken(t, "ES256", ec384Key, nil, valid), "invalid token signature"},
+		{"pinned key with another alg", signToken(t, "PS256", pinnedKey, nil, valid), "invalid token signature"},
+		{"encryption key", signToken(t, "RS256", encKey, nil, valid), `unknown signing key "rsa-enc"`},
+
+		{"wrong issuer", signToken(t, "RS256", rsaKey, nil, validClaims(now, map[string]any{"iss": "https://evil.example.com/"})), "issuer"},
+		{"missing issuer", signToken(t, "RS256", rsaKey, nil, validClaims(now, map[string]any{"iss": nil})), "issuer"},
+		{"wrong audience", signToken(t, "RS256", rsaKey, nil, validClaims(now, map[string]any{"aud": "other-api"})), "audience"},
+		{"missing audience", signToken(t, "RS256", rsaKey, nil, validClaims(now, map[string]any{"aud": nil})), "audience"},
+		{"audience list", signToken(t, "RS256", rsaKey, nil, validClaims(now, map[string]any{"aud": []string{"other-api", testAudience}})), ""},
+		{"audience list without us", signToken(t, "RS256", rsaKey, nil, validClaims(now, map[string]any{"aud": []string{"other-api"}})), "audience"},
+		{"expired", signToken(t, "RS256", rsaKey, nil, validClaims(now, map[string]any{"exp": now.Add(-time.Minute).Unix()})), "expired"},
+		{"expired within skew", signToken(t, "RS256", rsaKey, nil, validClaims(now, map[string]any{"exp": now.Add(-10 * time.Second).Unix()})), ""},
+		{"missing exp", signToken(t, "RS256", rsaKey, nil, validClaims(now, map[string]any{"exp": nil})), "no exp claim"},
+		{"exp as string", signToken(t, "RS256", rsaKey, nil, validClaims(now, map[string]any{"exp": "tomorrow"})), "invalid exp claim"},
+		{"not yet valid", signToken(t, "RS256", rsaKey, nil, validClaims(now, map[string]any{"nbf": now.Add(time.Minute).Unix()})), "not valid before"},
+		{"nbf within skew", signToken(t, "RS256", rsaKey, nil, validClaims(now, map[string]any{"nbf": now.Add(10 * time.Second).Unix()})), ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := auth.verify(tt.token, now)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("verify() = %v, want nil", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("verify() = %v, want error containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestJWTAuthenticate(t *testing.T) {
+	now := time.Date(2026, 5, 1, 12, 0, 0, 0, time.UTC)
+	db := newTestDB(t)
+	workspaces := repository.NewWorkspaceRepository(db)
+
+	alice, _ := workspaces.FindOrCreateUser("alice@example.com", "Alice")
+	bob, _ := workspaces.FindOrCreateUser("bob@example.com", "Bob")
+	if _, err := workspaces.FindOrCreateUser("carol@example.com", "Carol"); err != nil {
+		t.Fatalf("create user: %v", err)
+	}
+	marketing := &model.Workspace{Name: "marketing"}
+	sales := &model.Workspace{Name: "sales"}
+	if err := workspaces.Create(marketing, &alice.ID); err != nil {
+		t.Fatalf("create workspace: %v", err)
+	}
+	if err := workspaces.Create(sales, &bob.ID); err != nil {
+		t.Fatalf("create workspace: %v", err)
+	}
+	if err := workspaces.AddMember(&model.WorkspaceMember{WorkspaceID: marketing.ID, UserID: bob.ID, Role: model.RoleViewer}); err != nil {
+		t.Fatalf("add member: %v", err)
+	}
+
+	key := newECKey(t, "ec-1", elliptic.P256())
+	jwksFile := filepath.Join(t.TempDir(), "jwks.json")
+	writeJWKS(t, jwksFile, key)
+	auth, err := NewJWTAuthenticator(workspaces, testJWTConfig(jwksFile))
+	if err != nil {
+		t.Fatalf("NewJWTAuthenticator: %v", err)
+	}
+	token := func(claims map[string]any) string {
+		return signToken(t, "ES256", key, nil, validClaims(now, claims))
+	}
+
+	tests := []struct {
+		name        string
+		token       string
+		workspaceID uint
+		wantErr     *utils.AppError
+		want        *Principal
+	}{
+		{
+			name:  "service token maps known scopes",
+			token: token(map[string]any{"workspace_id": marketing.ID, "scope": "links:read bogus analytics:read"}),
+			want:  &Principal{WorkspaceID: marketing.ID, Scopes: []string{model.ScopeLinksRead, model.ScopeAnalyticsRead}},
+		},
+		{
+			name:  "service token with scope array and string workspace",
+			token: token(map[string]any{"workspace_id": strconv.Itoa(int(sales.ID)), "scope": []string{"reports:read"}}),
+			want:  &Principal{WorkspaceID: sales.ID, Scopes: []string{model.ScopeReportsRead}},
+		},
+		{
+			name:        "service token with matching workspace header",
+			token:       token(map[string]any{"workspace_id": marketing.ID, "scope": "links:read"}),
+			workspaceID: marketing.ID,
+			want:        &Principal{WorkspaceID: marketing.ID, Scopes: []string{model.ScopeLinksRead}},
+		},
+		{
+			name:        "service token for another workspace",
+			token:       token(map[string]any{"workspace_id": marketing.ID, "scope": "links:read"}),
+			workspaceID: sales.ID,
+			wantErr:     utils.ErrForbidden,
+		},
+		{
+			name:    "service token without workspace claim",
+			token:   token(map[string]any{"scope": "links:read"}),
+			wantErr: utils.ErrForbidden,
+		},
+		{
+			name:    "service token without scope claim",
+			token:   token(map[string]any{"workspace_id": marketing.ID}),
+			wantErr: utils.ErrForbidden,
+		},
+		{
+			name:    "service token with only unknown scopes",
+			token:   token(map[string]any{"workspace_id": marketing.ID, "scope": "admin root"}),
+			wantErr: utils.ErrForbidden,
+		},
+		{
+			name:    "service token for a missing workspace",
+			token:   token(map[string]any{"workspace_id": 999, "scope": "links:read"}),
+			wantErr: utils.ErrForbidden,
+		},
+		{
+			name:    "invalid workspace claim",
+			token:   token(map[string]any{"workspace_id": "marketing", "scope": "links:read"}),
+			wantErr: utils.ErrUnauthorized,
+		},
+		{
+			name:    "invalid scope claim",
+			token:   token(map[string]any{"workspace_id": marketing.ID, "scope": 42}),
+			wantErr: utils.ErrUnauthorized,
+		},
+		{
+			name:  "user token gets role scopes",
+			token: token(map[string]any{"email": "Alice@Example.com"}),
+			want:  &Principal{WorkspaceID: marketing.ID, UserID: &alice.ID, Role: model.RoleOwner, Scopes: model.AllScopes},
+		},
+		{
+			name:  "user token with scope claim",
+			token: token(map[string]any{"email": "alice@example.com", "email_verified": true, "scope": "links:read links:write"}),
+			want:  &Principal{WorkspaceID: marketing.ID, UserID: &alice.ID, Role: model.RoleOwner, Scopes: []string{model.ScopeLinksRead, model.ScopeLinksWrite}},
+		},
+		{
+			name:  "user token with empty scope claim",
+			token: token(map[string]any{"email": "alice@example.com", "scope": ""}),
+			want:  &Principal{WorkspaceID: marketing.ID, UserID: &alice.ID, Role: model.RoleOwner, Scopes: []string{}},
+		},
+		{
+			name:    "user in several workspaces without a choice",
+			token:   token(map[string]any{"email": "bob@example.com"}),
+			wantErr: utils.ErrInvalidInput,
+		},
+		{
+			name:        "user picks a workspace with the header",
+			token:       token(map[string]any{"email": "bob@example.com"}),
+			workspaceID: marketing.ID,
+			want:        &Principal{WorkspaceID: marketing.ID, UserID: &bob.ID, Role: model.RoleViewer, Scopes: roleScopes[model.RoleViewer]},
+		},
+		{
+			name:  "user picks a workspace with the claim",
+			token: token(map[string]any{"email": "bob@example.com", "workspace_id": sales.ID}),
+			want:  &Principal{WorkspaceID: sales.ID, UserID: &bob.ID, Role: model.RoleOwner, Scopes: model.AllScopes},
+		},
+		{
+			name:        "user is not a member",
+			token:       token(map[string]any{"email": "carol@example.com"}),
+			workspaceID: marketing.ID,
+			wantErr:     utils.ErrForbidden,
+		},
+		{
+			name:    "user has no workspace",
+			token:   token(map[string]any{"email": "carol@example.com"}),
+			wantErr: utils.ErrInvalidInput,
+		},
+		{
+			name:    "unknown user",
+			token:   token(map[string]any{"email": "mallory@example.com"}),
+			wantErr: utils.ErrForbidden,
+		},
+		{
+			name:    "unverified email",
+			token:   token(map[string]any{"email": "alice@example.com", "email_verified": false}),
+			wantErr: utils.ErrForbidden,
+		},
+		{
+			name:    "invalid token",
+			token:   token(map[string]any{"email": "alice@example.com", "exp": now.Add(-time.Hour).Unix()}),
+			wantErr: utils.ErrUnauthorized,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := auth.Authenticate(tt.token, tt.workspaceID, now)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("Authenticate() = %+v, %v; want %v", got, err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Authenticate() = %v", err)
+			}
+			if got.APIKeyID != 0 || got.WorkspaceID != tt.want.WorkspaceID || got.Role != tt.want.Role ||
+				(got.UserID == nil) != (tt.want.UserID == nil) || (got.UserID != nil && *got.UserID != *tt.want.UserID) ||
+				!slices.Equal(got.Scopes, tt.want.Scopes) {
+				t.Fatalf("Authenticate() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestJWKSRefreshesInBackground(t *testing.T) {
+	oldKey := newRSAKey(t, "2026-04")
+	newKey := newRSAKey(t, "2026-05")
+	jwksFile := filepath.Join(t.TempDir(), "jwks.json")
+	writeJWKS(t, jwksFile, oldKey)
+
+	var fetches atomic.Int32
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// The first fetch is the startup load; later fetches wait until released
+		if fetches.Add(1) > 1 {
+			<-release
+		}
+		http.ServeFile(w, r, jwksFile)
+	}))
+	defer server.Close()
+	var releaseOnce sync.Once
+	defer releaseOnce.Do(func() { close(release) })
+
+	cfg := testJWTConfig("")
+	cfg.JWKSURL = server.URL
+	auth, err := NewJWTAuthenticator(nil, cfg)
+	if err != nil {
+		t.Fatalf("NewJWTAuthenticator: %v", err)
+	}
+
+	// The identity provider rolls over to a new key
+	writeJWKS(t, jwksFile, oldKey, newKey)
+	now := time.Now().Add(2 * jwksMinRefetch)
+	token := signToken(t, "RS256", newKey, nil, validClaims(now, nil))
+
+	started := time.Now()
+	if _, err := auth.verify(token, now); err == nil || !strings.Contains(err.Error(), "unknown signing key") {
+		t.Fatalf("verify() = %v, want unknown signing key before the reload finishes", err)
+	}
+	if elapsed := time.Since(started); elapsed > time.Second {
+		t.Fatalf("verify() waited %s for the JWKS fetch", elapsed)
+	}
+	// Tokens signed with known keys keep working while the reload is pending
+	if _, err := auth.verify(signToken(t, "RS256", oldKey, nil, validClaims(now, nil)), now); err != nil {
+		t.Fatalf("verify() with the old key = %v", err)
+	}
+
+	releaseOnce.Do(func() { close(release) })
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		_, err := auth.verify(token, now)
+		if err == nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("verify() = %v after the reload, want nil", err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if n := fetches.Load(); n != 2 {
+		t.Fatalf("JWKS fetched %d times, want 2", n)
+	}
+}
@@ -0,0 +1,143 @@
+package service
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	"url-shortener/internal/config"
+	"url-shortener/internal/model"
+	"url-shortener/internal/repository"
+)
+
+// maxReportsPerRun 单次检查最多处理的到期订阅数，其余的留到下一次检查
+const maxReportsPerRun = 100
+
+// ReportScheduler 后台报告推送任务
+// 定期查找到期的订阅，推送上一个完整周期（天或周）的报告
+type ReportScheduler struct {
+	repo     *repository.ReportRepository
+	reports  *ReportService
+	interval time.Duration
+	workers  int
+	stop     chan struct{}
+	done     chan struct{}
+	stopOnce sync.Once
+}
+
+// NewReportScheduler 创建报告推送任务
+func NewReportScheduler(repo *repository.ReportRepository, reports *ReportService, cfg *config.ReportConfig) *ReportScheduler {
+	return &ReportScheduler{
+		repo:     repo,
+		reports:  reports,
+		interval: cfg.CheckInterval,
+		workers:  cfg.Workers,
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+}
+
+// Start 在后台按固定间隔检查到期的订阅
+func (s *ReportScheduler) Start() {
+	go func() {
+		defer close(s.done)
+
+		ticker := time.NewTicker(s.interval)
+		defer ticker.Stop()
+
+		for {
+			if err := s.RunOnce(time.Now()); err != nil {
+				log.Printf("Report delivery run failed: %v", err)
+			}
+
+			select {
+			case <-ticker.C:
+			case <-s.stop:
+				return
+			}
+		}
+	}()
+}
+
+// Stop 停止后台任务并等待当前推送结束，等待中的重试会被放弃
+func (s *ReportScheduler) Stop() {
+	s.stopOnce.Do(func() {
+		close(s.stop)
+	})
+	<-s.done
+}
+
+// reportJob 一次已认领的报告推送
+type reportJob struct {
+	sub        *model.ReportSubscription
+	start, end time.Time
+}
+
+// RunOnce 推送所有到期的报告，由 workers 个协程并发推送，等待全部完成后返回
+// 服务停机错过多个周期时只推送最近一个完整周期，避免恢复后集中补发
+func (s *ReportScheduler) RunOnce(now time.Time) error {
+	subs, err := s.repo.ListDue(now, maxReportsPerRun)
+	if err != nil {
+		return err
+	}
+
+	jobs := make(chan reportJob)
+	var wg sync.WaitGroup
+	for i := 0; i < s.workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for job := range jobs {
+				s.deliver(job)
+			}
+		}()
+	}
+	err = s.dispatch(subs, now, jobs)
+	close(jobs)
+	wg.Wait()
+	return err
+}
+
+// dispatch 认领到期的订阅并交给推送协程，停止时不再认领新的订阅
+func (s *ReportScheduler) dispatch(subs []model.ReportSubscription, now time.Time, jobs chan<- reportJob) error {
+	for i := range subs {
+		sub := &subs[i]
+		loc, err := time.LoadLocation(sub.Timezone)
+		if err != nil {
+			loc = time.UTC
+		}
+
+		end := sub.NextRunAt.In(loc)
+		for next := nextReportBoundary(sub.Schedule, end); !next.After(now); next = nextReportBoundary(sub.Schedule, end) {
+			end = next
+		}
+		start := previousReportBoundary(sub.Schedule, end)
+
+		// 先推进下一次发送时间再推送，其他实例不会重复认领
+		claimed, err := s.repo.Claim(sub, nextReportBoundary(sub.Schedule, end), now)
+		if err != nil {
+			return err
+		}
+		if !claimed {
+			continue
+		}
+
+		select {
+		case jobs <- reportJob{sub: sub, start: start, end: end}:
+		case <-s.stop:
+			// 已认领的这一期在当前协程推送（停止后不再重试），之后不再认领
+			s.deliver(reportJob{sub: sub, start: start, end: end})
+			return nil
+		}
+	}
+	return nil
+}
+
+// deliver 推送一次报告，失败时记录日志
+func (s *ReportScheduler) deliver(job reportJob) {
+	delivery := s.reports.Deliver(job.sub, job.start, job.end, s.stop)
+	if delivery.Error != "" {
+		log.Printf("Report %d delivery for %s - %s failed after %d attempt(s): %s",
+			job.sub.ID, job.start.Format(time.RFC3339), job.end.Format(time.RFC3339), delivery.Attempts, delivery.Error)
+	}
+}
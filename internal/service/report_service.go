@@ -0,0 +1,279 @@
+package service
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"url-shortener/internal/config"
+	"url-shortener/internal/model"
+	"url-shortener/internal/repository"
+	"url-shortener/internal/utils"
+)
+
+const (
+	// ReportSignatureHeader 推送请求中携带报告内容签名的请求头，值为 sha256=<HMAC-SHA256 十六进制>
+	ReportSignatureHeader = "X-Report-Signature"
+	// maxDeliveryHistory 查询投递记录时最多返回的条数
+	maxDeliveryHistory = 100
+)
+
+// ReportService 报告订阅管理与报告推送
+type ReportService struct {
+	repo          *repository.ReportRepository
+	urlRepo       *repository.URLRepository
+	analyticsRepo *repository.AnalyticsRepository
+	client        *http.Client
+	allowPrivate  bool
+	maxAttempts   int
+	retryBackoff  time.Duration
+	topLinks      int
+}
+
+// NewReportService 创建报告服务
+func NewReportService(repo *repository.ReportRepository, urlRepo *repository.URLRepository, analyticsRepo *repository.AnalyticsRepository, cfg *config.ReportConfig) *ReportService {
+	return &ReportService{
+		repo:          repo,
+		urlRepo:       urlRepo,
+		analyticsRepo: analyticsRepo,
+		client:        newWebhookClient(cfg.WebhookTimeout, cfg.AllowPrivateWebhooks),
+		allowPrivate:  cfg.AllowPrivateWebhooks,
+		maxAttempts:   cfg.MaxAttempts,
+		retryBackoff:  cfg.RetryBackoff,
+		topLinks:      cfg.TopLinks,
+	}
+}
+
+// CreateSubscription 为工作区内的 API Key 创建报告订阅，返回的签名密钥只在创建时可见
+// 订阅归属于 API Key，使用 JWT 认证的请求（apiKeyID 为 0）不能创建
+func (s *ReportService) CreateSubscription(workspaceID, apiKeyID uint, req *model.CreateReportSubscriptionRequest, now time.Time) (*model.CreateReportSubscriptionResponse, error) {
+	if apiKeyID == 0 {
+		return nil, fmt.Errorf("report subscriptions belong to an API key; authenticate with an API key to create one: %w", utils.ErrInvalidInput)
+	}
+
+	if err := validateWebhookURL(req.WebhookURL, s.allowPrivate); err != nil {
+		return nil, err
+	}
+
+	tz := req.Timezone
+	if tz == "" {
+		tz = "UTC"
+	}
+	loc, err := time.LoadLocation(tz)
+	if err != nil {
+		return nil, fmt.Errorf("invalid timezone %q: %w", tz, utils.ErrInvalidInput)
+	}
+
+	// 去重并确认指定的短链接都存在于工作区内
+	codes := make([]string, 0, len(req.ShortCodes))
+	seen := make(map[string]bool, len(req.ShortCodes))
+	for _, code := range req.ShortCodes {
+		if seen[code] {
+			continue
+		}
+		seen[code] = true
+		if _, err := s.urlRepo.GetByShortCodeInWorkspace(workspaceID, code); err != nil {
+			return nil, err
+		}
+		codes = append(codes, code)
+	}
+
+	secretBytes := make([]byte, 32)
+	if _, err := rand.Read(secretBytes); err != nil {
+		return nil, fmt.Errorf("failed to generate webhook secret: %w", err)
+	}
+	secret := hex.EncodeToString(secretBytes)
+
+	sub := &model.ReportSubscription{
+		APIKeyID:    apiKeyID,
+		WorkspaceID: workspaceID,
+		Name:        req.Name,
+		Schedule:    req.Schedule,
+		ShortCodes:  codes,
+		WebhookURL:  req.WebhookURL,
+		Secret:      secret,
+		Timezone:    tz,
+		IsActive:    true,
+		NextRunAt:   nextReportBoundary(req.Schedule, now.In(loc)).UTC(),
+	}
+	if err := s.repo.Create(sub); err != nil {
+		return nil, fmt.Errorf("failed to create report subscription: %w", err)
+	}
+
+	return &model.CreateReportSubscriptionResponse{ReportSubscription: sub, Secret: secret}, nil
+}
+
+// ListSubscriptions 列出 API Key 的报告订阅
+func (s *ReportService) ListSubscriptions(workspaceID, apiKeyID uint) ([]model.ReportSubscription, error) {
+	return s.repo.ListByAPIKey(workspaceID, apiKeyID)
+}
+
+// GetSubscription 获取 API Key 名下的报告订阅
+func (s *ReportService) GetSubscription(workspaceID, apiKeyID, id uint) (*model.ReportSubscription, error) {
+	return s.repo.GetByID(workspaceID, apiKeyID, id)
+}
+
+// DeleteSubscription 删除 API Key 名下的报告订阅
+func (s *ReportService) DeleteSubscription(workspaceID, apiKeyID, id uint) error {
+	return s.repo.Delete(workspaceID, apiKeyID, id)
+}
+
+// ListDeliveries 列出报告订阅最近的投递记录
+func (s *ReportService) ListDeliveries(workspaceID, apiKeyID, id uint, limit int) ([]model.ReportDelivery, error) {
+	if _, err := s.repo.GetByID(workspaceID, apiKeyID, id); err != nil {
+		return nil, err
+	}
+	if limit <= 0 || limit > maxDeliveryHistory {
+		limit = maxDeliveryHistory
+	}
+	return s.repo.ListDeliveries(id, limit)
+}
+
+// BuildReport 生成订阅在 [start, end) 区间的报告内容
+func (s *ReportService) BuildReport(sub *model.ReportSubscription, start, end, now time.Time) (*model.ReportPayload, error) {
+	loc, err := time.LoadLocation(sub.Timezone)
+	if err != nil {
+		loc = time.UTC
+	}
+
+	summary, links, err := s.analyticsRepo.GetReportAnalytics(sub.WorkspaceID, sub.ShortCodes, &start, &end, loc, s.topLinks)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build report: %w", err)
+	}
+
+	return &model.ReportPayload{
+		SubscriptionID: sub.ID,
+		Name:           sub.Name,
+		Schedule:       sub.Schedule,
+		Timezone:       loc.String(),
+		Period:         model.TimeRange{Since: start.In(loc), Until: end.In(loc)},
+		GeneratedAt:    now.UTC(),
+		Summary:        summary,
+		Links:          links,
+	}, nil
+}
+
+// Deliver 生成并推送订阅在 [start, end) 区间的报告，失败时按指数退避重试，结果写入投递记录
+// stop 关闭时放弃剩余的重试
+func (s *ReportService) Deliver(sub *model.ReportSubscription, start, end time.Time, stop <-chan struct{}) *model.ReportDelivery {
+	delivery := &model.ReportDelivery{
+		SubscriptionID: sub.ID,
+		PeriodStart:    start.UTC(),
+		PeriodEnd:      end.UTC(),
+		Status:         model.ReportDeliveryFailed,
+	}
+
+	body, err := s.renderReport(sub, start, end)
+	if err != nil {
+		delivery.Error = truncate(err.Error(), 500)
+		s.saveDelivery(delivery)
+		return delivery
+	}
+
+	backoff := s.retryBackoff
+	for attempt := 1; attempt <= s.maxAttempts; attempt++ {
+		if attempt > 1 {
+			select {
+			case <-time.After(backoff):
+				backoff *= 2
+			case <-stop:
+				delivery.Error = truncate("delivery aborted by shutdown; last error: "+delivery.Error, 500)
+				s.saveDelivery(delivery)
+				return delivery
+			}
+		}
+
+		delivery.Attempts = attempt
+		statusCode, err := s.post(sub, body)
+		delivery.StatusCode = statusCode
+		if err == nil {
+			delivery.Status = model.ReportDeliveryDelivered
+			delivery.Error = ""
+			break
+		}
+		delivery.Error = truncate(err.Error(), 500)
+
+		// 4xx（408、429 除外）说明接收方拒绝了请求，重试也不会成功
+		if statusCode >= 400 && statusCode < 500 && statusCode != http.StatusRequestTimeout && statusCode != http.StatusTooManyRequests {
+			break
+		}
+	}
+
+	s.saveDelivery(delivery)
+	return delivery
+}
+
+// renderReport 生成报告并序列化为 JSON
+func (s *ReportService) renderReport(sub *model.ReportSubscription, start, end time.Time) ([]byte, error) {
+	payload, err := s.BuildReport(sub, start, end, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(payload)
+}
+
+// post 推送一次报告，返回接收方的状态码
+func (s *ReportService) post(sub *model.ReportSubscription, body []byte) (int, error) {
+	req, err := http.NewRequest(http.MethodPost, sub.WebhookURL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "url-shortener-reports/1.0")
+	req.Header.Set(ReportSignatureHeader, "sha256="+SignReport(sub.Secret, body))
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return resp.StatusCode, fmt.Errorf("webhook responded with status %d", resp.StatusCode)
+	}
+	return resp.StatusCode, nil
+}
+
+// saveDelivery 保存投递记录，失败只记录日志
+func (s *ReportService) saveDelivery(delivery *model.ReportDelivery) {
+	if err := s.repo.RecordDelivery(delivery); err != nil {
+		log.Printf("Failed to save report delivery for subscription %d: %v", delivery.SubscriptionID, err)
+	}
+}
+
+// SignReport 计算报告内容的签名，接收方可用订阅密钥验证请求来源
+func SignReport(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// nextReportBoundary 返回 t 之后的下一个发送时间：每天 0 点或每周一 0 点（t 所在时区）
+func nextReportBoundary(schedule string, t time.Time) time.Time {
+	y, m, d := t.Date()
+	if schedule == model.ReportScheduleWeekly {
+		days := (8 - int(t.Weekday())) % 7
+		if days == 0 {
+			days = 7
+		}
+		return time.Date(y, m, d+days, 0, 0, 0, 0, t.Location())
+	}
+	return time.Date(y, m, d+1, 0, 0, 0, 0, t.Location())
+}
+
+// previousReportBoundary 返回发送时间 end 对应统计区间的开始时间
+func previousReportBoundary(schedule string, end time.Time) time.Time {
+	if schedule == model.ReportScheduleWeekly {
+		return end.AddDate(0, 0, -7)
+	}
+	return end.AddDate(0, 0, -1)
+}
@@ -0,0 +1,304 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+
+	"url-shortener/internal/config"
+	"url-shortener/internal/model"
+	"url-shortener/internal/repository"
+	"url-shortener/internal/utils"
+)
+
+func newTestReportService(t *testing.T, db *gorm.DB, allowPrivate bool) (*ReportService, *config.ReportConfig) {
+	t.Helper()
+	cfg := &config.ReportConfig{
+		CheckInterval:        time.Minute,
+		MaxAttempts:          3,
+		RetryBackoff:         time.Millisecond,
+		WebhookTimeout:       5 * time.Second,
+		TopLinks:             10,
+		Workers:              2,
+		AllowPrivateWebhooks: allowPrivate,
+	}
+	reports := NewReportService(repository.NewReportRepository(db), repository.NewURLRepository(db), repository.NewAnalyticsRepository(db), cfg)
+	return reports, cfg
+}
+
+func TestValidateWebhookURL(t *testing.T) {
+	tests := []struct {
+		url          string
+		allowPrivate bool
+		wantErr      bool
+	}{
+		{"https://hooks.example.com/report", false, false},
+		{"https://8.8.8.8/hook", false, false},
+		{"https://[2606:4700:4700::1111]/hook", false, false},
+		{"ftp://hooks.example.com/report", false, true},
+		{"https:///no-host", false, true},
+		{"http://localhost:8080/hook", false, true},
+		{"http://LOCALHOST/hook", false, true},
+		{"http://api.localhost/hook", false, true},
+		{"http://127.0.0.1/hook", false, true},
+		{"http://127.1.2.3/hook", false, true},
+		{"http://[::1]/hook", false, true},
+		{"http://[::ffff:127.0.0.1]/hook", false, true},
+		{"http://169.254.169.254/latest/meta-data/", false, true},
+		{"http://[fe80::1]/hook", false, true},
+		{"http://10.0.0.5/hook", false, true},
+		{"http://172.16.3.4/hook", false, true},
+		{"http://192.168.1.1/hook", false, true},
+		{"http://[fd00::1]/hook", false, true},
+		{"http://100.64.0.1/hook", false, true},
+		{"http://0.0.0.0/hook", false, true},
+		{"http://224.0.0.1/hook", false, true},
+		{"http://127.0.0.1/hook", true, false},
+		{"http://localhost:8080/hook", true, false},
+		{"ftp://127.0.0.1/hook", true, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			err := validateWebhookURL(tt.url, tt.allowPrivate)
+			if tt.wantErr && !errors.Is(err, utils.ErrInvalidInput) {
+				t.Fatalf("validateWebhookURL(%q, %v) = %v, want ErrInvalidInput", tt.url, tt.allowPrivate, err)
+			}
+			if !tt.wantErr && err != nil {
+				t.Fatalf("validateWebhookURL(%q, %v) = %v, want nil", tt.url, tt.allowPrivate, err)
+			}
+		})
+	}
+}
+
+func TestRejectPrivateAddress(t *testing.T) {
+	tests := []struct {
+		address string
+		allowed bool
+	}{
+		{"93.184.216.34:443", true},
+		{"[2606:4700:4700::1111]:443", true},
+		{"127.0.0.1:80", false},
+		{"[::1]:80", false},
+		{"[::ffff:127.0.0.1]:80", false},
+		{"169.254.169.254:80", false},
+		{"10.1.2.3:80", false},
+		{"192.168.0.10:80", false},
+		{"[fd12:3456::1]:80", false},
+		{"100.100.100.200:80", false},
+		{"0.0.0.0:80", false},
+		{"255.255.255.255:80", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.address, func(t *testing.T) {
+			err := rejectPrivateAddress("tcp", tt.address, nil)
+			if tt.allowed && err != nil {
+				t.Fatalf("rejectPrivateAddress(%q) = %v, want nil", tt.address, err)
+			}
+			if !tt.allowed && err == nil {
+				t.Fatalf("rejectPrivateAddress(%q) = nil, want error", tt.address)
+			}
+		})
+	}
+}
+
+func TestWebhookClientRefusesPrivateAddresses(t *testing.T) {
+	var hits atomic.Int32
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+	}))
+	defer receiver.Close()
+
+	// 主机名在连接时才解析，localhost 和 IP 字面量都应在连接前被拦截
+	receiverURL, _ := url.Parse(receiver.URL)
+	port := receiverURL.Port()
+	guarded := newWebhookClient(time.Second, false)
+	for _, target := range []string{receiver.URL, "http://localhost:" + port} {
+		resp, err := guarded.Get(target)
+		if err == nil {
+			resp.Body.Close()
+			t.Fatalf("GET %s succeeded, want the dial to be refused", target)
+		}
+	}
+
+	// 重定向到内部地址同样被拦截
+	redirector := httptest.NewServer(http.RedirectHandler(receiver.URL, http.StatusFound))
+	defer redirector.Close()
+	if resp, err := guarded.Get(redirector.URL); err == nil {
+		resp.Body.Close()
+		t.Fatal("redirect to a private address succeeded")
+	}
+	if hits.Load() != 0 {
+		t.Fatalf("receiver got %d requests, want 0", hits.Load())
+	}
+
+	resp, err := newWebhookClient(time.Second, true).Get(receiver.URL)
+	if err != nil {
+		t.Fatalf("GET with private addresses allowed: %v", err)
+	}
+	resp.Body.Close()
+	if hits.Load() != 1 {
+		t.Fatalf("receiver got %d requests, want 1", hits.Load())
+	}
+}
+
+func TestCreateSubscriptionRejectsPrivateWebhook(t *testing.T) {
+	reports, _ := newTestReportService(t, newTestDB(t), false)
+	now := time.Date(2026, 3, 4, 10, 0, 0, 0, time.UTC)
+
+	for _, webhook := range []string{"http://127.0.0.1:9000/hook", "http://localhost/hook", "http://169.254.169.254/", "http://[::1]/hook"} {
+		req := &model.CreateReportSubscriptionRequest{Name: "daily", Schedule: "daily", WebhookURL: webhook}
+		if _, err := reports.CreateSubscription(1, 1, req, now); !errors.Is(err, utils.ErrInvalidInput) {
+			t.Errorf("CreateSubscription(%s) = %v, want ErrInvalidInput", webhook, err)
+		}
+	}
+
+	req := &model.CreateReportSubscriptionRequest{Name: "daily", Schedule: "daily", WebhookURL: "https://hooks.example.com/report"}
+	resp, err := reports.CreateSubscription(1, 1, req, now)
+	if err != nil {
+		t.Fatalf("CreateSubscription: %v", err)
+	}
+	if want := time.Date(2026, 3, 5, 0, 0, 0, 0, time.UTC); !resp.NextRunAt.Equal(want) {
+		t.Fatalf("NextRunAt = %s, want %s", resp.NextRunAt, want)
+	}
+}
+
+func TestDeliverSignsAndRetries(t *testing.T) {
+	db := newTestDB(t)
+	reports, _ := newTestReportService(t, db, true)
+
+	var attempts atomic.Int32
+	var gotBody []byte
+	var gotSignature string
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if attempts.Add(1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		gotBody, _ = io.ReadAll(r.Body)
+		gotSignature = r.Header.Get(ReportSignatureHeader)
+	}))
+	defer receiver.Close()
+
+	sub := &model.ReportSubscription{
+		APIKeyID: 1, WorkspaceID: 1, Name: "daily", Schedule: "daily",
+		WebhookURL: receiver.URL, Secret: "secret", Timezone: "UTC", IsActive: true,
+	}
+	if err := db.Create(sub).Error; err != nil {
+		t.Fatalf("create subscription: %v", err)
+	}
+
+	start := time.Date(2026, 3, 3, 0, 0, 0, 0, time.UTC)
+	end := start.AddDate(0, 0, 1)
+	delivery := reports.Deliver(sub, start, end, nil)
+	if delivery.Status != model.ReportDeliveryDelivered || delivery.Attempts != 2 {
+		t.Fatalf("delivery = %+v, want delivered after 2 attempts", delivery)
+	}
+	if want := "sha256=" + SignReport("secret", gotBody); gotSignature != want {
+		t.Fatalf("signature = %q, want %q", gotSignature, want)
+	}
+
+	var payload model.ReportPayload
+	if err := json.Unmarshal(gotBody, &payload); err != nil {
+		t.Fatalf("decode payload: %v", err)
+	}
+	if payload.SubscriptionID != sub.ID || !payload.Period.Since.Equal(start) || !payload.Period.Until.Equal(end) {
+		t.Fatalf("payload = %+v, want subscription %d for %s - %s", payload, sub.ID, start, end)
+	}
+
+	deliveries, err := reports.ListDeliveries(1, 1, sub.ID, 10)
+	if err != nil || len(deliveries) != 1 {
+		t.Fatalf("ListDeliveries = %v, %v; want 1 delivery", deliveries, err)
+	}
+}
+
+func TestDeliverDoesNotRetryClientErrors(t *testing.T) {
+	db := newTestDB(t)
+	reports, _ := newTestReportService(t, db, true)
+
+	var attempts atomic.Int32
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts.Add(1)
+		w.WriteHeader(http.StatusGone)
+	}))
+	defer receiver.Close()
+
+	sub := &model.ReportSubscription{
+		APIKeyID: 1, WorkspaceID: 1, Name: "daily", Schedule: "daily",
+		WebhookURL: receiver.URL, Secret: "secret", Timezone: "UTC", IsActive: true,
+	}
+	if err := db.Create(sub).Error; err != nil {
+		t.Fatalf("create subscription: %v", err)
+	}
+
+	start := time.Date(2026, 3, 3, 0, 0, 0, 0, time.UTC)
+	delivery := reports.Deliver(sub, start, start.AddDate(0, 0, 1), nil)
+	if delivery.Status != model.ReportDeliveryFailed || delivery.StatusCode != http.StatusGone || attempts.Load() != 1 {
+		t.Fatalf("delivery = %+v after %d attempts, want one failed attempt with 410", delivery, attempts.Load())
+	}
+}
+
+func TestSchedulerSlowWebhookDoesNotBlockOthers(t *testing.T) {
+	db := newTestDB(t)
+	reports, cfg := newTestReportService(t, db, true)
+	scheduler := NewReportScheduler(repository.NewReportRepository(db), reports, cfg)
+
+	release := make(chan struct{})
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer slow.Close()
+	defer close(release)
+
+	fastDone := make(chan struct{}, 1)
+	fast := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fastDone <- struct{}{}
+	}))
+	defer fast.Close()
+
+	now := time.Date(2026, 3, 4, 0, 5, 0, 0, time.UTC)
+	due := time.Date(2026, 3, 4, 0, 0, 0, 0, time.UTC)
+	// 慢的订阅先到期，串行推送时会挡住后面的订阅
+	for i, webhook := range []string{slow.URL, fast.URL} {
+		sub := &model.ReportSubscription{
+			APIKeyID: 1, WorkspaceID: 1, Name: "daily", Schedule: "daily",
+			WebhookURL: webhook, Secret: "secret", Timezone: "UTC", IsActive: true,
+			NextRunAt: due.Add(-time.Duration(2-i) * time.Minute),
+		}
+		if err := db.Create(sub).Error; err != nil {
+			t.Fatalf("create subscription: %v", err)
+		}
+	}
+
+	runDone := make(chan error, 1)
+	go func() { runDone <- scheduler.RunOnce(now) }()
+
+	select {
+	case <-fastDone:
+	case <-time.After(3 * time.Second):
+		t.Fatal("fast webhook was not called while the slow one was pending")
+	}
+	release <- struct{}{}
+
+	select {
+	case err := <-runDone:
+		if err != nil {
+			t.Fatalf("RunOnce: %v", err)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatal("RunOnce did not return")
+	}
+
+	var delivered int64
+	db.Model(&model.ReportDelivery{}).Where("status = ?", model.ReportDeliveryDelivered).Count(&delivered)
+	if delivered != 2 {
+		t.Fatalf("delivered = %d, want 2", delivered)
+	}
+}
@@ -0,0 +1,100 @@
+package service
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"syscall"
+	"time"
+
+	"url-shortener/internal/utils"
+)
+
+// reservedNetworks 除 net.IP 方法已覆盖的回环、私有、链路本地等地址外，
+// 其他不应作为推送目标的保留网段
+var reservedNetworks = mustParseNetworks(
+	"0.0.0.0/8",      // 本网络
+	"100.64.0.0/10",  // 运营商级 NAT
+	"192.0.0.0/24",   // IETF 协议分配
+	"198.18.0.0/15",  // 网络基准测试
+	"240.0.0.0/4",    // 保留，含广播地址
+	"64:ff9b:1::/48", // 本地 NAT64
+	"2001:db8::/32",  // 文档示例
+)
+
+func mustParseNetworks(cidrs ...string) []*net.IPNet {
+	networks := make([]*net.IPNet, 0, len(cidrs))
+	for _, cidr := range cidrs {
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			panic(err)
+		}
+		networks = append(networks, network)
+	}
+	return networks
+}
+
+// isPublicIP 地址是否可以作为推送目标：排除回环、私有、链路本地（含云厂商元数据地址 169.254.169.254）、
+// 组播等内部地址
+func isPublicIP(ip net.IP) bool {
+	if ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() || ip.IsLinkLocalUnicast() ||
+		ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast() || ip.IsMulticast() {
+		return false
+	}
+	for _, network := range reservedNetworks {
+		if network.Contains(ip) {
+			return false
+		}
+	}
+	return true
+}
+
+// validateWebhookURL 创建订阅时检查推送地址
+// 主机名在推送时才解析，届时由 newWebhookClient 的连接检查拦截内部地址
+func validateWebhookURL(raw string, allowPrivate bool) error {
+	webhook, err := url.Parse(raw)
+	if err != nil || (webhook.Scheme != "http" && webhook.Scheme != "https") || webhook.Host == "" {
+		return fmt.Errorf("webhook_url must be an http or https URL: %w", utils.ErrInvalidInput)
+	}
+	if allowPrivate {
+		return nil
+	}
+
+	host := webhook.Hostname()
+	if strings.EqualFold(host, "localhost") || strings.HasSuffix(strings.ToLower(host), ".localhost") {
+		return fmt.Errorf("webhook_url must not point to localhost: %w", utils.ErrInvalidInput)
+	}
+	if ip := net.ParseIP(host); ip != nil && !isPublicIP(ip) {
+		return fmt.Errorf("webhook_url must not point to a private or reserved address: %w", utils.ErrInvalidInput)
+	}
+	return nil
+}
+
+// newWebhookClient 创建推送报告的 HTTP 客户端
+// allowPrivate 为 false 时在建立连接前检查实际连接的地址，域名解析到内部地址（包括 DNS 重绑定）
+// 和重定向到内部地址都会被拒绝；此时不使用环境变量中的代理，否则检查的只是代理地址
+func newWebhookClient(timeout time.Duration, allowPrivate bool) *http.Client {
+	dialer := &net.Dialer{Timeout: timeout, KeepAlive: 30 * time.Second}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if !allowPrivate {
+		dialer.Control = rejectPrivateAddress
+		transport.Proxy = nil
+	}
+	transport.DialContext = dialer.DialContext
+	return &http.Client{Timeout: timeout, Transport: transport}
+}
+
+// rejectPrivateAddress net.Dialer 的 Control 回调，在连接前拒绝内部地址
+func rejectPrivateAddress(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip := net.ParseIP(host)
+	if ip == nil || !isPublicIP(ip) {
+		return fmt.Errorf("webhook address %s is not allowed: private or reserved network", host)
+	}
+	return nil
+}
@@ -0,0 +1,261 @@
+package service
+
+import (
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"url-shortener/internal/config"
+	"url-shortener/internal/model"
+	"url-shortener/internal/repository"
+)
+
+const (
+	// rollupGracePeriod 小时结束后等待异步写入的访问记录落库的时间
+	rollupGracePeriod = time.Minute
+	// maxRollupHoursPerRun 单次运行最多汇总的小时数，避免首次启动时长时间占用数据库
+	maxRollupHoursPerRun = 24 * 7
+	// rollupLateWindow 已汇总的小时在此时间内仍会检查迟到的访问记录（如数据库恢复后队列补写的记录）并重新汇总，
+	// 原始记录在重新汇总的窗口结束前不会被清理
+	rollupLateWindow = 24 * time.Hour
+)
+
+// RollupAggregator 后台汇总任务
+// 将原始访问记录汇总为小时和天粒度，并清理超过保留期的原始记录和超过转化窗口的点击
+type RollupAggregator struct {
+	repo      *repository.AnalyticsRepository
+	interval  time.Duration
+	retention time.Duration
+	stop      chan struct{}
+	done      chan struct{}
+	stopOnce  sync.Once
+
+	conversionWindow time.Duration
+}
+
+// NewRollupAggregator 创建汇总任务
+func NewRollupAggregator(repo *repository.AnalyticsRepository, cfg *config.AnalyticsConfig) *RollupAggregator {
+	return &RollupAggregator{
+		repo:      repo,
+		interval:  cfg.RollupInterval,
+		retention: time.Duration(cfg.RawRetentionDays) * 24 * time.Hour,
+		stop:      make(chan struct{}),
+		done:      make(chan struct{}),
+
+		conversionWindow: time.Duration(cfg.ConversionWindowDays) * 24 * time.Hour,
+	}
+}
+
+// Start 在后台按固定间隔运行汇总任务
+func (a *RollupAggregator) Start() {
+	go func() {
+		defer close(a.done)
+
+		ticker := time.NewTicker(a.interval)
+		defer ticker.Stop()
+
+		for {
+			if err := a.RunOnce(time.Now()); err != nil {
+				log.Printf("Visit rollup failed: %v", err)
+			}
+
+			select {
+			case <-ticker.C:
+			case <-a.stop:
+				return
+			}
+		}
+	}()
+}
+
+// Stop 停止后台任务并等待当前运行结束
+func (a *RollupAggregator) Stop() {
+	a.stopOnce.Do(func() {
+		close(a.stop)
+	})
+	<-a.done
+}
+
+// RunOnce 执行一次汇总与清理
+func (a *RollupAggregator) RunOnce(now time.Time) error {
+	hourlyMark, err := a.rollupHours(now.UTC())
+	if err != nil {
+		return err
+	}
+
+	lateFrom, err := a.rerollLateHours(hourlyMark)
+	if err != nil {
+		return err
+	}
+
+	dailyMark, err := a.rollupDays(hourlyMark, lateFrom)
+	if err != nil {
+		return err
+	}
+
+	if err := a.purge(now.UTC(), hourlyMark, dailyMark); err != nil {
+		return err
+	}
+
+	return a.purgeClicks(now.UTC())
+}
+
+// rollupHours 汇总所有已结束的小时，返回新的小时进度
+func (a *RollupAggregator) rollupHours(now time.Time) (time.Time, error) {
+	mark, err := a.repo.GetRollupWatermark(model.WatermarkHourly)
+	if err != nil {
+		return mark, fmt.Errorf("failed to load hourly watermark: %w", err)
+	}
+
+	closedBefore := now.Add(-rollupGracePeriod).Truncate(time.Hour)
+	if mark.IsZero() {
+		earliest, err := a.repo.EarliestVisitTime()
+		if err != nil {
+			return mark, fmt.Errorf("failed to find earliest visit: %w", err)
+		}
+		if earliest == nil {
+			return mark, nil
+		}
+		mark = earliest.Truncate(time.Hour)
+	}
+
+	for i := 0; mark.Before(closedBefore) && i < maxRollupHoursPerRun; i++ {
+		if err := a.repo.RollupHour(mark); err != nil {
+			return mark, fmt.Errorf("failed to roll up hour %s: %w", mark.Format(time.RFC3339), err)
+		}
+		mark = mark.Add(time.Hour)
+		if err := a.repo.SetRollupWatermark(model.WatermarkHourly, mark); err != nil {
+			return mark, fmt.Errorf("failed to save hourly watermark: %w", err)
+		}
+	}
+
+	return mark, nil
+}
+
+// rerollLateHours 重新汇总 rollupLateWindow 内汇总后又写入了访问记录的小时，
+// 返回其中最早的小时，没有需要重新汇总的小时时返回零值
+func (a *RollupAggregator) rerollLateHours(hourlyMark time.Time) (time.Time, error) {
+	var lateFrom time.Time
+	if hourlyMark.IsZero() {
+		return lateFrom, nil
+	}
+
+	for hour := hourlyMark.Add(-rollupLateWindow); hour.Before(hourlyMark); hour = hour.Add(time.Hour) {
+		stale, err := a.repo.HourlyRollupStale(hour)
+		if err != nil {
+			return lateFrom, fmt.Errorf("failed to check hour %s: %w", hour.Format(time.RFC3339), err)
+		}
+		if !stale {
+			continue
+		}
+		if err := a.repo.RollupHour(hour); err != nil {
+			return lateFrom, fmt.Errorf("failed to roll up hour %s: %w", hour.Format(time.RFC3339), err)
+		}
+		if lateFrom.IsZero() {
+			lateFrom = hour
+		}
+	}
+
+	return lateFrom, nil
+}
+
+// rollupDays 汇总所有小时数据已完整的自然日，并重新汇总 lateFrom 之后已汇总过的自然日，返回新的天进度
+func (a *RollupAggregator) rollupDays(hourlyMark, lateFrom time.Time) (time.Time, error) {
+	mark, err := a.repo.GetRollupWatermark(model.WatermarkDaily)
+	if err != nil {
+		return mark, fmt.Errorf("failed to load daily watermark: %w", err)
+	}
+	if hourlyMark.IsZero() {
+		return mark, nil
+	}
+
+	completeBefore := hourlyMark.Truncate(24 * time.Hour)
+	if mark.IsZero() {
+		earliest, err := a.repo.EarliestVisitTime()
+		if err != nil {
+			return mark, fmt.Errorf("failed to find earliest visit: %w", err)
+		}
+		if earliest == nil {
+			return mark, nil
+		}
+		mark = earliest.Truncate(24 * time.Hour)
+	}
+
+	if !lateFrom.IsZero() {
+		for day := lateFrom.Truncate(24 * time.Hour); day.Before(mark); day = day.Add(24 * time.Hour) {
+			if err := a.repo.RollupDay(day); err != nil {
+				return mark, fmt.Errorf("failed to roll up day %s: %w", day.Format("2006-01-02"), err)
+			}
+		}
+	}
+
+	for mark.Before(completeBefore) {
+		if err := a.repo.RollupDay(mark); err != nil {
+			return mark, fmt.Errorf("failed to roll up day %s: %w", mark.Format("2006-01-02"), err)
+		}
+		mark = mark.Add(24 * time.Hour)
+		if err := a.repo.SetRollupWatermark(model.WatermarkDaily, mark); err != nil {
+			return mark, fmt.Errorf("failed to save daily watermark: %w", err)
+		}
+	}
+
+	return mark, nil
+}
+
+// purge 清理超过保留期且已完成汇总的原始访问记录
+// 仍可能重新汇总的小时所在的自然日保留原始记录，天汇总的独立访客数需要从原始记录计算
+func (a *RollupAggregator) purge(now, hourlyMark, dailyMark time.Time) error {
+	if a.retention <= 0 || hourlyMark.IsZero() || dailyMark.IsZero() {
+		return nil
+	}
+
+	cutoff := now.Add(-a.retention)
+	if settled := hourlyMark.Add(-rollupLateWindow).Truncate(24 * time.Hour); settled.Before(cutoff) {
+		cutoff = settled
+	}
+	if dailyMark.Before(cutoff) {
+		cutoff = dailyMark
+	}
+	cutoff = cutoff.Truncate(time.Hour)
+
+	purgedBefore, err := a.repo.GetRollupWatermark(model.WatermarkPurge)
+	if err != nil {
+		return fmt.Errorf("failed to load purge watermark: %w", err)
+	}
+	if !cutoff.After(purgedBefore) {
+		return nil
+	}
+
+	// 先推进进度再删除，保证查询不会读到被部分清理的原始数据
+	if err := a.repo.SetRollupWatermark(model.WatermarkPurge, cutoff); err != nil {
+		return fmt.Errorf("failed to save purge watermark: %w", err)
+	}
+
+	deleted, err := a.repo.PurgeVisitsBefore(cutoff)
+	if err != nil {
+		return fmt.Errorf("failed to purge visits: %w", err)
+	}
+	if deleted > 0 {
+		log.Printf("Purged %d raw visits recorded before %s", deleted, cutoff.Format(time.RFC3339))
+	}
+
+	return nil
+}
+
+// purgeClicks 清理超过转化窗口的点击，之后回传的转化返回点击不存在
+func (a *RollupAggregator) purgeClicks(now time.Time) error {
+	if a.conversionWindow <= 0 {
+		return nil
+	}
+
+	deleted, err := a.repo.PurgeClicksBefore(now.Add(-a.conversionWindow))
+	if err != nil {
+		return fmt.Errorf("failed to purge clicks: %w", err)
+	}
+	if deleted > 0 {
+		log.Printf("Purged %d clicks outside the conversion window", deleted)
+	}
+
+	return nil
+}
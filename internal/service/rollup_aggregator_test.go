@@ -0,0 +1,217 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+
+	"url-shortener/internal/config"
+	"url-shortener/internal/model"
+	"url-shortener/internal/repository"
+)
+
+// newTestAggregator 返回基于测试数据库的汇总任务，retentionDays 为 0 时不清理原始记录
+func newTestAggregator(t *testing.T, retentionDays int) (*RollupAggregator, *repository.AnalyticsRepository, *gorm.DB) {
+	t.Helper()
+
+	db := newTestDB(t)
+	repo := repository.NewAnalyticsRepository(db)
+	return NewRollupAggregator(repo, &config.AnalyticsConfig{
+		RawRetentionDays: retentionDays,
+		RollupInterval:   time.Minute,
+	}), repo, db
+}
+
+func recordVisits(t *testing.T, repo *repository.AnalyticsRepository, ip string, times ...time.Time) {
+	t.Helper()
+
+	for _, at := range times {
+		if err := repo.RecordVisit(&model.VisitRecord{ShortCode: "abc", IPAddress: ip, VisitedAt: at}); err != nil {
+			t.Fatalf("record visit: %v", err)
+		}
+	}
+}
+
+func runAggregator(t *testing.T, a *RollupAggregator, now time.Time) {
+	t.Helper()
+
+	if err := a.RunOnce(now); err != nil {
+		t.Fatalf("RunOnce(%s): %v", now.Format(time.RFC3339), err)
+	}
+}
+
+func watermark(t *testing.T, repo *repository.AnalyticsRepository, name string) time.Time {
+	t.Helper()
+
+	mark, err := repo.GetRollupWatermark(name)
+	if err != nil {
+		t.Fatalf("GetRollupWatermark(%s): %v", name, err)
+	}
+	return mark
+}
+
+// rollupCount 返回汇总表中短码 abc 在 bucket 时间桶内某个维度取值的计数
+func rollupCount(t *testing.T, db *gorm.DB, table interface{}, bucket time.Time, dimension, value string) int64 {
+	t.Helper()
+
+	var count int64
+	err := db.Model(table).Select("COALESCE(SUM(count), 0)").
+		Where("short_code = ? AND bucket_start = ? AND dimension = ? AND value = ?", "abc", bucket.UTC(), dimension, value).
+		Scan(&count).Error
+	if err != nil {
+		t.Fatalf("read rollup: %v", err)
+	}
+	return count
+}
+
+func TestRollupAggregatorAdvancesHourlyWatermark(t *testing.T) {
+	a, repo, db := newTestAggregator(t, 0)
+	first := time.Date(2026, 4, 20, 0, 10, 0, 0, time.UTC)
+	recordVisits(t, repo, "192.0.2.1",
+		first,
+		time.Date(2026, 5, 1, 10, 10, 0, 0, time.UTC),
+		time.Date(2026, 5, 1, 11, 20, 0, 0, time.UTC),
+	)
+
+	steps := []struct {
+		now  time.Time
+		want time.Time
+	}{
+		// 首次运行从最早的访问开始，单次最多汇总 maxRollupHoursPerRun 个小时
+		{time.Date(2026, 5, 1, 12, 0, 30, 0, time.UTC), first.Truncate(time.Hour).Add(maxRollupHoursPerRun * time.Hour)},
+		// 12 点刚结束，还在等待异步写入的宽限期内
+		{time.Date(2026, 5, 1, 12, 0, 30, 0, time.UTC), time.Date(2026, 5, 1, 11, 0, 0, 0, time.UTC)},
+		{time.Date(2026, 5, 1, 12, 1, 30, 0, time.UTC), time.Date(2026, 5, 1, 12, 0, 0, 0, time.UTC)},
+		{time.Date(2026, 5, 1, 12, 30, 0, 0, time.UTC), time.Date(2026, 5, 1, 12, 0, 0, 0, time.UTC)},
+	}
+	for i, step := range steps {
+		runAggregator(t, a, step.now)
+		if got := watermark(t, repo, model.WatermarkHourly); !got.Equal(step.want) {
+			t.Errorf("run %d: hourly watermark = %s, want %s", i+1, got, step.want)
+		}
+	}
+
+	for hour, want := range map[int]int64{9: 0, 10: 1, 11: 1} {
+		bucket := time.Date(2026, 5, 1, hour, 0, 0, 0, time.UTC)
+		if got := rollupCount(t, db, &model.HourlyVisitRollup{}, bucket, model.DimensionTotal, ""); got != want {
+			t.Errorf("hour %d total = %d, want %d", hour, got, want)
+		}
+	}
+}
+
+func TestRollupAggregatorBuildsDailyFromHourly(t *testing.T) {
+	a, repo, db := newTestAggregator(t, 0)
+	recordVisits(t, repo, "192.0.2.1",
+		time.Date(2026, 5, 1, 8, 5, 0, 0, time.UTC),
+		time.Date(2026, 5, 1, 8, 50, 0, 0, time.UTC),
+		time.Date(2026, 5, 1, 23, 59, 0, 0, time.UTC),
+	)
+	recordVisits(t, repo, "192.0.2.2", time.Date(2026, 5, 1, 23, 0, 0, 0, time.UTC))
+	recordVisits(t, repo, "192.0.2.3", time.Date(2026, 5, 2, 0, 30, 0, 0, time.UTC))
+
+	// 5 月 1 日的最后一个小时尚未汇总，天汇总不能开始
+	runAggregator(t, a, time.Date(2026, 5, 1, 23, 59, 30, 0, time.UTC))
+	if got := watermark(t, repo, model.WatermarkDaily); !got.IsZero() {
+		t.Fatalf("daily watermark = %s before the day's hours are rolled up", got)
+	}
+
+	runAggregator(t, a, time.Date(2026, 5, 2, 1, 5, 0, 0, time.UTC))
+	day := time.Date(2026, 5, 1, 0, 0, 0, 0, time.UTC)
+	if got, want := watermark(t, repo, model.WatermarkDaily), day.Add(24*time.Hour); !got.Equal(want) {
+		t.Fatalf("daily watermark = %s, want %s", got, want)
+	}
+
+	daily := &model.DailyVisitRollup{}
+	tests := []struct {
+		dimension, value string
+		want             int64
+	}{
+		{model.DimensionTotal, "", 4},
+		{model.DimensionUnique, "", 2},
+		{model.DimensionHour, "8", 2},
+		{model.DimensionHour, "23", 2},
+		{model.DimensionHour, "0", 0},
+	}
+	for _, tt := range tests {
+		if got := rollupCount(t, db, daily, day, tt.dimension, tt.value); got != tt.want {
+			t.Errorf("daily %s %q = %d, want %d", tt.dimension, tt.value, got, tt.want)
+		}
+	}
+	if got := rollupCount(t, db, daily, day.Add(24*time.Hour), model.DimensionTotal, ""); got != 0 {
+		t.Errorf("unfinished day rolled up with %d visits", got)
+	}
+}
+
+func TestRollupAggregatorPurgeCutoff(t *testing.T) {
+	now := time.Date(2026, 5, 5, 12, 30, 0, 0, time.UTC)
+	visits := []time.Time{
+		time.Date(2026, 5, 1, 10, 0, 0, 0, time.UTC),
+		time.Date(2026, 5, 2, 10, 0, 0, 0, time.UTC),
+		time.Date(2026, 5, 3, 10, 0, 0, 0, time.UTC),
+		time.Date(2026, 5, 4, 6, 0, 0, 0, time.UTC),
+		time.Date(2026, 5, 4, 10, 0, 0, 0, time.UTC),
+		time.Date(2026, 5, 5, 10, 0, 0, 0, time.UTC),
+	}
+
+	tests := []struct {
+		name          string
+		retentionDays int
+		wantMark      time.Time
+		wantRemaining int64
+	}{
+		{"永久保留", 0, time.Time{}, 6},
+		// 保留期结束的时间截断到整点
+		{"保留期", 2, time.Date(2026, 5, 3, 12, 0, 0, 0, time.UTC), 3},
+		// 5 月 4 日的小时仍可能重新汇总，原始记录保留到重新汇总的窗口结束
+		{"重新汇总窗口", 1, time.Date(2026, 5, 4, 0, 0, 0, 0, time.UTC), 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a, repo, db := newTestAggregator(t, tt.retentionDays)
+			recordVisits(t, repo, "192.0.2.1", visits...)
+
+			runAggregator(t, a, now)
+			if got := watermark(t, repo, model.WatermarkPurge); !got.Equal(tt.wantMark) {
+				t.Errorf("purge watermark = %s, want %s", got, tt.wantMark)
+			}
+			var remaining int64
+			if err := db.Model(&model.VisitRecord{}).Count(&remaining).Error; err != nil {
+				t.Fatalf("count visits: %v", err)
+			}
+			if remaining != tt.wantRemaining {
+				t.Errorf("%d raw visits remain, want %d", remaining, tt.wantRemaining)
+			}
+		})
+	}
+}
+
+func TestRollupAggregatorRerollsLateVisits(t *testing.T) {
+	a, repo, db := newTestAggregator(t, 0)
+	day := time.Date(2026, 5, 1, 0, 0, 0, 0, time.UTC)
+	recordVisits(t, repo, "192.0.2.1", day.Add(10*time.Hour))
+
+	runAggregator(t, a, day.Add(25*time.Hour))
+	if got := watermark(t, repo, model.WatermarkDaily); !got.Equal(day.Add(24 * time.Hour)) {
+		t.Fatalf("daily watermark = %s, want the day rolled up", got)
+	}
+
+	// 数据库恢复后，队列补写了一条已汇总小时内的访问
+	late := day.Add(22*time.Hour + 30*time.Minute)
+	recordVisits(t, repo, "192.0.2.2", late)
+	runAggregator(t, a, day.Add(25*time.Hour+5*time.Minute))
+
+	if got := rollupCount(t, db, &model.HourlyVisitRollup{}, late.Truncate(time.Hour), model.DimensionTotal, ""); got != 1 {
+		t.Errorf("late hour total = %d, want 1", got)
+	}
+	daily := &model.DailyVisitRollup{}
+	if got := rollupCount(t, db, daily, day, model.DimensionTotal, ""); got != 2 {
+		t.Errorf("daily total = %d, want 2", got)
+	}
+	if got := rollupCount(t, db, daily, day, model.DimensionUnique, ""); got != 2 {
+		t.Errorf("daily unique = %d, want 2", got)
+	}
+	if got := rollupCount(t, db, daily, day, model.DimensionHour, "22"); got != 1 {
+		t.Errorf("daily hour 22 = %d, want 1", got)
+	}
+}
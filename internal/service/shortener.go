@@ -24,7 +24,7 @@ func NewShortenerService(repo *repository.URLRepository, baseURL string) *Shorte
 	}
 }
 
-func (s *ShortenerService) CreateShortURL(originalURL string, customCode string, expireInHours int) (*model.CreateURLResponse, error) {
+func (s *ShortenerService) CreateShortURL(workspaceID uint, originalURL string, customCode string, expireInHours int) (*model.CreateURLResponse, error) {
 	var shortCode string
 
 	// 如果提供了自定义短码，验证并使用它
@@ -62,7 +62,7 @@ func (s *ShortenerService) CreateShortURL(originalURL string, customCode string,
 	}
 
 	// 保存到数据库
-	err := s.repo.CreateWithExpiry(originalURL, shortCode, expiresAt)
+	err := s.repo.CreateWithExpiry(workspaceID, originalURL, shortCode, expiresAt)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create URL with expiry: %w", err)
 	}
@@ -103,8 +103,8 @@ func (s *ShortenerService) GetByShortCode(shortCode string) (*model.URL, error)
 	return url, nil
 }
 
-func (s *ShortenerService) GetStats(shortCode string) (*model.StatsResponse, error) {
-	url, err := s.repo.GetByShortCode(shortCode)
+func (s *ShortenerService) GetStats(workspaceID uint, shortCode string) (*model.StatsResponse, error) {
+	url, err := s.repo.GetByShortCodeInWorkspace(workspaceID, shortCode)
 	if err != nil {
 		return nil, err
 	}
@@ -141,6 +141,9 @@ func (s *ShortenerService) generateUniqueShortCode() (string, error) {
 			// 如果随机数生成失败，记录错误并继续尝试
 			continue
 		}
+		if utils.IsReservedShortCode(shortCode) {
+			continue
+		}
 
 		// 检查短码是否已存在
 		_, err = s.repo.GetByShortCode(shortCode)
@@ -171,15 +174,15 @@ func (s *ShortenerService) generateRandomString(length int) (string, error) {
 	return string(result), nil
 }
 
-func (s *ShortenerService) GetAllURLs() ([]*model.URL, error) {
-	return s.repo.GetAll()
+func (s *ShortenerService) GetAllURLs(workspaceID uint) ([]*model.URL, error) {
+	return s.repo.GetAll(workspaceID)
 }
 
-func (s *ShortenerService) DeleteShortCode(shortCode string) error {
-	return s.repo.DeleteByShortCode(shortCode)
+func (s *ShortenerService) DeleteShortCode(workspaceID uint, shortCode string) error {
+	return s.repo.DeleteByShortCode(workspaceID, shortCode)
 }
 
 // CleanupExpiredURLs 清理过期链接的方法
-func (s *ShortenerService) CleanupExpiredURLs() error {
-	return s.repo.DeleteExpiredURLs()
+func (s *ShortenerService) CleanupExpiredURLs(workspaceID uint) error {
+	return s.repo.DeleteExpiredURLs(workspaceID)
 }
\ No newline at end of file
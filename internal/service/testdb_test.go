@@ -0,0 +1,54 @@
+package service
+
+import (
+	"path/filepath"
+	"testing"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+
+	"url-shortener/internal/model"
+)
+
+// newTestDB 在临时目录中创建 SQLite 数据库并迁移所有表
+func newTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "test.db")), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+	if err != nil {
+		t.Fatalf("open database: %v", err)
+	}
+	err = db.AutoMigrate(
+		&model.URL{},
+		&model.APIKey{},
+		&model.VisitRecord{},
+		&model.HourlyVisitRollup{},
+		&model.DailyVisitRollup{},
+		&model.RollupWatermark{},
+		&model.Conversion{},
+		&model.Click{},
+		&model.ReportSubscription{},
+		&model.ReportDelivery{},
+		&model.APIKeyDenial{},
+		&model.APIKeyEndpointUsage{},
+		&model.APIKeyChange{},
+		&model.Workspace{},
+		&model.User{},
+		&model.WorkspaceMember{},
+	)
+	if err != nil {
+		t.Fatalf("migrate database: %v", err)
+	}
+
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatalf("get sql.DB: %v", err)
+	}
+	// SQLite 不支持并发写入，测试中只用一个连接
+	sqlDB.SetMaxOpenConns(1)
+	t.Cleanup(func() { sqlDB.Close() })
+	return db
+}
@@ -0,0 +1,156 @@
+package service
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"url-shortener/internal/config"
+	"url-shortener/internal/model"
+	"url-shortener/internal/utils"
+)
+
+// VisitBroker 进程内的访问事件发布/订阅
+// 访问记录写入后发布到所有匹配的订阅者，订阅者缓冲区满时丢弃事件而不阻塞发布方
+// 订阅数按工作区限制，整个进程的上限只作为兜底
+type VisitBroker struct {
+	mu             sync.RWMutex
+	subscribers    map[*VisitSubscription]struct{}
+	maxSubscribers int
+	bufferSize     int
+	heartbeat      time.Duration
+	closed         bool
+
+	perWorkspace    map[uint]int // 每个工作区当前的订阅数
+	maxPerWorkspace int
+}
+
+// VisitSubscription 单个订阅者
+type VisitSubscription struct {
+	broker      *VisitBroker
+	workspaceID uint
+	shortCode   string // 为空时接收工作区内所有短链接的访问
+	events      chan *model.VisitRecord
+	dropped     atomic.Int64
+	closeOnce   sync.Once
+}
+
+// NewVisitBroker 创建访问事件发布/订阅
+func NewVisitBroker(cfg *config.AnalyticsConfig) *VisitBroker {
+	return &VisitBroker{
+		subscribers:    make(map[*VisitSubscription]struct{}),
+		maxSubscribers: cfg.LiveMaxSubscribers,
+		bufferSize:     cfg.LiveBufferSize,
+		heartbeat:      cfg.LiveHeartbeat,
+
+		perWorkspace:    make(map[uint]int),
+		maxPerWorkspace: cfg.LiveMaxSubscribersPerWorkspace,
+	}
+}
+
+// Subscribe 订阅工作区内的访问事件，shortCode 为空时订阅工作区内所有短链接
+// 工作区的订阅数达到上限时返回 ErrRateLimitExceeded，整个进程达到上限时返回 ErrTooManySubscribers
+func (b *VisitBroker) Subscribe(workspaceID uint, shortCode string) (*VisitSubscription, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.closed {
+		return nil, utils.ErrServiceUnavailable
+	}
+	if b.perWorkspace[workspaceID] >= b.maxPerWorkspace {
+		return nil, fmt.Errorf("workspace %d already has %d live streams open: %w", workspaceID, b.maxPerWorkspace, utils.ErrRateLimitExceeded)
+	}
+	if len(b.subscribers) >= b.maxSubscribers {
+		return nil, utils.ErrTooManySubscribers
+	}
+
+	sub := &VisitSubscription{
+		broker:      b,
+		workspaceID: workspaceID,
+		shortCode:   shortCode,
+		events:      make(chan *model.VisitRecord, b.bufferSize),
+	}
+	b.subscribers[sub] = struct{}{}
+	b.perWorkspace[workspaceID]++
+	return sub, nil
+}
+
+// Publish 向匹配的订阅者发布工作区内短链接的访问事件，不会阻塞
+func (b *VisitBroker) Publish(workspaceID uint, visit *model.VisitRecord) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	for sub := range b.subscribers {
+		if sub.workspaceID != workspaceID {
+			continue
+		}
+		if sub.shortCode != "" && sub.shortCode != visit.ShortCode {
+			continue
+		}
+		select {
+		case sub.events <- visit:
+		default:
+			sub.dropped.Add(1)
+		}
+	}
+}
+
+// Close 关闭所有订阅，之后的订阅请求会被拒绝
+func (b *VisitBroker) Close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.closed = true
+	for sub := range b.subscribers {
+		b.remove(sub)
+	}
+}
+
+// SubscriberCount 当前订阅者数量
+func (b *VisitBroker) SubscriberCount() int {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return len(b.subscribers)
+}
+
+// Events 事件通道，订阅关闭后通道被关闭
+func (s *VisitSubscription) Events() <-chan *model.VisitRecord {
+	return s.events
+}
+
+// HeartbeatInterval 心跳间隔
+func (s *VisitSubscription) HeartbeatInterval() time.Duration {
+	return s.broker.heartbeat
+}
+
+// TakeDropped 返回自上次调用以来因缓冲区已满而丢弃的事件数
+func (s *VisitSubscription) TakeDropped() int64 {
+	return s.dropped.Swap(0)
+}
+
+// Close 取消订阅
+func (s *VisitSubscription) Close() {
+	s.broker.mu.Lock()
+	defer s.broker.mu.Unlock()
+
+	if _, ok := s.broker.subscribers[s]; ok {
+		s.broker.remove(s)
+	}
+}
+
+// remove 移除订阅并关闭事件通道，调用方需持有写锁
+func (b *VisitBroker) remove(sub *VisitSubscription) {
+	delete(b.subscribers, sub)
+	b.perWorkspace[sub.workspaceID]--
+	if b.perWorkspace[sub.workspaceID] <= 0 {
+		delete(b.perWorkspace, sub.workspaceID)
+	}
+	sub.closeEvents()
+}
+
+func (s *VisitSubscription) closeEvents() {
+	s.closeOnce.Do(func() {
+		close(s.events)
+	})
+}
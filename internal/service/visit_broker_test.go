@@ -0,0 +1,88 @@
+package service
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"url-shortener/internal/config"
+	"url-shortener/internal/model"
+	"url-shortener/internal/utils"
+)
+
+func newTestBroker(perWorkspace, total int) *VisitBroker {
+	return NewVisitBroker(&config.AnalyticsConfig{
+		LiveMaxSubscribers:             total,
+		LiveMaxSubscribersPerWorkspace: perWorkspace,
+		LiveBufferSize:                 4,
+		LiveHeartbeat:                  time.Second,
+	})
+}
+
+func TestVisitBrokerLimitsSubscribersPerWorkspace(t *testing.T) {
+	b := newTestBroker(2, 5)
+
+	first, err := b.Subscribe(1, "")
+	if err != nil {
+		t.Fatalf("Subscribe: %v", err)
+	}
+	if _, err := b.Subscribe(1, "abc"); err != nil {
+		t.Fatalf("Subscribe: %v", err)
+	}
+	if _, err := b.Subscribe(1, ""); !errors.Is(err, utils.ErrRateLimitExceeded) {
+		t.Fatalf("third subscription of workspace 1: error = %v, want ErrRateLimitExceeded", err)
+	}
+
+	// 其他工作区不受影响
+	for i := 0; i < 2; i++ {
+		if _, err := b.Subscribe(2, ""); err != nil {
+			t.Fatalf("workspace 2 subscription %d: %v", i+1, err)
+		}
+	}
+
+	// 取消订阅后释放名额
+	first.Close()
+	first.Close()
+	if _, err := b.Subscribe(1, ""); err != nil {
+		t.Fatalf("Subscribe after Close: %v", err)
+	}
+
+	// 进程上限作为兜底
+	if _, err := b.Subscribe(3, ""); err != nil {
+		t.Fatalf("workspace 3 subscription: %v", err)
+	}
+	if _, err := b.Subscribe(4, ""); !errors.Is(err, utils.ErrTooManySubscribers) {
+		t.Fatalf("subscription over the process limit: error = %v, want ErrTooManySubscribers", err)
+	}
+	if got := b.SubscriberCount(); got != 5 {
+		t.Errorf("SubscriberCount() = %d, want 5", got)
+	}
+
+	b.Close()
+	if _, err := b.Subscribe(5, ""); !errors.Is(err, utils.ErrServiceUnavailable) {
+		t.Errorf("Subscribe after Close: error = %v, want ErrServiceUnavailable", err)
+	}
+	if len(b.perWorkspace) != 0 {
+		t.Errorf("per-workspace counts left after Close: %v", b.perWorkspace)
+	}
+}
+
+func TestVisitBrokerPublishMatchesWorkspaceAndCode(t *testing.T) {
+	b := newTestBroker(5, 10)
+	all, _ := b.Subscribe(1, "")
+	one, _ := b.Subscribe(1, "abc")
+	other, _ := b.Subscribe(2, "")
+
+	b.Publish(1, &model.VisitRecord{ID: 1, ShortCode: "abc"})
+	b.Publish(1, &model.VisitRecord{ID: 2, ShortCode: "xyz"})
+
+	if got := len(all.Events()); got != 2 {
+		t.Errorf("workspace subscriber received %d events, want 2", got)
+	}
+	if got := len(one.Events()); got != 1 {
+		t.Errorf("short code subscriber received %d events, want 1", got)
+	}
+	if got := len(other.Events()); got != 0 {
+		t.Errorf("other workspace received %d events, want 0", got)
+	}
+}
@@ -0,0 +1,100 @@
+package service
+
+import (
+	"context"
+	"log"
+	"sync"
+
+	"url-shortener/internal/config"
+	"url-shortener/internal/metrics"
+	"url-shortener/internal/model"
+)
+
+// VisitQueue 有界的访问记录队列，由固定数量的后台协程写入数据库
+// 队列满时丢弃新的访问记录而不是阻塞跳转，流量突增时数据库连接数保持可控
+type VisitQueue struct {
+	analyticsSvc *AnalyticsService
+	jobs         chan visitJob
+	workers      int
+	wg           sync.WaitGroup
+	mu           sync.RWMutex // 保护 closed，避免向已关闭的通道发送
+	closed       bool
+}
+
+// visitJob 一次待记录的访问
+type visitJob struct {
+	link *model.URL
+	info *VisitInfo
+}
+
+// NewVisitQueue 创建访问记录队列
+func NewVisitQueue(analyticsSvc *AnalyticsService, cfg *config.AnalyticsConfig) *VisitQueue {
+	return &VisitQueue{
+		analyticsSvc: analyticsSvc,
+		jobs:         make(chan visitJob, cfg.VisitQueueSize),
+		workers:      cfg.VisitQueueWorkers,
+	}
+}
+
+// Start 启动后台写入协程
+func (q *VisitQueue) Start() {
+	for i := 0; i < q.workers; i++ {
+		q.wg.Add(1)
+		go q.run()
+	}
+}
+
+// Enqueue 提交一次访问，队列已满或已关闭时丢弃并返回 false
+func (q *VisitQueue) Enqueue(link *model.URL, info *VisitInfo) bool {
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+
+	if q.closed {
+		metrics.VisitQueueDropped.Inc()
+		return false
+	}
+
+	select {
+	case q.jobs <- visitJob{link: link, info: info}:
+		return true
+	default:
+		metrics.VisitQueueDropped.Inc()
+		return false
+	}
+}
+
+// Len 当前排队的访问数
+func (q *VisitQueue) Len() int {
+	return len(q.jobs)
+}
+
+// Cap 队列容量
+func (q *VisitQueue) Cap() int {
+	return cap(q.jobs)
+}
+
+// Close 停止接收新的访问，写完已排队的记录后返回
+func (q *VisitQueue) Close() {
+	q.mu.Lock()
+	if q.closed {
+		q.mu.Unlock()
+		return
+	}
+	q.closed = true
+	close(q.jobs)
+	q.mu.Unlock()
+
+	q.wg.Wait()
+}
+
+// run 写入协程主循环
+func (q *VisitQueue) run() {
+	defer q.wg.Done()
+
+	for job := range q.jobs {
+		// 请求上下文在跳转响应后即被取消，这里使用独立的上下文
+		if _, err := q.analyticsSvc.RecordVisit(context.Background(), job.link, job.info); err != nil {
+			log.Printf("Failed to record visit for %s: %v", job.link.ShortCode, err)
+		}
+	}
+}
@@ -0,0 +1,113 @@
+package service
+
+import (
+	"fmt"
+
+	"url-shortener/internal/model"
+	"url-shortener/internal/repository"
+	"url-shortener/internal/utils"
+)
+
+// WorkspaceService 工作区及成员管理
+// 路由上的权限范围由中间件检查，这里只处理与角色相关的规则
+type WorkspaceService struct {
+	repo  *repository.WorkspaceRepository
+	authz *AuthorizationService
+}
+
+// NewWorkspaceService 创建工作区服务
+func NewWorkspaceService(repo *repository.WorkspaceRepository, authz *AuthorizationService) *WorkspaceService {
+	return &WorkspaceService{repo: repo, authz: authz}
+}
+
+// CreateWorkspace 创建工作区，调用方代表的用户成为所有者
+// 工作区服务 Key 不代表任何用户，不能创建工作区
+func (s *WorkspaceService) CreateWorkspace(p *Principal, req *model.CreateWorkspaceRequest) (*model.Workspace, error) {
+	if p.UserID == nil {
+		return nil, fmt.Errorf("only keys that belong to a user can create workspaces: %w", utils.ErrForbidden)
+	}
+	workspace := &model.Workspace{Name: req.Name}
+	if err := s.repo.Create(workspace, p.UserID); err != nil {
+		return nil, fmt.Errorf("failed to create workspace: %w", err)
+	}
+	return workspace, nil
+}
+
+// GetWorkspace 获取调用方所在的工作区
+func (s *WorkspaceService) GetWorkspace(p *Principal) (*model.Workspace, error) {
+	return s.repo.GetByID(p.WorkspaceID)
+}
+
+// ListWorkspaces 列出调用方可以访问的工作区；服务 Key 只能访问自己的工作区
+func (s *WorkspaceService) ListWorkspaces(p *Principal) ([]model.WorkspaceMembership, error) {
+	if p.UserID != nil {
+		return s.repo.ListForUser(*p.UserID)
+	}
+	workspace, err := s.repo.GetByID(p.WorkspaceID)
+	if err != nil {
+		return nil, err
+	}
+	return []model.WorkspaceMembership{{Workspace: *workspace}}, nil
+}
+
+// ListMembers 列出调用方所在工作区的成员
+func (s *WorkspaceService) ListMembers(p *Principal) ([]model.Member, error) {
+	return s.repo.ListMembers(p.WorkspaceID)
+}
+
+// AddMember 将邮箱对应的用户加入调用方所在的工作区，用户不存在时创建
+func (s *WorkspaceService) AddMember(p *Principal, req *model.AddMemberRequest) (*model.Member, error) {
+	if req.Role == model.RoleOwner && !s.authz.CanManageOwners(p) {
+		return nil, fmt.Errorf("only owners can add owners: %w", utils.ErrForbidden)
+	}
+
+	user, err := s.repo.FindOrCreateUser(req.Email, req.Name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create user: %w", err)
+	}
+	member := &model.WorkspaceMember{WorkspaceID: p.WorkspaceID, UserID: user.ID, Role: req.Role}
+	if err := s.repo.AddMember(member); err != nil {
+		return nil, err
+	}
+	return &model.Member{
+		UserID:    user.ID,
+		Email:     user.Email,
+		Name:      user.Name,
+		Role:      member.Role,
+		CreatedAt: member.CreatedAt,
+	}, nil
+}
+
+// UpdateMember 修改成员角色；涉及所有者角色的修改只有所有者可以进行
+func (s *WorkspaceService) UpdateMember(p *Principal, userID uint, req *model.UpdateMemberRequest) error {
+	if err := s.checkOwnerChange(p, userID, req.Role); err != nil {
+		return err
+	}
+	return s.repo.UpdateRole(p.WorkspaceID, userID, req.Role)
+}
+
+// RemoveMember 将成员移出工作区；移除所有者只有所有者可以进行
+func (s *WorkspaceService) RemoveMember(p *Principal, userID uint) error {
+	if err := s.checkOwnerChange(p, userID, ""); err != nil {
+		return err
+	}
+	return s.repo.RemoveMember(p.WorkspaceID, userID)
+}
+
+// checkOwnerChange 授予或取消所有者角色需要所有者权限
+func (s *WorkspaceService) checkOwnerChange(p *Principal, userID uint, role string) error {
+	if s.authz.CanManageOwners(p) {
+		return nil
+	}
+	if role == model.RoleOwner {
+		return fmt.Errorf("only owners can grant the owner role: %w", utils.ErrForbidden)
+	}
+	current, err := s.repo.Role(p.WorkspaceID, userID)
+	if err != nil {
+		return err
+	}
+	if current == model.RoleOwner {
+		return fmt.Errorf("only owners can change or remove an owner: %w", utils.ErrForbidden)
+	}
+	return nil
+}
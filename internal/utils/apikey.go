@@ -0,0 +1,24 @@
+package utils
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+)
+
+// APIKeyPrefixLength 可见前缀的长度："sk_" 加 8 位十六进制字符
+const APIKeyPrefixLength = 11
+
+// HashAPIKey 计算 API Key 的 SHA-256 十六进制摘要，数据库只保存摘要
+// Key 本身是 256 位随机数，无需加盐或慢哈希
+func HashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// APIKeyPrefix 返回 API Key 的可见前缀，用于在列表和日志中识别 Key
+func APIKeyPrefix(key string) string {
+	if len(key) <= APIKeyPrefixLength {
+		return key
+	}
+	return key[:APIKeyPrefixLength]
+}
@@ -0,0 +1,175 @@
+package utils
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ClientIPKey 解析后的客户端 IP 在 gin.Context 中的键
+const ClientIPKey = "client_ip"
+
+// ClientIPResolver 根据受信任代理列表解析客户端 IP
+// 只有直接连接方属于受信任代理时才读取转发头，且只读取代理实际设置的那一个，
+// 其他转发头可能由客户端伪造
+type ClientIPResolver struct {
+	trusted   []*net.IPNet
+	forwarded bool // 读取 Forwarded（RFC 7239），否则读取 X-Forwarded-For
+}
+
+// NewClientIPResolver 创建客户端 IP 解析器，cidrs 支持 CIDR 和单个 IP
+// header 为受信任代理设置的转发头：X-Forwarded-For 或 Forwarded
+func NewClientIPResolver(cidrs []string, header string) (*ClientIPResolver, error) {
+	var forwarded bool
+	switch {
+	case strings.EqualFold(header, "X-Forwarded-For"):
+	case strings.EqualFold(header, "Forwarded"):
+		forwarded = true
+	default:
+		return nil, fmt.Errorf("unsupported forwarding header %q", header)
+	}
+
+	trusted := make([]*net.IPNet, 0, len(cidrs))
+	for _, cidr := range cidrs {
+		network, err := ParseNetwork(cidr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy: %w", err)
+		}
+		trusted = append(trusted, network)
+	}
+	return &ClientIPResolver{trusted: trusted, forwarded: forwarded}, nil
+}
+
+// ParseNetwork 解析 CIDR 或单个 IP（视为 /32 或 /128）
+func ParseNetwork(cidr string) (*net.IPNet, error) {
+	cidr = strings.TrimSpace(cidr)
+	if !strings.Contains(cidr, "/") {
+		ip := net.ParseIP(cidr)
+		if ip == nil {
+			return nil, fmt.Errorf("%q is not an IP address or CIDR range", cidr)
+		}
+		bits := 128
+		if ip.To4() != nil {
+			bits = 32
+		}
+		cidr = fmt.Sprintf("%s/%d", cidr, bits)
+	}
+
+	_, network, err := net.ParseCIDR(cidr)
+	if err != nil {
+		return nil, fmt.Errorf("%q is not an IP address or CIDR range", cidr)
+	}
+	return network, nil
+}
+
+// IPInNetworks 检查 ip 是否属于 cidrs 中的任一网段，无法解析的 IP 或网段视为不匹配
+func IPInNetworks(ip string, cidrs []string) bool {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return false
+	}
+	for _, cidr := range cidrs {
+		network, err := ParseNetwork(cidr)
+		if err == nil && network.Contains(parsed) {
+			return true
+		}
+	}
+	return false
+}
+
+// Resolve 返回请求的客户端 IP
+// 从配置的转发头中从右向左跳过受信任代理，第一个不受信任的地址即为客户端；
+// 链中出现无法解析的地址时停在其右侧的一跳
+func (r *ClientIPResolver) Resolve(req *http.Request) string {
+	remote := parseHostIP(req.RemoteAddr)
+	if remote == nil {
+		return req.RemoteAddr
+	}
+	if !r.isTrusted(remote) {
+		return remote.String()
+	}
+
+	var chain []string
+	if r.forwarded {
+		chain = forwardedFor(req.Header)
+	} else {
+		chain = splitHeaderList(req.Header.Values("X-Forwarded-For"))
+	}
+
+	client := remote
+	for i := len(chain) - 1; i >= 0; i-- {
+		ip := parseHostIP(chain[i])
+		if ip == nil {
+			break
+		}
+		client = ip
+		if !r.isTrusted(ip) {
+			break
+		}
+	}
+	return client.String()
+}
+
+// isTrusted 检查地址是否属于受信任代理
+func (r *ClientIPResolver) isTrusted(ip net.IP) bool {
+	for _, network := range r.trusted {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// ClientIP 返回中间件解析后的客户端 IP，未经过中间件时使用直接连接方地址
+func ClientIP(c *gin.Context) string {
+	if ip := c.GetString(ClientIPKey); ip != "" {
+		return ip
+	}
+	if ip := parseHostIP(c.Request.RemoteAddr); ip != nil {
+		return ip.String()
+	}
+	return c.Request.RemoteAddr
+}
+
+// forwardedFor 按顺序提取 Forwarded 头中各节点的 for 参数
+func forwardedFor(header http.Header) []string {
+	var chain []string
+	for _, element := range splitHeaderList(header.Values("Forwarded")) {
+		for _, pair := range strings.Split(element, ";") {
+			key, value, ok := strings.Cut(strings.TrimSpace(pair), "=")
+			if ok && strings.EqualFold(key, "for") {
+				chain = append(chain, strings.Trim(value, `"`))
+			}
+		}
+	}
+	return chain
+}
+
+// splitHeaderList 拆分逗号分隔的头部值，支持多个同名头部
+func splitHeaderList(values []string) []string {
+	var items []string
+	for _, value := range values {
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+	}
+	return items
+}
+
+// parseHostIP 解析 "ip"、"ip:port"、"[ipv6]" 和 "[ipv6]:port" 形式的地址
+// "unknown" 和混淆标识（如 "_hidden"）返回 nil
+func parseHostIP(addr string) net.IP {
+	addr = strings.TrimSpace(addr)
+	if ip := net.ParseIP(addr); ip != nil {
+		return ip
+	}
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		return net.ParseIP(host)
+	}
+	return net.ParseIP(strings.TrimSuffix(strings.TrimPrefix(addr, "["), "]"))
+}
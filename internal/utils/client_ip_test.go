@@ -0,0 +1,156 @@
+package utils
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestClientIPResolverResolve(t *testing.T) {
+	trusted := []string{"10.0.0.0/8", "192.168.1.1"}
+
+	tests := []struct {
+		name      string
+		header    string // 受信任代理设置的转发头
+		remote    string
+		xff       []string
+		forwarded []string
+		want      string
+	}{
+		{
+			name:   "不受信任的直接连接方伪造 X-Forwarded-For",
+			header: "X-Forwarded-For",
+			remote: "203.0.113.9:51234",
+			xff:    []string{"198.51.100.7"},
+			want:   "203.0.113.9",
+		},
+		{
+			name:   "不受信任的 IPv6 直接连接方",
+			header: "X-Forwarded-For",
+			remote: "[2001:db8::1]:443",
+			xff:    []string{"198.51.100.7"},
+			want:   "2001:db8::1",
+		},
+		{
+			name:   "受信任代理未设置转发头",
+			header: "X-Forwarded-For",
+			remote: "10.0.0.1:80",
+			want:   "10.0.0.1",
+		},
+		{
+			name:   "从右向左跳过多个受信任代理",
+			header: "X-Forwarded-For",
+			remote: "10.0.0.1:80",
+			xff:    []string{"198.51.100.7, 203.0.113.5, 192.168.1.1, 10.0.0.2"},
+			want:   "203.0.113.5",
+		},
+		{
+			name:   "多个同名头部按顺序拼接",
+			header: "X-Forwarded-For",
+			remote: "10.0.0.1:80",
+			xff:    []string{"198.51.100.7", "10.0.0.2"},
+			want:   "198.51.100.7",
+		},
+		{
+			name:   "整条链都是受信任代理",
+			header: "X-Forwarded-For",
+			remote: "10.0.0.1:80",
+			xff:    []string{"10.0.0.3, 192.168.1.1"},
+			want:   "10.0.0.3",
+		},
+		{
+			name:   "无法解析的地址停在其右侧的一跳",
+			header: "X-Forwarded-For",
+			remote: "10.0.0.1:80",
+			xff:    []string{"198.51.100.7, not-an-ip, 10.0.0.2"},
+			want:   "10.0.0.2",
+		},
+		{
+			name:   "紧邻的地址无法解析时使用直接连接方",
+			header: "X-Forwarded-For",
+			remote: "10.0.0.1:80",
+			xff:    []string{"198.51.100.7, 999.1.1.1"},
+			want:   "10.0.0.1",
+		},
+		{
+			name:      "只读取 X-Forwarded-For",
+			header:    "X-Forwarded-For",
+			remote:    "10.0.0.1:80",
+			forwarded: []string{"for=198.51.100.7"},
+			want:      "10.0.0.1",
+		},
+		{
+			name:      "Forwarded 中带引号和端口的 IPv6 地址",
+			header:    "Forwarded",
+			remote:    "10.0.0.1:80",
+			forwarded: []string{`for="[2001:db8:cafe::17]:4711";proto=https`},
+			want:      "2001:db8:cafe::17",
+		},
+		{
+			name:      "Forwarded 多个节点和其他参数",
+			header:    "Forwarded",
+			remote:    "10.0.0.1:80",
+			forwarded: []string{"for=198.51.100.7;proto=https;by=10.0.0.2, For=10.0.0.2"},
+			want:      "198.51.100.7",
+		},
+		{
+			name:      "Forwarded 混淆标识",
+			header:    "Forwarded",
+			remote:    "10.0.0.1:80",
+			forwarded: []string{"for=_hidden, for=10.0.0.2"},
+			want:      "10.0.0.2",
+		},
+		{
+			name:      "Forwarded 未知地址",
+			header:    "Forwarded",
+			remote:    "10.0.0.1:80",
+			forwarded: []string{"for=unknown"},
+			want:      "10.0.0.1",
+		},
+		{
+			name:   "只读取 Forwarded",
+			header: "Forwarded",
+			remote: "10.0.0.1:80",
+			xff:    []string{"198.51.100.7"},
+			want:   "10.0.0.1",
+		},
+		{
+			name:      "不受信任的直接连接方伪造 Forwarded",
+			header:    "Forwarded",
+			remote:    "203.0.113.9:51234",
+			forwarded: []string{"for=198.51.100.7"},
+			want:      "203.0.113.9",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resolver, err := NewClientIPResolver(trusted, tt.header)
+			if err != nil {
+				t.Fatalf("NewClientIPResolver: %v", err)
+			}
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.RemoteAddr = tt.remote
+			for _, v := range tt.xff {
+				req.Header.Add("X-Forwarded-For", v)
+			}
+			for _, v := range tt.forwarded {
+				req.Header.Add("Forwarded", v)
+			}
+			if got := resolver.Resolve(req); got != tt.want {
+				t.Errorf("Resolve() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewClientIPResolverErrors(t *testing.T) {
+	if _, err := NewClientIPResolver(nil, "X-Real-IP"); err == nil {
+		t.Error("unsupported header accepted")
+	}
+	if _, err := NewClientIPResolver([]string{"10.0.0.0/33"}, "X-Forwarded-For"); err == nil {
+		t.Error("invalid trusted proxy accepted")
+	}
+	if _, err := NewClientIPResolver([]string{" 10.0.0.1 ", "2001:db8::/32"}, "forwarded"); err != nil {
+		t.Errorf("NewClientIPResolver: %v", err)
+	}
+}
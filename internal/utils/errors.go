@@ -53,18 +53,31 @@ func IsAppError(err error, code string) bool {
 
 // 预定义错误
 var (
-	ErrNotFound          = NewAppError("NOT_FOUND", "resource not found")
-	ErrInvalidInput      = NewAppError("INVALID_INPUT", "invalid input provided")
-	ErrUnauthorized      = NewAppError("UNAUTHORIZED", "unauthorized access")
-	ErrForbidden         = NewAppError("FORBIDDEN", "forbidden access")
-	ErrInternal          = NewAppError("INTERNAL_ERROR", "internal server error")
-	ErrRateLimitExceeded = NewAppError("RATE_LIMIT_EXCEEDED", "rate limit exceeded")
-	ErrDatabaseError     = NewAppError("DATABASE_ERROR", "database error occurred")
-	ErrAlreadyExists     = NewAppError("ALREADY_EXISTS", "resource already exists")
-	ErrExpired           = NewAppError("EXPIRED", "resource has expired")
-	ErrURLNotFound       = NewAppError("URL_NOT_FOUND", "short URL not found")
-	ErrURLExpired        = NewAppError("URL_EXPIRED", "short URL has expired")
-	ErrInvalidCustomCode = NewAppError("INVALID_CUSTOM_CODE", "invalid custom code format")
-	ErrCustomCodeExists  = NewAppError("CUSTOM_CODE_EXISTS", "custom code already exists")
-	ErrGenerateShortCode = NewAppError("GENERATE_SHORT_CODE_FAILED", "failed to generate unique short code after multiple attempts")
-)
\ No newline at end of file
+	ErrNotFound           = NewAppError("NOT_FOUND", "resource not found")
+	ErrInvalidInput       = NewAppError("INVALID_INPUT", "invalid input provided")
+	ErrUnauthorized       = NewAppError("UNAUTHORIZED", "unauthorized access")
+	ErrForbidden          = NewAppError("FORBIDDEN", "forbidden access")
+	ErrInternal           = NewAppError("INTERNAL_ERROR", "internal server error")
+	ErrRateLimitExceeded  = NewAppError("RATE_LIMIT_EXCEEDED", "rate limit exceeded")
+	ErrDatabaseError      = NewAppError("DATABASE_ERROR", "database error occurred")
+	ErrAlreadyExists      = NewAppError("ALREADY_EXISTS", "resource already exists")
+	ErrExpired            = NewAppError("EXPIRED", "resource has expired")
+	ErrURLNotFound        = NewAppError("URL_NOT_FOUND", "short URL not found")
+	ErrURLExpired         = NewAppError("URL_EXPIRED", "short URL has expired")
+	ErrInvalidCustomCode  = NewAppError("INVALID_CUSTOM_CODE", "invalid custom code format")
+	ErrCustomCodeExists   = NewAppError("CUSTOM_CODE_EXISTS", "custom code already exists")
+	ErrGenerateShortCode  = NewAppError("GENERATE_SHORT_CODE_FAILED", "failed to generate unique short code after multiple attempts")
+	ErrServiceUnavailable = NewAppError("SERVICE_UNAVAILABLE", "service is shutting down")
+	ErrTooManySubscribers = NewAppError("TOO_MANY_SUBSCRIBERS", "too many live stream subscribers")
+	ErrClickNotFound      = NewAppError("CLICK_NOT_FOUND", "click ID not found")
+	ErrReportNotFound     = NewAppError("REPORT_NOT_FOUND", "report subscription not found")
+	ErrAPIKeyNotFound     = NewAppError("API_KEY_NOT_FOUND", "API key not found")
+	ErrAmbiguousKeyPrefix = NewAppError("AMBIGUOUS_KEY_PREFIX", "key prefix matches more than one API key")
+	ErrAPIKeyInactive     = NewAppError("API_KEY_INACTIVE", "API key is revoked or expired")
+	ErrAPIKeyRotated      = NewAppError("API_KEY_ROTATED", "API key has already been rotated")
+	ErrQuotaExceeded      = NewAppError("QUOTA_EXCEEDED", "monthly quota exceeded")
+	ErrIPNotAllowed       = NewAppError("IP_NOT_ALLOWED", "client IP is not in the API key allowlist")
+	ErrWorkspaceNotFound  = NewAppError("WORKSPACE_NOT_FOUND", "workspace not found")
+	ErrMemberNotFound     = NewAppError("MEMBER_NOT_FOUND", "workspace member not found")
+	ErrLastOwner          = NewAppError("LAST_OWNER", "a workspace must keep at least one owner")
+)
@@ -0,0 +1,71 @@
+package utils
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net"
+	"strings"
+	"time"
+)
+
+// IP 地址匿名化模式
+const (
+	IPModeKeep     = "keep"     // 保留完整 IP
+	IPModeTruncate = "truncate" // IPv4 截断为 /24，IPv6 截断为 /48
+	IPModeHash     = "hash"     // 使用每日轮换的盐值做带密钥的哈希
+)
+
+// hashedIPLength 哈希后保留的十六进制字符数
+const hashedIPLength = 32
+
+// IPAnonymizer 按配置的模式对访客 IP 做匿名化处理
+type IPAnonymizer struct {
+	mode string
+	key  []byte
+}
+
+// NewIPAnonymizer 创建 IP 匿名化处理器，key 仅在 hash 模式下使用
+func NewIPAnonymizer(mode, key string) *IPAnonymizer {
+	return &IPAnonymizer{mode: mode, key: []byte(key)}
+}
+
+// Anonymize 返回用于存储的 IP 值，at 决定 hash 模式下使用哪一天的盐值
+// 同一 IP 在同一 UTC 自然日内得到相同的哈希值，可用于统计独立访客，跨天无法关联
+func (a *IPAnonymizer) Anonymize(ip string, at time.Time) string {
+	ip = strings.TrimSpace(ip)
+	if ip == "" {
+		return ""
+	}
+
+	switch a.mode {
+	case IPModeTruncate:
+		return TruncateIP(ip)
+	case IPModeHash:
+		return a.hash(ip, at)
+	}
+	return ip
+}
+
+// hash 计算 HMAC-SHA256(dailySalt, ip)，每日盐值由密钥和日期派生，无需持久化
+func (a *IPAnonymizer) hash(ip string, at time.Time) string {
+	saltMac := hmac.New(sha256.New, a.key)
+	saltMac.Write([]byte(at.UTC().Format("2006-01-02")))
+	salt := saltMac.Sum(nil)
+
+	mac := hmac.New(sha256.New, salt)
+	mac.Write([]byte(ip))
+	return hex.EncodeToString(mac.Sum(nil))[:hashedIPLength]
+}
+
+// TruncateIP 将 IPv4 地址截断为 /24、IPv6 地址截断为 /48，无法解析的地址返回空字符串
+func TruncateIP(ip string) string {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return ""
+	}
+	if v4 := parsed.To4(); v4 != nil {
+		return v4.Mask(net.CIDRMask(24, 32)).String()
+	}
+	return parsed.Mask(net.CIDRMask(48, 128)).String()
+}
@@ -0,0 +1,163 @@
+package utils
+
+import (
+	"net"
+	"net/url"
+	"strings"
+)
+
+// 流量来源分类
+const (
+	TrafficSourceDirect = "direct"
+	TrafficSourceSearch = "search"
+	TrafficSourceSocial = "social"
+	TrafficSourceEmail  = "email"
+	TrafficSourceOther  = "other"
+)
+
+// 内置的已知域名列表，以 ".*" 结尾的条目匹配任意顶级域（如 google.* 匹配 google.co.uk）
+var (
+	defaultSearchDomains = []string{
+		"google.*", "bing.com", "yahoo.*", "baidu.com", "yandex.*", "duckduckgo.com",
+		"sogou.com", "so.com", "sm.cn", "naver.com", "ecosia.org", "ask.com",
+		"search.brave.com", "startpage.com", "seznam.cz", "qwant.com",
+	}
+	defaultSocialDomains = []string{
+		"facebook.com", "fb.com", "fb.me", "instagram.com", "twitter.com", "x.com", "t.co",
+		"linkedin.com", "lnkd.in", "reddit.com", "pinterest.*", "tiktok.com", "youtube.com",
+		"youtu.be", "weibo.com", "weibo.cn", "weixin.qq.com", "zhihu.com", "douyin.com",
+		"xiaohongshu.com", "bilibili.com", "vk.com", "tumblr.com", "threads.net",
+		"telegram.org", "t.me", "whatsapp.com", "discord.com", "mastodon.social",
+		"news.ycombinator.com", "quora.com",
+	}
+	defaultEmailDomains = []string{
+		"mail.google.com", "outlook.live.com", "outlook.office.com", "outlook.office365.com",
+		"mail.yahoo.com", "mail.qq.com", "exmail.qq.com", "mail.163.com", "mail.126.com",
+		"mail.aol.com", "mail.proton.me", "mail.zoho.com", "webmail",
+	}
+)
+
+// ReferrerClassifier 根据来源域名判断流量来源
+type ReferrerClassifier struct {
+	email  []string
+	search []string
+	social []string
+}
+
+// NewReferrerClassifier 创建分类器，extra* 中的域名追加到内置列表
+func NewReferrerClassifier(extraSearch, extraSocial, extraEmail []string) *ReferrerClassifier {
+	return &ReferrerClassifier{
+		email:  mergeDomains(defaultEmailDomains, extraEmail),
+		search: mergeDomains(defaultSearchDomains, extraSearch),
+		social: mergeDomains(defaultSocialDomains, extraSocial),
+	}
+}
+
+// Classify 返回规范化的来源域名和流量来源
+// utm_medium 为 email 的访问归为邮件流量，无来源时为直接访问
+func (rc *ReferrerClassifier) Classify(referer, utmMedium string) (host, source string) {
+	host = NormalizeReferrerHost(referer)
+
+	switch {
+	case strings.EqualFold(utmMedium, "email"):
+		return host, TrafficSourceEmail
+	case host == "":
+		return host, TrafficSourceDirect
+	case matchAnyDomain(host, rc.email):
+		return host, TrafficSourceEmail
+	case matchAnyDomain(host, rc.search):
+		return host, TrafficSourceSearch
+	case matchAnyDomain(host, rc.social):
+		return host, TrafficSourceSocial
+	}
+	return host, TrafficSourceOther
+}
+
+// NormalizeReferrerHost 提取来源地址的主机名：转为小写，去掉端口和 www./m. 前缀
+func NormalizeReferrerHost(referer string) string {
+	referer = strings.TrimSpace(referer)
+	if referer == "" {
+		return ""
+	}
+
+	parsed, err := url.Parse(referer)
+	if err != nil || parsed.Host == "" {
+		// 兼容缺少协议的来源，如 "example.com/page"
+		parsed, err = url.Parse("http://" + referer)
+		if err != nil {
+			return ""
+		}
+	}
+
+	host := strings.ToLower(parsed.Host)
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	host = strings.TrimSuffix(host, ".")
+	for _, prefix := range []string{"www.", "m.", "mobile."} {
+		if strings.HasPrefix(host, prefix) && strings.Count(host, ".") > 1 {
+			host = strings.TrimPrefix(host, prefix)
+			break
+		}
+	}
+
+	if len(host) > 255 {
+		return host[:255]
+	}
+	return host
+}
+
+// matchAnyDomain 检查主机名是否属于列表中的任一域名（含子域名）
+func matchAnyDomain(host string, domains []string) bool {
+	for _, domain := range domains {
+		if matchDomain(host, domain) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchDomain 匹配单个域名
+// "example.com" 匹配 example.com 及其子域名；"example.*" 匹配任意顶级域；
+// 不含点的条目（如 webmail）匹配任一级标签
+func matchDomain(host, domain string) bool {
+	if !strings.Contains(domain, ".") {
+		for _, label := range strings.Split(host, ".") {
+			if label == domain {
+				return true
+			}
+		}
+		return false
+	}
+
+	if brand, ok := strings.CutSuffix(domain, ".*"); ok {
+		labels := strings.Split(host, ".")
+		brandLabels := strings.Split(brand, ".")
+		// 品牌标签之后允许一到两级顶级域（com、co.uk）
+		for i := 0; i+len(brandLabels) < len(labels); i++ {
+			rest := len(labels) - i - len(brandLabels)
+			if rest > 2 {
+				continue
+			}
+			if strings.Join(labels[i:i+len(brandLabels)], ".") == brand {
+				return true
+			}
+		}
+		return false
+	}
+
+	return host == domain || strings.HasSuffix(host, "."+domain)
+}
+
+// mergeDomains 合并内置与自定义域名列表
+func mergeDomains(base, extra []string) []string {
+	merged := make([]string, 0, len(base)+len(extra))
+	merged = append(merged, base...)
+	for _, domain := range extra {
+		domain = strings.ToLower(strings.TrimSpace(domain))
+		if domain != "" {
+			merged = append(merged, domain)
+		}
+	}
+	return merged
+}
@@ -13,6 +13,7 @@ type Response struct {
 	Data    interface{} `json:"data,omitempty"`
 	Message string      `json:"message,omitempty"`
 	Error   string      `json:"error,omitempty"`
+	ErrorCode string    `json:"error_code,omitempty"` // 对应 AppError.Code，便于客户端区分错误类型
 	Success bool        `json:"success"`
 	Timestamp int64     `json:"timestamp"`
 }
@@ -48,6 +49,17 @@ func ErrorResponse(c *gin.Context, code int, message string) {
 	})
 }
 
+// ErrorResponseWithCode 带错误码的错误响应，errorCode 取自预定义的 AppError
+func ErrorResponseWithCode(c *gin.Context, code int, errorCode, message string) {
+	c.JSON(code, Response{
+		Code:      code,
+		Error:     message,
+		ErrorCode: errorCode,
+		Success:   false,
+		Timestamp: time.Now().Unix(),
+	})
+}
+
 // ErrorResponseWithData 带数据的错误响应
 func ErrorResponseWithData(c *gin.Context, code int, message string, data interface{}) {
 	c.JSON(code, Response{
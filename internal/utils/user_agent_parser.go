@@ -1,263 +1,175 @@
 package utils
 
 import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"os"
 	"regexp"
 	"strings"
 )
 
+// defaultUserAgentRules 内置的 User-Agent 识别规则
+//
+//go:embed user_agent_rules.json
+var defaultUserAgentRules []byte
+
+// defaultUserAgentParser 使用内置规则的解析器
+var defaultUserAgentParser = mustNewUserAgentParser(defaultUserAgentRules)
+
 // UserAgentInfo 用户代理信息结构
 type UserAgentInfo struct {
-	Browser   string `json:"browser"`
-	Version   string `json:"version"`
-	OS        string `json:"os"`
-	OSVersion string `json:"os_version"`
-	Device    string `json:"device"`
+	Browser    string `json:"browser"`
+	Version    string `json:"version"`
+	OS         string `json:"os"`
+	OSVersion  string `json:"os_version"`
+	Device     string `json:"device"`
 	DeviceType string `json:"device_type"`
 }
 
-// ParseUserAgent 解析用户代理字符串
-func ParseUserAgent(userAgent string) *UserAgentInfo {
-	if userAgent == "" {
-		return &UserAgentInfo{
-			Browser:    "Unknown",
-			OS:         "Unknown",
-			DeviceType: "Desktop",
-		}
-	}
-
-	info := &UserAgentInfo{
-		Browser:  "Unknown",
-		OS:       "Unknown",
-		Device:   "Unknown",
-		DeviceType: "Desktop", // 默认为桌面端
-	}
-
-	// 解析浏览器和版本
-	info.Browser, info.Version = parseBrowser(userAgent)
+// UserAgentRule 单条识别规则，按顺序匹配，第一条命中的规则生效
+// name 和 version 是模板，可以用 $1 引用 pattern 的捕获组
+type UserAgentRule struct {
+	Name    string   `json:"name"`
+	Pattern string   `json:"pattern"`
+	Version string   `json:"version,omitempty"`
+	Ignore  []string `json:"ignore,omitempty"` // 展开后的名称属于这些值时视为未命中，继续匹配下一条
 
-	// 解析操作系统和版本
-	info.OS, info.OSVersion = parseOS(userAgent)
-
-	// 解析设备类型
-	info.DeviceType = parseDeviceType(userAgent)
+	re *regexp.Regexp
+}
 
-	// 设备品牌/型号（简化版）
-	info.Device = parseDeviceBrand(userAgent)
+// UserAgentRules 识别规则集
+type UserAgentRules struct {
+	Browsers    []*UserAgentRule `json:"browsers"`
+	OS          []*UserAgentRule `json:"os"`
+	Devices     []*UserAgentRule `json:"devices"`      // 设备型号
+	DeviceTypes []*UserAgentRule `json:"device_types"` // 设备类型，均未命中时为 Desktop
+}
 
-	return info
+// UserAgentParser 基于规则集的 User-Agent 解析器
+type UserAgentParser struct {
+	rules *UserAgentRules
 }
 
-// parseBrowser 解析浏览器信息
-func parseBrowser(userAgent string) (string, string) {
-	// Chrome
-	if strings.Contains(userAgent, "Chrome/") {
-		parts := strings.Split(userAgent, "Chrome/")
-		if len(parts) > 1 {
-			version := strings.Split(parts[1], " ")[0]
-			return "Chrome", strings.Split(version, ".")[0] // 只返回主版本号
+// NewUserAgentParser 从 JSON 格式的规则集创建解析器
+func NewUserAgentParser(data []byte) (*UserAgentParser, error) {
+	var rules UserAgentRules
+	if err := json.Unmarshal(data, &rules); err != nil {
+		return nil, fmt.Errorf("invalid user agent rules: %w", err)
+	}
+
+	for group, list := range map[string][]*UserAgentRule{
+		"browsers":     rules.Browsers,
+		"os":           rules.OS,
+		"devices":      rules.Devices,
+		"device_types": rules.DeviceTypes,
+	} {
+		for i, rule := range list {
+			re, err := regexp.Compile(rule.Pattern)
+			if err != nil {
+				return nil, fmt.Errorf("invalid user agent rule %s[%d]: %w", group, i, err)
+			}
+			rule.re = re
 		}
-		return "Chrome", ""
 	}
 
-	// Firefox
-	if strings.Contains(userAgent, "Firefox/") {
-		parts := strings.Split(userAgent, "Firefox/")
-		if len(parts) > 1 {
-			version := strings.Split(parts[1], " ")[0]
-			return "Firefox", strings.Split(version, ".")[0]
-		}
-		return "Firefox", ""
-	}
+	return &UserAgentParser{rules: &rules}, nil
+}
 
-	// Safari
-	if strings.Contains(userAgent, "Safari/") && !strings.Contains(userAgent, "Chrome/") {
-		parts := strings.Split(userAgent, "Safari/")
-		if len(parts) > 1 {
-			version := strings.Split(parts[1], " ")[0]
-			return "Safari", strings.Split(version, ".")[0]
-		}
-		return "Safari", ""
+// LoadUserAgentParser 从文件加载规则集，path 为空时使用内置规则
+func LoadUserAgentParser(path string) (*UserAgentParser, error) {
+	if path == "" {
+		return defaultUserAgentParser, nil
 	}
 
-	// Edge
-	if strings.Contains(userAgent, "Edg/") || strings.Contains(userAgent, "Edge/") {
-		var version string
-		if strings.Contains(userAgent, "Edg/") {
-			parts := strings.Split(userAgent, "Edg/")
-			if len(parts) > 1 {
-				version = strings.Split(parts[1], " ")[0]
-			}
-		} else {
-			parts := strings.Split(userAgent, "Edge/")
-			if len(parts) > 1 {
-				version = strings.Split(parts[1], " ")[0]
-			}
-		}
-		return "Edge", strings.Split(version, ".")[0]
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read user agent rules: %w", err)
 	}
+	return NewUserAgentParser(data)
+}
 
-	// Internet Explorer
-	if strings.Contains(userAgent, "MSIE") {
-		parts := strings.Split(userAgent, "MSIE ")
-		if len(parts) > 1 {
-			version := strings.Split(parts[1], ";")[0]
-			return "Internet Explorer", strings.Split(version, ".")[0]
-		}
-		return "Internet Explorer", ""
+func mustNewUserAgentParser(data []byte) *UserAgentParser {
+	parser, err := NewUserAgentParser(data)
+	if err != nil {
+		panic(err)
 	}
+	return parser
+}
 
-	return "Unknown", ""
+// ParseUserAgent 使用内置规则解析用户代理字符串
+func ParseUserAgent(userAgent string) *UserAgentInfo {
+	return defaultUserAgentParser.Parse(userAgent)
 }
 
-// parseOS 解析操作系统信息
-func parseOS(userAgent string) (string, string) {
-	// Windows
-	if strings.Contains(userAgent, "Windows NT") {
-		parts := strings.Split(userAgent, "Windows NT ")
-		if len(parts) > 1 {
-			version := strings.Split(parts[1], ";")[0]
-			version = strings.Split(version, " ")[0]
-			
-			versions := map[string]string{
-				"5.1": "XP",
-				"6.0": "Vista",
-				"6.1": "7",
-				"6.2": "8",
-				"6.3": "8.1",
-				"10.0": "10",
-				"11.0": "11",
-			}
-			
-			osName := "Windows " + versions[version]
-			if osName == "Windows " {
-				osName = "Windows NT " + version
-			}
-			return osName, version
-		}
-		return "Windows", ""
+// Parse 解析用户代理字符串
+func (p *UserAgentParser) Parse(userAgent string) *UserAgentInfo {
+	info := &UserAgentInfo{
+		Browser:    "Unknown",
+		OS:         "Unknown",
+		Device:     "Unknown",
+		DeviceType: "Desktop", // 默认为桌面端
 	}
 
-	// macOS
-	if strings.Contains(userAgent, "Mac OS X") {
-		parts := strings.Split(userAgent, "Mac OS X ")
-		if len(parts) > 1 {
-			version := strings.Split(parts[1], " ")[0]
-			version = strings.ReplaceAll(version, "_", ".")
-			return "macOS", version
-		}
-		return "macOS", ""
+	userAgent = strings.TrimSpace(userAgent)
+	if userAgent == "" {
+		return info
 	}
 
-	// iOS
-	if strings.Contains(userAgent, "iPhone") || strings.Contains(userAgent, "iPad") {
-		// 查找 OS 标识
-		re := regexp.MustCompile(`OS (\d+)_(\d+)_?(\d+)?`)
-		matches := re.FindStringSubmatch(userAgent)
-		if len(matches) > 1 {
-			version := matches[1] + "." + matches[2]
-			if len(matches) > 3 && matches[3] != "" {
-				version += "." + matches[3]
-			}
-			return "iOS", version
-		}
-		return "iOS", ""
+	if name, version, ok := matchUserAgentRules(p.rules.Browsers, userAgent); ok {
+		info.Browser, info.Version = name, version
 	}
-
-	// Android
-	if strings.Contains(userAgent, "Android") {
-		parts := strings.Split(userAgent, "Android ")
-		if len(parts) > 1 {
-			version := strings.Split(parts[1], " ")[0]
-			return "Android", version
-		}
-		return "Android", ""
+	if name, version, ok := matchUserAgentRules(p.rules.OS, userAgent); ok {
+		info.OS, info.OSVersion = name, version
 	}
-
-	// Linux
-	if strings.Contains(userAgent, "Linux") {
-		return "Linux", ""
+	if name, _, ok := matchUserAgentRules(p.rules.Devices, userAgent); ok {
+		info.Device = name
+	}
+	if name, _, ok := matchUserAgentRules(p.rules.DeviceTypes, userAgent); ok {
+		info.DeviceType = name
 	}
 
-	return "Unknown", ""
+	return info
 }
 
-// parseDeviceType 解析设备类型
-func parseDeviceType(userAgent string) string {
-	userAgent = strings.ToLower(userAgent)
-
-	// 检查移动设备特征
-	mobileIndicators := []string{
-		"iphone", "ipad", "android", "mobile", "blackberry", "windows phone",
-		"opera mini", "iemobile", "mobile safari", "phone",
-	}
-
-	for _, indicator := range mobileIndicators {
-		if strings.Contains(userAgent, indicator) {
-			// 检查是否是平板
-			tabletIndicators := []string{
-				"ipad", "tablet", "playbook", "silk-accelerated",
-			}
-			
-			for _, tabletIndicator := range tabletIndicators {
-				if strings.Contains(userAgent, tabletIndicator) {
-					return "Tablet"
-				}
-			}
-			
-			return "Mobile"
+// matchUserAgentRules 返回第一条命中规则展开后的名称和版本，版本中的下划线替换为点
+func matchUserAgentRules(rules []*UserAgentRule, userAgent string) (name, version string, ok bool) {
+	for _, rule := range rules {
+		match := rule.re.FindStringSubmatchIndex(userAgent)
+		if match == nil {
+			continue
 		}
-	}
-
-	// 检查是否是机器人
-	botIndicators := []string{
-		"bot", "crawl", "spider", "slurp", "facebookexternalhit",
-		"facebookplatform", "twitterbot", "linkedinbot", "embedly",
-		"pinterest", "slackbot", "vkshare", "bingpreview", "tumblr",
-	}
 
-	for _, indicator := range botIndicators {
-		if strings.Contains(userAgent, indicator) {
-			return "Bot"
+		name = strings.TrimSpace(string(rule.re.ExpandString(nil, rule.Name, userAgent, match)))
+		if name == "" || containsString(rule.Ignore, name) {
+			continue
 		}
+		version = string(rule.re.ExpandString(nil, rule.Version, userAgent, match))
+		return name, strings.ReplaceAll(version, "_", "."), true
 	}
-
-	return "Desktop"
+	return "", "", false
 }
 
-// parseDeviceBrand 解析设备品牌
-func parseDeviceBrand(userAgent string) string {
-	userAgent = strings.ToLower(userAgent)
-
-	// 常见设备品牌
-	brands := []string{
-		"iphone", "ipad", "samsung", "galaxy", "nexus", "pixel",
-		"htc", "lg", "motorola", "sony", "xiaomi", "huawei",
-		"oppo", "vivo", "oneplus", "lenovo", "dell", "hp",
-		"asus", "acer", "toshiba", "surface", "mac", "thinkpad",
-	}
-
-	for _, brand := range brands {
-		if strings.Contains(userAgent, brand) {
-			return strings.Title(brand)
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
 		}
 	}
-
-	return "Unknown"
+	return false
 }
 
 // GetUserDeviceType 便捷函数，只获取设备类型
 func GetUserDeviceType(userAgent string) string {
-	return parseDeviceType(userAgent)
+	return ParseUserAgent(userAgent).DeviceType
 }
 
 // GetBrowserName 便捷函数，只获取浏览器名称
 func GetBrowserName(userAgent string) string {
-	browser, _ := parseBrowser(userAgent)
-	return browser
+	return ParseUserAgent(userAgent).Browser
 }
 
 // GetOSName 便捷函数，只获取操作系统名称
 func GetOSName(userAgent string) string {
-	os, _ := parseOS(userAgent)
-	return os
-}
\ No newline at end of file
+	return ParseUserAgent(userAgent).OS
+}
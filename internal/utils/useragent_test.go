@@ -0,0 +1,586 @@
+package utils
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestParseUserAgent(t *testing.T) {
+	tests := []struct {
+		name string
+		ua   string
+		want UserAgentInfo
+	}{
+		// 桌面浏览器
+		{
+			name: "Chrome on Windows",
+			ua:   "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/124.0.0.0 Safari/537.36",
+			want: UserAgentInfo{Browser: "Chrome", Version: "124.0.0.0", OS: "Windows 10", OSVersion: "10.0", Device: "Unknown", DeviceType: "Desktop"},
+		},
+		{
+			name: "Edge on Windows",
+			ua:   "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/124.0.0.0 Safari/537.36 Edg/124.0.2478.51",
+			want: UserAgentInfo{Browser: "Edge", Version: "124.0.2478.51", OS: "Windows 10", OSVersion: "10.0", Device: "Unknown", DeviceType: "Desktop"},
+		},
+		{
+			name: "legacy Edge",
+			ua:   "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/70.0.3538.102 Safari/537.36 Edge/18.19582",
+			want: UserAgentInfo{Browser: "Edge", Version: "18.19582", OS: "Windows 10", OSVersion: "10.0", Device: "Unknown", DeviceType: "Desktop"},
+		},
+		{
+			name: "Edge on Windows ARM",
+			ua:   "Mozilla/5.0 (Windows NT 10.0; ARM64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/124.0.0.0 Safari/537.36 Edg/124.0.0.0",
+			want: UserAgentInfo{Browser: "Edge", Version: "124.0.0.0", OS: "Windows 10", OSVersion: "10.0", Device: "Unknown", DeviceType: "Desktop"},
+		},
+		{
+			name: "Firefox on Windows",
+			ua:   "Mozilla/5.0 (Windows NT 10.0; Win64; x64; rv:125.0) Gecko/20100101 Firefox/125.0",
+			want: UserAgentInfo{Browser: "Firefox", Version: "125.0", OS: "Windows 10", OSVersion: "10.0", Device: "Unknown", DeviceType: "Desktop"},
+		},
+		{
+			name: "Chrome on Windows 8.1",
+			ua:   "Mozilla/5.0 (Windows NT 6.3; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/109.0.0.0 Safari/537.36",
+			want: UserAgentInfo{Browser: "Chrome", Version: "109.0.0.0", OS: "Windows 8.1", OSVersion: "6.3", Device: "Unknown", DeviceType: "Desktop"},
+		},
+		{
+			name: "Chrome on Windows 8",
+			ua:   "Mozilla/5.0 (Windows NT 6.2; WOW64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/49.0.2623.112 Safari/537.36",
+			want: UserAgentInfo{Browser: "Chrome", Version: "49.0.2623.112", OS: "Windows 8", OSVersion: "6.2", Device: "Unknown", DeviceType: "Desktop"},
+		},
+		{
+			name: "Firefox on Windows Vista",
+			ua:   "Mozilla/5.0 (Windows NT 6.0; rv:52.0) Gecko/20100101 Firefox/52.0",
+			want: UserAgentInfo{Browser: "Firefox", Version: "52.0", OS: "Windows Vista", OSVersion: "6.0", Device: "Unknown", DeviceType: "Desktop"},
+		},
+		{
+			name: "Firefox on Windows XP",
+			ua:   "Mozilla/5.0 (Windows NT 5.1; rv:52.0) Gecko/20100101 Firefox/52.0",
+			want: UserAgentInfo{Browser: "Firefox", Version: "52.0", OS: "Windows XP", OSVersion: "5.1", Device: "Unknown", DeviceType: "Desktop"},
+		},
+		{
+			name: "Windows Server 2003",
+			ua:   "Mozilla/5.0 (Windows NT 5.2; WOW64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/49.0.2623.112 Safari/537.36",
+			want: UserAgentInfo{Browser: "Chrome", Version: "49.0.2623.112", OS: "Windows XP", OSVersion: "5.1", Device: "Unknown", DeviceType: "Desktop"},
+		},
+		{
+			name: "Windows 2000",
+			ua:   "Mozilla/4.0 (compatible; MSIE 6.0; Windows NT 5.0)",
+			want: UserAgentInfo{Browser: "Internet Explorer", Version: "6.0", OS: "Windows NT 5.0", OSVersion: "5.0", Device: "Unknown", DeviceType: "Desktop"},
+		},
+		{
+			name: "Internet Explorer 11",
+			ua:   "Mozilla/5.0 (Windows NT 6.1; WOW64; Trident/7.0; rv:11.0) like Gecko",
+			want: UserAgentInfo{Browser: "Internet Explorer", Version: "11.0", OS: "Windows 7", OSVersion: "6.1", Device: "Unknown", DeviceType: "Desktop"},
+		},
+		{
+			name: "Internet Explorer 9",
+			ua:   "Mozilla/5.0 (compatible; MSIE 9.0; Windows NT 6.1; Trident/5.0)",
+			want: UserAgentInfo{Browser: "Internet Explorer", Version: "9.0", OS: "Windows 7", OSVersion: "6.1", Device: "Unknown", DeviceType: "Desktop"},
+		},
+		{
+			name: "Windows 98",
+			ua:   "Mozilla/4.0 (compatible; MSIE 5.5; Windows 98; Win 9x 4.90)",
+			want: UserAgentInfo{Browser: "Internet Explorer", Version: "5.5", OS: "Windows", Device: "Unknown", DeviceType: "Desktop"},
+		},
+		{
+			name: "Opera on Windows",
+			ua:   "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/123.0.0.0 Safari/537.36 OPR/109.0.0.0",
+			want: UserAgentInfo{Browser: "Opera", Version: "109.0.0.0", OS: "Windows 10", OSVersion: "10.0", Device: "Unknown", DeviceType: "Desktop"},
+		},
+		{
+			name: "Opera Presto",
+			ua:   "Opera/9.80 (Windows NT 6.1; WOW64) Presto/2.12.388 Version/12.18",
+			want: UserAgentInfo{Browser: "Opera", Version: "12.18", OS: "Windows 7", OSVersion: "6.1", Device: "Unknown", DeviceType: "Desktop"},
+		},
+		{
+			name: "Opera Presto on Mac",
+			ua:   "Opera/9.80 (Macintosh; Intel Mac OS X 10.6.8; U; en) Presto/2.9.168 Version/11.52",
+			want: UserAgentInfo{Browser: "Opera", Version: "11.52", OS: "macOS", OSVersion: "10.6.8", Device: "Mac", DeviceType: "Desktop"},
+		},
+		{
+			name: "Opera 8",
+			ua:   "Opera/8.51 (Windows NT 5.1; U; en)",
+			want: UserAgentInfo{Browser: "Opera", Version: "8.51", OS: "Windows XP", OSVersion: "5.1", Device: "Unknown", DeviceType: "Desktop"},
+		},
+		{
+			name: "Vivaldi",
+			ua:   "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/124.0.0.0 Safari/537.36 Vivaldi/6.7.3329.17",
+			want: UserAgentInfo{Browser: "Vivaldi", Version: "6.7.3329.17", OS: "Windows 10", OSVersion: "10.0", Device: "Unknown", DeviceType: "Desktop"},
+		},
+		{
+			name: "Yandex Browser",
+			ua:   "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/122.0.0.0 YaBrowser/24.4.0.0 Safari/537.36",
+			want: UserAgentInfo{Browser: "Yandex Browser", Version: "24.4.0.0", OS: "Windows 10", OSVersion: "10.0", Device: "Unknown", DeviceType: "Desktop"},
+		},
+		{
+			name: "Brave with product token",
+			ua:   "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Brave/1.65.114 Chrome/124.0.0.0 Safari/537.36",
+			want: UserAgentInfo{Browser: "Brave", Version: "1.65.114", OS: "Windows 10", OSVersion: "10.0", Device: "Unknown", DeviceType: "Desktop"},
+		},
+		{
+			name: "QQ Browser on Windows",
+			ua:   "Mozilla/5.0 (Windows NT 10.0; WOW64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/94.0.4606.71 Safari/537.36 Core/1.94.202.400 QQBrowser/11.9.5355.400",
+			want: UserAgentInfo{Browser: "QQ Browser", Version: "11.9.5355.400", OS: "Windows 10", OSVersion: "10.0", Device: "Unknown", DeviceType: "Desktop"},
+		},
+		{
+			name: "Safari on macOS",
+			ua:   "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.4.1 Safari/605.1.15",
+			want: UserAgentInfo{Browser: "Safari", Version: "17.4.1", OS: "macOS", OSVersion: "10.15.7", Device: "Mac", DeviceType: "Desktop"},
+		},
+		{
+			name: "Chrome on macOS",
+			ua:   "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/124.0.0.0 Safari/537.36",
+			want: UserAgentInfo{Browser: "Chrome", Version: "124.0.0.0", OS: "macOS", OSVersion: "10.15.7", Device: "Mac", DeviceType: "Desktop"},
+		},
+		{
+			name: "Firefox on macOS",
+			ua:   "Mozilla/5.0 (Macintosh; Intel Mac OS X 14.4; rv:125.0) Gecko/20100101 Firefox/125.0",
+			want: UserAgentInfo{Browser: "Firefox", Version: "125.0", OS: "macOS", OSVersion: "14.4", Device: "Mac", DeviceType: "Desktop"},
+		},
+		{
+			name: "Edge on macOS",
+			ua:   "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/124.0.0.0 Safari/537.36 Edg/124.0.2478.51",
+			want: UserAgentInfo{Browser: "Edge", Version: "124.0.2478.51", OS: "macOS", OSVersion: "10.15.7", Device: "Mac", DeviceType: "Desktop"},
+		},
+		{
+			name: "old Mac without version",
+			ua:   "Mozilla/5.0 (Macintosh; U; PPC Mac OS; en) AppleWebKit/125.2 (KHTML, like Gecko) Safari/125.8",
+			want: UserAgentInfo{Browser: "Unknown", OS: "macOS", Device: "Mac", DeviceType: "Desktop"},
+		},
+		{
+			name: "Firefox on Linux",
+			ua:   "Mozilla/5.0 (X11; Linux x86_64; rv:125.0) Gecko/20100101 Firefox/125.0",
+			want: UserAgentInfo{Browser: "Firefox", Version: "125.0", OS: "Linux", Device: "Unknown", DeviceType: "Desktop"},
+		},
+		{
+			name: "Firefox on Ubuntu",
+			ua:   "Mozilla/5.0 (X11; Ubuntu; Linux x86_64; rv:124.0) Gecko/20100101 Firefox/124.0",
+			want: UserAgentInfo{Browser: "Firefox", Version: "124.0", OS: "Linux", Device: "Unknown", DeviceType: "Desktop"},
+		},
+		{
+			name: "Chrome on Linux",
+			ua:   "Mozilla/5.0 (X11; Linux x86_64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/124.0.0.0 Safari/537.36",
+			want: UserAgentInfo{Browser: "Chrome", Version: "124.0.0.0", OS: "Linux", Device: "Unknown", DeviceType: "Desktop"},
+		},
+		{
+			name: "Chrome OS",
+			ua:   "Mozilla/5.0 (X11; CrOS x86_64 14541.0.0) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/124.0.0.0 Safari/537.36",
+			want: UserAgentInfo{Browser: "Chrome", Version: "124.0.0.0", OS: "Chrome OS", OSVersion: "14541.0.0", Device: "Unknown", DeviceType: "Desktop"},
+		},
+
+		// iOS
+		{
+			name: "Safari on iPhone",
+			ua:   "Mozilla/5.0 (iPhone; CPU iPhone OS 17_4_1 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.4.1 Mobile/15E148 Safari/604.1",
+			want: UserAgentInfo{Browser: "Safari", Version: "17.4.1", OS: "iOS", OSVersion: "17.4.1", Device: "iPhone", DeviceType: "Mobile"},
+		},
+		{
+			name: "Chrome on iPhone",
+			ua:   "Mozilla/5.0 (iPhone; CPU iPhone OS 17_4 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) CriOS/124.0.6367.88 Mobile/15E148 Safari/604.1",
+			want: UserAgentInfo{Browser: "Chrome", Version: "124.0.6367.88", OS: "iOS", OSVersion: "17.4", Device: "iPhone", DeviceType: "Mobile"},
+		},
+		{
+			name: "Firefox on iPhone",
+			ua:   "Mozilla/5.0 (iPhone; CPU iPhone OS 17_4 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) FxiOS/125.0 Mobile/15E148 Safari/605.1.15",
+			want: UserAgentInfo{Browser: "Firefox", Version: "125.0", OS: "iOS", OSVersion: "17.4", Device: "iPhone", DeviceType: "Mobile"},
+		},
+		{
+			name: "Edge on iPhone",
+			ua:   "Mozilla/5.0 (iPhone; CPU iPhone OS 17_4 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.0 EdgiOS/124.2478.50 Mobile/15E148 Safari/605.1.15",
+			want: UserAgentInfo{Browser: "Edge", Version: "124.2478.50", OS: "iOS", OSVersion: "17.4", Device: "iPhone", DeviceType: "Mobile"},
+		},
+		{
+			name: "Opera on iPhone",
+			ua:   "Mozilla/5.0 (iPhone; CPU iPhone OS 16_6 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/16.0 OPT/4.3.1 Mobile/15E148",
+			want: UserAgentInfo{Browser: "Opera", Version: "4.3.1", OS: "iOS", OSVersion: "16.6", Device: "iPhone", DeviceType: "Mobile"},
+		},
+		{
+			name: "Safari on iPad",
+			ua:   "Mozilla/5.0 (iPad; CPU OS 16_6 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/16.6 Mobile/15E148 Safari/604.1",
+			want: UserAgentInfo{Browser: "Safari", Version: "16.6", OS: "iOS", OSVersion: "16.6", Device: "iPad", DeviceType: "Tablet"},
+		},
+		{
+			name: "Chrome on iPad",
+			ua:   "Mozilla/5.0 (iPad; CPU OS 17_4 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) CriOS/124.0.6367.88 Mobile/15E148 Safari/604.1",
+			want: UserAgentInfo{Browser: "Chrome", Version: "124.0.6367.88", OS: "iOS", OSVersion: "17.4", Device: "iPad", DeviceType: "Tablet"},
+		},
+		{
+			name: "iPod touch",
+			ua:   "Mozilla/5.0 (iPod touch; CPU iPhone OS 12_5_7 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/12.1.2 Mobile/15E148 Safari/604.1",
+			want: UserAgentInfo{Browser: "Safari", Version: "12.1.2", OS: "iOS", OSVersion: "12.5.7", Device: "iPod", DeviceType: "Mobile"},
+		},
+		{
+			name: "iOS without version",
+			ua:   "MyApp/1.0 (iPhone)",
+			want: UserAgentInfo{Browser: "Unknown", OS: "iOS", Device: "iPhone", DeviceType: "Mobile"},
+		},
+
+		// Android
+		{
+			name: "Chrome on Pixel",
+			ua:   "Mozilla/5.0 (Linux; Android 14; Pixel 8 Pro) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/124.0.6367.82 Mobile Safari/537.36",
+			want: UserAgentInfo{Browser: "Chrome", Version: "124.0.6367.82", OS: "Android", OSVersion: "14", Device: "Pixel 8 Pro", DeviceType: "Mobile"},
+		},
+		{
+			name: "Chrome with reduced user agent",
+			ua:   "Mozilla/5.0 (Linux; Android 10; K) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/124.0.0.0 Mobile Safari/537.36",
+			want: UserAgentInfo{Browser: "Chrome", Version: "124.0.0.0", OS: "Android", OSVersion: "10", Device: "Unknown", DeviceType: "Mobile"},
+		},
+		{
+			name: "Chrome on Android tablet",
+			ua:   "Mozilla/5.0 (Linux; Android 10; K) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/124.0.0.0 Safari/537.36",
+			want: UserAgentInfo{Browser: "Chrome", Version: "124.0.0.0", OS: "Android", OSVersion: "10", Device: "Unknown", DeviceType: "Tablet"},
+		},
+		{
+			name: "Samsung Internet",
+			ua:   "Mozilla/5.0 (Linux; Android 13; SAMSUNG SM-S918B) AppleWebKit/537.36 (KHTML, like Gecko) SamsungBrowser/24.0 Chrome/117.0.0.0 Mobile Safari/537.36",
+			want: UserAgentInfo{Browser: "Samsung Internet", Version: "24.0", OS: "Android", OSVersion: "13", Device: "SM-S918B", DeviceType: "Mobile"},
+		},
+		{
+			name: "Samsung Galaxy Tab S9",
+			ua:   "Mozilla/5.0 (Linux; Android 13; SM-X710) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/124.0.0.0 Safari/537.36",
+			want: UserAgentInfo{Browser: "Chrome", Version: "124.0.0.0", OS: "Android", OSVersion: "13", Device: "SM-X710", DeviceType: "Tablet"},
+		},
+		{
+			name: "Samsung Galaxy Tab A",
+			ua:   "Mozilla/5.0 (Linux; Android 11; SM-T505) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/110.0.0.0 Mobile Safari/537.36",
+			want: UserAgentInfo{Browser: "Chrome", Version: "110.0.0.0", OS: "Android", OSVersion: "11", Device: "SM-T505", DeviceType: "Tablet"},
+		},
+		{
+			name: "Android stock browser",
+			ua:   "Mozilla/5.0 (Linux; U; Android 4.4.2; en-us; SM-G900V Build/KOT49H) AppleWebKit/534.30 (KHTML, like Gecko) Version/4.0 Mobile Safari/534.30",
+			want: UserAgentInfo{Browser: "Android Browser", Version: "4.0", OS: "Android", OSVersion: "4.4.2", Device: "SM-G900V", DeviceType: "Mobile"},
+		},
+		{
+			name: "Android WebView",
+			ua:   "Mozilla/5.0 (Linux; Android 12; SM-A515F Build/SP1A.210812.016; wv) AppleWebKit/537.36 (KHTML, like Gecko) Version/4.0 Chrome/123.0.6312.118 Mobile Safari/537.36",
+			want: UserAgentInfo{Browser: "Chrome", Version: "123.0.6312.118", OS: "Android", OSVersion: "12", Device: "SM-A515F", DeviceType: "Mobile"},
+		},
+		{
+			name: "Xiaomi",
+			ua:   "Mozilla/5.0 (Linux; Android 13; 2201116SG) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/124.0.0.0 Mobile Safari/537.36",
+			want: UserAgentInfo{Browser: "Chrome", Version: "124.0.0.0", OS: "Android", OSVersion: "13", Device: "2201116SG", DeviceType: "Mobile"},
+		},
+		{
+			name: "Firefox on Android",
+			ua:   "Mozilla/5.0 (Android 14; Mobile; rv:125.0) Gecko/125.0 Firefox/125.0",
+			want: UserAgentInfo{Browser: "Firefox", Version: "125.0", OS: "Android", OSVersion: "14", Device: "Unknown", DeviceType: "Mobile"},
+		},
+		{
+			name: "Firefox on Android tablet",
+			ua:   "Mozilla/5.0 (Android 13; Tablet; rv:125.0) Gecko/125.0 Firefox/125.0",
+			want: UserAgentInfo{Browser: "Firefox", Version: "125.0", OS: "Android", OSVersion: "13", Device: "Unknown", DeviceType: "Tablet"},
+		},
+		{
+			name: "Edge on Android",
+			ua:   "Mozilla/5.0 (Linux; Android 10; K) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/124.0.0.0 Mobile Safari/537.36 EdgA/124.0.2478.64",
+			want: UserAgentInfo{Browser: "Edge", Version: "124.0.2478.64", OS: "Android", OSVersion: "10", Device: "Unknown", DeviceType: "Mobile"},
+		},
+		{
+			name: "Opera on Android",
+			ua:   "Mozilla/5.0 (Linux; Android 10; K) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/119.0.0.0 Mobile Safari/537.36 OPR/79.0.4195.76464",
+			want: UserAgentInfo{Browser: "Opera", Version: "79.0.4195.76464", OS: "Android", OSVersion: "10", Device: "Unknown", DeviceType: "Mobile"},
+		},
+		{
+			name: "Opera Mini",
+			ua:   "Opera/9.80 (J2ME/MIDP; Opera Mini/9.80 (S60; SymbOS; Opera Mobi/23.348; U; en) Presto/2.5.25 Version/10.54",
+			want: UserAgentInfo{Browser: "Opera Mini", Version: "9.80", OS: "Unknown", Device: "Unknown", DeviceType: "Mobile"},
+		},
+		{
+			name: "UC Browser",
+			ua:   "Mozilla/5.0 (Linux; U; Android 10; en-US; RMX1971 Build/QKQ1.190918.001) AppleWebKit/537.36 (KHTML, like Gecko) Version/4.0 Chrome/78.0.3904.108 UCBrowser/13.4.0.1306 Mobile Safari/537.36",
+			want: UserAgentInfo{Browser: "UC Browser", Version: "13.4.0.1306", OS: "Android", OSVersion: "10", Device: "RMX1971", DeviceType: "Mobile"},
+		},
+		{
+			name: "QQ Browser on Android",
+			ua:   "Mozilla/5.0 (Linux; U; Android 11; zh-cn; V2055A Build/RP1A.200720.012) AppleWebKit/537.36 (KHTML, like Gecko) Version/4.0 Chrome/66.0.3359.126 MQQBrowser/12.1 Mobile Safari/537.36",
+			want: UserAgentInfo{Browser: "QQ Browser", Version: "12.1", OS: "Android", OSVersion: "11", Device: "V2055A", DeviceType: "Mobile"},
+		},
+		{
+			name: "Yandex on Android",
+			ua:   "Mozilla/5.0 (Linux; Android 12; M2101K6G) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/122.0.0.0 YaBrowser/24.1.6.80.00 SA/3 Mobile Safari/537.36",
+			want: UserAgentInfo{Browser: "Yandex Browser", Version: "24.1.6.80.00", OS: "Android", OSVersion: "12", Device: "M2101K6G", DeviceType: "Mobile"},
+		},
+		{
+			name: "Huawei Browser on HarmonyOS",
+			ua:   "Mozilla/5.0 (Linux; Android 10; HarmonyOS; NOH-AN00; HMSCore 6.11.0.302) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/99.0.4844.88 HuaweiBrowser/14.0.2.300 Mobile Safari/537.36",
+			want: UserAgentInfo{Browser: "Huawei Browser", Version: "14.0.2.300", OS: "HarmonyOS", Device: "NOH-AN00", DeviceType: "Mobile"},
+		},
+		{
+			name: "HarmonyOS NEXT",
+			ua:   "Mozilla/5.0 (Phone; OpenHarmony 4.1) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/114.0.0.0 Safari/537.36 ArkWeb/4.1.6.1 Mobile HuaweiBrowser/5.0.3.300",
+			want: UserAgentInfo{Browser: "Huawei Browser", Version: "5.0.3.300", OS: "HarmonyOS", OSVersion: "4.1", Device: "Unknown", DeviceType: "Mobile"},
+		},
+		{
+			name: "Silk on Fire tablet",
+			ua:   "Mozilla/5.0 (Linux; Android 9; KFTRWI) AppleWebKit/537.36 (KHTML, like Gecko) Silk/124.2.1 like Chrome/124.0.6367.82 Safari/537.36",
+			want: UserAgentInfo{Browser: "Silk", Version: "124.2.1", OS: "Android", OSVersion: "9", Device: "KFTRWI", DeviceType: "Tablet"},
+		},
+		{
+			name: "Windows Phone",
+			ua:   "Mozilla/5.0 (compatible; MSIE 10.0; Windows Phone 8.0; Trident/6.0; IEMobile/10.0; ARM; Touch; NOKIA; Lumia 920)",
+			want: UserAgentInfo{Browser: "Internet Explorer", Version: "10.0", OS: "Windows Phone", OSVersion: "8.0", Device: "Unknown", DeviceType: "Mobile"},
+		},
+
+		// 应用内浏览器
+		{
+			name: "WeChat on iPhone",
+			ua:   "Mozilla/5.0 (iPhone; CPU iPhone OS 16_5 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Mobile/15E148 MicroMessenger/8.0.38(0x1800262c) NetType/WIFI Language/zh_CN",
+			want: UserAgentInfo{Browser: "WeChat", Version: "8.0.38", OS: "iOS", OSVersion: "16.5", Device: "iPhone", DeviceType: "Mobile"},
+		},
+		{
+			name: "WeChat on Android",
+			ua:   "Mozilla/5.0 (Linux; Android 13; V2203A Build/TP1A.220624.014; wv) AppleWebKit/537.36 (KHTML, like Gecko) Version/4.0 Chrome/107.0.5304.141 Mobile Safari/537.36 XWEB/5075 MMWEBSDK/20230504 MicroMessenger/8.0.37.2380(0x2800253D) WeChat/arm64 Weixin NetType/WIFI Language/zh_CN ABI/arm64",
+			want: UserAgentInfo{Browser: "WeChat", Version: "8.0.37.2380", OS: "Android", OSVersion: "13", Device: "V2203A", DeviceType: "Mobile"},
+		},
+		{
+			name: "Instagram on iPhone",
+			ua:   "Mozilla/5.0 (iPhone; CPU iPhone OS 17_3_1 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Mobile/15E148 Instagram 321.0.2.16.105 (iPhone14,5; iOS 17_3_1; en_US; en; scale=3.00; 1170x2532; 572436108)",
+			want: UserAgentInfo{Browser: "Instagram", Version: "321.0.2.16.105", OS: "iOS", OSVersion: "17.3.1", Device: "iPhone", DeviceType: "Mobile"},
+		},
+		{
+			name: "Instagram on Android",
+			ua:   "Mozilla/5.0 (Linux; Android 14; SM-S911B Build/UP1A.231005.007; wv) AppleWebKit/537.36 (KHTML, like Gecko) Version/4.0 Chrome/124.0.6367.82 Mobile Safari/537.36 Instagram 330.0.0.40.92 Android (34/14; 480dpi; 1080x2340; samsung; SM-S911B; dm1q; qcom; en_US; 596227446)",
+			want: UserAgentInfo{Browser: "Instagram", Version: "330.0.0.40.92", OS: "Android", OSVersion: "14", Device: "SM-S911B", DeviceType: "Mobile"},
+		},
+		{
+			name: "Facebook on iPhone",
+			ua:   "Mozilla/5.0 (iPhone; CPU iPhone OS 17_4 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Mobile/15E148 [FBAN/FBIOS;FBAV/458.0.0.37.106;FBBV/585404345;FBDV/iPhone15,2;FBMD/iPhone;FBSN/iOS;FBSV/17.4;FBSS/3;FBCR/;FBID/phone;FBLC/en_US;FBOP/5]",
+			want: UserAgentInfo{Browser: "Facebook", Version: "458.0.0.37.106", OS: "iOS", OSVersion: "17.4", Device: "iPhone", DeviceType: "Mobile"},
+		},
+		{
+			name: "Facebook on Android",
+			ua:   "Mozilla/5.0 (Linux; Android 14; Pixel 7 Build/AP1A.240405.002; wv) AppleWebKit/537.36 (KHTML, like Gecko) Version/4.0 Chrome/123.0.6312.118 Mobile Safari/537.36 [FB_IAB/FB4A;FBAV/459.0.0.46.109;]",
+			want: UserAgentInfo{Browser: "Facebook", Version: "459.0.0.46.109", OS: "Android", OSVersion: "14", Device: "Pixel 7", DeviceType: "Mobile"},
+		},
+		{
+			name: "Facebook without version",
+			ua:   "Mozilla/5.0 (iPhone; CPU iPhone OS 17_4 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Mobile/15E148 [FBAN/FBIOS]",
+			want: UserAgentInfo{Browser: "Facebook", OS: "iOS", OSVersion: "17.4", Device: "iPhone", DeviceType: "Mobile"},
+		},
+		{
+			name: "LINE",
+			ua:   "Mozilla/5.0 (iPhone; CPU iPhone OS 17_4 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Mobile/15E148 Safari Line/14.5.0",
+			want: UserAgentInfo{Browser: "LINE", Version: "14.5.0", OS: "iOS", OSVersion: "17.4", Device: "iPhone", DeviceType: "Mobile"},
+		},
+		{
+			name: "TikTok",
+			ua:   "Mozilla/5.0 (iPhone; CPU iPhone OS 14_4_2 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Mobile/15E148 TikTok 26.2.0 rv:262018 (iPhone; iOS 14.4.2; en_US) Cronet",
+			want: UserAgentInfo{Browser: "TikTok", Version: "26.2.0", OS: "iOS", OSVersion: "14.4.2", Device: "iPhone", DeviceType: "Mobile"},
+		},
+
+		// 爬虫、链接预览和命令行工具
+		{
+			name: "Googlebot",
+			ua:   "Mozilla/5.0 (compatible; Googlebot/2.1; +http://www.google.com/bot.html)",
+			want: UserAgentInfo{Browser: "Unknown", OS: "Unknown", Device: "Unknown", DeviceType: "Bot"},
+		},
+		{
+			name: "Googlebot smartphone",
+			ua:   "Mozilla/5.0 (Linux; Android 6.0.1; Nexus 5X Build/MMB29P) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/124.0.6367.82 Mobile Safari/537.36 (compatible; Googlebot/2.1; +http://www.google.com/bot.html)",
+			want: UserAgentInfo{Browser: "Chrome", Version: "124.0.6367.82", OS: "Android", OSVersion: "6.0.1", Device: "Nexus 5X", DeviceType: "Bot"},
+		},
+		{
+			name: "bingbot",
+			ua:   "Mozilla/5.0 (compatible; bingbot/2.0; +http://www.bing.com/bingbot.htm)",
+			want: UserAgentInfo{Browser: "Unknown", OS: "Unknown", Device: "Unknown", DeviceType: "Bot"},
+		},
+		{
+			name: "Yahoo Slurp",
+			ua:   "Mozilla/5.0 (compatible; Yahoo! Slurp; http://help.yahoo.com/help/us/ysearch/slurp)",
+			want: UserAgentInfo{Browser: "Unknown", OS: "Unknown", Device: "Unknown", DeviceType: "Bot"},
+		},
+		{
+			name: "Baiduspider",
+			ua:   "Mozilla/5.0 (compatible; Baiduspider/2.0; +http://www.baidu.com/search/spider.html)",
+			want: UserAgentInfo{Browser: "Unknown", OS: "Unknown", Device: "Unknown", DeviceType: "Bot"},
+		},
+		{
+			name: "Applebot",
+			ua:   "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_5) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/13.1.1 Safari/605.1.15 (Applebot/0.1; +http://www.apple.com/go/applebot)",
+			want: UserAgentInfo{Browser: "Safari", Version: "13.1.1", OS: "macOS", OSVersion: "10.15.5", Device: "Mac", DeviceType: "Bot"},
+		},
+		{
+			name: "Facebook link preview",
+			ua:   "facebookexternalhit/1.1 (+http://www.facebook.com/externalhit_uatext.php)",
+			want: UserAgentInfo{Browser: "Unknown", OS: "Unknown", Device: "Unknown", DeviceType: "Bot"},
+		},
+		{
+			name: "Twitterbot",
+			ua:   "Twitterbot/1.0",
+			want: UserAgentInfo{Browser: "Unknown", OS: "Unknown", Device: "Unknown", DeviceType: "Bot"},
+		},
+		{
+			name: "LinkedInBot",
+			ua:   "LinkedInBot/1.0 (compatible; Mozilla/5.0; Apache-HttpClient +http://www.linkedin.com)",
+			want: UserAgentInfo{Browser: "Unknown", OS: "Unknown", Device: "Unknown", DeviceType: "Bot"},
+		},
+		{
+			name: "Slackbot",
+			ua:   "Slackbot-LinkExpanding 1.0 (+https://api.slack.com/robots)",
+			want: UserAgentInfo{Browser: "Unknown", OS: "Unknown", Device: "Unknown", DeviceType: "Bot"},
+		},
+		{
+			name: "Discordbot",
+			ua:   "Mozilla/5.0 (compatible; Discordbot/2.0; +https://discordapp.com)",
+			want: UserAgentInfo{Browser: "Unknown", OS: "Unknown", Device: "Unknown", DeviceType: "Bot"},
+		},
+		{
+			name: "WhatsApp link preview",
+			ua:   "WhatsApp/2.23.20.0",
+			want: UserAgentInfo{Browser: "Unknown", OS: "Unknown", Device: "Unknown", DeviceType: "Bot"},
+		},
+		{
+			name: "Telegram link preview",
+			ua:   "TelegramBot (like TwitterBot)",
+			want: UserAgentInfo{Browser: "Unknown", OS: "Unknown", Device: "Unknown", DeviceType: "Bot"},
+		},
+		{
+			name: "Headless Chrome",
+			ua:   "Mozilla/5.0 (X11; Linux x86_64) AppleWebKit/537.36 (KHTML, like Gecko) HeadlessChrome/124.0.6367.60 Safari/537.36",
+			want: UserAgentInfo{Browser: "Chrome", Version: "124.0.6367.60", OS: "Linux", Device: "Unknown", DeviceType: "Bot"},
+		},
+		{
+			name: "Lighthouse",
+			ua:   "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/124.0.0.0 Safari/537.36 Chrome-Lighthouse",
+			want: UserAgentInfo{Browser: "Chrome", Version: "124.0.0.0", OS: "macOS", OSVersion: "10.15.7", Device: "Mac", DeviceType: "Bot"},
+		},
+		{
+			name: "curl",
+			ua:   "curl/8.4.0",
+			want: UserAgentInfo{Browser: "Unknown", OS: "Unknown", Device: "Unknown", DeviceType: "Bot"},
+		},
+		{
+			name: "Wget",
+			ua:   "Wget/1.21.4",
+			want: UserAgentInfo{Browser: "Unknown", OS: "Unknown", Device: "Unknown", DeviceType: "Bot"},
+		},
+		{
+			name: "python-requests",
+			ua:   "python-requests/2.31.0",
+			want: UserAgentInfo{Browser: "Unknown", OS: "Unknown", Device: "Unknown", DeviceType: "Bot"},
+		},
+		{
+			name: "Go HTTP client",
+			ua:   "Go-http-client/1.1",
+			want: UserAgentInfo{Browser: "Unknown", OS: "Unknown", Device: "Unknown", DeviceType: "Bot"},
+		},
+
+		// 空值与无法识别的值
+		{
+			name: "empty",
+			ua:   "",
+			want: UserAgentInfo{Browser: "Unknown", OS: "Unknown", Device: "Unknown", DeviceType: "Desktop"},
+		},
+		{
+			name: "whitespace",
+			ua:   "   \t",
+			want: UserAgentInfo{Browser: "Unknown", OS: "Unknown", Device: "Unknown", DeviceType: "Desktop"},
+		},
+		{
+			name: "unrecognized",
+			ua:   "Mozilla/5.0",
+			want: UserAgentInfo{Browser: "Unknown", OS: "Unknown", Device: "Unknown", DeviceType: "Desktop"},
+		},
+		{
+			name: "surrounding whitespace",
+			ua:   "  Mozilla/5.0 (Windows NT 10.0; Win64; x64; rv:125.0) Gecko/20100101 Firefox/125.0  ",
+			want: UserAgentInfo{Browser: "Firefox", Version: "125.0", OS: "Windows 10", OSVersion: "10.0", Device: "Unknown", DeviceType: "Desktop"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := ParseUserAgent(tt.ua)
+			if *got != tt.want {
+				t.Errorf("ParseUserAgent(%q)\n got  %+v\n want %+v", tt.ua, *got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUserAgentHelpers(t *testing.T) {
+	ua := "Mozilla/5.0 (iPhone; CPU iPhone OS 17_4_1 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.4.1 Mobile/15E148 Safari/604.1"
+	if got := GetBrowserName(ua); got != "Safari" {
+		t.Errorf("GetBrowserName() = %q, want Safari", got)
+	}
+	if got := GetOSName(ua); got != "iOS" {
+		t.Errorf("GetOSName() = %q, want iOS", got)
+	}
+	if got := GetUserDeviceType(ua); got != "Mobile" {
+		t.Errorf("GetUserDeviceType() = %q, want Mobile", got)
+	}
+}
+
+func TestNewUserAgentParser(t *testing.T) {
+	rules := []byte(`{
+		"browsers": [{"name": "Edge", "pattern": "(?:Edg|EdgA|EdgiOS)/([\\d.]+)", "version": "$1"}],
+		"os": [{"name": "$1", "pattern": "(Android|Windows)(?: NT)? ([\\d_.]+)", "version": "$2"}],
+		"devices": [{"name": "$1", "pattern": "Android [\\d.]+; ([^;)]+?)[;)]", "ignore": ["K"]}],
+		"device_types": [{"name": "Mobile", "pattern": "(?i)mobile|iphone"}]
+	}`)
+	parser, err := NewUserAgentParser(rules)
+	if err != nil {
+		t.Fatalf("NewUserAgentParser: %v", err)
+	}
+
+	tests := []struct {
+		ua   string
+		want UserAgentInfo
+	}{
+		{
+			ua:   "Mozilla/5.0 (Linux; Android 10; K) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/124.0.0.0 Mobile Safari/537.36 EdgA/124.0.2478.64",
+			want: UserAgentInfo{Browser: "Edge", Version: "124.0.2478.64", OS: "Android", OSVersion: "10", Device: "Unknown", DeviceType: "Mobile"},
+		},
+		{
+			ua:   "Mozilla/5.0 (Linux; Android 14; Pixel 8) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/124.0.0.0 Safari/537.36",
+			want: UserAgentInfo{Browser: "Unknown", OS: "Android", OSVersion: "14", Device: "Pixel 8", DeviceType: "Desktop"},
+		},
+		{
+			ua:   "Mozilla/5.0 (Windows NT 6_1; Win64; x64) Chrome/124.0.0.0",
+			want: UserAgentInfo{Browser: "Unknown", OS: "Windows", OSVersion: "6.1", Device: "Unknown", DeviceType: "Desktop"},
+		},
+	}
+	for _, tt := range tests {
+		if got := parser.Parse(tt.ua); *got != tt.want {
+			t.Errorf("Parse(%q)\n got  %+v\n want %+v", tt.ua, *got, tt.want)
+		}
+	}
+}
+
+func TestNewUserAgentParserErrors(t *testing.T) {
+	for name, rules := range map[string]string{
+		"invalid JSON":  `{"browsers": [`,
+		"invalid regex": `{"os": [{"name": "Broken", "pattern": "(unclosed"}]}`,
+	} {
+		if _, err := NewUserAgentParser([]byte(rules)); err == nil {
+			t.Errorf("%s: NewUserAgentParser() = nil error", name)
+		}
+	}
+}
+
+func TestLoadUserAgentParser(t *testing.T) {
+	parser, err := LoadUserAgentParser("")
+	if err != nil || parser != defaultUserAgentParser {
+		t.Fatalf("LoadUserAgentParser(\"\") = %p, %v; want the built-in parser", parser, err)
+	}
+
+	if _, err := LoadUserAgentParser(filepath.Join(t.TempDir(), "missing.json")); err == nil {
+		t.Fatal("LoadUserAgentParser() with a missing file = nil error")
+	}
+
+	path := filepath.Join(t.TempDir(), "rules.json")
+	if err := os.WriteFile(path, []byte(`{"browsers": [{"name": "Custom", "pattern": "Custom/([\\d.]+)", "version": "$1"}]}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	parser, err = LoadUserAgentParser(path)
+	if err != nil {
+		t.Fatalf("LoadUserAgentParser(%s): %v", path, err)
+	}
+	// 自定义规则完整替换内置规则
+	want := UserAgentInfo{Browser: "Custom", Version: "2.0", OS: "Unknown", Device: "Unknown", DeviceType: "Desktop"}
+	if got := parser.Parse("Mozilla/5.0 (iPhone) Custom/2.0"); *got != want {
+		t.Errorf("Parse() = %+v, want %+v", *got, want)
+	}
+}
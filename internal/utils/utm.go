@@ -0,0 +1,100 @@
+package utils
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+
+	"url-shortener/internal/model"
+)
+
+// UTM 参数名称
+const (
+	UTMSourceParam   = "utm_source"
+	UTMMediumParam   = "utm_medium"
+	UTMCampaignParam = "utm_campaign"
+	UTMTermParam     = "utm_term"
+	UTMContentParam  = "utm_content"
+)
+
+// UTMParamsFromQuery 从查询参数中提取 UTM 参数
+func UTMParamsFromQuery(values url.Values) model.UTMParams {
+	return model.UTMParams{
+		Source:   values.Get(UTMSourceParam),
+		Medium:   values.Get(UTMMediumParam),
+		Campaign: values.Get(UTMCampaignParam),
+		Term:     values.Get(UTMTermParam),
+		Content:  values.Get(UTMContentParam),
+	}
+}
+
+// UTMParamsFromURL 从 URL 的查询字符串中提取 UTM 参数，URL 无法解析时返回空值
+func UTMParamsFromURL(rawURL string) model.UTMParams {
+	parsed, err := url.Parse(rawURL)
+	if err != nil {
+		return model.UTMParams{}
+	}
+	return UTMParamsFromQuery(parsed.Query())
+}
+
+// MergeUTMParams 合并 UTM 参数，override 中非空的字段覆盖 base
+func MergeUTMParams(base, override model.UTMParams) model.UTMParams {
+	if override.Source != "" {
+		base.Source = override.Source
+	}
+	if override.Medium != "" {
+		base.Medium = override.Medium
+	}
+	if override.Campaign != "" {
+		base.Campaign = override.Campaign
+	}
+	if override.Term != "" {
+		base.Term = override.Term
+	}
+	if override.Content != "" {
+		base.Content = override.Content
+	}
+	return base
+}
+
+// AppendUTMParams 将 UTM 参数追加到 URL，已存在的同名参数会被替换
+// 原有的其他查询参数按原样保留，不重新编码或排序
+func AppendUTMParams(rawURL string, params model.UTMParams) (string, error) {
+	parsed, err := url.Parse(rawURL)
+	if err != nil {
+		return "", fmt.Errorf("invalid URL format: %w", err)
+	}
+
+	var added []string
+	replaced := make(map[string]bool)
+	for _, param := range []struct{ name, value string }{
+		{UTMSourceParam, params.Source},
+		{UTMMediumParam, params.Medium},
+		{UTMCampaignParam, params.Campaign},
+		{UTMTermParam, params.Term},
+		{UTMContentParam, params.Content},
+	} {
+		if param.value != "" {
+			added = append(added, url.QueryEscape(param.name)+"="+url.QueryEscape(param.value))
+			replaced[param.name] = true
+		}
+	}
+	if len(added) == 0 {
+		return parsed.String(), nil
+	}
+
+	var kept []string
+	for _, pair := range strings.Split(parsed.RawQuery, "&") {
+		if pair == "" {
+			continue
+		}
+		name, _, _ := strings.Cut(pair, "=")
+		if unescaped, err := url.QueryUnescape(name); err == nil && replaced[unescaped] {
+			continue
+		}
+		kept = append(kept, pair)
+	}
+	parsed.RawQuery = strings.Join(append(kept, added...), "&")
+
+	return parsed.String(), nil
+}
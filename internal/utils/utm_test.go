@@ -0,0 +1,73 @@
+package utils
+
+import (
+	"testing"
+
+	"url-shortener/internal/model"
+)
+
+func TestAppendUTMParams(t *testing.T) {
+	tests := []struct {
+		name   string
+		url    string
+		params model.UTMParams
+		want   string
+	}{
+		{
+			name:   "no query",
+			url:    "https://example.com/landing",
+			params: model.UTMParams{Source: "newsletter", Medium: "email", Campaign: "spring sale"},
+			want:   "https://example.com/landing?utm_source=newsletter&utm_medium=email&utm_campaign=spring+sale",
+		},
+		{
+			name:   "existing query kept as is",
+			url:    "https://example.com/p?z=1&a=%7Bb%7D&sig=a%2Fb&flag",
+			params: model.UTMParams{Source: "ads"},
+			want:   "https://example.com/p?z=1&a=%7Bb%7D&sig=a%2Fb&flag&utm_source=ads",
+		},
+		{
+			name:   "repeated parameters kept",
+			url:    "https://example.com/?id=1&id=2",
+			params: model.UTMParams{Medium: "social"},
+			want:   "https://example.com/?id=1&id=2&utm_medium=social",
+		},
+		{
+			name:   "existing utm parameter replaced",
+			url:    "https://example.com/?utm_source=old&x=1&utm%5Fsource=older&utm_medium=keep",
+			params: model.UTMParams{Source: "new"},
+			want:   "https://example.com/?x=1&utm_medium=keep&utm_source=new",
+		},
+		{
+			name:   "fragment preserved",
+			url:    "https://example.com/app?tab=1#/route?x=1",
+			params: model.UTMParams{Term: "shoes", Content: "a&b"},
+			want:   "https://example.com/app?tab=1&utm_term=shoes&utm_content=a%26b#/route?x=1",
+		},
+		{
+			name:   "empty query marker",
+			url:    "https://example.com/?",
+			params: model.UTMParams{Source: "qr"},
+			want:   "https://example.com/?utm_source=qr",
+		},
+		{
+			name: "no parameters",
+			url:  "https://example.com/?b=2&a=1",
+			want: "https://example.com/?b=2&a=1",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := AppendUTMParams(tt.url, tt.params)
+			if err != nil {
+				t.Fatalf("AppendUTMParams: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("AppendUTMParams(%q) = %q, want %q", tt.url, got, tt.want)
+			}
+		})
+	}
+
+	if _, err := AppendUTMParams("http://[::1", model.UTMParams{Source: "x"}); err == nil {
+		t.Error("AppendUTMParams accepted an invalid URL")
+	}
+}
@@ -78,11 +78,23 @@ func IsValidURL(rawURL string) bool {
 	return parsed.Scheme != "" && parsed.Host != ""
 }
 
+// reservedShortCodes 与 /api/analytics/live、/api/visits/export 等静态路由同名的短码，
+// 使用这些短码的链接无法通过 /api/analytics/:code 等路由访问
+var reservedShortCodes = map[string]bool{
+	"live":   true,
+	"export": true,
+}
+
+// IsReservedShortCode 检查短码是否为保留字
+func IsReservedShortCode(code string) bool {
+	return reservedShortCodes[code]
+}
+
 // IsValidCustomCode 检查自定义短码格式
 func IsValidCustomCode(code string) bool {
-	// 自定义短码只能包含字母、数字、下划线和连字符，长度3-32
+	// 自定义短码只能包含字母、数字、下划线和连字符，长度3-32，且不能是保留字
 	matched, err := regexp.MatchString(`^[a-zA-Z0-9_-]{3,32}$`, code)
-	return err == nil && matched
+	return err == nil && matched && !IsReservedShortCode(code)
 }
 
 // SanitizeCustomCode 清理自定义短码
@@ -140,7 +152,7 @@ func ValidateURLShortenRequest(longURL, customCode string, expireInHours int) *V
 	
 	// 验证自定义短码
 	if customCode != "" {
-		v.Check(IsValidCustomCode(customCode), "custom_code", "invalid custom code format. Must contain only letters, numbers, underscores, and hyphens, 3-32 characters")
+		v.Check(IsValidCustomCode(customCode), "custom_code", "invalid custom code format. Must contain only letters, numbers, underscores, and hyphens, 3-32 characters, and must not be live or export")
 	}
 	
 	// 验证过期时间
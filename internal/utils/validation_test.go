@@ -0,0 +1,26 @@
+package utils
+
+import "testing"
+
+func TestIsValidCustomCode(t *testing.T) {
+	tests := []struct {
+		code string
+		want bool
+	}{
+		{"mycode", true},
+		{"my-code_2", true},
+		{"ab", false},
+		{"has space", false},
+		{"abcdefghijklmnopqrstuvwxyz0123456", false},
+		// 与静态路由同名的保留字
+		{"live", false},
+		{"export", false},
+		{"Live", true},
+		{"exports", true},
+	}
+	for _, tt := range tests {
+		if got := IsValidCustomCode(tt.code); got != tt.want {
+			t.Errorf("IsValidCustomCode(%q) = %v, want %v", tt.code, got, tt.want)
+		}
+	}
+}